@@ -0,0 +1,108 @@
+package main
+
+import (
+	"basic-go-redis/internal/server"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, 1 * time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(latencies, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+
+	s := summarize(benchResult{elapsed: time.Second, latencies: latencies})
+	if s.rps != 100 || s.avg != 50.5 || s.min != 1 || s.maxLat != 100 {
+		t.Errorf("summarize() = %+v", s)
+	}
+}
+
+func TestSelected(t *testing.T) {
+	tests := standardTests("xxx")
+	var names []string
+	for _, test := range tests {
+		if selected(test, []string{"ping", "lrange", "set"}) {
+			names = append(names, strings.Fields(test.name)[0])
+		}
+	}
+	if got := strings.Join(names, ","); got != "PING_MBULK,SET,LRANGE_100,LRANGE_300,LRANGE_500,LRANGE_600" {
+		t.Errorf("selected tests = %s", got)
+	}
+}
+
+func TestRandomize(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	args := []string{"MSET", "key:" + randPlaceholder, "v", "key:" + randPlaceholder, "v"}
+	if got := randomize(args, 0, rng); got[1] != "key:"+randPlaceholder {
+		t.Errorf("randomize() without a key space = %q", got)
+	}
+	got := randomize(args, 1000, rng)
+	for _, key := range []string{got[1], got[3]} {
+		if len(key) != len("key:")+12 || !strings.HasPrefix(key, "key:000000000") {
+			t.Errorf("randomize() key = %q, want key: and 12 digits below 1000", key)
+		}
+	}
+	if args[1] != "key:"+randPlaceholder {
+		t.Errorf("randomize() modified its input")
+	}
+}
+
+func TestRunAgainstServer(t *testing.T) {
+	s := server.NewServer("12427")
+	go func() {
+		if err := s.Start(); err != nil {
+			panic(fmt.Sprintf("Failed to start server: %v", err))
+		}
+	}()
+	defer s.Close()
+	time.Sleep(time.Second) // Give the server time to start
+
+	cfg := &benchConfig{addr: "127.0.0.1:12427", clients: 3, requests: 100, pipeline: 4, keySpace: 50, dataSize: 3}
+	tests := []benchTest{
+		{name: "SET", args: []string{"SET", "key:" + randPlaceholder, "xxx"}},
+		{name: "NOSUCH", args: []string{"NOSUCHCMD"}},
+	}
+	if missing := unsupported(cfg, tests); !missing["NOSUCHCMD"] || missing["SET"] {
+		t.Errorf("unsupported() = %v", missing)
+	}
+
+	r, err := runTest(cfg, tests[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.latencies) != cfg.requests || r.errors != 0 || r.elapsed <= 0 {
+		t.Errorf("SET: %d replies, %d errors in %v", len(r.latencies), r.errors, r.elapsed)
+	}
+	conn, reader, err := dialBench(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if reply, err := call(conn, reader, []string{"DBSIZE"}); err != nil || reply.Int == 0 || reply.Int > 50 {
+		t.Errorf("DBSIZE after SET = %+v, %v, want keys from the key space", reply, err)
+	}
+
+	// Error replies are counted, not fatal
+	r, err = runTest(cfg, tests[1])
+	if err != nil || r.errors != cfg.requests || !strings.HasPrefix(r.lastError, "ERR unknown command") {
+		t.Errorf("NOSUCHCMD: %d errors, last %q, %v", r.errors, r.lastError, err)
+	}
+}
@@ -0,0 +1,217 @@
+// File: cmd/benchmark/main.go
+
+// Command benchmark measures the throughput and latency of a Go-Redis (or
+// Redis) server in the manner of redis-benchmark.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: benchmark [OPTIONS] [command [arg ...]]
+
+Runs the standard tests, or those picked with -t, or the command given
+after the options.
+
+Options:
+`)
+	flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, `
+Examples:
+  benchmark -q
+  benchmark -t set,get -n 1000000 -P 16 -r 100000 -d 100
+  benchmark --csv -t lpush,lrange > results.csv
+  benchmark -r 10000 -n 100000 SET key:__rand_int__ value
+`)
+}
+
+// standardTests are the workloads run by default, named as redis-benchmark
+// names them.
+func standardTests(value string) []benchTest {
+	lrange := func(n int) benchTest {
+		// The list must hold enough elements for the range to be full
+		setup := [][]string{{"DEL", "mylist"}}
+		for i := 0; i < 600; i += 100 {
+			push := []string{"LPUSH", "mylist"}
+			for j := 0; j < 100; j++ {
+				push = append(push, value)
+			}
+			setup = append(setup, push)
+		}
+		return benchTest{
+			name:  "LRANGE_" + strconv.Itoa(n) + " (first " + strconv.Itoa(n) + " elements)",
+			args:  []string{"LRANGE", "mylist", "0", strconv.Itoa(n - 1)},
+			setup: setup,
+		}
+	}
+	mset := []string{"MSET"}
+	for i := 0; i < 10; i++ {
+		mset = append(mset, "key:"+randPlaceholder, value)
+	}
+
+	return []benchTest{
+		{name: "PING_MBULK", args: []string{"PING"}},
+		{name: "SET", args: []string{"SET", "key:" + randPlaceholder, value}},
+		{name: "GET", args: []string{"GET", "key:" + randPlaceholder}},
+		{name: "INCR", args: []string{"INCR", "counter:" + randPlaceholder}},
+		{name: "LPUSH", args: []string{"LPUSH", "mylist", value}},
+		{name: "RPUSH", args: []string{"RPUSH", "mylist", value}},
+		{name: "LPOP", args: []string{"LPOP", "mylist"}},
+		{name: "RPOP", args: []string{"RPOP", "mylist"}},
+		{name: "SADD", args: []string{"SADD", "myset", "element:" + randPlaceholder}},
+		{name: "HSET", args: []string{"HSET", "myhash", "element:" + randPlaceholder, value}},
+		{name: "SPOP", args: []string{"SPOP", "myset"}},
+		{name: "ZADD", args: []string{"ZADD", "myzset", "0", "element:" + randPlaceholder}},
+		{name: "ZPOPMIN", args: []string{"ZPOPMIN", "myzset"}},
+		lrange(100),
+		lrange(300),
+		lrange(500),
+		lrange(600),
+		{name: "MSET (10 keys)", args: mset},
+	}
+}
+
+// selected reports whether -t picks the test. A name picks the test of
+// that name, and also its variants: "lrange" picks LRANGE_100 and the
+// others, "ping" picks PING_MBULK.
+func selected(test benchTest, picks []string) bool {
+	if len(picks) == 0 {
+		return true
+	}
+	name := strings.ToLower(strings.Fields(test.name)[0])
+	for _, pick := range picks {
+		if name == pick || strings.HasPrefix(name, pick+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// unsupported returns the commands among tests that the server doesn't
+// know, as COMMAND INFO reports them. A server without COMMAND INFO is
+// assumed to support everything.
+func unsupported(cfg *benchConfig, tests []benchTest) map[string]bool {
+	conn, reader, err := dialBench(cfg)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	args := []string{"COMMAND", "INFO"}
+	for _, test := range tests {
+		args = append(args, test.args[0])
+		for _, setup := range test.setup {
+			args = append(args, setup[0])
+		}
+	}
+	reply, err := call(conn, reader, args)
+	if err != nil || reply.IsError() || len(reply.Elems) != len(args)-2 {
+		return nil
+	}
+	missing := make(map[string]bool)
+	for i, info := range reply.Elems {
+		if info.Null {
+			missing[strings.ToUpper(args[i+2])] = true
+		}
+	}
+	return missing
+}
+
+// missingCommand returns the first command test needs that is missing, or "".
+func missingCommand(test benchTest, missing map[string]bool) string {
+	commands := []string{test.args[0]}
+	for _, setup := range test.setup {
+		commands = append(commands, setup[0])
+	}
+	for _, cmd := range commands {
+		if cmd = strings.ToUpper(cmd); missing[cmd] {
+			return cmd
+		}
+	}
+	return ""
+}
+
+func main() {
+	host := flag.String("h", "127.0.0.1", "server `hostname`")
+	port := flag.Int("p", 6379, "server `port`")
+	password := flag.String("a", "", "`password` to log in with")
+	user := flag.String("user", "", "`username` to log in with, along with -a")
+	db := flag.Int("dbnum", 0, "database `number` to select")
+	clients := flag.Int("c", 50, "number of parallel `clients`")
+	requests := flag.Int("n", 100000, "total number of `requests` per test")
+	dataSize := flag.Int("d", 3, "`size` in bytes of SET and list values")
+	pipeline := flag.Int("P", 1, "pipeline `depth`: requests each client sends before reading replies")
+	keySpace := flag.Int("r", 0, "replace __rand_int__ in keys with random numbers below `keyspacelen`, so requests spread over that many keys")
+	tests := flag.String("t", "", "comma separated `tests` to run, such as set,get,lpush")
+	quiet := flag.Bool("q", false, "quiet: print only requests per second and p50 latency")
+	csvOutput := flag.Bool("csv", false, "print results as CSV")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *clients < 1 || *requests < 1 || *pipeline < 1 || *dataSize < 0 {
+		fmt.Fprintln(os.Stderr, "Invalid options: -c, -n and -P must be positive and -d can't be negative")
+		os.Exit(1)
+	}
+	cfg := &benchConfig{
+		addr:     net.JoinHostPort(*host, strconv.Itoa(*port)),
+		user:     *user,
+		password: *password,
+		db:       *db,
+		clients:  *clients,
+		requests: *requests,
+		pipeline: *pipeline,
+		keySpace: *keySpace,
+		dataSize: *dataSize,
+	}
+
+	var suite []benchTest
+	if flag.NArg() > 0 {
+		suite = []benchTest{{name: strings.Join(flag.Args(), " "), args: flag.Args()}}
+	} else {
+		var picks []string
+		for _, pick := range strings.Split(*tests, ",") {
+			if pick = strings.ToLower(strings.TrimSpace(pick)); pick != "" {
+				picks = append(picks, pick)
+			}
+		}
+		for _, test := range standardTests(strings.Repeat("x", *dataSize)) {
+			if selected(test, picks) {
+				suite = append(suite, test)
+			}
+		}
+		if len(suite) == 0 {
+			fmt.Fprintf(os.Stderr, "No tests match %q\n", *tests)
+			os.Exit(1)
+		}
+	}
+
+	missing := unsupported(cfg, suite)
+	if *csvOutput {
+		fmt.Println(csvHeader)
+	}
+	for _, test := range suite {
+		if cmd := missingCommand(test, missing); cmd != "" {
+			fmt.Fprintf(os.Stderr, "%s: skipped, the server doesn't support %s\n", test.name, cmd)
+			continue
+		}
+		result, err := runTest(cfg, test)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", test.name, err)
+			os.Exit(1)
+		}
+		switch {
+		case *csvOutput:
+			writeCSV(os.Stdout, test, result)
+		case *quiet:
+			writeQuiet(os.Stdout, test, result)
+		default:
+			writeReport(os.Stdout, cfg, test, result)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// File: cmd/benchmark/report.go
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+func sortDurations(d []time.Duration) {
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+}
+
+// percentile returns the latency at or below which p percent of the
+// sorted latencies fall.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p/100*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+// summary is the throughput and latency figures of a result, in requests
+// per second and milliseconds.
+type summary struct {
+	rps                             float64
+	avg, min, p50, p95, p99, maxLat float64
+}
+
+func summarize(r benchResult) summary {
+	var s summary
+	n := len(r.latencies)
+	if n == 0 {
+		return s
+	}
+	if r.elapsed > 0 {
+		s.rps = float64(n) / r.elapsed.Seconds()
+	}
+	var total time.Duration
+	for _, d := range r.latencies {
+		total += d
+	}
+	s.avg = msec(total / time.Duration(n))
+	s.min = msec(r.latencies[0])
+	s.p50 = msec(percentile(r.latencies, 50))
+	s.p95 = msec(percentile(r.latencies, 95))
+	s.p99 = msec(percentile(r.latencies, 99))
+	s.maxLat = msec(r.latencies[n-1])
+	return s
+}
+
+func msec(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// writeReport prints a result in full, as redis-benchmark does: the run's
+// parameters, the latency distribution by percentile, halving the distance
+// to 100% at each step, and a summary.
+func writeReport(w io.Writer, cfg *benchConfig, test benchTest, r benchResult) {
+	fmt.Fprintf(w, "====== %s ======\n", test.name)
+	fmt.Fprintf(w, "  %d requests completed in %.2f seconds\n", len(r.latencies), r.elapsed.Seconds())
+	fmt.Fprintf(w, "  %d parallel clients\n", cfg.clients)
+	fmt.Fprintf(w, "  %d bytes payload\n", cfg.dataSize)
+	fmt.Fprintf(w, "  pipeline %d\n", cfg.pipeline)
+	if r.errors > 0 {
+		fmt.Fprintf(w, "  %d errors, the last: %s\n", r.errors, r.lastError)
+	}
+
+	fmt.Fprintf(w, "\nLatency by percentile distribution:\n")
+	n := len(r.latencies)
+	for _, p := range distributionPercentiles(n) {
+		count := int(p/100*float64(n) + 0.5)
+		fmt.Fprintf(w, "%.3f%% <= %.3f milliseconds (cumulative count %d)\n", p, msec(percentile(r.latencies, p)), max(count, 1))
+	}
+
+	s := summarize(r)
+	fmt.Fprintf(w, "\nSummary:\n")
+	fmt.Fprintf(w, "  throughput summary: %.2f requests per second\n", s.rps)
+	fmt.Fprintf(w, "  latency summary (msec):\n")
+	fmt.Fprintf(w, "%13s %9s %9s %9s %9s %9s\n", "avg", "min", "p50", "p95", "p99", "max")
+	fmt.Fprintf(w, "%13.3f %9.3f %9.3f %9.3f %9.3f %9.3f\n\n", s.avg, s.min, s.p50, s.p95, s.p99, s.maxLat)
+}
+
+// distributionPercentiles lists 0, 50, 75, 87.5 and so on, stopping once
+// a step would distinguish less than one request, and then 100.
+func distributionPercentiles(n int) []float64 {
+	percentiles := []float64{0}
+	for gap := 50.0; gap/100*float64(n) >= 1; gap /= 2 {
+		percentiles = append(percentiles, 100-gap)
+	}
+	return append(percentiles, 100)
+}
+
+// writeQuiet prints a result on one line, as redis-benchmark -q does.
+func writeQuiet(w io.Writer, test benchTest, r benchResult) {
+	s := summarize(r)
+	fmt.Fprintf(w, "%s: %.2f requests per second, p50=%.3f msec", test.name, s.rps, s.p50)
+	if r.errors > 0 {
+		fmt.Fprintf(w, " (%d errors: %s)", r.errors, r.lastError)
+	}
+	fmt.Fprintln(w)
+}
+
+// csvHeader is the header line of --csv output, matching redis-benchmark's.
+const csvHeader = `"test","rps","avg_latency_ms","min_latency_ms","p50_latency_ms","p95_latency_ms","p99_latency_ms","max_latency_ms"`
+
+func writeCSV(w io.Writer, test benchTest, r benchResult) {
+	s := summarize(r)
+	fmt.Fprintf(w, "%q,\"%.2f\",\"%.3f\",\"%.3f\",\"%.3f\",\"%.3f\",\"%.3f\",\"%.3f\"\n",
+		test.name, s.rps, s.avg, s.min, s.p50, s.p95, s.p99, s.maxLat)
+}
@@ -0,0 +1,215 @@
+// File: cmd/benchmark/runner.go
+
+package main
+
+import (
+	"basic-go-redis/internal/protocol"
+	"bufio"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// randPlaceholder is replaced in command arguments by a random number
+// below the -r key space, so requests touch different keys.
+const randPlaceholder = "__rand_int__"
+
+// benchConfig holds the options shared by every test.
+type benchConfig struct {
+	addr     string
+	user     string
+	password string
+	db       int
+	clients  int
+	requests int
+	pipeline int
+	keySpace int // 0 leaves the placeholder in keys as it is
+	dataSize int
+}
+
+// benchTest is one named workload: a command sent over and over, after
+// optional setup commands sent once.
+type benchTest struct {
+	name  string
+	args  []string
+	setup [][]string
+}
+
+// benchResult is what running a test measured.
+type benchResult struct {
+	elapsed   time.Duration
+	latencies []time.Duration // one per request, sorted
+	errors    int
+	lastError string
+}
+
+// dialBench connects one benchmark client and runs AUTH and SELECT.
+func dialBench(cfg *benchConfig) (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", cfg.addr, 5*time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := bufio.NewReaderSize(conn, 64*1024)
+	var handshake [][]string
+	if cfg.password != "" {
+		if cfg.user != "" {
+			handshake = append(handshake, []string{"AUTH", cfg.user, cfg.password})
+		} else {
+			handshake = append(handshake, []string{"AUTH", cfg.password})
+		}
+	}
+	if cfg.db != 0 {
+		handshake = append(handshake, []string{"SELECT", strconv.Itoa(cfg.db)})
+	}
+	for _, args := range handshake {
+		reply, err := call(conn, reader, args)
+		if err == nil && reply.IsError() {
+			err = fmt.Errorf("%s failed: %s", args[0], reply.Str)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	return conn, reader, nil
+}
+
+// call sends one command and reads its reply.
+func call(conn net.Conn, reader *bufio.Reader, args []string) (protocol.Value, error) {
+	if _, err := conn.Write([]byte(protocol.Serialize(args[0], args[1:]))); err != nil {
+		return protocol.Value{}, err
+	}
+	return protocol.ReadValue(reader)
+}
+
+// runTest runs test with cfg.clients connections in parallel until
+// cfg.requests replies have been read. Each client sends cfg.pipeline
+// requests at a time, and each request's latency runs from the write of
+// its batch to the arrival of its reply.
+func runTest(cfg *benchConfig, test benchTest) (benchResult, error) {
+	type client struct {
+		conn   net.Conn
+		reader *bufio.Reader
+	}
+	clients := make([]client, cfg.clients)
+	for i := range clients {
+		conn, reader, err := dialBench(cfg)
+		if err != nil {
+			for _, c := range clients[:i] {
+				c.conn.Close()
+			}
+			return benchResult{}, err
+		}
+		clients[i] = client{conn, reader}
+	}
+	defer func() {
+		for _, c := range clients {
+			c.conn.Close()
+		}
+	}()
+
+	if len(test.setup) > 0 {
+		for _, args := range test.setup {
+			if _, err := call(clients[0].conn, clients[0].reader, args); err != nil {
+				return benchResult{}, err
+			}
+		}
+	}
+
+	var (
+		remaining atomic.Int64
+		mu        sync.Mutex
+		result    benchResult
+		firstErr  error
+		wg        sync.WaitGroup
+	)
+	remaining.Store(int64(cfg.requests))
+	result.latencies = make([]time.Duration, 0, cfg.requests)
+
+	start := time.Now()
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c client) {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+			w := bufio.NewWriterSize(c.conn, 64*1024)
+			latencies := make([]time.Duration, 0, cfg.requests/cfg.clients+cfg.pipeline)
+			errors, lastError := 0, ""
+
+			for {
+				// Claim a batch of requests from what is left
+				n := int64(cfg.pipeline)
+				left := remaining.Add(-n)
+				if left+n <= 0 {
+					break
+				}
+				if left < 0 {
+					n += left
+				}
+
+				for i := int64(0); i < n; i++ {
+					args := randomize(test.args, cfg.keySpace, rng)
+					w.WriteString(protocol.Serialize(args[0], args[1:]))
+				}
+				sent := time.Now()
+				err := w.Flush()
+				for i := int64(0); err == nil && i < n; i++ {
+					var reply protocol.Value
+					if reply, err = protocol.ReadValue(c.reader); err == nil {
+						latencies = append(latencies, time.Since(sent))
+						if reply.IsError() {
+							errors++
+							lastError = reply.Str
+						}
+					}
+				}
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					remaining.Store(0) // Stop the other clients too
+					break
+				}
+			}
+
+			mu.Lock()
+			result.latencies = append(result.latencies, latencies...)
+			result.errors += errors
+			if lastError != "" {
+				result.lastError = lastError
+			}
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+	result.elapsed = time.Since(start)
+	if firstErr != nil {
+		return benchResult{}, firstErr
+	}
+	sortDurations(result.latencies)
+	return result, nil
+}
+
+// randomize returns args with every placeholder replaced by a random
+// number below keySpace, zero-padded to twelve digits as redis-benchmark
+// does. Without a key space args are returned unchanged.
+func randomize(args []string, keySpace int, rng *rand.Rand) []string {
+	if keySpace <= 0 {
+		return args
+	}
+	out := make([]string, len(args))
+	for i, arg := range args {
+		for strings.Contains(arg, randPlaceholder) {
+			arg = strings.Replace(arg, randPlaceholder, fmt.Sprintf("%012d", rng.IntN(keySpace)), 1)
+		}
+		out[i] = arg
+	}
+	return out
+}
@@ -0,0 +1,118 @@
+// File: cmd/client/args.go
+
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+var errUnbalancedQuotes = errors.New("Invalid argument(s)")
+
+// splitArgs splits a command line into arguments the way redis-cli does.
+// Arguments are separated by whitespace. Double quotes allow the escapes
+// \n, \r, \t, \b, \a, \\, \" and \xHH; single quotes only allow \'. A
+// closing quote must be followed by whitespace or the end of the line.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+
+		var current strings.Builder
+		inDouble, inSingle, done := false, false, false
+		for !done {
+			if i == len(line) {
+				if inDouble || inSingle {
+					return nil, errUnbalancedQuotes
+				}
+				break
+			}
+			c := line[i]
+			switch {
+			case inDouble:
+				switch {
+				case c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]):
+					current.WriteByte(hexValue(line[i+2])<<4 | hexValue(line[i+3]))
+					i += 3
+				case c == '\\' && i+1 < len(line):
+					i++
+					switch line[i] {
+					case 'n':
+						current.WriteByte('\n')
+					case 'r':
+						current.WriteByte('\r')
+					case 't':
+						current.WriteByte('\t')
+					case 'b':
+						current.WriteByte('\b')
+					case 'a':
+						current.WriteByte('\a')
+					default:
+						current.WriteByte(line[i])
+					}
+				case c == '"':
+					// The closing quote must end the argument
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				default:
+					current.WriteByte(c)
+				}
+			case inSingle:
+				switch {
+				case c == '\\' && i+1 < len(line) && line[i+1] == '\'':
+					i++
+					current.WriteByte('\'')
+				case c == '\'':
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				default:
+					current.WriteByte(c)
+				}
+			default:
+				switch {
+				case isSpace(c):
+					done = true
+				case c == '"':
+					inDouble = true
+				case c == '\'':
+					inSingle = true
+				default:
+					current.WriteByte(c)
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+		args = append(args, current.String())
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{`SET greeting "hello world"`, []string{"SET", "greeting", "hello world"}},
+		{`  GET   key  `, []string{"GET", "key"}},
+		{`SET k "a\tb\n\x41\"q\\"`, []string{"SET", "k", "a\tb\nA\"q\\"}},
+		{`SET k 'it\'s "raw" \n'`, []string{"SET", "k", `it's "raw" \n`}},
+		{`SET k ""`, []string{"SET", "k", ""}},
+		{`SET k foo"bar"`, []string{"SET", "k", "foobar"}},
+		{``, nil},
+	}
+	for _, tt := range tests {
+		got, err := splitArgs(tt.line)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, %v, want %q", tt.line, got, err, tt.want)
+		}
+	}
+
+	for _, line := range []string{`SET k "unterminated`, `SET k 'open`, `SET k "a"b`} {
+		if got, err := splitArgs(line); err == nil {
+			t.Errorf("splitArgs(%q) = %q, want an error", line, got)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+// File: cmd/client/diagnostics.go
+
+package main
+
+import (
+	"basic-go-redis/internal/protocol"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// latencySampleRate is how often --latency sends a PING.
+const latencySampleRate = 10 * time.Millisecond
+
+// latencyStats accumulates PING round trips.
+type latencyStats struct {
+	min, max, total time.Duration
+	samples         int
+}
+
+func (l *latencyStats) add(d time.Duration) {
+	if l.samples == 0 || d < l.min {
+		l.min = d
+	}
+	l.max = max(l.max, d)
+	l.total += d
+	l.samples++
+}
+
+func (l *latencyStats) String() string {
+	var avg time.Duration
+	if l.samples > 0 {
+		avg = l.total / time.Duration(l.samples)
+	}
+	return fmt.Sprintf("min: %.2f, max: %.2f, avg: %.2f (%d samples)", msec(l.min), msec(l.max), msec(avg), l.samples)
+}
+
+func msec(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// runLatency pings the server continuously and shows the minimum, maximum
+// and average round trip in milliseconds until interrupted. On a terminal
+// the line is redrawn after every sample, elsewhere printed every second.
+// With history, the figures are printed and reset every interval instead.
+func runLatency(sess *session, out io.Writer, history bool, interval time.Duration, redraw bool) error {
+	var stats latencyStats
+	start, lastPrint := time.Now(), time.Now()
+	for {
+		sent := time.Now()
+		reply, err := sess.do([]string{"PING"})
+		if err != nil {
+			return err
+		}
+		if reply.IsError() {
+			return errors.New(reply.Str)
+		}
+		stats.add(time.Since(sent))
+
+		// Redrawing returns to the start of the line and clears it first
+		clear := ""
+		if redraw {
+			clear = "\r\x1b[2K"
+		}
+		switch {
+		case history && time.Since(start) >= interval:
+			fmt.Fprintf(out, "%s%s -- %.2f seconds range\n", clear, &stats, time.Since(start).Seconds())
+			stats, start = latencyStats{}, time.Now()
+		case redraw:
+			fmt.Fprintf(out, "%s%s", clear, &stats)
+		case !history && time.Since(lastPrint) >= time.Second:
+			fmt.Fprintln(out, &stats)
+			lastPrint = time.Now()
+		}
+		time.Sleep(latencySampleRate)
+	}
+}
+
+// parseInfo splits an INFO reply into its fields, skipping section headers.
+func parseInfo(info string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			fields[name] = value
+		}
+	}
+	return fields
+}
+
+// keyspaceKeys sums the keys of every database in the keyspace fields,
+// which look like db0:keys=1,expires=0,avg_ttl=0.
+func keyspaceKeys(fields map[string]string) int64 {
+	var total int64
+	for name, value := range fields {
+		if !strings.HasPrefix(name, "db") {
+			continue
+		}
+		for _, part := range strings.Split(value, ",") {
+			if n, ok := strings.CutPrefix(part, "keys="); ok {
+				keys, _ := strconv.ParseInt(n, 10, 64)
+				total += keys
+			}
+		}
+	}
+	return total
+}
+
+// bytesToHuman formats a byte count as redis-cli does: 512B, 1.50K, 3.20M.
+func bytesToHuman(n float64) string {
+	for _, unit := range []string{"B", "K", "M", "G", "T"} {
+		if n < 1024 || unit == "T" {
+			if unit == "B" {
+				return strconv.FormatFloat(n, 'f', 0, 64) + unit
+			}
+			return strconv.FormatFloat(n, 'f', 2, 64) + unit
+		}
+		n /= 1024
+	}
+	return ""
+}
+
+// runStat prints a line of server statistics from INFO every interval,
+// with a header every 20 lines, until interrupted.
+func runStat(sess *session, out io.Writer, interval time.Duration) error {
+	var lastRequests int64 = -1
+	for line := 0; ; line++ {
+		reply, err := sess.do([]string{"INFO"})
+		if err != nil {
+			return err
+		}
+		if reply.IsError() {
+			return fmt.Errorf("INFO failed: %s", reply.Str)
+		}
+		fields := parseInfo(reply.Str)
+
+		if line%20 == 0 {
+			fmt.Fprintln(out, "------- data ------ --------------------- load --------------------")
+			fmt.Fprintln(out, "keys       mem      clients blocked requests            connections")
+		}
+		usedMemory, _ := strconv.ParseFloat(fields["used_memory"], 64)
+		requests, _ := strconv.ParseInt(fields["total_commands_processed"], 10, 64)
+		delta := int64(0)
+		if lastRequests >= 0 {
+			delta = requests - lastRequests
+		}
+		lastRequests = requests
+
+		fmt.Fprintf(out, "%-11d%-9s%-8s%-8s%-20s%-12s\n",
+			keyspaceKeys(fields),
+			bytesToHuman(usedMemory),
+			fields["connected_clients"],
+			fields["blocked_clients"],
+			fmt.Sprintf("%d (+%d)", requests, delta),
+			fields["total_connections_received"])
+		time.Sleep(interval)
+	}
+}
+
+// scanKeys walks the keyspace with SCAN and hands each step's keys to fn.
+// Every hundred SCAN calls it sleeps for pause, to go easy on a busy server.
+func scanKeys(sess *session, pattern string, count int, pause time.Duration, fn func(keys []string) error) error {
+	cursor := "0"
+	for calls := 1; ; calls++ {
+		args := []string{"SCAN", cursor, "COUNT", strconv.Itoa(count)}
+		if pattern != "" {
+			args = append(args, "MATCH", pattern)
+		}
+		reply, err := sess.do(args)
+		if err != nil {
+			return err
+		}
+		if reply.IsError() {
+			return fmt.Errorf("SCAN failed: %s", reply.Str)
+		}
+		if len(reply.Elems) != 2 {
+			return errors.New("SCAN returned an unexpected reply")
+		}
+		keys := make([]string, len(reply.Elems[1].Elems))
+		for i, key := range reply.Elems[1].Elems {
+			keys[i] = key.Str
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if cursor = reply.Elems[0].Str; cursor == "0" {
+			return nil
+		}
+		if pause > 0 && calls%100 == 0 {
+			time.Sleep(pause)
+		}
+	}
+}
+
+// runScan prints the keys matching pattern, one per line.
+func runScan(sess *session, out io.Writer, pattern string, count int, mode outputMode) error {
+	return scanKeys(sess, pattern, count, 0, func(keys []string) error {
+		for _, key := range keys {
+			if mode == outputReadable {
+				key = protocol.Quote(key)
+			}
+			fmt.Fprintln(out, key)
+		}
+		return nil
+	})
+}
+
+// keyType describes how --bigkeys measures the keys of one type.
+type keyType struct {
+	name       string
+	sizeCmd    string
+	unit       string
+	plural     string
+	keys       int
+	totalSize  int64
+	biggest    string
+	biggestLen int64
+}
+
+func newKeyTypes() map[string]*keyType {
+	return map[string]*keyType{
+		"string": {name: "string", sizeCmd: "STRLEN", unit: "bytes", plural: "strings"},
+		"list":   {name: "list", sizeCmd: "LLEN", unit: "items", plural: "lists"},
+		"set":    {name: "set", sizeCmd: "SCARD", unit: "members", plural: "sets"},
+		"hash":   {name: "hash", sizeCmd: "HLEN", unit: "fields", plural: "hashs"},
+		"zset":   {name: "zset", sizeCmd: "ZCARD", unit: "members", plural: "zsets"},
+		"stream": {name: "stream", sizeCmd: "XLEN", unit: "entries", plural: "streams"},
+	}
+}
+
+// keyTypeOrder is the order types are summarized in.
+var keyTypeOrder = []string{"string", "list", "set", "hash", "zset", "stream"}
+
+// runBigKeys walks the keyspace and reports the biggest key of each type
+// and how many keys of each type there are, as redis-cli --bigkeys does.
+// With memkeys, sizes are the MEMORY USAGE of the keys in bytes instead of
+// their lengths.
+func runBigKeys(sess *session, out io.Writer, memkeys bool, samples, count int, pause time.Duration) error {
+	dbsize := int64(0)
+	if reply, err := sess.do([]string{"DBSIZE"}); err != nil {
+		return err
+	} else if reply.Kind == protocol.KindInteger {
+		dbsize = reply.Int
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "# Scanning the entire keyspace to find biggest keys as well as")
+	fmt.Fprintln(out, "# average sizes per key type.  You can use -i 0.1 to sleep 0.1 sec")
+	fmt.Fprintln(out, "# per 100 SCAN commands (not usually needed).")
+	fmt.Fprintln(out)
+
+	types := newKeyTypes()
+	var sampled, totalKeyLen int64
+	err := scanKeys(sess, "", count, pause, func(keys []string) error {
+		typeCmds := make([][]string, len(keys))
+		for i, key := range keys {
+			typeCmds[i] = []string{"TYPE", key}
+		}
+		typeReplies, err := sess.pipeline(typeCmds)
+		if err != nil {
+			return err
+		}
+
+		var sizeCmds [][]string
+		var sizeKeys []string
+		var sizeTypes []*keyType
+		for i, reply := range typeReplies {
+			t, ok := types[reply.Str]
+			if !ok {
+				continue // Deleted meanwhile, or a type we don't know how to measure
+			}
+			if memkeys {
+				sizeCmds = append(sizeCmds, []string{"MEMORY", "USAGE", keys[i], "SAMPLES", strconv.Itoa(samples)})
+			} else {
+				sizeCmds = append(sizeCmds, []string{t.sizeCmd, keys[i]})
+			}
+			sizeKeys = append(sizeKeys, keys[i])
+			sizeTypes = append(sizeTypes, t)
+		}
+		if len(sizeCmds) == 0 {
+			return nil
+		}
+		sizeReplies, err := sess.pipeline(sizeCmds)
+		if err != nil {
+			return err
+		}
+
+		for i, reply := range sizeReplies {
+			if reply.IsError() || reply.Kind != protocol.KindInteger {
+				continue
+			}
+			key, t, size := sizeKeys[i], sizeTypes[i], reply.Int
+			sampled++
+			totalKeyLen += int64(len(key))
+			t.keys++
+			t.totalSize += size
+			if t.biggest == "" || size > t.biggestLen {
+				t.biggest, t.biggestLen = key, size
+				progress := 0.0
+				if dbsize > 0 {
+					progress = 100 * float64(sampled) / float64(dbsize)
+				}
+				fmt.Fprintf(out, "[%05.2f%%] Biggest %-6s found so far %s with %d %s\n",
+					min(progress, 100), t.name, protocol.Quote(key), size, sizeUnit(t, memkeys))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "-------- summary -------")
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Sampled %d keys in the keyspace!\n", sampled)
+	avgKeyLen := 0.0
+	if sampled > 0 {
+		avgKeyLen = float64(totalKeyLen) / float64(sampled)
+	}
+	fmt.Fprintf(out, "Total key length in bytes is %d (avg len %.2f)\n", totalKeyLen, avgKeyLen)
+	fmt.Fprintln(out)
+
+	ordered := make([]*keyType, 0, len(keyTypeOrder))
+	for _, name := range keyTypeOrder {
+		ordered = append(ordered, types[name])
+	}
+	for _, t := range ordered {
+		if t.biggest != "" {
+			fmt.Fprintf(out, "Biggest %6s found %s has %d %s\n", t.name, protocol.Quote(t.biggest), t.biggestLen, sizeUnit(t, memkeys))
+		}
+	}
+	fmt.Fprintln(out)
+	for _, t := range ordered {
+		share, avg := 0.0, 0.0
+		if sampled > 0 {
+			share = 100 * float64(t.keys) / float64(sampled)
+		}
+		if t.keys > 0 {
+			avg = float64(t.totalSize) / float64(t.keys)
+		}
+		fmt.Fprintf(out, "%d %s with %d %s (%05.2f%% of keys, avg size %.2f)\n",
+			t.keys, t.plural, t.totalSize, sizeUnit(t, memkeys), share, avg)
+	}
+	return nil
+}
+
+func sizeUnit(t *keyType, memkeys bool) string {
+	if memkeys {
+		return "bytes"
+	}
+	return t.unit
+}
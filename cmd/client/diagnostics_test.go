@@ -0,0 +1,64 @@
+package main
+
+import (
+	"basic-go-redis/internal/server"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseInfo(t *testing.T) {
+	info := "# Server\r\nuptime_in_seconds:42\r\n\r\n# Keyspace\r\ndb0:keys=3,expires=1,avg_ttl=0\r\ndb1:keys=2,expires=0,avg_ttl=0\r\n"
+	fields := parseInfo(info)
+	if fields["uptime_in_seconds"] != "42" {
+		t.Errorf("parseInfo() = %v", fields)
+	}
+	if got := keyspaceKeys(fields); got != 5 {
+		t.Errorf("keyspaceKeys() = %d, want 5", got)
+	}
+
+	for n, want := range map[float64]string{512: "512B", 1536: "1.50K", 3 * 1024 * 1024: "3.00M"} {
+		if got := bytesToHuman(n); got != want {
+			t.Errorf("bytesToHuman(%v) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestBigKeysAndScan(t *testing.T) {
+	srv := server.NewServer("12412")
+	go srv.Start()
+	defer srv.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	sess := newSession(connOptions{host: "127.0.0.1", port: 12412})
+	defer sess.Close()
+	for i := 0; i < 50; i++ {
+		sess.do([]string{"SET", fmt.Sprintf("key:%d", i), "v"})
+	}
+	sess.do([]string{"SET", "big", strings.Repeat("x", 100)})
+	sess.do([]string{"ZADD", "myzset", "1", "a", "2", "b"})
+
+	var out strings.Builder
+	if err := runBigKeys(sess, &out, false, 0, 7, 0); err != nil {
+		t.Fatalf("runBigKeys() error: %v", err)
+	}
+	for _, want := range []string{
+		"Sampled 52 keys in the keyspace!",
+		`Biggest string found "big" has 100 bytes`,
+		`Biggest   zset found "myzset" has 2 members`,
+		"51 strings with 150 bytes",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("runBigKeys() output lacks %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := runScan(sess, &out, "key:4*", 5, outputRaw); err != nil {
+		t.Fatalf("runScan() error: %v", err)
+	}
+	if keys := strings.Fields(out.String()); len(keys) != 11 {
+		t.Errorf("runScan(key:4*) = %v, want 11 keys", keys)
+	}
+}
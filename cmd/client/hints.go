@@ -0,0 +1,165 @@
+// File: cmd/client/hints.go
+
+package main
+
+import (
+	"basic-go-redis/internal/protocol"
+	"sort"
+	"strings"
+)
+
+// commandHelp describes one command for tab completion and hints.
+type commandHelp struct {
+	name   string   // Upper case, with subcommands as "COMMAND INFO"
+	params []string // One hint token per argument, such as "key" or "[NX|XX]"
+}
+
+// loadCommandHelp asks the server for COMMAND DOCS and returns its commands
+// sorted by name. Servers without COMMAND DOCS yield no help.
+func loadCommandHelp(sess *session) []commandHelp {
+	reply, err := sess.do([]string{"COMMAND", "DOCS"})
+	if err != nil || !reply.IsAggregate() {
+		return nil
+	}
+	return parseCommandHelp(reply)
+}
+
+// parseCommandHelp turns a COMMAND DOCS reply into help sorted by name.
+func parseCommandHelp(reply protocol.Value) []commandHelp {
+	var help []commandHelp
+	addDocs(&help, reply.Elems)
+	sort.Slice(help, func(i, j int) bool { return help[i].name < help[j].name })
+	return help
+}
+
+// addDocs adds the commands of a COMMAND DOCS reply, given as alternating
+// names and documentation maps, along with their subcommands.
+func addDocs(help *[]commandHelp, pairs []protocol.Value) {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		name := strings.ToUpper(strings.ReplaceAll(pairs[i].Str, "|", " "))
+		entry := commandHelp{name: name}
+		docs := pairs[i+1].Elems
+		for j := 0; j+1 < len(docs); j += 2 {
+			switch docs[j].Str {
+			case "arguments":
+				for _, arg := range docs[j+1].Elems {
+					entry.params = append(entry.params, argumentHint(arg))
+				}
+			case "subcommands":
+				addDocs(help, docs[j+1].Elems)
+			}
+		}
+		*help = append(*help, entry)
+	}
+}
+
+// argumentHint renders one documented argument as redis-cli does, such as
+// "[EX seconds|PX milliseconds|KEEPTTL]" or "score member [score member ...]".
+func argumentHint(arg protocol.Value) string {
+	var name, typ, token string
+	var optional, multiple bool
+	var nested []string
+	for i := 0; i+1 < len(arg.Elems); i += 2 {
+		field, value := arg.Elems[i].Str, arg.Elems[i+1]
+		switch field {
+		case "name":
+			name = value.Str
+		case "type":
+			typ = value.Str
+		case "token":
+			token = value.Str
+		case "flags":
+			for _, flag := range value.Elems {
+				optional = optional || flag.Str == "optional"
+				multiple = multiple || flag.Str == "multiple"
+			}
+		case "arguments":
+			for _, sub := range value.Elems {
+				nested = append(nested, argumentHint(sub))
+			}
+		}
+	}
+
+	var hint string
+	switch typ {
+	case "pure-token":
+		hint = token
+	case "oneof":
+		hint = strings.Join(nested, "|")
+	case "block":
+		hint = strings.Join(nested, " ")
+	default:
+		hint = name
+	}
+	if token != "" && typ != "pure-token" {
+		hint = token + " " + hint
+	}
+	if multiple {
+		hint += " [" + hint + " ...]"
+	}
+	if optional {
+		hint = "[" + hint + "]"
+	}
+	return hint
+}
+
+// completeCommand completes command names, keeping the case the user typed in.
+func completeCommand(help []commandHelp, line string) []string {
+	typed := strings.TrimLeft(line, " ")
+	if typed == "" {
+		return nil
+	}
+	upper := strings.ToUpper(typed)
+	lower := typed == strings.ToLower(typed)
+	var candidates []string
+	for _, cmd := range help {
+		if !strings.HasPrefix(cmd.name, upper) || cmd.name == upper {
+			continue
+		}
+		if lower {
+			candidates = append(candidates, strings.ToLower(cmd.name))
+		} else {
+			candidates = append(candidates, cmd.name)
+		}
+	}
+	return candidates
+}
+
+// hintCommand shows the arguments still to be typed after the command
+// name, dropping one for each argument already entered.
+func hintCommand(help []commandHelp, line string) string {
+	args, err := splitArgs(line)
+	if err != nil || len(args) == 0 {
+		return ""
+	}
+	cmd := matchCommand(help, args)
+	if cmd == nil {
+		return ""
+	}
+	typed := len(args) - strings.Count(cmd.name, " ") - 1
+	if typed >= len(cmd.params) {
+		return ""
+	}
+	hint := strings.Join(cmd.params[typed:], " ")
+	if !strings.HasSuffix(line, " ") {
+		hint = " " + hint
+	}
+	return hint
+}
+
+// matchCommand finds the command args start with, preferring a subcommand
+// over its container.
+func matchCommand(help []commandHelp, args []string) *commandHelp {
+	var names []string
+	if len(args) > 1 {
+		names = append(names, strings.ToUpper(args[0]+" "+args[1]))
+	}
+	names = append(names, strings.ToUpper(args[0]))
+	for _, name := range names {
+		i := sort.Search(len(help), func(i int) bool { return help[i].name >= name })
+		if i < len(help) && help[i].name == name {
+			return &help[i]
+		}
+	}
+	return nil
+}
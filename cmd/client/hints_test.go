@@ -0,0 +1,74 @@
+package main
+
+import (
+	"basic-go-redis/internal/protocol"
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestCompletionAndHints(t *testing.T) {
+	// COMMAND DOCS for SET and COMMAND INFO, as the server sends them
+	docs := protocol.Array(
+		protocol.BulkString("set"),
+		protocol.Array(
+			protocol.BulkString("arguments"),
+			protocol.Array(
+				protocol.Array(protocol.BulkString("name"), protocol.BulkString("key"), protocol.BulkString("type"), protocol.BulkString("key")),
+				protocol.Array(protocol.BulkString("name"), protocol.BulkString("value"), protocol.BulkString("type"), protocol.BulkString("string")),
+				protocol.Array(
+					protocol.BulkString("name"), protocol.BulkString("expiration"),
+					protocol.BulkString("type"), protocol.BulkString("oneof"),
+					protocol.BulkString("flags"), protocol.Array(protocol.SimpleString("optional")),
+					protocol.BulkString("arguments"), protocol.Array(
+						protocol.Array(protocol.BulkString("name"), protocol.BulkString("seconds"), protocol.BulkString("type"), protocol.BulkString("integer"), protocol.BulkString("token"), protocol.BulkString("EX")),
+						protocol.Array(protocol.BulkString("name"), protocol.BulkString("keepttl"), protocol.BulkString("type"), protocol.BulkString("pure-token"), protocol.BulkString("token"), protocol.BulkString("KEEPTTL")),
+					),
+				),
+			),
+		),
+		protocol.BulkString("command"),
+		protocol.Array(
+			protocol.BulkString("subcommands"),
+			protocol.Array(
+				protocol.BulkString("command|info"),
+				protocol.Array(
+					protocol.BulkString("arguments"),
+					protocol.Array(protocol.Array(
+						protocol.BulkString("name"), protocol.BulkString("command-name"),
+						protocol.BulkString("type"), protocol.BulkString("string"),
+						protocol.BulkString("flags"), protocol.Array(protocol.SimpleString("optional"), protocol.SimpleString("multiple")),
+					)),
+				),
+			),
+		),
+	)
+	reply, err := protocol.ReadValue(bufio.NewReader(strings.NewReader(docs)))
+	if err != nil {
+		t.Fatalf("ReadValue() error: %v", err)
+	}
+	help := parseCommandHelp(reply)
+
+	if got := strings.Join(completeCommand(help, "comm"), ","); got != "command,command info" {
+		t.Errorf("completeCommand(comm) = %q", got)
+	}
+	if got := strings.Join(completeCommand(help, "S"), ","); got != "SET" {
+		t.Errorf("completeCommand(S) = %q", got)
+	}
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"set", " key value [EX seconds|KEEPTTL]"},
+		{"SET foo ", "value [EX seconds|KEEPTTL]"},
+		{"set foo bar EX 10", ""},
+		{"command info ", "[command-name [command-name ...]]"},
+		{"unknown ", ""},
+	}
+	for _, tt := range tests {
+		if got := hintCommand(help, tt.line); got != tt.want {
+			t.Errorf("hintCommand(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// File: cmd/client/options.go
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// parseURI applies a redis://[[user]:password@]host[:port][/db] URI to
+// opts, and reports whether it uses the rediss:// scheme, which asks for TLS.
+func parseURI(uri string, opts *connOptions) (useTLS bool, err error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false, err
+	}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		useTLS = true
+	default:
+		return false, fmt.Errorf("invalid URI scheme %q, expected redis:// or rediss://", u.Scheme)
+	}
+
+	if u.User != nil {
+		opts.user = u.User.Username()
+		if password, ok := u.User.Password(); ok {
+			opts.password = password
+		} else {
+			// A lone user info part is the password, as in redis://secret@host
+			opts.user, opts.password = "", u.User.Username()
+		}
+	}
+	if host := u.Hostname(); host != "" {
+		opts.host = host
+	}
+	if port := u.Port(); port != "" {
+		if opts.port, err = strconv.Atoi(port); err != nil {
+			return false, fmt.Errorf("invalid port %q", port)
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if opts.db, err = strconv.Atoi(db); err != nil {
+			return false, fmt.Errorf("invalid database number %q", db)
+		}
+	}
+	return useTLS, nil
+}
+
+// tlsFlags are the command-line options for connecting over TLS.
+type tlsFlags struct {
+	enabled    bool
+	sni        string
+	caCert     string
+	caCertDir  string
+	cert       string
+	key        string
+	insecure   bool
+	minVersion string
+}
+
+// config builds the TLS client configuration the flags describe. Without
+// a CA certificate or directory the system roots are used.
+func (f *tlsFlags) config(host string) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: host, InsecureSkipVerify: f.insecure}
+	if f.sni != "" {
+		cfg.ServerName = f.sni
+	}
+
+	switch f.minVersion {
+	case "", "1.2":
+		cfg.MinVersion = tls.VersionTLS12
+	case "1.3":
+		cfg.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported TLS version %q, expected 1.2 or 1.3", f.minVersion)
+	}
+
+	if f.caCert != "" || f.caCertDir != "" {
+		pool := x509.NewCertPool()
+		files := []string{}
+		if f.caCert != "" {
+			files = append(files, f.caCert)
+		}
+		if f.caCertDir != "" {
+			matches, err := filepath.Glob(filepath.Join(f.caCertDir, "*"))
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, matches...)
+		}
+		for _, file := range files {
+			pem, err := os.ReadFile(file)
+			if err != nil {
+				if f.caCertDir != "" && file != f.caCert {
+					continue // Skip unreadable entries of the directory, such as subdirectories
+				}
+				return nil, err
+			}
+			if !pool.AppendCertsFromPEM(pem) && file == f.caCert {
+				return nil, fmt.Errorf("no certificates found in %s", file)
+			}
+		}
+		cfg.RootCAs = pool
+	}
+
+	if (f.cert == "") != (f.key == "") {
+		return nil, errors.New("--cert and --key must be given together")
+	}
+	if f.cert != "" {
+		pair, err := tls.LoadX509KeyPair(f.cert, f.key)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	return cfg, nil
+}
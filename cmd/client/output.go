@@ -0,0 +1,38 @@
+// File: cmd/client/output.go
+
+package main
+
+import (
+	"basic-go-redis/internal/protocol"
+	"os"
+)
+
+// outputMode selects how replies are printed.
+type outputMode int
+
+const (
+	outputReadable outputMode = iota // redis-cli's terminal format
+	outputRaw                        // values only, one per line
+	outputCSV
+	outputJSON
+)
+
+// format renders a reply in the mode, ending with a newline.
+func (m outputMode) format(v protocol.Value) string {
+	switch m {
+	case outputRaw:
+		return protocol.FormatRaw(v)
+	case outputCSV:
+		return protocol.FormatCSV(v)
+	case outputJSON:
+		return protocol.FormatJSON(v)
+	default:
+		return protocol.FormatReadable(v)
+	}
+}
+
+// isTerminal reports whether f is attached to a terminal rather than a pipe or file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,136 @@
+// File: cmd/client/pipe.go
+
+package main
+
+import (
+	"basic-go-redis/internal/protocol"
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// pipeResult counts what the server answered in pipe mode.
+type pipeResult struct {
+	replies int
+	errors  int
+}
+
+// runPipe streams the commands read from r to the server as fast as it
+// takes them, the way redis-cli --pipe does. The input is either raw RESP
+// or inline commands, one per line; the first byte tells which. Replies are
+// read concurrently and counted, and error replies are printed to stderr.
+//
+// To know when the last reply has arrived, an ECHO of a random marker is
+// sent after the input. Once everything is written, the server must answer
+// within timeout of each reply, or the transfer is abandoned; zero waits
+// forever.
+func runPipe(sess *session, r io.Reader, timeout time.Duration) (pipeResult, error) {
+	if !sess.connected() {
+		if err := sess.connect(); err != nil {
+			return pipeResult{}, err
+		}
+	}
+	marker := make([]byte, 20)
+	rand.Read(marker)
+	echo := hex.EncodeToString(marker)
+
+	conn := sess.conn
+	var writeDone atomic.Bool
+	writeErr := make(chan error, 1)
+	go func() {
+		w := bufio.NewWriterSize(conn, 64*1024)
+		err := copyCommands(w, bufio.NewReaderSize(r, 64*1024))
+		if err == nil {
+			w.WriteString(protocol.Serialize("ECHO", []string{echo}))
+			err = w.Flush()
+		}
+		writeErr <- err
+		if err != nil {
+			// Unblock the reader, which would otherwise wait for replies forever
+			conn.SetReadDeadline(aLongTimeAgo)
+			return
+		}
+		fmt.Fprintln(os.Stderr, "All data transferred. Waiting for the last reply...")
+		writeDone.Store(true)
+		if timeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(timeout))
+		}
+	}()
+
+	var result pipeResult
+	for {
+		reply, err := protocol.ReadValue(sess.reader)
+		if err != nil {
+			sess.Close()
+			select {
+			case werr := <-writeErr:
+				if werr != nil {
+					return result, fmt.Errorf("Error writing to the server: %w", werr)
+				}
+			default:
+			}
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return result, errors.New("No reply received within the pipe timeout")
+			}
+			return result, fmt.Errorf("Error reading from the server: %w", err)
+		}
+		if reply.Kind == protocol.KindBulkString && reply.Str == echo {
+			fmt.Fprintln(os.Stderr, "Last reply received from server.")
+			return result, <-writeErr
+		}
+		result.replies++
+		if reply.IsError() {
+			result.errors++
+			fmt.Fprintln(os.Stderr, reply.Str)
+		}
+		if timeout > 0 && writeDone.Load() {
+			conn.SetReadDeadline(time.Now().Add(timeout))
+		}
+	}
+}
+
+// aLongTimeAgo is a deadline in the past, used to interrupt a blocked read.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// copyCommands copies the input to w: raw RESP as it is, and inline
+// commands converted to RESP. Blank lines and lines starting with # are
+// skipped in inline input.
+func copyCommands(w *bufio.Writer, in *bufio.Reader) error {
+	first, err := in.Peek(1)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if first[0] == '*' {
+		_, err := io.Copy(w, in)
+		return err
+	}
+
+	for lineNo := 1; ; lineNo++ {
+		line, err := in.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			args, splitErr := splitArgs(trimmed)
+			if splitErr != nil {
+				return fmt.Errorf("line %d: %w", lineNo, splitErr)
+			}
+			if _, werr := w.WriteString(protocol.Serialize(args[0], args[1:])); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
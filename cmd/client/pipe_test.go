@@ -0,0 +1,40 @@
+package main
+
+import (
+	"basic-go-redis/internal/protocol"
+	"basic-go-redis/internal/server"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunPipe(t *testing.T) {
+	srv := server.NewServer("12411")
+	go srv.Start()
+	defer srv.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	var raw strings.Builder
+	for i := 0; i < 10000; i++ {
+		raw.WriteString(protocol.Serialize("SET", []string{"key:" + strconv.Itoa(i), "value"}))
+	}
+	raw.WriteString(protocol.Serialize("NOSUCHCOMMAND", nil))
+
+	sess := newSession(connOptions{host: "127.0.0.1", port: 12411})
+	defer sess.Close()
+	result, err := runPipe(sess, strings.NewReader(raw.String()), 5*time.Second)
+	if err != nil || result.replies != 10001 || result.errors != 1 {
+		t.Errorf("runPipe(raw RESP) = %+v, %v, want 10001 replies and 1 error", result, err)
+	}
+
+	inline := "# fixtures\nSET greeting \"hello world\"\n\nGET greeting\nDEL greeting"
+	result, err = runPipe(sess, strings.NewReader(inline), 5*time.Second)
+	if err != nil || result.replies != 3 || result.errors != 0 {
+		t.Errorf("runPipe(inline) = %+v, %v, want 3 replies", result, err)
+	}
+
+	if _, err := runPipe(sess, strings.NewReader("SET \"unbalanced\n"), 5*time.Second); err == nil {
+		t.Errorf("runPipe(unbalanced quotes) succeeded, want an error")
+	}
+}
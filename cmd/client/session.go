@@ -0,0 +1,186 @@
+// File: cmd/client/session.go
+
+package main
+
+import (
+	"basic-go-redis/internal/protocol"
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialTimeout bounds how long connecting to the server may take.
+const dialTimeout = 5 * time.Second
+
+// connOptions says where the CLI connects and how it logs in.
+type connOptions struct {
+	host      string
+	port      int
+	user      string
+	password  string
+	db        int
+	tlsConfig *tls.Config // nil for plain TCP
+}
+
+func (o *connOptions) addr() string {
+	return net.JoinHostPort(o.host, strconv.Itoa(o.port))
+}
+
+// session is the CLI's connection to the server. It connects lazily and
+// reconnects when the connection is lost, logging in and selecting the
+// database again each time. The reply reader lives as long as the
+// connection, so bytes it has buffered beyond one reply are not lost.
+type session struct {
+	opts   connOptions
+	db     int // the database selected now, which SELECT changes
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newSession(opts connOptions) *session {
+	return &session{opts: opts, db: opts.db}
+}
+
+// connect dials the server and runs AUTH and SELECT. A failed AUTH or
+// SELECT is reported as a warning, as redis-cli does, and leaves the
+// connection open.
+func (s *session) connect() error {
+	s.Close()
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var conn net.Conn
+	var err error
+	if s.opts.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.opts.addr(), s.opts.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", s.opts.addr())
+	}
+	if err != nil {
+		return fmt.Errorf("Could not connect to Go-Redis at %s: %w", s.opts.addr(), err)
+	}
+	s.conn, s.reader = conn, bufio.NewReader(conn)
+
+	if s.opts.password != "" {
+		auth := []string{"AUTH", s.opts.password}
+		if s.opts.user != "" {
+			auth = []string{"AUTH", s.opts.user, s.opts.password}
+		}
+		reply, err := s.roundTrip(auth)
+		if err != nil {
+			s.Close()
+			return err
+		}
+		if reply.IsError() {
+			fmt.Fprintf(os.Stderr, "Warning: AUTH failed: %s\n", reply.Str)
+		}
+	}
+	if s.db != 0 {
+		reply, err := s.roundTrip([]string{"SELECT", strconv.Itoa(s.db)})
+		if err != nil {
+			s.Close()
+			return err
+		}
+		if reply.IsError() {
+			fmt.Fprintf(os.Stderr, "Warning: SELECT %d failed: %s\n", s.db, reply.Str)
+			s.db = 0
+		}
+	}
+	return nil
+}
+
+// connected reports whether the session holds an open connection.
+func (s *session) connected() bool {
+	return s.conn != nil
+}
+
+// prompt is the interactive prompt: the address and, unless it is 0, the
+// selected database, as in "127.0.0.1:6379[2]> ".
+func (s *session) prompt() string {
+	if !s.connected() {
+		return "not connected> "
+	}
+	if s.db != 0 {
+		return fmt.Sprintf("%s[%d]> ", s.opts.addr(), s.db)
+	}
+	return s.opts.addr() + "> "
+}
+
+// do sends one command and reads its reply, connecting first if needed.
+// When the connection turns out to be gone, for instance because the
+// server restarted, it reconnects and sends the command once more.
+func (s *session) do(args []string) (protocol.Value, error) {
+	if !s.connected() {
+		if err := s.connect(); err != nil {
+			return protocol.Value{}, err
+		}
+	}
+	reply, err := s.roundTrip(args)
+	if err != nil && isConnectionLost(err) {
+		if err := s.connect(); err != nil {
+			return protocol.Value{}, err
+		}
+		reply, err = s.roundTrip(args)
+	}
+	if err != nil {
+		s.Close()
+		return protocol.Value{}, fmt.Errorf("Error talking to Go-Redis at %s: %w", s.opts.addr(), err)
+	}
+
+	if strings.EqualFold(args[0], "select") && len(args) == 2 && !reply.IsError() {
+		s.db, _ = strconv.Atoi(args[1])
+	}
+	return reply, nil
+}
+
+// pipeline sends several commands at once and reads their replies in order.
+func (s *session) pipeline(commands [][]string) ([]protocol.Value, error) {
+	if !s.connected() {
+		if err := s.connect(); err != nil {
+			return nil, err
+		}
+	}
+	var buf strings.Builder
+	for _, args := range commands {
+		buf.WriteString(protocol.Serialize(args[0], args[1:]))
+	}
+	replies := make([]protocol.Value, len(commands))
+	_, err := io.WriteString(s.conn, buf.String())
+	for i := 0; err == nil && i < len(commands); i++ {
+		replies[i], err = protocol.ReadValue(s.reader)
+	}
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("Error talking to Go-Redis at %s: %w", s.opts.addr(), err)
+	}
+	return replies, nil
+}
+
+func (s *session) roundTrip(args []string) (protocol.Value, error) {
+	if _, err := s.conn.Write([]byte(protocol.Serialize(args[0], args[1:]))); err != nil {
+		return protocol.Value{}, err
+	}
+	return protocol.ReadValue(s.reader)
+}
+
+// isConnectionLost reports whether err means the server closed or reset
+// the connection, rather than sending something unreadable.
+func isConnectionLost(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr) || errors.Is(err, net.ErrClosed)
+}
+
+func (s *session) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn, s.reader = nil, nil
+	return err
+}
@@ -0,0 +1,187 @@
+// File: cmd/dumptool/main.go
+
+// Command dumptool exports a server's keys as NDJSON, one key with its
+// type, value and TTL per line, and imports such files back.
+package main
+
+import (
+	"basic-go-redis/internal/dump"
+	"basic-go-redis/pkg/client"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: dumptool export [OPTIONS] [-match pattern] [-o file]
+       dumptool import [OPTIONS] [-conflict fail|skip|overwrite] [-match pattern] [file]
+
+export writes every key, or those matching the pattern, sorted by name so
+that two exports diff well. import reads a file written by export, or by
+hand, from the file or stdin. With -conflict fail, the default, nothing is
+imported if any key exists already; skip keeps existing keys and overwrite
+replaces them.
+
+Options:
+  -h host      server hostname (default 127.0.0.1)
+  -p port      server port (default 6379)
+  -a password  password to log in with
+
+Examples:
+  dumptool export -o before.ndjson
+  dumptool export -match 'user:*' | diff before.ndjson -
+  dumptool import -conflict skip seed.ndjson
+`)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "export":
+		err = export(args)
+	case "import":
+		err = importFile(args)
+	case "-h", "-help", "--help", "help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", cmd)
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dumptool: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// flagSet returns the flags of a command, with those connecting to the
+// server, and a function returning a client once they're parsed.
+func flagSet(name string) (*flag.FlagSet, func() *client.Client) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = usage
+	host := flags.String("h", "127.0.0.1", "server hostname")
+	port := flags.Int("p", 6379, "server port")
+	password := flags.String("a", "", "password to log in with")
+	return flags, func() *client.Client {
+		return client.New(&client.Options{
+			Addr:        net.JoinHostPort(*host, strconv.Itoa(*port)),
+			Password:    *password,
+			ReadTimeout: -1, // Big imports take a while
+		})
+	}
+}
+
+func export(args []string) error {
+	flags, connect := flagSet("export")
+	pattern := flags.String("match", "*", "export the keys matching pattern")
+	out := flags.String("o", "", "file to write instead of stdout")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		usage()
+		os.Exit(2)
+	}
+	c := connect()
+	defer c.Close()
+
+	// Lines start with the key, so sorting them sorts the keys
+	var lines [][]byte
+	ctx := context.Background()
+	cursor := "0"
+	for {
+		reply, err := c.Do(ctx, "EXPORT", cursor, "MATCH", *pattern, "COUNT", "1000").Strings()
+		if err != nil {
+			return err
+		}
+		if len(reply) != 2 {
+			return fmt.Errorf("unexpected EXPORT reply %q", reply)
+		}
+		for _, line := range bytes.SplitAfter([]byte(reply[1]), []byte("\n")) {
+			if len(line) > 0 {
+				lines = append(lines, line)
+			}
+		}
+		if cursor = reply[0]; cursor == "0" {
+			break
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool { return bytes.Compare(lines[i], lines[j]) < 0 })
+
+	if *out == "" {
+		return writeLines(os.Stdout, lines)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	err = writeLines(f, lines)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		fmt.Fprintf(os.Stderr, "Exported %d keys to %s\n", len(lines), *out)
+	}
+	return err
+}
+
+func writeLines(w io.Writer, lines [][]byte) error {
+	bw := bufio.NewWriter(w)
+	for _, line := range lines {
+		bw.Write(line)
+	}
+	return bw.Flush()
+}
+
+func importFile(args []string) error {
+	flags, connect := flagSet("import")
+	conflict := flags.String("conflict", "fail", "what to do with keys that exist: fail, skip or overwrite")
+	pattern := flags.String("match", "*", "import the keys matching pattern")
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	var data []byte
+	var err error
+	name := "stdin"
+	if flags.NArg() == 1 {
+		name = flags.Arg(0)
+		data, err = os.ReadFile(name)
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return err
+	}
+	// Mistakes are reported here, with their line, rather than by the server
+	records, err := dump.ReadAll(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	c := connect()
+	defer c.Close()
+	n, err := c.Do(context.Background(), "IMPORT", string(data), "CONFLICT", *conflict, "MATCH", *pattern).Int()
+	var replyErr client.Error
+	if errors.As(err, &replyErr) && strings.HasPrefix(string(replyErr), "BUSYKEY") {
+		return errors.New("some keys exist already, nothing was imported; use -conflict skip or overwrite")
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d keys of the %d in %s\n", n, len(records), name)
+	return nil
+}
@@ -0,0 +1,257 @@
+// File: cmd/rdbtool/main.go
+
+// Command rdbtool inspects RDB files, such as those Redis writes, and
+// converts them into files the server loads.
+package main
+
+import (
+	"basic-go-redis/internal/rdb"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: rdbtool COMMAND [OPTIONS] FILE
+
+Commands:
+  info     Shows the file's version, auxiliary fields and keys by type
+  keys     Lists the keys with their database, type and TTL
+  convert  Writes the strings and sorted sets of one database to a file
+           the server loads, reporting the keys left out
+
+Options of convert:
+  -db n    database to convert (default 0)
+  -o path  file to write (default dump.rdb)
+
+Examples:
+  rdbtool info dump.rdb
+  rdbtool convert -db 1 -o data/dump.rdb redis-dump.rdb
+`)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "info":
+		err = withFile(args, info)
+	case "keys":
+		err = withFile(args, keys)
+	case "convert":
+		err = convert(args)
+	case "-h", "-help", "--help", "help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", cmd)
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rdbtool: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// withFile runs fn on the file named by the only argument.
+func withFile(args []string, fn func(*rdb.Decoder) error) error {
+	if len(args) != 1 {
+		usage()
+		os.Exit(2)
+	}
+	return decodeFile(args[0], fn)
+}
+
+func decodeFile(path string, fn func(*rdb.Decoder) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec, err := rdb.NewDecoder(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := fn(dec); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// each calls fn for every key of the file.
+func each(dec *rdb.Decoder, fn func(*rdb.Entry)) error {
+	for {
+		e, err := dec.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fn(e)
+	}
+}
+
+func info(dec *rdb.Decoder) error {
+	type dbStats struct {
+		keys, expires int
+		types         map[string]int
+	}
+	dbs := make(map[int]*dbStats)
+	err := each(dec, func(e *rdb.Entry) {
+		st := dbs[e.DB]
+		if st == nil {
+			st = &dbStats{types: make(map[string]int)}
+			dbs[e.DB] = st
+		}
+		st.keys++
+		if !e.ExpireAt.IsZero() {
+			st.expires++
+		}
+		st.types[rdb.TypeName(e.Type)]++
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("version: %d\n", dec.Version)
+	names := make([]string, 0, len(dec.Aux))
+	for name := range dec.Aux {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s: %s\n", name, dec.Aux[name])
+	}
+	numbers := make([]int, 0, len(dbs))
+	for db := range dbs {
+		numbers = append(numbers, db)
+	}
+	sort.Ints(numbers)
+	for _, db := range numbers {
+		st := dbs[db]
+		fmt.Printf("db%d: keys=%d,expires=%d", db, st.keys, st.expires)
+		types := make([]string, 0, len(st.types))
+		for t := range st.types {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		for _, t := range types {
+			fmt.Printf(",%s=%d", t, st.types[t])
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func keys(dec *rdb.Decoder) error {
+	return each(dec, func(e *rdb.Entry) {
+		ttl := "-1"
+		if !e.ExpireAt.IsZero() {
+			ttl = strconv.FormatInt(time.Until(e.ExpireAt).Milliseconds(), 10) + "ms"
+		}
+		fmt.Printf("%d\t%s\t%s\t%q\n", e.DB, rdb.TypeName(e.Type), ttl, e.Key)
+	})
+}
+
+func convert(args []string) error {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	flags.Usage = usage
+	db := flags.Int("db", 0, "database to convert")
+	out := flags.String("o", "dump.rdb", "file to write")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+		os.Exit(2)
+	}
+	in := flags.Arg(0)
+
+	// The keys are counted before they are written, so they are held in
+	// memory until the file has been read
+	var kept []*rdb.Entry
+	expires := 0
+	skipped := make(map[string]int)
+	now := time.Now()
+	err := decodeFile(in, func(dec *rdb.Decoder) error {
+		return each(dec, func(e *rdb.Entry) {
+			switch {
+			case e.DB != *db:
+				skipped[fmt.Sprintf("in db %d", e.DB)]++
+			case e.Type != rdb.TypeString && e.Type != rdb.TypeZSet:
+				skipped[rdb.TypeName(e.Type)+" type not supported"]++
+			case !e.ExpireAt.IsZero() && !e.ExpireAt.After(now):
+				skipped["expired"]++
+			default:
+				kept = append(kept, e)
+				if !e.ExpireAt.IsZero() {
+					expires++
+				}
+			}
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeFile(*out, kept, expires); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d keys to %s\n", len(kept), *out)
+	reasons := make([]string, 0, len(skipped))
+	for reason := range skipped {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Printf("Left out %d keys: %s\n", skipped[reason], reason)
+	}
+	return nil
+}
+
+// writeFile writes entries to a temporary file that is then renamed to
+// path, as the server saves its snapshots.
+func writeFile(path string, entries []*rdb.Entry, expires int) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "temp-*.rdb")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	enc := rdb.NewEncoder(tmp)
+	enc.Header(
+		"redis-ver", "7.0.0",
+		"redis-bits", strconv.Itoa(strconv.IntSize),
+		"ctime", strconv.FormatInt(time.Now().Unix(), 10),
+	)
+	if len(entries) > 0 {
+		enc.SelectDB(0, len(entries), expires)
+	}
+	for _, e := range entries {
+		if e.Type == rdb.TypeZSet {
+			err = enc.ZSet(e.Key, e.ZSet, e.ExpireAt)
+		} else {
+			err = enc.String(e.Key, e.String, e.ExpireAt)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = enc.Close()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
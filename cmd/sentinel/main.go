@@ -0,0 +1,104 @@
+// File: cmd/sentinel/main.go
+
+// Command sentinel monitors primaries and their replicas and, when enough
+// sentinels agree a primary is down, promotes one of its replicas and
+// points the others at it.
+package main
+
+import (
+	"basic-go-redis/internal/sentinel"
+	"basic-go-redis/pkg/logger"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listFlag collects the values of a flag given several times.
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ", ") }
+func (l *listFlag) Set(v string) error { *l = append(*l, v); return nil }
+
+func main() {
+	var monitors, peers listFlag
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: sentinel [OPTIONS] -monitor "name host port quorum" ...
+
+Options:
+`)
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, `
+Example, one of three sentinels watching the primary on port 6379:
+  sentinel -port 26379 -monitor "mymaster 127.0.0.1 6379 2" \
+    -down-after 5s -sentinel 127.0.0.1:26380 -state sentinel-26379.json
+`)
+	}
+	port := flag.Int("port", 26379, "port to listen on")
+	announceIP := flag.String("announce-ip", "127.0.0.1", "address the other sentinels reach this one at")
+	flag.Var(&monitors, "monitor", `primary to monitor, as "name host port quorum"; may be repeated`)
+	flag.Var(&peers, "sentinel", "host:port of another sentinel to greet at first; may be repeated")
+	downAfter := flag.Duration("down-after", sentinel.DefaultDownAfter, "how long a primary may go without answering before it is down")
+	failoverTimeout := flag.Duration("failover-timeout", sentinel.DefaultFailoverTimeout, "time a failover may take; a failed one is retried after twice as long")
+	statePath := flag.String("state", "", "file to keep the sentinel's state in across restarts; once it exists it takes over from -monitor")
+	logLevel := flag.String("loglevel", "notice", "debug, verbose, notice or warning")
+	logFile := flag.String("logfile", "", "file to log to instead of stdout")
+	flag.Parse()
+
+	if err := logger.Setup(logger.Options{Level: *logLevel, File: *logFile}); err != nil {
+		fmt.Fprintf(os.Stderr, "Can't set up logging: %v\n", err)
+		os.Exit(1)
+	}
+
+	cfg := sentinel.Config{
+		Port:       *port,
+		AnnounceIP: *announceIP,
+		Sentinels:  peers,
+		StateFile:  *statePath,
+	}
+	for _, spec := range monitors {
+		mc, err := parseMonitor(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Bad -monitor %q: %v\n", spec, err)
+			os.Exit(2)
+		}
+		mc.DownAfter, mc.FailoverTimeout = *downAfter, *failoverTimeout
+		cfg.Masters = append(cfg.Masters, mc)
+	}
+
+	s, err := sentinel.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Bad configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if err := s.Start(); err != nil {
+		logger.Error("Failed to start sentinel", "err", err)
+		os.Exit(1)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+	logger.Notice("Received signal, shutting down", "signal", sig.String())
+	s.Close()
+}
+
+// parseMonitor parses "name host port quorum".
+func parseMonitor(spec string) (sentinel.MasterConfig, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 4 {
+		return sentinel.MasterConfig{}, fmt.Errorf("want \"name host port quorum\"")
+	}
+	port, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return sentinel.MasterConfig{}, fmt.Errorf("invalid port %q", fields[2])
+	}
+	quorum, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return sentinel.MasterConfig{}, fmt.Errorf("invalid quorum %q", fields[3])
+	}
+	return sentinel.MasterConfig{Name: fields[0], Host: fields[1], Port: port, Quorum: quorum}, nil
+}
@@ -6,33 +6,82 @@ import (
 	"basic-go-redis/internal/server"
 	"basic-go-redis/pkg/config"
 	"basic-go-redis/pkg/logger"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
 	// Parse command-line arguments
 	configPath := flag.String("config", "./config.json", "path to the config file")
+	importRDB := flag.String("import-rdb", "", "path of an RDB file, such as one Redis wrote, to add to the dataset at startup")
+	importDB := flag.Int("import-db", 0, "database of the -import-rdb file to import")
 	flag.Parse()
 
-	// Load configuration or use default if the file is not found
-	cfg, err := config.LoadConfig(*configPath)
+	// Load configuration or use the defaults if the file is not found. A
+	// file with mistakes in it stops the server instead.
+	cfg, err := config.Load(*configPath)
+	missing := errors.Is(err, fs.ErrNotExist)
+	if missing {
+		cfg = config.New()
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Bad configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = logger.Setup(logger.Options{
+		Level:          cfg.Get("loglevel"),
+		Format:         cfg.Get("log-format"),
+		File:           cfg.Get("logfile"),
+		MaxSize:        cfg.Int("log-max-size"),
+		MaxBackups:     int(cfg.Int("log-max-backups")),
+		Syslog:         cfg.Bool("syslog-enabled"),
+		SyslogIdent:    cfg.Get("syslog-ident"),
+		SyslogFacility: cfg.Get("syslog-facility"),
+	})
 	if err != nil {
-		logger.ErrorLogger.Printf("Server side: Failed to load configuration: %v", err)
-		logger.InfoLogger.Println("Using default configuration")
+		fmt.Fprintf(os.Stderr, "Can't set up logging: %v\n", err)
+		os.Exit(1)
+	}
+	if missing {
+		logger.Warning("No config file, using the default configuration", "path", *configPath)
+	}
 
-		cfg = &config.Config{
-			ServerPort: "6379", // Default port number
-			LogLevel:   "info", // Default log level
+	// Initialize and start the server with configuration settings
+	srv := server.NewServerWithConfig(cfg)
+	if err := srv.LoadData(); err != nil {
+		logger.Error("Failed to load the dataset", "err", err)
+		os.Exit(1)
+	}
+	if *importRDB != "" {
+		if err := srv.ImportRDB(*importRDB, *importDB); err != nil {
+			logger.Error("Failed to import the RDB file", "err", err)
+			os.Exit(1)
 		}
 	}
 
-	// Initialize and start the server with configuration settings
-	srv := server.NewServer(cfg.ServerPort)
-	fmt.Printf("Starting server on port %s...\n", cfg.ServerPort)
+	// Save on the way out, as the save rules ask. Start returns as soon as
+	// the listener is closed, so the rest of Shutdown, such as the last
+	// AOF writes, is waited for below.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	shutdown := make(chan error, 1)
+	go func() {
+		sig := <-signals
+		logger.Notice("Received signal, shutting down", "signal", sig.String())
+		shutdown <- srv.Shutdown()
+	}()
+
 	if err := srv.Start(); err != nil {
-		logger.ErrorLogger.Printf("Failed to start server: %v", err)
+		logger.Error("Failed to start server", "err", err)
+		os.Exit(1)
+	}
+	if err := <-shutdown; err != nil {
+		logger.Error("Error shutting down", "err", err)
 		os.Exit(1)
 	}
 }
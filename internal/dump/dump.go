@@ -0,0 +1,275 @@
+// File: internal/dump/dump.go
+
+// Package dump reads and writes datasets as NDJSON, a JSON object per key
+// on its own line, for people and diff tools to read:
+//
+//	{"key":"greeting","type":"string","value":"hello","ttl":59000}
+//	{"key":"board","type":"zset","value":[{"member":"alice","score":1.5}]}
+//
+// A TTL is in milliseconds. Files may give an absolute expiry instead, as
+// expire_at in Unix milliseconds. Keys and values that aren't UTF-8 are
+// written in base64, which the record's encoding field says.
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// Record is a key and its value.
+type Record struct {
+	Key  string
+	Type string // string or zset
+
+	String string             // Value of a string
+	ZSet   map[string]float64 // Members of a zset
+
+	// When the key expires: after TTL, or at ExpireAt if it is set. Both
+	// are zero for a key without a TTL.
+	TTL      time.Duration
+	ExpireAt time.Time
+}
+
+// Deadline returns when the key expires, counting a TTL from now, or the
+// zero time if it doesn't.
+func (r *Record) Deadline(now time.Time) time.Time {
+	if !r.ExpireAt.IsZero() {
+		return r.ExpireAt
+	}
+	if r.TTL > 0 {
+		return now.Add(r.TTL)
+	}
+	return time.Time{}
+}
+
+// line is a Record as it is written.
+type line struct {
+	Key      string          `json:"key"`
+	Type     string          `json:"type"`
+	Value    json.RawMessage `json:"value"`
+	TTL      int64           `json:"ttl,omitempty"`
+	ExpireAt int64           `json:"expire_at,omitempty"`
+	Encoding string          `json:"encoding,omitempty"`
+}
+
+type member struct {
+	Member string `json:"member"`
+	Score  score  `json:"score"`
+}
+
+// score is a float that JSON can't hold as a number when it is infinite,
+// so inf and -inf are written as strings.
+type score float64
+
+func (s score) MarshalJSON() ([]byte, error) {
+	switch {
+	case math.IsInf(float64(s), 1):
+		return []byte(`"inf"`), nil
+	case math.IsInf(float64(s), -1):
+		return []byte(`"-inf"`), nil
+	}
+	return strconv.AppendFloat(nil, float64(s), 'g', -1, 64), nil
+}
+
+func (s *score) UnmarshalJSON(b []byte) error {
+	var f float64
+	switch string(b) {
+	case `"inf"`, `"+inf"`:
+		f = math.Inf(1)
+	case `"-inf"`:
+		f = math.Inf(-1)
+	default:
+		if err := json.Unmarshal(b, &f); err != nil {
+			return fmt.Errorf("score %s isn't a number", b)
+		}
+	}
+	*s = score(f)
+	return nil
+}
+
+// needsBase64 reports whether any of the record's strings isn't UTF-8,
+// which JSON strings can't hold as they are.
+func (r *Record) needsBase64() bool {
+	if !utf8.ValidString(r.Key) || !utf8.ValidString(r.String) {
+		return true
+	}
+	for m := range r.ZSet {
+		if !utf8.ValidString(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON writes the record as one line, without the newline. The
+// members of a zset are sorted by score, as ZRANGE returns them, so equal
+// datasets give equal output.
+func (r Record) MarshalJSON() ([]byte, error) {
+	encode := func(s string) string { return s }
+	l := line{Type: r.Type, TTL: r.TTL.Milliseconds()}
+	if r.needsBase64() {
+		encode = func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+		l.Encoding = "base64"
+	}
+	if !r.ExpireAt.IsZero() {
+		l.TTL, l.ExpireAt = 0, r.ExpireAt.UnixMilli()
+	}
+	l.Key = encode(r.Key)
+
+	var err error
+	switch r.Type {
+	case "string":
+		l.Value, err = json.Marshal(encode(r.String))
+	case "zset":
+		members := make([]member, 0, len(r.ZSet))
+		for m, s := range r.ZSet {
+			members = append(members, member{m, score(s)})
+		}
+		sort.Slice(members, func(i, j int) bool {
+			a, b := members[i], members[j]
+			return a.Score < b.Score || a.Score == b.Score && a.Member < b.Member
+		})
+		for i := range members {
+			members[i].Member = encode(members[i].Member)
+		}
+		l.Value, err = json.Marshal(members)
+	default:
+		return nil, fmt.Errorf("unknown type %q", r.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(l)
+}
+
+func (r *Record) UnmarshalJSON(b []byte) error {
+	var l line
+	if err := json.Unmarshal(b, &l); err != nil {
+		return err
+	}
+	decode := func(s string) (string, error) { return s, nil }
+	switch l.Encoding {
+	case "":
+	case "base64":
+		decode = func(s string) (string, error) {
+			b, err := base64.StdEncoding.DecodeString(s)
+			return string(b), err
+		}
+	default:
+		return fmt.Errorf("unknown encoding %q", l.Encoding)
+	}
+	var err error
+	if r.Key, err = decode(l.Key); err != nil {
+		return err
+	}
+	if l.Key == "" {
+		return errors.New("no key")
+	}
+	if len(l.Value) == 0 {
+		return errors.New("no value")
+	}
+	if l.TTL < 0 || l.ExpireAt < 0 {
+		return errors.New("negative ttl")
+	}
+	r.Type, r.String, r.ZSet = l.Type, "", nil
+	r.TTL, r.ExpireAt = time.Duration(l.TTL)*time.Millisecond, time.Time{}
+	if l.ExpireAt > 0 {
+		r.TTL, r.ExpireAt = 0, time.UnixMilli(l.ExpireAt)
+	}
+
+	switch l.Type {
+	case "string":
+		var s string
+		if err := json.Unmarshal(l.Value, &s); err != nil {
+			return errors.New("the value of a string must be a JSON string")
+		}
+		r.String, err = decode(s)
+		return err
+	case "zset":
+		var members []member
+		if err := json.Unmarshal(l.Value, &members); err != nil {
+			return fmt.Errorf("the value of a zset must be an array of members: %w", err)
+		}
+		if len(members) == 0 {
+			return errors.New("a zset needs members")
+		}
+		r.ZSet = make(map[string]float64, len(members))
+		for _, m := range members {
+			name, err := decode(m.Member)
+			if err != nil {
+				return err
+			}
+			r.ZSet[name] = float64(m.Score)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported type %q", l.Type)
+}
+
+// Append appends the record and a newline to dst.
+func Append(dst []byte, r Record) ([]byte, error) {
+	b, err := r.MarshalJSON()
+	if err != nil {
+		return dst, err
+	}
+	return append(append(dst, b...), '\n'), nil
+}
+
+// Reader reads the records of an NDJSON file. Blank lines are skipped.
+type Reader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func NewReader(r io.Reader) *Reader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 512*1024*1024)
+	return &Reader{s: s}
+}
+
+// Next returns the next record, or io.EOF after the last. An error names
+// the line it is on.
+func (r *Reader) Next() (Record, error) {
+	for r.s.Scan() {
+		r.line++
+		b := bytes.TrimSpace(r.s.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(b, &rec); err != nil {
+			return Record{}, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		return rec, nil
+	}
+	if err := r.s.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+// ReadAll returns every record of r.
+func ReadAll(r io.Reader) ([]Record, error) {
+	var records []Record
+	reader := NewReader(r)
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+}
@@ -0,0 +1,64 @@
+package dump
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordLines(t *testing.T) {
+	tests := []struct {
+		record Record
+		line   string
+	}{
+		{Record{Key: "greeting", Type: "string", String: "hello", TTL: 59 * time.Second},
+			`{"key":"greeting","type":"string","value":"hello","ttl":59000}`},
+		{Record{Key: "board", Type: "zset", ZSet: map[string]float64{"bob": 2, "alice": 2, "carol": math.Inf(-1)}},
+			`{"key":"board","type":"zset","value":[{"member":"carol","score":"-inf"},{"member":"alice","score":2},{"member":"bob","score":2}]}`},
+		{Record{Key: "bin\xff", Type: "string", String: "v", ExpireAt: time.UnixMilli(1893456000123)},
+			`{"key":"Ymlu/w==","type":"string","value":"dg==","expire_at":1893456000123,"encoding":"base64"}`},
+	}
+	for _, tt := range tests {
+		b, err := tt.record.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.line {
+			t.Errorf("got  %s\nwant %s", b, tt.line)
+		}
+		var back Record
+		if err := back.UnmarshalJSON(b); err != nil {
+			t.Fatalf("%s: %v", b, err)
+		}
+		if !reflect.DeepEqual(back, tt.record) {
+			t.Errorf("%s read back as %+v", b, back)
+		}
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	input := `{"key":"a","type":"string","value":"1"}
+
+{"key":"b","type":"list","value":["x"]}
+`
+	records, err := ReadAll(strings.NewReader(input))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("ReadAll = %v, %v", records, err)
+	}
+	for _, line := range []string{
+		`{"type":"string","value":"1"}`,
+		`{"key":"a","type":"string"}`,
+		`{"key":"a","type":"string","value":1}`,
+		`{"key":"a","type":"zset","value":[]}`,
+		`{"key":"a","type":"zset","value":[{"member":"m","score":"high"}]}`,
+		`{"key":"a","type":"string","value":"1","ttl":-5}`,
+		`not json`,
+	} {
+		var r Record
+		if err := r.UnmarshalJSON([]byte(line)); err == nil {
+			t.Errorf("%s read as %+v", line, r)
+		}
+	}
+}
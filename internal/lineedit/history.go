@@ -0,0 +1,77 @@
+// File: internal/lineedit/history.go
+
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// AddHistory remembers line for browsing with the arrow keys. Empty lines
+// and repeats of the previous line are skipped.
+func (e *Editor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if max := e.maxHistory(); len(e.history) > max {
+		e.history = append(e.history[:0], e.history[len(e.history)-max:]...)
+	}
+}
+
+// History returns the remembered lines, oldest first.
+func (e *Editor) History() []string {
+	return e.history
+}
+
+// LoadHistory adds the lines of the file at path to the history. A missing
+// file is not an error.
+func (e *Editor) LoadHistory(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 4096), 1024*1024)
+	for scanner.Scan() {
+		e.AddHistory(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// SaveHistory writes the history to the file at path, one line per entry.
+// The file is only readable by its owner since lines may hold secrets.
+func (e *Editor) SaveHistory(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, line := range e.history {
+		w.WriteString(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (e *Editor) maxHistory() int {
+	if e.MaxHistory > 0 {
+		return e.MaxHistory
+	}
+	return 1000
+}
@@ -0,0 +1,368 @@
+// File: internal/lineedit/lineedit.go
+
+// Package lineedit reads lines from a terminal with Emacs-style editing
+// keys, history, tab completion and hints shown after the cursor, in the
+// manner of linenoise. When input isn't a terminal it falls back to reading
+// plain lines.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInterrupted is returned by ReadLine when the user presses Ctrl-C.
+var ErrInterrupted = errors.New("lineedit: interrupted")
+
+// Key codes of the control keys the editor handles.
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlT     = 20
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// Editor reads lines from a terminal. It is not safe for concurrent use.
+type Editor struct {
+	// Complete returns the candidates for completing line when Tab is
+	// pressed, each one a whole replacement line. It may be nil.
+	Complete func(line string) []string
+	// Hint returns text shown greyed out after the line while the cursor
+	// is at its end, or "" for none. It may be nil.
+	Hint func(line string) string
+	// MaxHistory bounds the number of remembered lines. Defaults to 1000.
+	MaxHistory int
+
+	history []string
+	in      *os.File
+	out     *os.File
+	reader  *bufio.Reader // Reads in, keeping what was typed ahead between lines
+}
+
+// New returns an editor reading from stdin and drawing on stdout.
+func New() *Editor {
+	return &Editor{MaxHistory: 1000, in: os.Stdin, out: os.Stdout}
+}
+
+// ReadLine prints prompt and returns the line the user enters, without the
+// newline. It returns io.EOF when the user presses Ctrl-D on an empty line
+// or input ends, and ErrInterrupted on Ctrl-C.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	fd := int(e.in.Fd())
+	if !isTerminal(fd) {
+		return e.readPlain(prompt)
+	}
+	state, err := makeRaw(fd)
+	if err != nil {
+		return e.readPlain(prompt)
+	}
+	defer restore(fd, state)
+
+	line, err := e.edit(e.input(), e.out, prompt, terminalWidth(fd))
+	io.WriteString(e.out, "\r\n")
+	return line, err
+}
+
+// input returns the reader of the editor's input, the same for every
+// line, so that keys typed ahead and the lines of a paste after the first
+// aren't lost.
+func (e *Editor) input() *bufio.Reader {
+	if e.reader == nil {
+		e.reader = bufio.NewReader(e.in)
+	}
+	return e.reader
+}
+
+// readPlain reads a line without editing support.
+func (e *Editor) readPlain(prompt string) (string, error) {
+	io.WriteString(e.out, prompt)
+	line, err := e.input().ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// lineState is a line being edited.
+type lineState struct {
+	out    io.Writer
+	prompt string
+	cols   int
+	hint   func(string) string
+
+	buf []rune
+	pos int // cursor position in buf
+}
+
+// refresh redraws the line, scrolling it horizontally so the cursor stays visible.
+func (s *lineState) refresh(showHint bool) {
+	promptLen := utf8.RuneCountInString(s.prompt)
+	start, end := 0, len(s.buf)
+	for promptLen+s.pos-start >= s.cols && start < s.pos {
+		start++
+	}
+	for promptLen+end-start > s.cols && end > s.pos {
+		end--
+	}
+
+	var b strings.Builder
+	b.WriteString("\r")
+	b.WriteString(s.prompt)
+	b.WriteString(string(s.buf[start:end]))
+	if showHint && s.hint != nil && s.pos == len(s.buf) {
+		if hint := []rune(s.hint(string(s.buf))); len(hint) > 0 {
+			if room := s.cols - promptLen - (end - start); room > 0 {
+				if len(hint) > room {
+					hint = hint[:room]
+				}
+				b.WriteString("\x1b[90m" + string(hint) + "\x1b[0m")
+			}
+		}
+	}
+	b.WriteString("\x1b[0K") // Erase whatever is left of the previous line
+	if col := promptLen + s.pos - start; col > 0 {
+		fmt.Fprintf(&b, "\r\x1b[%dC", col)
+	} else {
+		b.WriteString("\r")
+	}
+	io.WriteString(s.out, b.String())
+}
+
+func (s *lineState) set(line string) {
+	s.buf = []rune(line)
+	s.pos = len(s.buf)
+}
+
+func (s *lineState) insert(r rune) {
+	s.buf = append(s.buf, 0)
+	copy(s.buf[s.pos+1:], s.buf[s.pos:])
+	s.buf[s.pos] = r
+	s.pos++
+}
+
+func (s *lineState) backspace() {
+	if s.pos > 0 {
+		s.buf = append(s.buf[:s.pos-1], s.buf[s.pos:]...)
+		s.pos--
+	}
+}
+
+func (s *lineState) deleteAtCursor() {
+	if s.pos < len(s.buf) {
+		s.buf = append(s.buf[:s.pos], s.buf[s.pos+1:]...)
+	}
+}
+
+func (s *lineState) deletePreviousWord() {
+	end := s.pos
+	for s.pos > 0 && s.buf[s.pos-1] == ' ' {
+		s.pos--
+	}
+	for s.pos > 0 && s.buf[s.pos-1] != ' ' {
+		s.pos--
+	}
+	s.buf = append(s.buf[:s.pos], s.buf[end:]...)
+}
+
+func (s *lineState) transpose() {
+	if s.pos > 0 && s.pos < len(s.buf) {
+		s.buf[s.pos-1], s.buf[s.pos] = s.buf[s.pos], s.buf[s.pos-1]
+		if s.pos < len(s.buf)-1 {
+			s.pos++
+		}
+	}
+}
+
+// edit runs the editing loop on keys read from in until Enter, Ctrl-C or
+// Ctrl-D on an empty line.
+func (e *Editor) edit(in *bufio.Reader, out io.Writer, prompt string, cols int) (string, error) {
+	s := &lineState{out: out, prompt: prompt, cols: cols, hint: e.Hint}
+
+	// historyIndex is the history entry being shown; len(e.history) stands
+	// for the line being typed, which is kept in current while browsing.
+	historyIndex := len(e.history)
+	var current string
+	showHistory := func(index int) {
+		if index < 0 || index > len(e.history) || index == historyIndex {
+			return
+		}
+		if historyIndex == len(e.history) {
+			current = string(s.buf)
+		}
+		historyIndex = index
+		if index == len(e.history) {
+			s.set(current)
+		} else {
+			s.set(e.history[index])
+		}
+	}
+
+	s.refresh(true)
+	for {
+		r, _, err := in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(s.buf) > 0 {
+				return string(s.buf), nil
+			}
+			return "", err
+		}
+
+		if r == keyTab && e.Complete != nil {
+			if r, err = e.completeLine(in, s); err != nil {
+				return "", err
+			}
+			if r == 0 {
+				continue // Completion cycle ended without a further key
+			}
+		}
+
+		switch r {
+		case keyEnter, '\n':
+			s.refresh(false) // Drop the hint from the accepted line
+			return string(s.buf), nil
+		case keyCtrlC:
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(s.buf) == 0 {
+				return "", io.EOF
+			}
+			s.deleteAtCursor()
+		case keyBackspace, keyCtrlH:
+			s.backspace()
+		case keyCtrlT:
+			s.transpose()
+		case keyCtrlB:
+			if s.pos > 0 {
+				s.pos--
+			}
+		case keyCtrlF:
+			if s.pos < len(s.buf) {
+				s.pos++
+			}
+		case keyCtrlP:
+			showHistory(historyIndex - 1)
+		case keyCtrlN:
+			showHistory(historyIndex + 1)
+		case keyCtrlU:
+			s.buf, s.pos = s.buf[:0], 0
+		case keyCtrlK:
+			s.buf = s.buf[:s.pos]
+		case keyCtrlA:
+			s.pos = 0
+		case keyCtrlE:
+			s.pos = len(s.buf)
+		case keyCtrlL:
+			io.WriteString(out, "\x1b[H\x1b[2J")
+		case keyCtrlW:
+			s.deletePreviousWord()
+		case keyEscape:
+			switch readEscape(in) {
+			case "[A":
+				showHistory(historyIndex - 1)
+			case "[B":
+				showHistory(historyIndex + 1)
+			case "[C":
+				if s.pos < len(s.buf) {
+					s.pos++
+				}
+			case "[D":
+				if s.pos > 0 {
+					s.pos--
+				}
+			case "[H", "OH", "[1~", "[7~":
+				s.pos = 0
+			case "[F", "OF", "[4~", "[8~":
+				s.pos = len(s.buf)
+			case "[3~":
+				s.deleteAtCursor()
+			}
+		default:
+			if r < ' ' {
+				continue // Ignore other control characters
+			}
+			s.insert(r)
+		}
+		s.refresh(true)
+	}
+}
+
+// readEscape reads the rest of an escape sequence after ESC, such as "[A"
+// for the up arrow or "[3~" for delete.
+func readEscape(in *bufio.Reader) string {
+	first, err := in.ReadByte()
+	if err != nil || (first != '[' && first != 'O') {
+		return ""
+	}
+	seq := []byte{first}
+	for {
+		c, err := in.ReadByte()
+		if err != nil {
+			return ""
+		}
+		seq = append(seq, c)
+		if c < '0' || c > '9' {
+			return string(seq)
+		}
+	}
+}
+
+// completeLine cycles through the completions of the line with each Tab.
+// Escape restores the original line; any other key accepts the candidate
+// shown and is returned to be handled as usual. A zero key means the key
+// was consumed here.
+func (e *Editor) completeLine(in *bufio.Reader, s *lineState) (rune, error) {
+	candidates := e.Complete(string(s.buf))
+	if len(candidates) == 0 {
+		io.WriteString(s.out, "\x07")
+		return 0, nil
+	}
+
+	original := string(s.buf)
+	i := 0
+	for {
+		// Position len(candidates) shows the original line again
+		if i < len(candidates) {
+			s.set(candidates[i])
+		} else {
+			s.set(original)
+		}
+		s.refresh(true)
+
+		r, _, err := in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		switch r {
+		case keyTab:
+			i = (i + 1) % (len(candidates) + 1)
+			if i == len(candidates) {
+				io.WriteString(s.out, "\x07")
+			}
+		case keyEscape:
+			s.set(original)
+			s.refresh(true)
+			return 0, nil
+		default:
+			return r, nil
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package lineedit
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func editKeys(e *Editor, keys string) (string, string, error) {
+	var out strings.Builder
+	line, err := e.edit(bufio.NewReader(strings.NewReader(keys)), &out, "> ", 80)
+	return line, out.String(), err
+}
+
+func TestEditKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys string
+		want string
+	}{
+		{"typing", "get foo\r", "get foo"},
+		{"backspace", "gett\x7f foo\r", "get foo"},
+		{"home and insert", "et foo\x01g\r", "get foo"},
+		{"arrows", "gt\x1b[De\x1b[C foo\r", "get foo"},
+		{"delete key", "gxet\x1b[H\x1b[C\x1b[3~\r", "get"},
+		{"kill to end", "get foo bar\x02\x02\x02\x02\x0b\r", "get foo"},
+		{"delete word", "get foo bar\x17\x17\r", "get "},
+		{"kill line", "junk\x15get\r", "get"},
+		{"utf-8", "echo héllo\r", "echo héllo"},
+	}
+	for _, tt := range tests {
+		got, _, err := editKeys(New(), tt.keys)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: edit(%q) = %q, %v, want %q", tt.name, tt.keys, got, err, tt.want)
+		}
+	}
+
+	if _, _, err := editKeys(New(), "\x04"); err != io.EOF {
+		t.Errorf("Ctrl-D on an empty line: err = %v, want io.EOF", err)
+	}
+	if _, _, err := editKeys(New(), "get\x03"); err != ErrInterrupted {
+		t.Errorf("Ctrl-C: err = %v, want ErrInterrupted", err)
+	}
+}
+
+func TestEditHistory(t *testing.T) {
+	e := New()
+	e.AddHistory("get a")
+	e.AddHistory("get b")
+	e.AddHistory("get b")
+	if got := len(e.History()); got != 2 {
+		t.Fatalf("len(History()) = %d, want 2 after a repeated line", got)
+	}
+
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"\x1b[A\r", "get b"},
+		{"\x1b[A\x1b[A\r", "get a"},
+		{"\x1b[A\x1b[A\x1b[A\r", "get a"},
+		{"typed\x1b[A\x1b[B\r", "typed"},
+		{"\x10\x10\x0e\r", "get b"},
+	}
+	for _, tt := range tests {
+		if got, _, _ := editKeys(e, tt.keys); got != tt.want {
+			t.Errorf("edit(%q) = %q, want %q", tt.keys, got, tt.want)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "history")
+	if err := e.SaveHistory(path); err != nil {
+		t.Fatalf("SaveHistory() error: %v", err)
+	}
+	loaded := New()
+	if err := loaded.LoadHistory(path); err != nil {
+		t.Fatalf("LoadHistory() error: %v", err)
+	}
+	if got := strings.Join(loaded.History(), ","); got != "get a,get b" {
+		t.Errorf("History() after LoadHistory = %q", got)
+	}
+}
+
+func TestEditCompletionAndHints(t *testing.T) {
+	e := New()
+	e.Complete = func(line string) []string {
+		if strings.HasPrefix("set", line) || strings.HasPrefix("setnx", line) {
+			return []string{"set", "setnx"}
+		}
+		return nil
+	}
+	e.Hint = func(line string) string {
+		if line == "set" {
+			return " key value"
+		}
+		return ""
+	}
+
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"s\t\r", "set"},
+		{"s\t\t\r", "setnx"},
+		{"s\t\t\t\r", "s"},
+		{"s\t\x1b\r", "s"},
+		{"s\t foo\r", "set foo"},
+	}
+	for _, tt := range tests {
+		if got, _, _ := editKeys(e, tt.keys); got != tt.want {
+			t.Errorf("edit(%q) = %q, want %q", tt.keys, got, tt.want)
+		}
+	}
+
+	_, out, _ := editKeys(e, "set\r")
+	if !strings.Contains(out, "\x1b[90m key value\x1b[0m") {
+		t.Errorf("hint not drawn, output %q", out)
+	}
+	if last := out[strings.LastIndex(out, "\r> "):]; strings.Contains(last, "key value") {
+		t.Errorf("accepted line still shows the hint: %q", last)
+	}
+}
+
+func TestTypeAhead(t *testing.T) {
+	// Lines pasted at once are read one after the other from the
+	// editor's reader
+	e := New()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	e.in = r
+	w.WriteString("get a\rget b\r")
+	w.Close()
+	var out strings.Builder
+	for _, want := range []string{"get a", "get b"} {
+		if got, err := e.edit(e.input(), &out, "> ", 80); err != nil || got != want {
+			t.Errorf("edit() = %q, %v, want %q", got, err, want)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+// File: internal/lineedit/term_bsd.go
+
+//go:build darwin || freebsd || netbsd || openbsd
+
+package lineedit
+
+import "syscall"
+
+const (
+	ioctlGetTermios = syscall.TIOCGETA
+	ioctlSetTermios = syscall.TIOCSETA
+)
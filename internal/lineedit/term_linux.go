@@ -0,0 +1,10 @@
+// File: internal/lineedit/term_linux.go
+
+package lineedit
+
+import "syscall"
+
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+)
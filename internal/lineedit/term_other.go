@@ -0,0 +1,27 @@
+// File: internal/lineedit/term_other.go
+
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+package lineedit
+
+import "errors"
+
+// terminalState is unused on platforms without raw mode support.
+type terminalState struct{}
+
+// isTerminal is always false here, so the editor falls back to plain line reads.
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (*terminalState, error) {
+	return nil, errors.New("lineedit: raw mode is not supported on this platform")
+}
+
+func restore(fd int, state *terminalState) error {
+	return nil
+}
+
+func terminalWidth(fd int) int {
+	return 80
+}
@@ -0,0 +1,65 @@
+// File: internal/lineedit/term_unix.go
+
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package lineedit
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// terminalState is the terminal configuration saved before entering raw mode.
+type terminalState struct {
+	termios syscall.Termios
+}
+
+func ioctl(fd int, request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// isTerminal reports whether fd refers to a terminal.
+func isTerminal(fd int) bool {
+	var t syscall.Termios
+	return ioctl(fd, ioctlGetTermios, unsafe.Pointer(&t)) == nil
+}
+
+// makeRaw puts the terminal into raw mode, in which every key press is
+// delivered immediately and not echoed, and returns the previous state.
+func makeRaw(fd int) (*terminalState, error) {
+	var t syscall.Termios
+	if err := ioctl(fd, ioctlGetTermios, unsafe.Pointer(&t)); err != nil {
+		return nil, err
+	}
+	old := &terminalState{termios: t}
+
+	t.Iflag &^= syscall.BRKINT | syscall.ICRNL | syscall.INPCK | syscall.ISTRIP | syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Cflag |= syscall.CS8
+	t.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.IEXTEN | syscall.ISIG
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, ioctlSetTermios, unsafe.Pointer(&t)); err != nil {
+		return nil, err
+	}
+	return old, nil
+}
+
+// restore returns the terminal to a state saved by makeRaw.
+func restore(fd int, state *terminalState) error {
+	return ioctl(fd, ioctlSetTermios, unsafe.Pointer(&state.termios))
+}
+
+// terminalWidth returns the number of columns of the terminal, or 80 if unknown.
+func terminalWidth(fd int) int {
+	var ws struct {
+		Row, Col, Xpixel, Ypixel uint16
+	}
+	if err := ioctl(fd, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil || ws.Col == 0 {
+		return 80
+	}
+	return int(ws.Col)
+}
@@ -0,0 +1,302 @@
+// File: internal/protocol/format.go
+
+package protocol
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Quote returns s in double quotes with the escapes redis-cli uses: \n, \r,
+// \t, \a, \b, \\ and \" by name and other non-printable bytes as \xHH.
+func Quote(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			if c >= 0x20 && c < 0x7f {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// FormatReadable renders v as redis-cli does on a terminal: strings quoted,
+// integers and other types tagged, and aggregates numbered with their
+// nested elements indented under them. The result ends with a newline.
+func FormatReadable(v Value) string {
+	var b strings.Builder
+	formatReadable(&b, v, "")
+	return b.String()
+}
+
+func formatReadable(b *strings.Builder, v Value, prefix string) {
+	if v.Null {
+		b.WriteString("(nil)\n")
+		return
+	}
+	switch v.Kind {
+	case KindError, KindBulkError:
+		b.WriteString("(error) " + v.Str + "\n")
+	case KindSimpleString, KindVerbatim:
+		b.WriteString(v.Str + "\n")
+	case KindInteger:
+		b.WriteString("(integer) " + strconv.FormatInt(v.Int, 10) + "\n")
+	case KindDouble:
+		b.WriteString("(double) " + v.Str + "\n")
+	case KindBigNumber:
+		b.WriteString("(big number) " + v.Str + "\n")
+	case KindBoolean:
+		if v.Int != 0 {
+			b.WriteString("(true)\n")
+		} else {
+			b.WriteString("(false)\n")
+		}
+	case KindBulkString:
+		b.WriteString(Quote(v.Str) + "\n")
+	case KindArray, KindSet, KindPush, KindMap:
+		formatAggregate(b, v, prefix)
+	default:
+		b.WriteString(v.Str + "\n")
+	}
+}
+
+// formatAggregate numbers the elements of v. Elements after the first are
+// indented by prefix, and their own nested elements by the width of the
+// index column as well.
+func formatAggregate(b *strings.Builder, v Value, prefix string) {
+	entries := len(v.Elems)
+	if v.Kind == KindMap {
+		entries /= 2
+	}
+	if entries == 0 {
+		switch v.Kind {
+		case KindMap:
+			b.WriteString("(empty hash)\n")
+		case KindSet:
+			b.WriteString("(empty set)\n")
+		case KindPush:
+			b.WriteString("(empty push)\n")
+		default:
+			b.WriteString("(empty array)\n")
+		}
+		return
+	}
+
+	separator := ")"
+	switch v.Kind {
+	case KindSet:
+		separator = "~"
+	case KindMap:
+		separator = "#"
+	}
+	width := len(strconv.Itoa(entries))
+	nested := prefix + strings.Repeat(" ", width+2)
+
+	for i := 0; i < entries; i++ {
+		if i > 0 {
+			b.WriteString(prefix)
+		}
+		fmt.Fprintf(b, "%*d%s ", width, i+1, separator)
+		if v.Kind != KindMap {
+			formatReadable(b, v.Elems[i], nested)
+			continue
+		}
+		var key strings.Builder
+		formatReadable(&key, v.Elems[2*i], nested)
+		b.WriteString(strings.TrimSuffix(key.String(), "\n"))
+		b.WriteString(" => ")
+		formatReadable(b, v.Elems[2*i+1], nested)
+	}
+}
+
+// FormatRaw renders v as redis-cli --raw does: strings as they are, nulls as
+// empty lines and the elements of aggregates one per line, without any
+// numbering or type tags. The result ends with a newline.
+func FormatRaw(v Value) string {
+	var b strings.Builder
+	formatRaw(&b, v)
+	b.WriteByte('\n')
+	return b.String()
+}
+
+func formatRaw(b *strings.Builder, v Value) {
+	switch {
+	case v.Null:
+	case v.Kind == KindInteger:
+		b.WriteString(strconv.FormatInt(v.Int, 10))
+	case v.Kind == KindBoolean:
+		if v.Int != 0 {
+			b.WriteString("(true)")
+		} else {
+			b.WriteString("(false)")
+		}
+	case v.IsAggregate():
+		for i, elem := range v.Elems {
+			if i > 0 {
+				b.WriteByte('\n')
+			}
+			formatRaw(b, elem)
+		}
+	default:
+		b.WriteString(v.Str)
+	}
+}
+
+// FormatCSV renders v as one line of comma separated values, as redis-cli
+// --csv does: strings quoted, nulls as NULL and aggregates flattened.
+func FormatCSV(v Value) string {
+	var b strings.Builder
+	formatCSV(&b, v)
+	b.WriteByte('\n')
+	return b.String()
+}
+
+func formatCSV(b *strings.Builder, v Value) {
+	switch {
+	case v.Null:
+		b.WriteString("NULL")
+	case v.IsError():
+		b.WriteString("ERROR," + Quote(v.Str))
+	case v.Kind == KindInteger:
+		b.WriteString(strconv.FormatInt(v.Int, 10))
+	case v.Kind == KindDouble, v.Kind == KindBigNumber:
+		b.WriteString(v.Str)
+	case v.Kind == KindBoolean:
+		if v.Int != 0 {
+			b.WriteString("true")
+		} else {
+			b.WriteString("false")
+		}
+	case v.IsAggregate():
+		for i, elem := range v.Elems {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			formatCSV(b, elem)
+		}
+	default:
+		b.WriteString(Quote(v.Str))
+	}
+}
+
+// FormatJSON renders v as one line of JSON: strings as strings, or as
+// {"base64": "..."} if they aren't UTF-8, integers and doubles as numbers,
+// nulls as null, maps as objects, other aggregates as arrays and errors as
+// {"error": "..."}. Map keys that aren't UTF-8 lose their invalid bytes.
+func FormatJSON(v Value) string {
+	var b strings.Builder
+	formatJSON(&b, v)
+	b.WriteByte('\n')
+	return b.String()
+}
+
+func formatJSON(b *strings.Builder, v Value) {
+	switch {
+	case v.Null:
+		b.WriteString("null")
+	case v.IsError():
+		b.WriteString(`{"error":` + jsonValue(v.Str) + "}")
+	case v.Kind == KindInteger:
+		b.WriteString(strconv.FormatInt(v.Int, 10))
+	case v.Kind == KindDouble:
+		if _, err := strconv.ParseFloat(v.Str, 64); err == nil && !strings.ContainsAny(v.Str, "in") {
+			b.WriteString(v.Str)
+		} else {
+			b.WriteString(jsonString(v.Str)) // inf, -inf and nan have no JSON number form
+		}
+	case v.Kind == KindBigNumber:
+		b.WriteString(v.Str)
+	case v.Kind == KindBoolean:
+		b.WriteString(strconv.FormatBool(v.Int != 0))
+	case v.Kind == KindMap:
+		b.WriteByte('{')
+		for i := 0; i+1 < len(v.Elems); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			key := v.Elems[i]
+			if key.Kind == KindInteger {
+				b.WriteString(jsonString(strconv.FormatInt(key.Int, 10)))
+			} else {
+				b.WriteString(jsonString(key.Str))
+			}
+			b.WriteByte(':')
+			formatJSON(b, v.Elems[i+1])
+		}
+		b.WriteByte('}')
+	case v.IsAggregate():
+		b.WriteByte('[')
+		for i, elem := range v.Elems {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			formatJSON(b, elem)
+		}
+		b.WriteByte(']')
+	default:
+		b.WriteString(jsonValue(v.Str))
+	}
+}
+
+// jsonValue renders a string value. One that isn't valid UTF-8, such as
+// a binary value, is written as {"base64": "..."}, as internal/dump marks
+// such values, so it can't be mistaken for text.
+func jsonValue(s string) string {
+	if !utf8.ValidString(s) {
+		return `{"base64":"` + base64.StdEncoding.EncodeToString([]byte(s)) + `"}`
+	}
+	return jsonString(s)
+}
+
+// jsonString quotes s as a JSON string. Bytes that aren't valid UTF-8 are
+// replaced with U+FFFD, so callers that must keep them use jsonValue.
+func jsonString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b.WriteRune(utf8.RuneError)
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	b.WriteByte('"')
+	return b.String()
+}
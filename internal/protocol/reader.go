@@ -0,0 +1,172 @@
+// File: internal/protocol/reader.go
+
+package protocol
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+const (
+	// defaultReaderSize is the size of the buffered reader wrapped around a connection.
+	defaultReaderSize = 16 * 1024
+	// maxMultiBulkLength bounds the number of arguments in a single request.
+	maxMultiBulkLength = 1024 * 1024
+	// maxBulkLength bounds the size of a single argument, matching Redis's proto-max-bulk-len.
+	maxBulkLength = 512 * 1024 * 1024
+	// maxRetainedBuffer is the largest argument buffer kept between commands;
+	// anything bigger is released so one huge request doesn't pin memory forever.
+	maxRetainedBuffer = 1024 * 1024
+)
+
+var (
+	errExpectedArray   = errors.New("deserialization protocol error: expected '*'")
+	errInvalidArrayLen = errors.New("deserialization protocol error: invalid array length")
+	errExpectedBulk    = errors.New("deserialization protocol error: expected '$'")
+	errInvalidBulkLen  = errors.New("deserialization protocol error: invalid bulk string length")
+	errLineTooLong     = errors.New("deserialization protocol error: line too long")
+)
+
+// Reader parses RESP requests from a connection into buffers that are reused
+// from one command to the next. The argument slices returned by ReadCommand
+// alias the Reader's internal storage and are only valid until the next call.
+type Reader struct {
+	rd      *bufio.Reader
+	buf     []byte   // payloads of the current command's arguments, back to back
+	offsets []int    // end offset in buf of each argument
+	args    [][]byte // views into buf handed back to the caller
+}
+
+// NewReader returns a Reader for rd. If rd is already a *bufio.Reader it is used as is.
+func NewReader(rd io.Reader) *Reader {
+	br, ok := rd.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReaderSize(rd, defaultReaderSize)
+	}
+	return &Reader{rd: br}
+}
+
+// Buffered returns the number of bytes that have been read from the
+// connection but not yet parsed, i.e. the rest of a pipeline.
+func (r *Reader) Buffered() int {
+	return r.rd.Buffered()
+}
+
+// ReadCommand reads one RESP array of bulk strings. A null bulk string is
+// returned as an empty argument and an empty or null array yields no arguments.
+func (r *Reader) ReadCommand() ([][]byte, error) {
+	if cap(r.buf) > maxRetainedBuffer {
+		r.buf = nil
+	}
+	r.buf = r.buf[:0]
+	r.offsets = r.offsets[:0]
+	r.args = r.args[:0]
+
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return nil, errExpectedArray
+	}
+	count, ok := parseInt(line[1:])
+	if !ok || count > maxMultiBulkLength {
+		return nil, errInvalidArrayLen
+	}
+
+	for i := 0; i < count; i++ {
+		line, err = r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errExpectedBulk
+		}
+		length, ok := parseInt(line[1:])
+		if !ok || length < -1 || length > maxBulkLength {
+			return nil, errInvalidBulkLen
+		}
+
+		if length == -1 { // Handle null bulk string
+			r.offsets = append(r.offsets, len(r.buf))
+			continue
+		}
+
+		// Read the payload and its trailing CRLF in one go, then drop the CRLF.
+		start := len(r.buf)
+		r.buf = grow(r.buf, length+2)
+		if _, err := io.ReadFull(r.rd, r.buf[start:]); err != nil {
+			return nil, err
+		}
+		r.buf = r.buf[:start+length]
+		r.offsets = append(r.offsets, len(r.buf))
+	}
+
+	// Views are built only once the buffer has stopped growing, since growing
+	// it may have moved the bytes. The three-index slices stop callers that
+	// append to an argument from clobbering the next one.
+	prev := 0
+	for _, end := range r.offsets {
+		r.args = append(r.args, r.buf[prev:end:end])
+		prev = end
+	}
+	return r.args, nil
+}
+
+// readLine returns the next line without its CRLF (or bare LF) terminator.
+// The slice points into the bufio buffer and is only valid until the next read.
+func (r *Reader) readLine() ([]byte, error) {
+	line, err := r.rd.ReadSlice('\n')
+	if err != nil {
+		if err == bufio.ErrBufferFull {
+			return nil, errLineTooLong
+		}
+		return nil, err
+	}
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+// grow extends buf by n bytes, reallocating only when the capacity runs out.
+func grow(buf []byte, n int) []byte {
+	if need := len(buf) + n; need > cap(buf) {
+		newCap := 2 * cap(buf)
+		if newCap < need {
+			newCap = need
+		}
+		grown := make([]byte, len(buf), newCap)
+		copy(grown, buf)
+		buf = grown
+	}
+	return buf[:len(buf)+n]
+}
+
+// parseInt parses a signed decimal length without allocating.
+func parseInt(b []byte) (int, bool) {
+	if len(b) == 0 || len(b) > 19 {
+		return 0, false
+	}
+	neg := false
+	if b[0] == '-' {
+		neg = true
+		b = b[1:]
+		if len(b) == 0 {
+			return 0, false
+		}
+	}
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	if neg {
+		n = -n
+	}
+	return n, true
+}
@@ -0,0 +1,122 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReaderReadCommand(t *testing.T) {
+	input := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$11\r\nhello world\r\n" +
+		"*2\r\n$3\r\nGET\r\n$-1\r\n" +
+		"*0\r\n"
+	reader := NewReader(strings.NewReader(input))
+
+	args, err := reader.ReadCommand()
+	if err != nil {
+		t.Fatalf("ReadCommand() error: %v", err)
+	}
+	if len(args) != 3 || string(args[0]) != "SET" || string(args[1]) != "key" || string(args[2]) != "hello world" {
+		t.Errorf("ReadCommand() = %q, want [SET key hello world]", args)
+	}
+
+	args, err = reader.ReadCommand()
+	if err != nil {
+		t.Fatalf("ReadCommand() error: %v", err)
+	}
+	if len(args) != 2 || string(args[0]) != "GET" || len(args[1]) != 0 {
+		t.Errorf("ReadCommand() = %q, want [GET \"\"]", args)
+	}
+
+	args, err = reader.ReadCommand()
+	if err != nil || len(args) != 0 {
+		t.Errorf("ReadCommand() = %q, %v, want no arguments", args, err)
+	}
+
+	if _, err := reader.ReadCommand(); err != io.EOF {
+		t.Errorf("ReadCommand() at end of input error = %v, want EOF", err)
+	}
+}
+
+func TestReaderArgumentsDoNotOverlap(t *testing.T) {
+	reader := NewReader(strings.NewReader("*2\r\n$1\r\na\r\n$1\r\nb\r\n"))
+	args, err := reader.ReadCommand()
+	if err != nil {
+		t.Fatalf("ReadCommand() error: %v", err)
+	}
+
+	// Appending to one view must not write into the next argument.
+	_ = append(args[0], 'x')
+	if string(args[1]) != "b" {
+		t.Errorf("second argument = %q after append to first, want %q", args[1], "b")
+	}
+}
+
+func TestReaderProtocolErrors(t *testing.T) {
+	tests := []string{
+		"GET key\r\n",
+		"*x\r\n",
+		"*1\r\n:1\r\n",
+		"*1\r\n$-2\r\n",
+		"*1\r\n$abc\r\n",
+	}
+	for _, input := range tests {
+		if _, err := NewReader(strings.NewReader(input)).ReadCommand(); err == nil || err == io.EOF {
+			t.Errorf("ReadCommand(%q) error = %v, want a protocol error", input, err)
+		}
+	}
+}
+
+// loopReader replays the same bytes forever so benchmarks never hit EOF.
+type loopReader struct {
+	data []byte
+	pos  int
+}
+
+func (l *loopReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		c := copy(p[n:], l.data[l.pos:])
+		n += c
+		l.pos = (l.pos + c) % len(l.data)
+	}
+	return n, nil
+}
+
+var benchmarkCommand = []byte(Serialize("SET", []string{"user:1000:session", strings.Repeat("v", 64), "EX", "60"}))
+
+func BenchmarkDeserialize(b *testing.B) {
+	reader := bufio.NewReader(&loopReader{data: benchmarkCommand})
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkCommand)))
+	for i := 0; i < b.N; i++ {
+		if _, _, err := Deserialize(reader); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReaderReadCommand(b *testing.B) {
+	reader := NewReader(&loopReader{data: benchmarkCommand})
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkCommand)))
+	for i := 0; i < b.N; i++ {
+		if _, err := reader.ReadCommand(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReaderReadCommandPipeline(b *testing.B) {
+	pipeline := bytes.Repeat(benchmarkCommand, 64)
+	reader := NewReader(&loopReader{data: pipeline})
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkCommand)))
+	for i := 0; i < b.N; i++ {
+		if _, err := reader.ReadCommand(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// File: internal/protocol/reply.go
+
+package protocol
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	// OK is the simple string reply most write commands answer with.
+	OK = "+OK\r\n"
+	// NullBulkString is the RESP2 reply for a missing value.
+	NullBulkString = "$-1\r\n"
+	// NullArray is the RESP2 reply for a missing aggregate.
+	NullArray = "*-1\r\n"
+	// EmptyArray is an array reply without elements.
+	EmptyArray = "*0\r\n"
+)
+
+// SimpleString encodes s as a RESP simple string. s must not contain CR or LF.
+func SimpleString(s string) string {
+	return "+" + s + "\r\n"
+}
+
+// ErrorReply encodes msg as a RESP error. By convention msg starts with an
+// upper-case error code such as ERR or WRONGTYPE.
+func ErrorReply(msg string) string {
+	return "-" + msg + "\r\n"
+}
+
+// Integer encodes n as a RESP integer.
+func Integer(n int64) string {
+	return ":" + strconv.FormatInt(n, 10) + "\r\n"
+}
+
+// BulkString encodes s as a RESP bulk string.
+func BulkString(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+// ArrayHeader returns the header of an array holding n elements.
+func ArrayHeader(n int) string {
+	return "*" + strconv.Itoa(n) + "\r\n"
+}
+
+// Array encodes an array from elements that are already RESP encoded.
+func Array(elems ...string) string {
+	var b strings.Builder
+	b.WriteString(ArrayHeader(len(elems)))
+	for _, elem := range elems {
+		b.WriteString(elem)
+	}
+	return b.String()
+}
+
+// AppendCommand appends args to dst as an array of bulk strings, the form
+// clients send commands in.
+func AppendCommand(dst []byte, args [][]byte) []byte {
+	dst = append(dst, '*')
+	dst = strconv.AppendInt(dst, int64(len(args)), 10)
+	dst = append(dst, '\r', '\n')
+	for _, arg := range args {
+		dst = append(dst, '$')
+		dst = strconv.AppendInt(dst, int64(len(arg)), 10)
+		dst = append(dst, '\r', '\n')
+		dst = append(dst, arg...)
+		dst = append(dst, '\r', '\n')
+	}
+	return dst
+}
+
+// BulkStringArray encodes items as an array of bulk strings.
+func BulkStringArray(items []string) string {
+	var b strings.Builder
+	b.WriteString(ArrayHeader(len(items)))
+	for _, item := range items {
+		b.WriteString(BulkString(item))
+	}
+	return b.String()
+}
@@ -4,10 +4,7 @@ package protocol
 
 import (
 	"bufio"
-	"errors"
 	"fmt"
-	"io"
-	"strconv"
 	"strings"
 )
 
@@ -26,161 +23,33 @@ func Serialize(command string, args []string) string {
 	return resp.String()
 }
 
-// Deserialize reads from a connection and parses the RESP command
+// Deserialize reads from a connection and parses the RESP command.
+// It copies every argument into a new string; servers should prefer a
+// long-lived Reader, which parses into reused buffers instead.
 func Deserialize(reader *bufio.Reader) (string, []string, error) {
-	line, err := reader.ReadString('\n')
+	parts, err := NewReader(reader).ReadCommand()
 	if err != nil {
 		return "", nil, err
 	}
-	line = strings.TrimRight(line, "\r\n") // Trim CR and LF
-
-	if !strings.HasPrefix(line, "*") {
-		return "", nil, errors.New("deserialization protocol error: expected '*'")
-	}
-
-	count, err := strconv.Atoi(line[1:])
-	if err != nil {
-		return "", nil, fmt.Errorf("deserialization protocol error: invalid array length")
+	if len(parts) == 0 {
+		return "", nil, nil
 	}
 
-	var command string
+	command := string(parts[0])
 	var args []string
-
-	for i := 0; i < count; i++ {
-		line, err = reader.ReadString('\n')
-		if err != nil {
-			return "", nil, err
-		}
-		line = strings.TrimRight(line, "\r\n") // Trim CR and LF
-
-		if !strings.HasPrefix(line, "$") {
-			return "", nil, errors.New("deserialization protocol error: expected '$'")
-		}
-
-		length, err := strconv.Atoi(line[1:])
-		if err != nil {
-			return "", nil, errors.New("deserialization protocol error: invalid bulk string length")
-		}
-
-		if length == -1 { // Handle null bulk string
-			args = append(args, "")
-			continue
-		}
-
-		bulk := make([]byte, length)
-		_, err = io.ReadFull(reader, bulk)
-		if err != nil {
-			return "", nil, err
-		}
-
-		_, err = reader.Discard(2) // Discard CRLF after bulk string
-		if err != nil {
-			return "", nil, err
-		}
-
-		arg := string(bulk)
-		if i == 0 {
-			command = arg
-		} else {
-			args = append(args, arg)
-		}
+	for _, part := range parts[1:] {
+		args = append(args, string(part))
 	}
-
 	return command, args, nil
 }
 
-func ReadFullResponse(reader *bufio.Reader) (string, error) {
-	var response strings.Builder
-
-	for {
-		line, err := reader.ReadString('\n')
-		//fmt.Println("Line:", line)
-		if err != nil {
-			if err == io.EOF && response.Len() > 0 {
-				break // End of file reached, return what we have
-			}
-			return "", err
-		}
-
-		// Break the loop if the line is empty
-		if line == "\r\n" || line == "\n" {
-			break
-		}
-
-		response.WriteString(line)
-
-		// Check if we've reached the end of a Redis response
-		if line[0] == '+' || line[0] == '-' || line[0] == ':' || line[0] == '_' {
-			break
-		} else if line[0] == '$' { // Bulk string
-			length, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
-			if length == -1 {
-				break // Handle nil bulk string
-			}
-			// Read the bulk string content
-			content := make([]byte, length+2) // +2 for \r\n
-			_, err = io.ReadFull(reader, content)
-			if err != nil {
-				return "", err
-			}
-			response.Write(content)
-			//fmt.Println("Bulk String:", response.String())
-		} else if line[0] == '*' { // Array
-			count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
-			if count == -1 {
-				// Handle nil array
-				continue
-			}
-			for i := 0; i < count; i++ {
-				element, err := reader.ReadString('\n')
-				if err != nil {
-					return "", err
-				}
-				response.WriteString(element)
-
-			}
-		}
-
-	}
-
-	return response.String(), nil
-}
-
+// ConvertRESPToReadable renders a raw reply, as returned by ReadFullResponse,
+// the way redis-cli prints replies on a terminal. Input that doesn't parse
+// as a reply is returned unchanged.
 func ConvertRESPToReadable(response string) string {
-
-	response = strings.TrimSuffix(response, "\r\n") // Remove trailing CRLF
-	var new_response strings.Builder
-	if strings.HasPrefix(response, "+") {
-		// Simple string
-		return strings.TrimPrefix(response, "+")
-	} else if strings.HasPrefix(response, ":") {
-		// Integer
-		return strings.TrimPrefix(response, ":")
-	} else if strings.HasPrefix(response, "$") {
-		// Bulk string
-		parts := strings.SplitN(response, "\r\n", 2)
-
-		if len(parts) > 1 {
-			return parts[1]
-		}
-	} else if strings.HasPrefix(response, "*") {
-		// Array
-		parts := strings.SplitN(response, "\r\n", 2)
-		if len(parts) > 1 {
-			arrayBody := parts[1]
-			arrayElements := strings.Split(arrayBody, "\r\n")
-			k := 0
-			for _, element := range arrayElements {
-				if element != "" && !strings.HasPrefix(element, "$") {
-					k++
-					formattedString := fmt.Sprintf("%d) \"%s\"\n", k, element)
-					new_response.WriteString(formattedString)
-
-				}
-
-			}
-		}
-		return new_response.String()
+	v, err := ReadValue(bufio.NewReader(strings.NewReader(response)))
+	if err != nil {
+		return response
 	}
-	return response
+	return strings.TrimSuffix(FormatReadable(v), "\n")
 }
@@ -0,0 +1,219 @@
+// File: internal/protocol/value.go
+
+package protocol
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Kind identifies the RESP type of a reply by its leading byte.
+type Kind byte
+
+// RESP2 types.
+const (
+	KindSimpleString Kind = '+'
+	KindError        Kind = '-'
+	KindInteger      Kind = ':'
+	KindBulkString   Kind = '$'
+	KindArray        Kind = '*'
+)
+
+// RESP3 types.
+const (
+	KindNull      Kind = '_'
+	KindBoolean   Kind = '#'
+	KindDouble    Kind = ','
+	KindBigNumber Kind = '('
+	KindBulkError Kind = '!'
+	KindVerbatim  Kind = '='
+	KindMap       Kind = '%'
+	KindSet       Kind = '~'
+	KindPush      Kind = '>'
+	KindAttribute Kind = '|'
+)
+
+// maxReplyDepth bounds how deeply aggregates may nest, so a malicious or
+// broken peer can't exhaust the stack.
+const maxReplyDepth = 64
+
+var errReplyTooDeep = errors.New("protocol error: reply nested too deeply")
+
+// maxReplyPrealloc bounds the room made for an aggregate or bulk string
+// before it's read: lengths come from the peer, so replies grow as they're
+// read rather than as announced.
+const maxReplyPrealloc = 64 * 1024
+
+// Value is a parsed RESP reply.
+//
+// Str holds the text of simple strings, errors, bulk strings and verbatim
+// strings (without their format prefix), as well as doubles and big numbers
+// as sent. Int holds integers, and booleans as 1 or 0. Elems holds the
+// elements of arrays, sets and pushes, and the keys and values of maps in
+// turn. Null marks RESP3 nulls and the RESP2 null bulk string and null array.
+// Attrs holds the attribute map, flattened, that preceded the reply, if any.
+type Value struct {
+	Kind  Kind
+	Str   string
+	Int   int64
+	Elems []Value
+	Null  bool
+	Attrs []Value
+}
+
+// IsError reports whether v is an error reply.
+func (v Value) IsError() bool {
+	return v.Kind == KindError || v.Kind == KindBulkError
+}
+
+// IsAggregate reports whether v holds elements: an array, map, set or push.
+func (v Value) IsAggregate() bool {
+	switch v.Kind {
+	case KindArray, KindMap, KindSet, KindPush:
+		return true
+	}
+	return false
+}
+
+// ReadValue reads one complete reply, including any nested elements.
+func ReadValue(reader *bufio.Reader) (Value, error) {
+	r := replyReader{rd: reader}
+	return r.readValue(0)
+}
+
+// ReadFullResponse reads one complete reply, including any nested elements,
+// and returns its raw RESP encoding.
+func ReadFullResponse(reader *bufio.Reader) (string, error) {
+	r := replyReader{rd: reader, raw: &strings.Builder{}}
+	if _, err := r.readValue(0); err != nil {
+		return "", err
+	}
+	return r.raw.String(), nil
+}
+
+// replyReader parses replies and, if raw is set, keeps a copy of the bytes read.
+type replyReader struct {
+	rd  *bufio.Reader
+	raw *strings.Builder
+}
+
+func (r *replyReader) readValue(depth int) (Value, error) {
+	if depth > maxReplyDepth {
+		return Value{}, errReplyTooDeep
+	}
+	line, err := r.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+	if len(line) == 0 {
+		return Value{}, errors.New("protocol error: empty reply line")
+	}
+
+	v := Value{Kind: Kind(line[0])}
+	payload := line[1:]
+	switch v.Kind {
+	case KindSimpleString, KindError, KindDouble, KindBigNumber:
+		v.Str = payload
+	case KindInteger:
+		if v.Int, err = strconv.ParseInt(payload, 10, 64); err != nil {
+			return Value{}, fmt.Errorf("protocol error: invalid integer %q", payload)
+		}
+	case KindNull:
+		v.Null = true
+	case KindBoolean:
+		switch payload {
+		case "t":
+			v.Int = 1
+		case "f":
+		default:
+			return Value{}, fmt.Errorf("protocol error: invalid boolean %q", payload)
+		}
+	case KindBulkString, KindBulkError, KindVerbatim:
+		length, err := strconv.Atoi(payload)
+		if err != nil || length < -1 || length > maxBulkLength {
+			return Value{}, fmt.Errorf("protocol error: invalid bulk length %q", payload)
+		}
+		if length == -1 {
+			v.Null = true
+			break
+		}
+		if v.Str, err = r.readPayload(length); err != nil {
+			return Value{}, err
+		}
+		if v.Kind == KindVerbatim {
+			// A three letter format such as "txt" and a colon precede the text
+			if len(v.Str) < 4 || v.Str[3] != ':' {
+				return Value{}, errors.New("protocol error: invalid verbatim string")
+			}
+			v.Str = v.Str[4:]
+		}
+	case KindArray, KindSet, KindPush, KindMap, KindAttribute:
+		count, err := strconv.Atoi(payload)
+		if err != nil || count < -1 || count > maxBulkLength {
+			return Value{}, fmt.Errorf("protocol error: invalid aggregate length %q", payload)
+		}
+		if count == -1 {
+			v.Null = true
+			break
+		}
+		if v.Kind == KindMap || v.Kind == KindAttribute {
+			count *= 2 // Keys and values
+		}
+		v.Elems = make([]Value, 0, min(count, maxReplyPrealloc))
+		for i := 0; i < count; i++ {
+			elem, err := r.readValue(depth + 1)
+			if err != nil {
+				return Value{}, err
+			}
+			v.Elems = append(v.Elems, elem)
+		}
+		if v.Kind == KindAttribute {
+			// Attributes decorate the reply that follows them
+			attrs := v.Elems
+			if v, err = r.readValue(depth); err != nil {
+				return Value{}, err
+			}
+			v.Attrs = attrs
+		}
+	default:
+		return Value{}, fmt.Errorf("protocol error: unexpected reply type %q", line[0])
+	}
+	return v, nil
+}
+
+// readLine reads a CRLF terminated line and returns it without the terminator.
+func (r *replyReader) readLine() (string, error) {
+	line, err := r.rd.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if r.raw != nil {
+		r.raw.WriteString(line)
+	}
+	line = line[:len(line)-1]
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return line, nil
+}
+
+// readPayload reads a bulk payload of length bytes and its trailing CRLF.
+func (r *replyReader) readPayload(length int) (string, error) {
+	buf := make([]byte, 0, min(length+2, maxReplyPrealloc))
+	for len(buf) < length+2 {
+		chunk := min(length+2-len(buf), maxReplyPrealloc)
+		buf = slices.Grow(buf, chunk)[:len(buf)+chunk]
+		if _, err := io.ReadFull(r.rd, buf[len(buf)-chunk:]); err != nil {
+			return "", err
+		}
+	}
+	if r.raw != nil {
+		r.raw.Write(buf)
+	}
+	return string(buf[:length]), nil
+}
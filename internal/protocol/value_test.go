@@ -0,0 +1,124 @@
+package protocol
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestReadFullResponse(t *testing.T) {
+	replies := []string{
+		"+OK\r\n",
+		"$5\r\nhello\r\n",
+		"$-1\r\n",
+		"*2\r\n$3\r\nfoo\r\n*2\r\n:1\r\n$0\r\n\r\n",
+		"*0\r\n",
+		"%1\r\n+key\r\n~2\r\n#t\r\n,3.14\r\n",
+		"|1\r\n+ttl\r\n:3600\r\n$3\r\nbar\r\n",
+	}
+	// A persistent reader must split back-to-back replies exactly
+	reader := bufio.NewReader(strings.NewReader(strings.Join(replies, "")))
+	for _, want := range replies {
+		got, err := ReadFullResponse(reader)
+		if err != nil || got != want {
+			t.Errorf("ReadFullResponse() = %q, %v, want %q", got, err, want)
+		}
+	}
+}
+
+func TestReadValue(t *testing.T) {
+	input := "*3\r\n$5\r\nhello\r\n_\r\n=15\r\ntxt:Some string\r\n"
+	v, err := ReadValue(bufio.NewReader(strings.NewReader(input)))
+	if err != nil {
+		t.Fatalf("ReadValue() error: %v", err)
+	}
+	if v.Kind != KindArray || len(v.Elems) != 3 {
+		t.Fatalf("ReadValue() = %+v, want an array of 3", v)
+	}
+	if v.Elems[0].Str != "hello" || !v.Elems[1].Null || v.Elems[2].Str != "Some string" {
+		t.Errorf("ReadValue() elements = %+v", v.Elems)
+	}
+
+	v, err = ReadValue(bufio.NewReader(strings.NewReader("!21\r\nSYNTAX invalid syntax\r\n")))
+	if err != nil || !v.IsError() || v.Str != "SYNTAX invalid syntax" {
+		t.Errorf("ReadValue(bulk error) = %+v, %v", v, err)
+	}
+
+	// Lengths from a broken peer are refused, or read as far as the data goes
+	for _, input := range []string{
+		"*9223372036854775807\r\n",
+		"%4611686018427387904\r\n",
+		"$9223372036854775807\r\n",
+		"*2147483647\r\n:1\r\n",
+		"$536870912\r\nabc\r\n",
+	} {
+		if _, err := ReadValue(bufio.NewReader(strings.NewReader(input))); err == nil {
+			t.Errorf("ReadValue(%q) succeeded", input)
+		}
+	}
+}
+
+func TestConvertRESPToReadable(t *testing.T) {
+	tests := []struct {
+		response string
+		want     string
+	}{
+		{"+OK\r\n", "OK"},
+		{":1\r\n", "(integer) 1"},
+		{"$-1\r\n", "(nil)"},
+		{"$11\r\nhello world\r\n", `"hello world"`},
+		{"$3\r\na\"\n\r\n", `"a\"\n"`},
+		{"-ERR unknown command\r\n", "(error) ERR unknown command"},
+		{"*0\r\n", "(empty array)"},
+		{"*2\r\n$4\r\nkey1\r\n$4\r\nkey2\r\n", "1) \"key1\"\n2) \"key2\""},
+		{
+			"*2\r\n*2\r\n:1\r\n$1\r\na\r\n*1\r\n$1\r\nb\r\n",
+			"1) 1) (integer) 1\n   2) \"a\"\n2) 1) \"b\"",
+		},
+		{"%1\r\n+k\r\n:2\r\n", "1# k => (integer) 2"},
+		{"~1\r\n#f\r\n", "1~ (false)"},
+	}
+	for _, tt := range tests {
+		if got := ConvertRESPToReadable(tt.response); got != tt.want {
+			t.Errorf("ConvertRESPToReadable(%q) = %q, want %q", tt.response, got, tt.want)
+		}
+	}
+
+	// Ten or more elements widen the index column
+	var elems []string
+	for i := 0; i < 10; i++ {
+		elems = append(elems, Integer(int64(i)))
+	}
+	got := ConvertRESPToReadable(Array(elems...))
+	if !strings.HasPrefix(got, " 1) (integer) 0\n 2)") || !strings.HasSuffix(got, "\n10) (integer) 9") {
+		t.Errorf("ConvertRESPToReadable(10 elements) = %q", got)
+	}
+}
+
+func TestFormatModes(t *testing.T) {
+	reply := Value{Kind: KindArray, Elems: []Value{
+		{Kind: KindBulkString, Str: "a \"b\""},
+		{Kind: KindInteger, Int: 7},
+		{Kind: KindBulkString, Null: true},
+	}}
+	if got, want := FormatRaw(reply), "a \"b\"\n7\n\n"; got != want {
+		t.Errorf("FormatRaw() = %q, want %q", got, want)
+	}
+	if got, want := FormatCSV(reply), "\"a \\\"b\\\"\",7,NULL\n"; got != want {
+		t.Errorf("FormatCSV() = %q, want %q", got, want)
+	}
+	if got, want := FormatJSON(reply), "[\"a \\\"b\\\"\",7,null]\n"; got != want {
+		t.Errorf("FormatJSON() = %q, want %q", got, want)
+	}
+	if got, want := FormatJSON(Value{Kind: KindError, Str: "ERR bad"}), "{\"error\":\"ERR bad\"}\n"; got != want {
+		t.Errorf("FormatJSON(error) = %q, want %q", got, want)
+	}
+	// A binary value can't be mistaken for text that looks the same
+	binary := Value{Kind: KindArray, Elems: []Value{
+		{Kind: KindBulkString, Str: "\xffa"},
+		{Kind: KindBulkString, Str: "\u00ffa"},
+	}}
+	if got, want := FormatJSON(binary), "[{\"base64\":\"/2E=\"},\"\u00ffa\"]\n"; got != want {
+		t.Errorf("FormatJSON(binary) = %q, want %q", got, want)
+	}
+}
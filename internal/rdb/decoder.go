@@ -0,0 +1,575 @@
+// File: internal/rdb/decoder.go
+
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// maxPrealloc bounds the room made for a value before it's read: lengths
+// come from the file, which may be damaged, so values grow as they're read.
+const maxPrealloc = 64 * 1024
+
+// Decoder reads the keys of an RDB file.
+type Decoder struct {
+	r   *bufio.Reader
+	crc uint64
+	buf [8]byte
+
+	// Version of the file, and its auxiliary fields once read
+	Version int
+	Aux     map[string]string
+
+	db       int
+	expireAt time.Time
+	done     bool
+}
+
+// NewDecoder reads the header of an RDB file.
+func NewDecoder(r io.Reader) (*Decoder, error) {
+	d := &Decoder{r: bufio.NewReaderSize(r, 64*1024), Aux: make(map[string]string)}
+	header := make([]byte, 9)
+	if err := d.read(header); err != nil {
+		return nil, err
+	}
+	if string(header[:5]) != magic {
+		return nil, fmt.Errorf("%w: not an RDB file", ErrFormat)
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil || version < 1 {
+		return nil, fmt.Errorf("%w: bad version %q", ErrFormat, header[5:])
+	}
+	d.Version = version
+	return d, nil
+}
+
+func (d *Decoder) read(p []byte) error {
+	if _, err := io.ReadFull(d.r, p); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	d.crc = updateCRC(d.crc, p)
+	return nil
+}
+
+func (d *Decoder) readByte() (byte, error) {
+	err := d.read(d.buf[:1])
+	return d.buf[0], err
+}
+
+// readLength reads a length, or reports that the string that follows has
+// the special encoding returned.
+func (d *Decoder) readLength() (n uint64, encoded bool, err error) {
+	b, err := d.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case len6Bit:
+		return uint64(b & 0x3f), false, nil
+	case len14Bit:
+		next, err := d.readByte()
+		return uint64(b&0x3f)<<8 | uint64(next), false, err
+	case lenEncoded:
+		return uint64(b & 0x3f), true, nil
+	}
+	switch b {
+	case len32Bit:
+		err := d.read(d.buf[:4])
+		return uint64(binary.BigEndian.Uint32(d.buf[:4])), false, err
+	case len64Bit:
+		err := d.read(d.buf[:8])
+		return binary.BigEndian.Uint64(d.buf[:8]), false, err
+	}
+	return 0, false, fmt.Errorf("%w: bad length encoding %#x", ErrFormat, b)
+}
+
+func (d *Decoder) readLen() (int, error) {
+	n, encoded, err := d.readLength()
+	if err != nil {
+		return 0, err
+	}
+	if encoded || n > math.MaxInt32 {
+		return 0, fmt.Errorf("%w: bad length", ErrFormat)
+	}
+	return int(n), nil
+}
+
+func (d *Decoder) readString() (string, error) {
+	n, encoded, err := d.readLength()
+	if err != nil {
+		return "", err
+	}
+	if encoded {
+		switch n {
+		case encInt8:
+			b, err := d.readByte()
+			return strconv.Itoa(int(int8(b))), err
+		case encInt16:
+			err := d.read(d.buf[:2])
+			return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(d.buf[:2])))), err
+		case encInt32:
+			err := d.read(d.buf[:4])
+			return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(d.buf[:4])))), err
+		case encLZF:
+			clen, err := d.readLen()
+			if err != nil {
+				return "", err
+			}
+			size, err := d.readLen()
+			if err != nil {
+				return "", err
+			}
+			p, err := d.readBytes(uint64(clen))
+			if err != nil {
+				return "", err
+			}
+			p, err = lzfDecompress(p, size)
+			return string(p), err
+		}
+		return "", fmt.Errorf("%w: unsupported string encoding %d", ErrFormat, n)
+	}
+	p, err := d.readBytes(n)
+	return string(p), err
+}
+
+func (d *Decoder) readBytes(n uint64) ([]byte, error) {
+	if n > math.MaxInt32 {
+		return nil, fmt.Errorf("%w: string of %d bytes", ErrFormat, n)
+	}
+	p := make([]byte, 0, min(n, maxPrealloc))
+	for uint64(len(p)) < n {
+		chunk := int(min(n-uint64(len(p)), maxPrealloc))
+		p = slices.Grow(p, chunk)[:len(p)+chunk]
+		if err := d.read(p[len(p)-chunk:]); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// readEncoded reads a string holding a ziplist, listpack or other compact
+// encoding and returns its entries as parse finds them.
+func (d *Decoder) readEncoded(parse func([]byte) ([]string, error)) ([]string, error) {
+	s, err := d.readString()
+	if err != nil {
+		return nil, err
+	}
+	return parse([]byte(s))
+}
+
+func (d *Decoder) readStrings() ([]string, error) {
+	n, err := d.readLen()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, min(n, maxPrealloc))
+	for i := 0; i < n; i++ {
+		value, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (d *Decoder) readFloat64() (float64, error) {
+	err := d.read(d.buf[:8])
+	return math.Float64frombits(binary.LittleEndian.Uint64(d.buf[:8])), err
+}
+
+// readDoubleString reads a score as the original zset type keeps them: a
+// length, with 253 to 255 standing for NaN, +inf and -inf, and the digits.
+func (d *Decoder) readDoubleString() (float64, error) {
+	n, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	p, err := d.readBytes(uint64(n))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(p), 64)
+}
+
+// Next returns the next key, or io.EOF once the file has ended and its
+// checksum matched.
+func (d *Decoder) Next() (*Entry, error) {
+	if d.done {
+		return nil, io.EOF
+	}
+	for {
+		op, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case opEOF:
+			d.done = true
+			return nil, d.checkCRC()
+		case opAux:
+			name, err := d.readString()
+			if err != nil {
+				return nil, err
+			}
+			value, err := d.readString()
+			if err != nil {
+				return nil, err
+			}
+			d.Aux[name] = value
+		case opSelectDB:
+			if d.db, err = d.readLen(); err != nil {
+				return nil, err
+			}
+		case opResizeDB:
+			// Sizes to preallocate for, which the store doesn't need
+			if _, err := d.readLen(); err != nil {
+				return nil, err
+			}
+			if _, err := d.readLen(); err != nil {
+				return nil, err
+			}
+		case opExpireTimeMs:
+			if err := d.read(d.buf[:8]); err != nil {
+				return nil, err
+			}
+			d.expireAt = time.UnixMilli(int64(binary.LittleEndian.Uint64(d.buf[:8])))
+		case opExpireTime:
+			if err := d.read(d.buf[:4]); err != nil {
+				return nil, err
+			}
+			d.expireAt = time.Unix(int64(binary.LittleEndian.Uint32(d.buf[:4])), 0)
+		case opIdle:
+			if _, err := d.readLen(); err != nil {
+				return nil, err
+			}
+		case opFreq:
+			if _, err := d.readByte(); err != nil {
+				return nil, err
+			}
+		case opSlotInfo:
+			// Slot, slot size and expires slot size, of a cluster node
+			for i := 0; i < 3; i++ {
+				if _, err := d.readLen(); err != nil {
+					return nil, err
+				}
+			}
+		case opFunction2:
+			// A library of functions, which the server has no use for
+			if _, err := d.readString(); err != nil {
+				return nil, err
+			}
+		case opFunction, opModuleAux:
+			return nil, fmt.Errorf("%w: unsupported opcode %#x", ErrFormat, op)
+		default:
+			e := &Entry{DB: d.db, ExpireAt: d.expireAt}
+			d.expireAt = time.Time{}
+			if e.Key, err = d.readString(); err != nil {
+				return nil, err
+			}
+			if err := d.readValue(e, int(op)); err != nil {
+				return nil, fmt.Errorf("key %q: %w", e.Key, err)
+			}
+			return e, nil
+		}
+	}
+}
+
+// readValue reads a value saved as type t, setting e.Type to its logical
+// type.
+func (d *Decoder) readValue(e *Entry, t int) error {
+	var err error
+	var pairs []string
+	switch t {
+	case TypeString:
+		e.Type = TypeString
+		e.String, err = d.readString()
+	case TypeList:
+		e.Type = TypeList
+		e.List, err = d.readStrings()
+	case typeListZiplist:
+		e.Type = TypeList
+		e.List, err = d.readEncoded(parseZiplist)
+	case typeListQuicklist, typeListQuicklist2:
+		e.Type = TypeList
+		e.List, err = d.readQuicklist(t == typeListQuicklist2)
+	case TypeSet:
+		e.Type = TypeSet
+		e.Set, err = d.readStrings()
+	case typeSetIntset:
+		e.Type = TypeSet
+		e.Set, err = d.readEncoded(parseIntset)
+	case typeSetListpack:
+		e.Type = TypeSet
+		e.Set, err = d.readEncoded(parseListpack)
+	case TypeZSet, typeZSet2:
+		e.Type = TypeZSet
+		e.ZSet, err = d.readZSet(t == typeZSet2)
+	case typeZSetZiplist, typeZSetListpack:
+		e.Type = TypeZSet
+		parse := parseZiplist
+		if t == typeZSetListpack {
+			parse = parseListpack
+		}
+		if pairs, err = d.readEncoded(parse); err == nil {
+			e.ZSet, err = zsetFromPairs(pairs)
+		}
+	case TypeHash, typeHashZipmap, typeHashZiplist, typeHashListpack:
+		e.Type = TypeHash
+		switch t {
+		case TypeHash:
+			pairs, err = d.readPairs()
+		case typeHashZipmap:
+			pairs, err = d.readEncoded(parseZipmap)
+		case typeHashZiplist:
+			pairs, err = d.readEncoded(parseZiplist)
+		default:
+			pairs, err = d.readEncoded(parseListpack)
+		}
+		if err == nil {
+			e.Hash, err = hashFromPairs(pairs)
+		}
+	case TypeStream, typeStreamListpacks2, typeStreamListpacks3:
+		e.Type = TypeStream
+		err = d.skipStream(t)
+	case typeModule, typeModule2:
+		return fmt.Errorf("%w: module values aren't supported", ErrFormat)
+	default:
+		return fmt.Errorf("%w: unsupported value type %d", ErrFormat, t)
+	}
+	return err
+}
+
+func (d *Decoder) readPairs() ([]string, error) {
+	n, err := d.readLen()
+	if err != nil {
+		return nil, err
+	}
+	pairs := make([]string, 0, min(2*n, maxPrealloc))
+	for i := 0; i < 2*n; i++ {
+		value, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, value)
+	}
+	return pairs, nil
+}
+
+// readZSet reads a sorted set whose scores are binary doubles or, in the
+// original type, strings.
+func (d *Decoder) readZSet(binaryScores bool) (map[string]float64, error) {
+	n, err := d.readLen()
+	if err != nil {
+		return nil, err
+	}
+	zset := make(map[string]float64, min(n, maxPrealloc))
+	for i := 0; i < n; i++ {
+		member, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		var score float64
+		if binaryScores {
+			score, err = d.readFloat64()
+		} else {
+			score, err = d.readDoubleString()
+		}
+		if err != nil {
+			return nil, err
+		}
+		zset[member] = score
+	}
+	return zset, nil
+}
+
+// readQuicklist reads a list saved as a series of ziplists or, in the
+// second version, of listpacks and single elements too big for one.
+func (d *Decoder) readQuicklist(v2 bool) ([]string, error) {
+	nodes, err := d.readLen()
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	for i := 0; i < nodes; i++ {
+		container := 2 // Packed
+		if v2 {
+			if container, err = d.readLen(); err != nil {
+				return nil, err
+			}
+		}
+		node, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		var entries []string
+		switch {
+		case container == 1: // Plain, a single element
+			entries = []string{node}
+		case container != 2:
+			return nil, fmt.Errorf("%w: bad quicklist container %d", ErrFormat, container)
+		case v2:
+			entries, err = parseListpack([]byte(node))
+		default:
+			entries, err = parseZiplist([]byte(node))
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, entries...)
+	}
+	return list, nil
+}
+
+// skipStream reads past a stream, which the server has no type for.
+func (d *Decoder) skipStream(t int) error {
+	skipLens := func(n int) error {
+		for i := 0; i < n; i++ {
+			if _, _, err := d.readLength(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	skipMillis := func() error { return d.read(d.buf[:8]) }
+
+	// Listpacks of entries, keyed by their first ID
+	listpacks, err := d.readLen()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 2*listpacks; i++ {
+		if _, err := d.readString(); err != nil {
+			return err
+		}
+	}
+	// Length and last ID, then first ID, max deleted ID and entries added
+	lens := 3
+	if t >= typeStreamListpacks2 {
+		lens += 5
+	}
+	if err := skipLens(lens); err != nil {
+		return err
+	}
+
+	groups, err := d.readLen()
+	if err != nil {
+		return err
+	}
+	for ; groups > 0; groups-- {
+		if _, err := d.readString(); err != nil {
+			return err
+		}
+		lens := 2 // Last ID, then entries read
+		if t >= typeStreamListpacks2 {
+			lens++
+		}
+		if err := skipLens(lens); err != nil {
+			return err
+		}
+		// Pending entries: ID, delivery time and count
+		pending, err := d.readLen()
+		if err != nil {
+			return err
+		}
+		for ; pending > 0; pending-- {
+			if _, err := d.readBytes(16); err != nil {
+				return err
+			}
+			if err := skipMillis(); err != nil {
+				return err
+			}
+			if err := skipLens(1); err != nil {
+				return err
+			}
+		}
+		// Consumers: name, seen and active times, and their pending IDs
+		consumers, err := d.readLen()
+		if err != nil {
+			return err
+		}
+		for ; consumers > 0; consumers-- {
+			if _, err := d.readString(); err != nil {
+				return err
+			}
+			if err := skipMillis(); err != nil {
+				return err
+			}
+			if t >= typeStreamListpacks3 {
+				if err := skipMillis(); err != nil {
+					return err
+				}
+			}
+			pending, err := d.readLen()
+			if err != nil {
+				return err
+			}
+			if _, err := d.readBytes(16 * uint64(pending)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func zsetFromPairs(pairs []string) (map[string]float64, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("%w: odd number of zset entries", ErrFormat)
+	}
+	zset := make(map[string]float64, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		score, err := strconv.ParseFloat(pairs[i+1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad score %q", ErrFormat, pairs[i+1])
+		}
+		zset[pairs[i]] = score
+	}
+	return zset, nil
+}
+
+func hashFromPairs(pairs []string) (map[string]string, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("%w: odd number of hash entries", ErrFormat)
+	}
+	hash := make(map[string]string, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		hash[pairs[i]] = pairs[i+1]
+	}
+	return hash, nil
+}
+
+// checkCRC reads the checksum after the EOF opcode. Files written without
+// one, by Redis with rdbchecksum off or before version 5, aren't checked.
+func (d *Decoder) checkCRC() error {
+	if d.Version < 5 {
+		return io.EOF
+	}
+	sum := d.crc
+	if _, err := io.ReadFull(d.r, d.buf[:8]); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	stored := binary.LittleEndian.Uint64(d.buf[:8])
+	if stored != 0 && stored != sum {
+		return ErrChecksum
+	}
+	return io.EOF
+}
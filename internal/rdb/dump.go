@@ -0,0 +1,77 @@
+// File: internal/rdb/dump.go
+
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxDumpVersion is the newest RDB version of the DUMP payloads Restore
+// reads, those of Redis 7.2 and older.
+const maxDumpVersion = 11
+
+// ErrDumpPayload is returned for a DUMP payload of an unknown version or
+// with a wrong checksum.
+var ErrDumpPayload = errors.New("DUMP payload version or checksum are wrong")
+
+// Dump serializes a key's value as DUMP does: its type and value in RDB
+// encoding, followed by the RDB version and a CRC64 of what precedes it.
+// Only strings and sorted sets are written.
+func Dump(e *Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	switch e.Type {
+	case TypeString:
+		enc.writeByte(TypeString)
+		enc.writeString(e.String)
+	case TypeZSet:
+		enc.writeByte(typeZSet2)
+		enc.writeZSet(e.ZSet)
+	default:
+		return nil, fmt.Errorf("%w: can't dump a %s", ErrFormat, TypeName(e.Type))
+	}
+	if enc.err == nil {
+		enc.err = enc.w.Flush()
+	}
+	if enc.err != nil {
+		return nil, enc.err
+	}
+	b := binary.LittleEndian.AppendUint16(buf.Bytes(), Version)
+	return binary.LittleEndian.AppendUint64(b, updateCRC(0, b)), nil
+}
+
+// Restore reads a DUMP payload, written by Dump or by Redis, into an Entry
+// without a key. Values of every type are read.
+func Restore(payload []byte) (*Entry, error) {
+	if len(payload) < 10 {
+		return nil, ErrDumpPayload
+	}
+	body := payload[:len(payload)-10]
+	version := int(binary.LittleEndian.Uint16(payload[len(body):]))
+	crc := binary.LittleEndian.Uint64(payload[len(payload)-8:])
+	if version > maxDumpVersion || crc != updateCRC(0, payload[:len(payload)-8]) {
+		return nil, ErrDumpPayload
+	}
+
+	d := &Decoder{r: bufio.NewReader(bytes.NewReader(body)), Version: version}
+	t, err := d.readByte()
+	if err != nil {
+		return nil, fmt.Errorf("%w: empty payload", ErrFormat)
+	}
+	e := &Entry{}
+	if err := d.readValue(e, int(t)); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = fmt.Errorf("%w: value truncated", ErrFormat)
+		}
+		return nil, err
+	}
+	if _, err := d.r.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("%w: bytes after the value", ErrFormat)
+	}
+	return e, nil
+}
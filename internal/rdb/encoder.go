@@ -0,0 +1,152 @@
+// File: internal/rdb/encoder.go
+
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Encoder writes an RDB file. Write the header, then each database's
+// keys, then Close. The first error is kept and returned by later calls.
+type Encoder struct {
+	w   *bufio.Writer
+	crc uint64
+	err error
+	buf [9]byte
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriterSize(w, 64*1024)}
+}
+
+func (e *Encoder) write(p []byte) {
+	if e.err != nil {
+		return
+	}
+	e.crc = updateCRC(e.crc, p)
+	_, e.err = e.w.Write(p)
+}
+
+func (e *Encoder) writeByte(b byte) {
+	e.buf[0] = b
+	e.write(e.buf[:1])
+}
+
+func (e *Encoder) writeLength(n uint64) {
+	switch {
+	case n < 1<<6:
+		e.writeByte(byte(n))
+	case n < 1<<14:
+		e.write([]byte{byte(n>>8) | len14Bit<<6, byte(n)})
+	case n <= math.MaxUint32:
+		e.buf[0] = len32Bit
+		binary.BigEndian.PutUint32(e.buf[1:], uint32(n))
+		e.write(e.buf[:5])
+	default:
+		e.buf[0] = len64Bit
+		binary.BigEndian.PutUint64(e.buf[1:], n)
+		e.write(e.buf[:9])
+	}
+}
+
+// writeString writes s, as an integer when it is one in canonical form.
+func (e *Encoder) writeString(s string) {
+	if len(s) <= 11 {
+		if n, err := strconv.ParseInt(s, 10, 32); err == nil && strconv.FormatInt(n, 10) == s {
+			e.writeInt(n)
+			return
+		}
+	}
+	e.writeLength(uint64(len(s)))
+	e.write([]byte(s))
+}
+
+func (e *Encoder) writeInt(n int64) {
+	switch {
+	case n >= math.MinInt8 && n <= math.MaxInt8:
+		e.write([]byte{lenEncoded<<6 | encInt8, byte(n)})
+	case n >= math.MinInt16 && n <= math.MaxInt16:
+		e.buf[0] = lenEncoded<<6 | encInt16
+		binary.LittleEndian.PutUint16(e.buf[1:], uint16(n))
+		e.write(e.buf[:3])
+	default:
+		e.buf[0] = lenEncoded<<6 | encInt32
+		binary.LittleEndian.PutUint32(e.buf[1:], uint32(n))
+		e.write(e.buf[:5])
+	}
+}
+
+// Header writes the file's header and its auxiliary fields, given as
+// name, value pairs.
+func (e *Encoder) Header(aux ...string) error {
+	e.write([]byte(magic + "000" + strconv.Itoa(Version)))
+	for i := 0; i+1 < len(aux); i += 2 {
+		e.writeByte(opAux)
+		e.writeString(aux[i])
+		e.writeString(aux[i+1])
+	}
+	return e.err
+}
+
+// SelectDB starts the keys of database db, of which there are keys, expires
+// of them with a TTL.
+func (e *Encoder) SelectDB(db, keys, expires int) error {
+	e.writeByte(opSelectDB)
+	e.writeLength(uint64(db))
+	e.writeByte(opResizeDB)
+	e.writeLength(uint64(keys))
+	e.writeLength(uint64(expires))
+	return e.err
+}
+
+func (e *Encoder) writeKey(typ byte, key string, expireAt time.Time) {
+	if !expireAt.IsZero() {
+		e.buf[0] = opExpireTimeMs
+		binary.LittleEndian.PutUint64(e.buf[1:], uint64(expireAt.UnixMilli()))
+		e.write(e.buf[:9])
+	}
+	e.writeByte(typ)
+	e.writeString(key)
+}
+
+// String writes a string key.
+func (e *Encoder) String(key, value string, expireAt time.Time) error {
+	e.writeKey(TypeString, key, expireAt)
+	e.writeString(value)
+	return e.err
+}
+
+// ZSet writes a sorted set key.
+func (e *Encoder) ZSet(key string, members map[string]float64, expireAt time.Time) error {
+	e.writeKey(typeZSet2, key, expireAt)
+	e.writeZSet(members)
+	return e.err
+}
+
+func (e *Encoder) writeZSet(members map[string]float64) {
+	e.writeLength(uint64(len(members)))
+	for member, score := range members {
+		e.writeString(member)
+		binary.LittleEndian.PutUint64(e.buf[:8], math.Float64bits(score))
+		e.write(e.buf[:8])
+	}
+}
+
+// Close ends the file with its checksum and flushes it. It doesn't close
+// the underlying writer.
+func (e *Encoder) Close() error {
+	e.writeByte(opEOF)
+	if e.err != nil {
+		return e.err
+	}
+	binary.LittleEndian.PutUint64(e.buf[:8], e.crc)
+	if _, err := e.w.Write(e.buf[:8]); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
@@ -0,0 +1,303 @@
+// File: internal/rdb/encodings.go
+
+package rdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// Redis keeps small values in compact encodings, saved as one string each:
+// ziplists and their successor listpacks hold lists of strings and
+// integers, intsets sets of integers and zipmaps small hashes.
+
+var errTruncated = fmt.Errorf("%w: value truncated", ErrFormat)
+
+// lzfDecompress expands LZF data, as Redis compresses long strings, into
+// a string of size bytes.
+func lzfDecompress(in []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, min(size, maxPrealloc))
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			// A run of ctrl+1 literal bytes
+			n := ctrl + 1
+			if i+n > len(in) {
+				return nil, errTruncated
+			}
+			if len(out)+n > size {
+				return nil, fmt.Errorf("%w: LZF data expands past %d bytes", ErrFormat, size)
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+		// A back reference to bytes already written
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, errTruncated
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errTruncated
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			return nil, fmt.Errorf("%w: bad LZF back reference", ErrFormat)
+		}
+		if len(out)+n+2 > size {
+			return nil, fmt.Errorf("%w: LZF data expands past %d bytes", ErrFormat, size)
+		}
+		for j := 0; j < n+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != size {
+		return nil, fmt.Errorf("%w: LZF data expands to %d bytes, not %d", ErrFormat, len(out), size)
+	}
+	return out, nil
+}
+
+// parseZiplist returns the entries of a ziplist.
+func parseZiplist(b []byte) ([]string, error) {
+	if len(b) < 11 {
+		return nil, errTruncated
+	}
+	var entries []string
+	for i := 10; ; {
+		if i >= len(b) {
+			return nil, errTruncated
+		}
+		if b[i] == 0xff {
+			return entries, nil
+		}
+		// Skip the length of the previous entry
+		if b[i] == 0xfe {
+			i += 5
+		} else {
+			i++
+		}
+		if i >= len(b) {
+			return nil, errTruncated
+		}
+		enc := b[i]
+		var n int
+		switch enc >> 6 {
+		case 0:
+			n, i = int(enc&0x3f), i+1
+		case 1:
+			if i+2 > len(b) {
+				return nil, errTruncated
+			}
+			n, i = int(enc&0x3f)<<8|int(b[i+1]), i+2
+		case 2:
+			if i+5 > len(b) {
+				return nil, errTruncated
+			}
+			n, i = int(binary.BigEndian.Uint32(b[i+1:])), i+5
+		default:
+			// An integer
+			var v int64
+			i++
+			size := ziplistIntSize(enc)
+			if enc >= 0xf1 && enc <= 0xfd {
+				v = int64(enc&0x0f) - 1
+			} else if size == 0 {
+				return nil, fmt.Errorf("%w: bad ziplist encoding %#x", ErrFormat, enc)
+			} else if i+size > len(b) {
+				return nil, errTruncated
+			} else {
+				v = littleEndianInt(b[i : i+size])
+			}
+			entries = append(entries, strconv.FormatInt(v, 10))
+			i += size
+			continue
+		}
+		if i+n > len(b) {
+			return nil, errTruncated
+		}
+		entries = append(entries, string(b[i:i+n]))
+		i += n
+	}
+}
+
+// ziplistIntSize returns the bytes of a ziplist integer, 0 for those kept
+// in the encoding byte itself.
+func ziplistIntSize(enc byte) int {
+	switch enc {
+	case 0xc0:
+		return 2
+	case 0xd0:
+		return 4
+	case 0xe0:
+		return 8
+	case 0xf0:
+		return 3
+	case 0xfe:
+		return 1
+	}
+	return 0
+}
+
+// littleEndianInt reads a signed little endian integer of 1 to 8 bytes.
+func littleEndianInt(b []byte) int64 {
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	shift := 64 - 8*uint(len(b))
+	return int64(v<<shift) >> shift
+}
+
+// parseListpack returns the entries of a listpack.
+func parseListpack(b []byte) ([]string, error) {
+	if len(b) < 7 {
+		return nil, errTruncated
+	}
+	var entries []string
+	for i := 6; ; {
+		if i >= len(b) {
+			return nil, errTruncated
+		}
+		enc := b[i]
+		if enc == 0xff {
+			return entries, nil
+		}
+		start := i
+		var str []byte
+		var v int64
+		isInt := true
+		switch {
+		case enc&0x80 == 0: // 7 bit unsigned integer
+			v, i = int64(enc), i+1
+		case enc&0xc0 == 0x80: // String of up to 63 bytes
+			n := int(enc & 0x3f)
+			if i+1+n > len(b) {
+				return nil, errTruncated
+			}
+			str, i, isInt = b[i+1:i+1+n], i+1+n, false
+		case enc&0xe0 == 0xc0: // 13 bit signed integer
+			if i+2 > len(b) {
+				return nil, errTruncated
+			}
+			u := uint64(enc&0x1f)<<8 | uint64(b[i+1])
+			v, i = int64(u<<51)>>51, i+2
+		case enc&0xf0 == 0xe0: // String of up to 4095 bytes
+			if i+2 > len(b) {
+				return nil, errTruncated
+			}
+			n := int(enc&0x0f)<<8 | int(b[i+1])
+			if i+2+n > len(b) {
+				return nil, errTruncated
+			}
+			str, i, isInt = b[i+2:i+2+n], i+2+n, false
+		case enc == 0xf0: // Longer string
+			if i+5 > len(b) {
+				return nil, errTruncated
+			}
+			n := int(binary.LittleEndian.Uint32(b[i+1:]))
+			if n < 0 || i+5+n > len(b) {
+				return nil, errTruncated
+			}
+			str, i, isInt = b[i+5:i+5+n], i+5+n, false
+		case enc >= 0xf1 && enc <= 0xf4: // 16, 24, 32 or 64 bit integer
+			size := [...]int{2, 3, 4, 8}[enc-0xf1]
+			if i+1+size > len(b) {
+				return nil, errTruncated
+			}
+			v, i = littleEndianInt(b[i+1:i+1+size]), i+1+size
+		default:
+			return nil, fmt.Errorf("%w: bad listpack encoding %#x", ErrFormat, enc)
+		}
+		if isInt {
+			entries = append(entries, strconv.FormatInt(v, 10))
+		} else {
+			entries = append(entries, string(str))
+		}
+		// Each entry ends with its own length, for walking backwards
+		i += backlenSize(i - start)
+	}
+}
+
+func backlenSize(n int) int {
+	switch {
+	case n <= 127:
+		return 1
+	case n < 16383:
+		return 2
+	case n < 2097151:
+		return 3
+	case n < 268435455:
+		return 4
+	}
+	return 5
+}
+
+// parseIntset returns the members of an intset.
+func parseIntset(b []byte) ([]string, error) {
+	if len(b) < 8 {
+		return nil, errTruncated
+	}
+	size := int(binary.LittleEndian.Uint32(b))
+	n := int(binary.LittleEndian.Uint32(b[4:]))
+	if size != 2 && size != 4 && size != 8 {
+		return nil, fmt.Errorf("%w: bad intset encoding %d", ErrFormat, size)
+	}
+	if n < 0 || 8+n*size > len(b) {
+		return nil, errTruncated
+	}
+	members := make([]string, n)
+	for i := range members {
+		off := 8 + i*size
+		members[i] = strconv.FormatInt(littleEndianInt(b[off:off+size]), 10)
+	}
+	return members, nil
+}
+
+// parseZipmap returns the fields and values of a zipmap, one after the other.
+func parseZipmap(b []byte) ([]string, error) {
+	var entries []string
+	i := 1
+	readLen := func() (int, bool) {
+		if i >= len(b) {
+			return 0, false
+		}
+		switch n := int(b[i]); {
+		case n < 254:
+			i++
+			return n, true
+		case n == 254 && i+5 <= len(b):
+			i += 5
+			return int(binary.LittleEndian.Uint32(b[i-4:])), true
+		}
+		return 0, false
+	}
+	for {
+		if i >= len(b) {
+			return nil, errTruncated
+		}
+		if b[i] == 0xff {
+			return entries, nil
+		}
+		n, ok := readLen()
+		if !ok || i+n > len(b) {
+			return nil, errTruncated
+		}
+		field := string(b[i : i+n])
+		i += n
+		n, ok = readLen()
+		if !ok || i+1+n > len(b) {
+			return nil, errTruncated
+		}
+		free := int(b[i])
+		value := string(b[i+1 : i+1+n])
+		i += 1 + n + free
+		entries = append(entries, field, value)
+	}
+}
@@ -0,0 +1,254 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCRCMatchesRedis(t *testing.T) {
+	// The check value of Redis's crc64.c
+	if got := updateCRC(0, []byte("123456789")); got != 0xe9c6d914c4b8d9ca {
+		t.Errorf("crc = %#x, want 0xe9c6d914c4b8d9ca", got)
+	}
+}
+
+func encode(t *testing.T) []byte {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.Header("redis-ver", "7.0.0", "redis-bits", "64")
+	e.SelectDB(0, 3, 1)
+	e.String("greeting", "hello", time.Time{})
+	for _, s := range []string{"12", "-300", "70000", "007", "-0", "99999999999", ""} {
+		e.String("n"+s, s, time.Time{})
+	}
+	e.String("long", string(bytes.Repeat([]byte("x"), 20000)), time.UnixMilli(1893456000123))
+	e.ZSet("board", map[string]float64{"alice": 1.5, "bob": -2}, time.Time{})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decodeAll(data []byte) ([]*Entry, *Decoder, error) {
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []*Entry
+	for {
+		e, err := d.Next()
+		if err == io.EOF {
+			return entries, d, nil
+		}
+		if err != nil {
+			return entries, d, err
+		}
+		entries = append(entries, e)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	entries, d, err := decodeAll(encode(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Version != Version || d.Aux["redis-ver"] != "7.0.0" || d.Aux["redis-bits"] != "64" {
+		t.Errorf("version %d, aux %v", d.Version, d.Aux)
+	}
+	if len(entries) != 10 {
+		t.Fatalf("got %d entries, want 10", len(entries))
+	}
+	if e := entries[0]; e.Key != "greeting" || e.String != "hello" || !e.ExpireAt.IsZero() {
+		t.Errorf("entry 0 = %+v", e)
+	}
+	for _, e := range entries[1:8] {
+		if e.String != e.Key[1:] {
+			t.Errorf("%s = %q", e.Key, e.String)
+		}
+	}
+	if e := entries[8]; len(e.String) != 20000 || e.ExpireAt.UnixMilli() != 1893456000123 {
+		t.Errorf("long: %d bytes, expires %v", len(e.String), e.ExpireAt)
+	}
+	want := map[string]float64{"alice": 1.5, "bob": -2}
+	if e := entries[9]; e.Type != TypeZSet || !reflect.DeepEqual(e.ZSet, want) {
+		t.Errorf("board = %+v", e)
+	}
+}
+
+func TestDamagedFiles(t *testing.T) {
+	data := encode(t)
+
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)/2] ^= 1
+	if _, _, err := decodeAll(flipped); err == nil {
+		t.Error("a flipped bit went unnoticed")
+	}
+
+	if _, _, err := decodeAll(data[:len(data)-20]); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated file: err = %v", err)
+	}
+
+	if _, err := NewDecoder(bytes.NewReader([]byte("NOTREDIS1"))); !errors.Is(err, ErrFormat) {
+		t.Errorf("not RDB: err = %v", err)
+	}
+}
+
+func TestHugeLengths(t *testing.T) {
+	huge := []byte{len32Bit, 0x7f, 0xff, 0xff, 0xff}
+	payload := func(b ...byte) []byte {
+		b = binary.LittleEndian.AppendUint16(b, Version)
+		return binary.LittleEndian.AppendUint64(b, updateCRC(0, b))
+	}
+	for _, typ := range []byte{TypeString, TypeList, TypeSet, TypeZSet, typeZSet2, TypeHash} {
+		if _, err := Restore(payload(append([]byte{typ}, huge...)...)); !errors.Is(err, ErrFormat) {
+			t.Errorf("type %d of 2^31 entries: err = %v", typ, err)
+		}
+	}
+	lzf := append([]byte{TypeString, lenEncoded<<6 | encLZF, 2}, huge...)
+	if _, err := Restore(payload(append(lzf, 0x00, 'a')...)); !errors.Is(err, ErrFormat) {
+		t.Errorf("LZF string of 2^31 bytes: err = %v", err)
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.Header("redis-ver", "7.2.4")
+	e.writeKey(TypeList, "list", time.Time{})
+	e.write(huge)
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Without the EOF opcode and checksum, the list's entries run out
+	if _, _, err := decodeAll(buf.Bytes()[:buf.Len()-9]); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("file with a list of 2^31 entries: err = %v", err)
+	}
+}
+
+// redisFile writes keys in the encodings Redis uses for small values.
+func redisFile(t *testing.T) []byte {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.Header("redis-ver", "7.2.4")
+	e.SelectDB(2, 10, 0)
+	blob := func(typ byte, key string, b ...byte) {
+		e.writeKey(typ, key, time.Time{})
+		e.writeLength(uint64(len(b)))
+		e.write(b)
+	}
+	lp := func(entries ...byte) []byte {
+		return append(append(make([]byte, 6), entries...), 0xff)
+	}
+	blob(typeListZiplist, "ziplist", append(make([]byte, 10),
+		0, 0x02, 'a', 'b', 4, 0xf6, 2, 0xc0, 0xfe, 0xff, 0xff)...)
+	blob(typeSetListpack, "listpack", lp(0x05, 1, 0x82, 'h', 'i', 3, 0xdf, 0x9c, 2, 0xf1, 0xe8, 0x03, 3)...)
+	blob(typeSetIntset, "intset", 4, 0, 0, 0, 3, 0, 0, 0, 0xfe, 0xff, 0xff, 0xff, 1, 0, 0, 0, 0x2c, 1, 0, 0)
+	blob(typeHashListpack, "hash", lp(0x81, 'f', 2, 0x81, 'v', 2)...)
+	blob(typeHashZipmap, "zipmap", 1, 1, 'a', 1, 0, 'b', 0xff)
+	blob(typeZSetListpack, "zset", lp(0x81, 'm', 2, 0x83, '1', '.', '5', 4)...)
+
+	// A string compressed with LZF
+	e.writeKey(TypeString, "lzf", time.Time{})
+	e.write([]byte{lenEncoded<<6 | encLZF, 5, 10, 0x00, 'a', 0xe0, 0x00, 0x00})
+
+	// A quicklist of a plain node and a listpack
+	e.writeKey(typeListQuicklist2, "quicklist", time.Time{})
+	e.writeLength(2)
+	e.writeLength(1)
+	e.writeString("big")
+	e.writeLength(2)
+	e.writeString(string(lp(0x07, 1)))
+
+	// The original zset type, with scores as strings
+	e.writeKey(TypeZSet, "oldzset", time.Time{})
+	e.writeLength(2)
+	e.writeString("x")
+	e.write([]byte{3, '2', '.', '5'})
+	e.writeString("y")
+	e.writeByte(254)
+
+	// An empty stream: no listpacks, length, last ID and no groups
+	e.writeKey(TypeStream, "stream", time.Time{})
+	e.write([]byte{0, 0, 0, 0, 0})
+	e.String("after", "ok", time.Time{})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRedisEncodings(t *testing.T) {
+	entries, _, err := decodeAll(redisFile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]*Entry)
+	for _, e := range entries {
+		if e.DB != 2 {
+			t.Errorf("%s in db %d", e.Key, e.DB)
+		}
+		got[e.Key] = e
+	}
+	checks := []struct {
+		key   string
+		typ   int
+		value any
+		field func(*Entry) any
+	}{
+		{"ziplist", TypeList, []string{"ab", "5", "-2"}, func(e *Entry) any { return e.List }},
+		{"listpack", TypeSet, []string{"5", "hi", "-100", "1000"}, func(e *Entry) any { return e.Set }},
+		{"intset", TypeSet, []string{"-2", "1", "300"}, func(e *Entry) any { return e.Set }},
+		{"hash", TypeHash, map[string]string{"f": "v"}, func(e *Entry) any { return e.Hash }},
+		{"zipmap", TypeHash, map[string]string{"a": "b"}, func(e *Entry) any { return e.Hash }},
+		{"zset", TypeZSet, map[string]float64{"m": 1.5}, func(e *Entry) any { return e.ZSet }},
+		{"lzf", TypeString, "aaaaaaaaaa", func(e *Entry) any { return e.String }},
+		{"quicklist", TypeList, []string{"big", "7"}, func(e *Entry) any { return e.List }},
+		{"oldzset", TypeZSet, map[string]float64{"x": 2.5, "y": math.Inf(1)}, func(e *Entry) any { return e.ZSet }},
+		{"stream", TypeStream, nil, func(e *Entry) any { return nil }},
+		{"after", TypeString, "ok", func(e *Entry) any { return e.String }},
+	}
+	for _, c := range checks {
+		e := got[c.key]
+		if e == nil {
+			t.Errorf("%s missing", c.key)
+			continue
+		}
+		if e.Type != c.typ || !reflect.DeepEqual(c.field(e), c.value) {
+			t.Errorf("%s: %s %v, want %s %v", c.key, TypeName(e.Type), c.field(e), TypeName(c.typ), c.value)
+		}
+	}
+}
+
+func TestDumpRestore(t *testing.T) {
+	// DUMP of the integer 10 in Redis's documentation
+	e, err := Restore([]byte("\x00\xc0\n\x06\x00\xf8r?\xc5\xfb\xfb_("))
+	if err != nil || e.Type != TypeString || e.String != "10" {
+		t.Errorf("Restore(Redis payload) = %+v, %v", e, err)
+	}
+
+	for _, in := range []*Entry{
+		{Type: TypeString, String: "hello"},
+		{Type: TypeZSet, ZSet: map[string]float64{"alice": 1.5, "bob": math.Inf(1)}},
+	} {
+		payload, err := Dump(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := Restore(payload)
+		if err != nil || out.Type != in.Type || out.String != in.String || !reflect.DeepEqual(out.ZSet, in.ZSet) {
+			t.Errorf("Restore(Dump(%+v)) = %+v, %v", in, out, err)
+		}
+		damaged := append([]byte(nil), payload...)
+		damaged[1] ^= 1
+		if _, err := Restore(damaged); !errors.Is(err, ErrDumpPayload) {
+			t.Errorf("damaged payload: err = %v", err)
+		}
+	}
+	if _, err := Dump(&Entry{Type: TypeList}); err == nil {
+		t.Error("dumped a list")
+	}
+}
@@ -0,0 +1,451 @@
+// File: internal/sentinel/commands.go
+
+package sentinel
+
+import (
+	"basic-go-redis/internal/protocol"
+	"basic-go-redis/pkg/logger"
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errNoSuchMaster = errors.New("ERR No such master with that name")
+
+// acceptLoop serves clients and other sentinels until Close.
+func (s *Sentinel) acceptLoop() {
+	defer s.wg.Done()
+	conns := make(map[net.Conn]bool)
+	done := make(chan net.Conn)
+	defer func() {
+		for conn := range conns {
+			conn.Close()
+		}
+		for range conns {
+			<-done
+		}
+	}()
+	accepted := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	for {
+		select {
+		case conn, ok := <-accepted:
+			if !ok {
+				return
+			}
+			conns[conn] = true
+			go func() {
+				s.serve(conn)
+				done <- conn
+			}()
+		case conn := <-done:
+			delete(conns, conn)
+		}
+	}
+}
+
+// serve runs the commands of one connection.
+func (s *Sentinel) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := protocol.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	for {
+		request, err := reader.ReadCommand()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				logger.Debug("Error reading command", "remote", conn.RemoteAddr().String(), "err", err)
+			}
+			return
+		}
+		if len(request) == 0 {
+			continue
+		}
+		args := make([]string, len(request))
+		for i, arg := range request {
+			args[i] = string(arg)
+		}
+		writer.WriteString(s.execute(args))
+		if reader.Buffered() == 0 {
+			if err := writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// execute runs one command. A sentinel answers only the commands that
+// clients and other sentinels need of it.
+func (s *Sentinel) execute(args []string) string {
+	switch name := strings.ToUpper(args[0]); name {
+	case "PING":
+		if len(args) > 1 {
+			return protocol.BulkString(args[1])
+		}
+		return protocol.SimpleString("PONG")
+	case "INFO":
+		return protocol.BulkString(s.info())
+	case "ROLE":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		names := make([]string, 0, len(s.masters))
+		for _, m := range s.sortedMasters() {
+			names = append(names, m.name)
+		}
+		return protocol.Array(protocol.BulkString("sentinel"), protocol.BulkStringArray(names))
+	case "SENTINEL":
+		if len(args) < 2 {
+			return protocol.ErrorReply("ERR wrong number of arguments for 'sentinel' command")
+		}
+		return s.sentinelCommand(args[1:])
+	default:
+		return protocol.ErrorReply(fmt.Sprintf("ERR unknown command '%s', this is a sentinel", args[0]))
+	}
+}
+
+// sentinelCommand runs a SENTINEL subcommand.
+func (s *Sentinel) sentinelCommand(args []string) string {
+	sub := strings.ToUpper(args[0])
+	arity := map[string]int{
+		"MASTERS": 1, "MASTER": 2, "REPLICAS": 2, "SLAVES": 2, "SENTINELS": 2,
+		"GET-MASTER-ADDR-BY-NAME": 2, "IS-MASTER-DOWN-BY-ADDR": 5, "HELLO": 9,
+		"CKQUORUM": 2, "FAILOVER": 2, "MONITOR": 5, "REMOVE": 2, "RESET": 2, "MYID": 1,
+	}
+	if n, ok := arity[sub]; !ok {
+		return protocol.ErrorReply(fmt.Sprintf("ERR unknown subcommand '%s'", args[0]))
+	} else if len(args) != n {
+		return protocol.ErrorReply(fmt.Sprintf("ERR wrong number of arguments for 'sentinel|%s' command", strings.ToLower(sub)))
+	}
+
+	if sub == "HELLO" {
+		currentEpoch, err1 := strconv.ParseInt(args[4], 10, 64)
+		configEpoch, err2 := strconv.ParseInt(args[8], 10, 64)
+		if err1 != nil || err2 != nil {
+			return protocol.ErrorReply("ERR value is not an integer or out of range")
+		}
+		known, err := s.hello(args[1], args[2], args[3], currentEpoch, args[5], args[6], args[7], configEpoch)
+		if err != nil {
+			return protocol.ErrorReply(err.Error())
+		}
+		return protocol.BulkStringArray(known)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	switch sub {
+	case "MYID":
+		return protocol.BulkString(s.runID)
+
+	case "MASTERS":
+		masters := s.sortedMasters()
+		replies := make([]string, len(masters))
+		for i, m := range masters {
+			replies[i] = protocol.BulkStringArray(s.masterFields(m, now))
+		}
+		return protocol.Array(replies...)
+
+	case "MONITOR":
+		port, err := strconv.Atoi(args[3])
+		if err != nil {
+			return protocol.ErrorReply("ERR Invalid port")
+		}
+		quorum, err := strconv.Atoi(args[4])
+		if err != nil || quorum <= 0 {
+			return protocol.ErrorReply("ERR Quorum must be 1 or greater.")
+		}
+		if _, ok := s.masters[args[1]]; ok {
+			return protocol.ErrorReply("ERR Duplicated master name.")
+		}
+		if err := s.addMaster(MasterConfig{Name: args[1], Host: args[2], Port: port, Quorum: quorum}); err != nil {
+			return protocol.ErrorReply("ERR " + err.Error())
+		}
+		m := s.masters[args[1]]
+		logger.Notice("+monitor", "master", m.name, "addr", m.inst.addr, "quorum", m.quorum)
+		s.watchAll(m)
+		s.persistOrWarn()
+		return protocol.OK
+
+	case "RESET":
+		n := 0
+		for _, m := range s.sortedMasters() {
+			if ok, _ := path.Match(args[1], m.name); ok {
+				s.resetMaster(m)
+				n++
+			}
+		}
+		s.persistOrWarn()
+		return protocol.Integer(int64(n))
+
+	case "IS-MASTER-DOWN-BY-ADDR":
+		epoch, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			return protocol.ErrorReply("ERR value is not an integer or out of range")
+		}
+		addr := net.JoinHostPort(args[1], args[2])
+		for _, m := range s.masters {
+			if m.inst.addr != addr {
+				continue
+			}
+			down := int64(0)
+			if m.inst.sdown {
+				down = 1
+			}
+			leader, leaderEpoch := "*", int64(0)
+			if args[4] != "*" {
+				leader, leaderEpoch = s.vote(m, epoch, args[4])
+			}
+			return protocol.Array(protocol.Integer(down), protocol.BulkString(leader), protocol.Integer(leaderEpoch))
+		}
+		return protocol.Array(protocol.Integer(0), protocol.BulkString("*"), protocol.Integer(0))
+	}
+
+	// The rest name a master
+	m := s.masters[args[1]]
+	if m == nil {
+		if sub == "GET-MASTER-ADDR-BY-NAME" {
+			return protocol.NullArray
+		}
+		return protocol.ErrorReply(errNoSuchMaster.Error())
+	}
+	switch sub {
+	case "MASTER":
+		return protocol.BulkStringArray(s.masterFields(m, now))
+
+	case "REPLICAS", "SLAVES":
+		replicas := sortedInstances(m.replicas)
+		replies := make([]string, len(replicas))
+		for i, rep := range replicas {
+			replies[i] = protocol.BulkStringArray(s.replicaFields(m, rep, now))
+		}
+		return protocol.Array(replies...)
+
+	case "SENTINELS":
+		replies := make([]string, 0, len(m.sentinels))
+		for _, p := range sortedPeers(m.sentinels) {
+			replies = append(replies, protocol.BulkStringArray(peerFields(m, p, now)))
+		}
+		return protocol.Array(replies...)
+
+	case "GET-MASTER-ADDR-BY-NAME":
+		return protocol.BulkStringArray([]string{m.inst.host, m.inst.port})
+
+	case "CKQUORUM":
+		usable := 1
+		for _, p := range m.sentinels {
+			if now.Sub(p.lastOK) < askValidity {
+				usable++
+			}
+		}
+		voters := len(m.sentinels) + 1
+		switch {
+		case usable < m.quorum:
+			return protocol.ErrorReply(fmt.Sprintf("NOQUORUM %d usable Sentinels. Not enough available Sentinels to reach the specified quorum for this master", usable))
+		case usable < voters/2+1:
+			return protocol.ErrorReply(fmt.Sprintf("NOQUORUM %d usable Sentinels. Not enough available Sentinels to reach the majority and authorize a failover", usable))
+		}
+		return protocol.SimpleString(fmt.Sprintf("OK %d usable Sentinels. Quorum and failover authorization can be reached", usable))
+
+	case "FAILOVER":
+		// A forced failover needs neither agreement nor an election
+		if m.failoverState != failoverNone {
+			return protocol.ErrorReply("INPROG Failover already in progress")
+		}
+		if s.selectReplica(m, now) == nil {
+			return protocol.ErrorReply("NOGOODSLAVE No suitable replica to promote")
+		}
+		s.currentEpoch++
+		m.failoverEpoch, m.failoverStart = s.currentEpoch, now
+		m.leader, m.leaderEpoch = s.runID, s.currentEpoch
+		logger.Warning("+new-epoch", "epoch", s.currentEpoch)
+		logger.Warning("+try-failover", "master", m.name, "addr", m.inst.addr, "forced", true)
+		s.persistOrWarn()
+		s.startFailover(m)
+		return protocol.OK
+
+	case "REMOVE":
+		s.unwatch(m.inst)
+		for _, rep := range m.replicas {
+			s.unwatch(rep)
+		}
+		delete(s.masters, m.name)
+		logger.Notice("-monitor", "master", m.name)
+		s.persistOrWarn()
+		return protocol.OK
+	}
+	return protocol.ErrorReply("ERR unknown subcommand")
+}
+
+// resetMaster forgets what the sentinel learnt around a master: its
+// replicas, the other sentinels and a failover in progress. The caller
+// holds s.mu.
+func (s *Sentinel) resetMaster(m *master) {
+	for _, rep := range m.replicas {
+		s.unwatch(rep)
+	}
+	m.replicas = make(map[string]*instance)
+	m.sentinels = make(map[string]*peer)
+	m.failoverState, m.promoted, m.odown = failoverNone, nil, false
+	logger.Notice("+reset-master", "master", m.name, "addr", m.inst.addr)
+}
+
+// masterFields describes a master for SENTINEL MASTERS and MASTER. The
+// caller holds s.mu.
+func (s *Sentinel) masterFields(m *master, now time.Time) []string {
+	flags := "master"
+	if m.inst.sdown {
+		flags += ",s_down"
+	}
+	if m.odown {
+		flags += ",o_down"
+	}
+	if m.failoverState != failoverNone {
+		flags += ",failover_in_progress"
+	}
+	fields := []string{
+		"name", m.name,
+		"ip", m.inst.host,
+		"port", m.inst.port,
+		"runid", m.inst.runID,
+		"flags", flags,
+	}
+	fields = append(fields, instanceFields(m.inst, now)...)
+	fields = append(fields,
+		"config-epoch", strconv.FormatInt(m.configEpoch, 10),
+		"num-slaves", strconv.Itoa(len(m.replicas)),
+		"num-other-sentinels", strconv.Itoa(len(m.sentinels)),
+		"quorum", strconv.Itoa(m.quorum),
+		"down-after-milliseconds", strconv.FormatInt(m.downAfter.Milliseconds(), 10),
+		"failover-timeout", strconv.FormatInt(m.failoverTimeout.Milliseconds(), 10),
+	)
+	if m.failoverState != failoverNone {
+		fields = append(fields, "failover-state", failoverStateNames[m.failoverState])
+	}
+	return fields
+}
+
+// replicaFields describes a replica for SENTINEL REPLICAS. The caller
+// holds s.mu.
+func (s *Sentinel) replicaFields(m *master, rep *instance, now time.Time) []string {
+	flags := "slave"
+	if rep.sdown {
+		flags += ",s_down"
+	}
+	if rep == m.promoted {
+		flags += ",promoted"
+	}
+	fields := []string{
+		"name", rep.addr,
+		"ip", rep.host,
+		"port", rep.port,
+		"runid", rep.runID,
+		"flags", flags,
+	}
+	fields = append(fields, instanceFields(rep, now)...)
+	masterHost, masterPort, _ := net.SplitHostPort(rep.masterAddr)
+	linkStatus := "err"
+	if rep.linkUp {
+		linkStatus = "ok"
+	}
+	return append(fields,
+		"master-link-status", linkStatus,
+		"master-host", masterHost,
+		"master-port", masterPort,
+		"slave-priority", strconv.Itoa(rep.priority),
+		"slave-repl-offset", strconv.FormatInt(rep.offset, 10),
+	)
+}
+
+// instanceFields are the fields masters and replicas share.
+func instanceFields(inst *instance, now time.Time) []string {
+	return []string{
+		"last-ok-ping-reply", millisSince(now, inst.lastOK),
+		"info-refresh", millisSince(now, inst.infoTime),
+		"role-reported", inst.role,
+		"role-reported-time", millisSince(now, inst.reportedSince),
+	}
+}
+
+func peerFields(m *master, p *peer, now time.Time) []string {
+	host, port, _ := net.SplitHostPort(p.addr)
+	flags := "sentinel"
+	if now.Sub(p.lastOK) > m.downAfter {
+		flags += ",s_down"
+	}
+	return []string{
+		"name", p.runID,
+		"ip", host,
+		"port", port,
+		"runid", p.runID,
+		"flags", flags,
+		"last-ok-ping-reply", millisSince(now, p.lastOK),
+		"last-hello-message", millisSince(now, p.lastHello),
+		"voted-leader", cmp.Or(p.leader, "?"),
+		"voted-leader-epoch", strconv.FormatInt(p.leaderEpoch, 10),
+	}
+}
+
+// millisSince returns the milliseconds since t, or since the sentinel
+// knows nothing of t, zero.
+func millisSince(now, t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(now.Sub(t).Milliseconds(), 10)
+}
+
+// sortedInstances returns the instances ordered by address.
+func sortedInstances(instances map[string]*instance) []*instance {
+	list := make([]*instance, 0, len(instances))
+	for _, inst := range instances {
+		list = append(list, inst)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].addr < list[j].addr })
+	return list
+}
+
+// sortedPeers returns the sentinels ordered by address.
+func sortedPeers(peers map[string]*peer) []*peer {
+	list := make([]*peer, 0, len(peers))
+	for _, p := range peers {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].addr < list[j].addr })
+	return list
+}
+
+// info is the sentinel's INFO reply.
+func (s *Sentinel) info() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Server\r\nredis_mode:sentinel\r\nrun_id:%s\r\ntcp_port:%d\r\n\r\n", s.runID, s.cfg.Port)
+	fmt.Fprintf(&b, "# Sentinel\r\nsentinel_masters:%d\r\nsentinel_current_epoch:%d\r\n", len(s.masters), s.currentEpoch)
+	for i, m := range s.sortedMasters() {
+		status := "ok"
+		if m.odown {
+			status = "odown"
+		} else if m.inst.sdown {
+			status = "sdown"
+		}
+		fmt.Fprintf(&b, "master%d:name=%s,status=%s,address=%s,slaves=%d,sentinels=%d\r\n",
+			i, m.name, status, m.inst.addr, len(m.replicas), len(m.sentinels)+1)
+	}
+	return b.String()
+}
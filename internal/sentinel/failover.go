@@ -0,0 +1,236 @@
+// File: internal/sentinel/failover.go
+
+package sentinel
+
+import (
+	"basic-go-redis/pkg/logger"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// checkFailover starts a failover of a primary a quorum finds down, once
+// the last attempt is old enough, and sees whether this sentinel won the
+// election it asked for. The caller holds s.mu.
+func (s *Sentinel) checkFailover(m *master, now time.Time) {
+	switch m.failoverState {
+	case failoverNone:
+		if !m.odown || now.Sub(m.failoverStart) < 2*m.failoverTimeout {
+			return
+		}
+		if m.startAt.IsZero() {
+			m.startAt = now.Add(rand.N(maxDesync))
+		}
+		if now.Before(m.startAt) {
+			return
+		}
+		m.startAt = time.Time{}
+		s.currentEpoch++
+		m.failoverState, m.failoverEpoch, m.failoverStart = failoverWaitStart, s.currentEpoch, now
+		m.leader, m.leaderEpoch = s.runID, s.currentEpoch
+		logger.Warning("+new-epoch", "epoch", s.currentEpoch)
+		logger.Warning("+try-failover", "master", m.name, "addr", m.inst.addr)
+		s.persistOrWarn()
+		m.lastAsk = now
+		s.askOthers(m)
+
+	case failoverWaitStart:
+		leader, votes := s.electedLeader(m)
+		if leader == s.runID {
+			logger.Warning("+elected-leader", "master", m.name, "epoch", m.failoverEpoch, "votes", votes)
+			s.startFailover(m)
+			return
+		}
+		if timeout := min(electionTimeout, m.failoverTimeout); now.Sub(m.failoverStart) > timeout {
+			logger.Warning("-failover-abort-not-elected", "master", m.name, "addr", m.inst.addr)
+			m.failoverState = failoverNone
+		}
+	}
+}
+
+// electedLeader counts the votes of the failover's epoch, this sentinel's
+// own and those the others sent back, and returns the sentinel that has
+// both a majority and a quorum, if one has. The caller holds s.mu.
+func (s *Sentinel) electedLeader(m *master) (string, int) {
+	counts := make(map[string]int)
+	if m.leaderEpoch == m.failoverEpoch {
+		counts[m.leader]++
+	}
+	for _, p := range m.sentinels {
+		if p.leaderEpoch == m.failoverEpoch && p.leader != "" {
+			counts[p.leader]++
+		}
+	}
+	voters := len(m.sentinels) + 1
+	for leader, votes := range counts {
+		if votes >= voters/2+1 && votes >= m.quorum {
+			return leader, votes
+		}
+	}
+	return "", 0
+}
+
+// vote gives this sentinel's vote for the epoch to the sentinel runID,
+// unless it voted in that epoch already, and returns the leader it voted
+// for and when. Having voted for another, it doesn't try a failover of
+// its own for a while. The caller holds s.mu.
+func (s *Sentinel) vote(m *master, epoch int64, runID string) (string, int64) {
+	if epoch > s.currentEpoch {
+		s.currentEpoch = epoch
+		logger.Notice("+new-epoch", "epoch", epoch)
+		s.persistOrWarn()
+	}
+	if m.leaderEpoch < epoch && s.currentEpoch <= epoch {
+		m.leader, m.leaderEpoch = runID, s.currentEpoch
+		logger.Notice("+vote-for-leader", "master", m.name, "leader", runID, "epoch", m.leaderEpoch)
+		s.persistOrWarn()
+		if runID != s.runID {
+			m.failoverStart = time.Now().Add(rand.N(maxDesync))
+		}
+	}
+	return m.leader, m.leaderEpoch
+}
+
+// startFailover promotes the best replica of m and reconfigures the rest,
+// in the background. The caller holds s.mu.
+func (s *Sentinel) startFailover(m *master) {
+	m.failoverState = failoverRunning
+	epoch := m.failoverEpoch
+	s.goTask(func() { s.failover(m, epoch) })
+}
+
+// failover runs the failover of epoch: it sends REPLICAOF NO ONE to the
+// replica it selects, waits for it to report itself a primary, makes it
+// the primary of m and points the other replicas at it.
+func (s *Sentinel) failover(m *master, epoch int64) {
+	// The election can end before the replicas' INFO is read again, and
+	// their offsets matter now
+	s.mu.Lock()
+	replicas := sortedInstances(m.replicas)
+	s.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, rep := range replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.refreshInfo(m, rep)
+		}()
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	rep := s.selectReplica(m, time.Now())
+	if rep == nil {
+		logger.Warning("-failover-abort-no-good-slave", "master", m.name, "addr", m.inst.addr)
+		m.failoverState = failoverNone
+		s.mu.Unlock()
+		return
+	}
+	m.promoted = rep
+	deadline := m.failoverStart.Add(m.failoverTimeout)
+	logger.Warning("+selected-slave", "master", m.name, "addr", rep.addr)
+	s.mu.Unlock()
+
+	promoted := false
+	if err := s.do(rep.addr, "REPLICAOF", "NO", "ONE").Err(); err == nil {
+		logger.Warning("+failover-state-wait-promotion", "master", m.name, "addr", rep.addr)
+	}
+	for time.Now().Before(deadline) {
+		info, err := s.do(rep.addr, "INFO", "replication").Text()
+		if err == nil && parseInfo(info)["role"] == "master" {
+			promoted = true
+			break
+		}
+		select {
+		case <-s.shutdown:
+			return
+		case <-time.After(pingPeriod):
+		}
+		s.do(rep.addr, "REPLICAOF", "NO", "ONE")
+	}
+
+	s.mu.Lock()
+	if m.failoverState != failoverRunning || m.failoverEpoch != epoch {
+		// A newer configuration arrived in the meantime
+		s.mu.Unlock()
+		return
+	}
+	if !promoted {
+		logger.Warning("-failover-abort-slave-timeout", "master", m.name, "addr", rep.addr)
+		m.failoverState, m.promoted = failoverNone, nil
+		s.mu.Unlock()
+		return
+	}
+	logger.Warning("+promoted-slave", "master", m.name, "addr", rep.addr)
+	m.configEpoch = epoch
+	s.switchMaster(m, rep.addr)
+	var others []string
+	for addr := range m.replicas {
+		others = append(others, addr)
+	}
+	s.persistOrWarn()
+	s.mu.Unlock()
+	s.announce()
+
+	// The replicas that are down, such as the former primary, are
+	// reconfigured once they are back
+	for _, addr := range others {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.do(addr, "REPLICAOF", rep.host, rep.port).Err(); err == nil {
+				logger.Notice("+slave-reconf-sent", "master", m.name, "addr", addr)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	if m.failoverEpoch == epoch {
+		m.failoverState, m.promoted = failoverNone, nil
+	}
+	s.mu.Unlock()
+	logger.Warning("+failover-end", "master", m.name, "addr", rep.addr)
+}
+
+// selectReplica returns the replica to promote: of those that are up,
+// answered INFO lately and don't have priority 0, the one with the
+// lowest priority, then the one with the most of the stream, then the
+// one with the smallest run ID. The caller holds s.mu.
+func (s *Sentinel) selectReplica(m *master, now time.Time) *instance {
+	infoValidity := 3 * infoPeriod
+	if m.inst.sdown {
+		infoValidity = 5 * time.Second
+	}
+	var candidates []*instance
+	for _, rep := range m.replicas {
+		if rep.sdown || rep.role != "slave" || rep.priority == 0 ||
+			now.Sub(rep.lastOK) > 5*pingPeriod || now.Sub(rep.infoTime) > infoValidity {
+			continue
+		}
+		candidates = append(candidates, rep)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.priority != b.priority {
+			return a.priority < b.priority
+		}
+		if a.offset != b.offset {
+			return a.offset > b.offset
+		}
+		return strings.Compare(a.runID, b.runID) < 0
+	})
+	return candidates[0]
+}
+
+// persistOrWarn saves the state, logging a failure to. The caller holds s.mu.
+func (s *Sentinel) persistOrWarn() {
+	if err := s.persist(); err != nil {
+		logger.Warning("Can't save the sentinel state", "err", err)
+	}
+}
@@ -0,0 +1,291 @@
+// File: internal/sentinel/monitor.go
+
+package sentinel
+
+import (
+	"basic-go-redis/pkg/client"
+	"basic-go-redis/pkg/logger"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// watch starts the goroutine that pings inst every pingPeriod and reads
+// its INFO as often as the failover state asks. The caller holds s.mu.
+func (s *Sentinel) watch(m *master, inst *instance) {
+	s.goTask(func() {
+		ticker := time.NewTicker(pingPeriod)
+		defer ticker.Stop()
+		for {
+			s.ping(inst)
+			if s.infoDue(m, inst) {
+				s.refreshInfo(m, inst)
+			}
+			select {
+			case <-s.shutdown:
+				return
+			case <-inst.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// unwatch stops watching inst. The caller holds s.mu.
+func (s *Sentinel) unwatch(inst *instance) {
+	select {
+	case <-inst.stop:
+	default:
+		close(inst.stop)
+	}
+}
+
+// ping records a valid reply to PING. A server loading its dataset or
+// whose primary is down answers with an error, but is up.
+func (s *Sentinel) ping(inst *instance) {
+	s.mu.Lock()
+	if inst.pingSent.IsZero() {
+		inst.pingSent = time.Now()
+	}
+	s.mu.Unlock()
+	err := s.do(inst.addr, "PING").Err()
+	var reply client.Error
+	if err != nil && !(errors.As(err, &reply) && (strings.HasPrefix(string(reply), "LOADING") || strings.HasPrefix(string(reply), "MASTERDOWN"))) {
+		return
+	}
+	s.mu.Lock()
+	inst.lastOK, inst.pingSent = time.Now(), time.Time{}
+	s.mu.Unlock()
+}
+
+// infoDue reports whether it is time to read inst's INFO: every
+// infoPeriod, and every second for the replicas of a primary that looks
+// down or is failing over, whose offsets decide which one is promoted.
+func (s *Sentinel) infoDue(m *master, inst *instance) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	period := infoPeriod
+	if inst != m.inst && (m.inst.sdown || m.failoverState != failoverNone) {
+		period = time.Second
+	}
+	return time.Since(inst.infoTime) >= period
+}
+
+// refreshInfo reads inst's INFO, learns of the replicas a primary lists
+// and fixes the configuration of instances that don't follow the primary
+// as they should.
+func (s *Sentinel) refreshInfo(m *master, inst *instance) {
+	info, err := s.do(inst.addr, "INFO").Text()
+	if err != nil {
+		return
+	}
+	fields := parseInfo(info)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst.infoTime = now
+	inst.runID = fields["run_id"]
+	role, masterAddr := fields["role"], ""
+	if role == "slave" {
+		masterAddr = net.JoinHostPort(fields["master_host"], fields["master_port"])
+		inst.linkUp = fields["master_link_status"] == "up"
+		inst.offset, _ = strconv.ParseInt(fields["slave_repl_offset"], 10, 64)
+		if priority, err := strconv.Atoi(fields["slave_priority"]); err == nil {
+			inst.priority = priority
+		}
+	}
+	if role != inst.role || masterAddr != inst.masterAddr {
+		inst.role, inst.masterAddr, inst.reportedSince = role, masterAddr, now
+	}
+
+	if inst == m.inst && role == "master" {
+		for key, value := range fields {
+			if !strings.HasPrefix(key, "slave") || !strings.HasPrefix(value, "ip=") {
+				continue
+			}
+			replica := parseReplicaLine(value)
+			addr := net.JoinHostPort(replica["ip"], replica["port"])
+			if _, ok := m.replicas[addr]; ok || addr == m.inst.addr {
+				continue
+			}
+			rep := newInstance(addr)
+			m.replicas[addr] = rep
+			s.watch(m, rep)
+			logger.Notice("+slave", "master", m.name, "addr", addr)
+			s.persistOrWarn()
+		}
+	}
+	if inst != m.inst {
+		s.reconfigure(m, inst, now)
+	}
+}
+
+// reconfigure points a replica that reports itself a primary, such as a
+// failed primary that came back, or that follows another primary, at
+// ours. It waits a few hello periods first, in case our configuration is
+// the stale one, and only acts while our primary is healthy.
+func (s *Sentinel) reconfigure(m *master, inst *instance, now time.Time) {
+	if m.failoverState != failoverNone || inst.role == "" || now.Sub(inst.reportedSince) < reconfigureWait ||
+		now.Sub(inst.lastReconf) < reconfigureWait || !s.masterLooksSane(m, now) {
+		return
+	}
+	var event string
+	switch {
+	case inst.role == "master":
+		event = "+convert-to-slave"
+	case inst.role == "slave" && inst.masterAddr != m.inst.addr:
+		event = "+fix-slave-config"
+	default:
+		return
+	}
+	inst.lastReconf = now
+	logger.Notice(event, "master", m.name, "addr", inst.addr)
+	host, port := m.inst.host, m.inst.port
+	s.goTask(func() { s.do(inst.addr, "REPLICAOF", host, port) })
+}
+
+// masterLooksSane reports whether m's primary is up and says it is one.
+// The caller holds s.mu.
+func (s *Sentinel) masterLooksSane(m *master, now time.Time) bool {
+	return !m.inst.sdown && m.inst.role == "master" && now.Sub(m.inst.infoTime) < 2*infoPeriod
+}
+
+// timer checks every primary ten times a second: whether it is down,
+// whether enough sentinels agree, and how its failover goes.
+func (s *Sentinel) timer() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.shutdown:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for _, m := range s.masters {
+				s.checkSubjectivelyDown(m, now)
+				s.checkObjectivelyDown(m, now)
+				if m.inst.sdown && now.Sub(m.lastAsk) >= askPeriod {
+					m.lastAsk = now
+					s.askOthers(m)
+				}
+				s.checkFailover(m, now)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// checkSubjectivelyDown marks the instances that have left a PING
+// unanswered for down-after-milliseconds as down. The caller holds s.mu.
+func (s *Sentinel) checkSubjectivelyDown(m *master, now time.Time) {
+	check := func(inst *instance) {
+		down := !inst.pingSent.IsZero() && now.Sub(inst.pingSent) > m.downAfter
+		if down != inst.sdown {
+			inst.sdown = down
+			event := "-sdown"
+			if down {
+				event = "+sdown"
+			}
+			role := "slave"
+			if inst == m.inst {
+				role = "master"
+			}
+			logger.Notice(event, "role", role, "master", m.name, "addr", inst.addr)
+		}
+	}
+	check(m.inst)
+	for _, inst := range m.replicas {
+		check(inst)
+	}
+}
+
+// checkObjectivelyDown marks the primary down for good once a quorum of
+// sentinels, this one included, finds it down. The caller holds s.mu.
+func (s *Sentinel) checkObjectivelyDown(m *master, now time.Time) {
+	votes := 0
+	if m.inst.sdown {
+		votes = 1
+		for _, p := range m.sentinels {
+			if p.masterDown && now.Sub(p.replyTime) < askValidity {
+				votes++
+			}
+		}
+	}
+	odown := votes >= m.quorum
+	if odown != m.odown {
+		m.odown = odown
+		if odown {
+			logger.Warning("+odown", "master", m.name, "addr", m.inst.addr, "quorum", strconv.Itoa(votes)+"/"+strconv.Itoa(m.quorum))
+		} else {
+			logger.Notice("-odown", "master", m.name, "addr", m.inst.addr)
+			m.startAt = time.Time{}
+		}
+	}
+}
+
+// askOthers asks every other sentinel whether it finds m's primary down,
+// and, while this one is waiting to be elected, for its vote. The caller
+// holds s.mu.
+func (s *Sentinel) askOthers(m *master) {
+	runID, epoch := "*", s.currentEpoch
+	if m.failoverState == failoverWaitStart {
+		runID, epoch = s.runID, m.failoverEpoch
+	}
+	args := []string{"SENTINEL", "IS-MASTER-DOWN-BY-ADDR", m.inst.host, m.inst.port, strconv.FormatInt(epoch, 10), runID}
+	for _, p := range m.sentinels {
+		if p.asking {
+			continue
+		}
+		p.asking = true
+		s.goTask(func() {
+			reply, err := s.do(p.addr, args...).Result()
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			p.asking = false
+			items, ok := reply.([]interface{})
+			if err != nil || !ok || len(items) != 3 {
+				return
+			}
+			down, _ := items[0].(int64)
+			leader, _ := items[1].(string)
+			epoch, _ := items[2].(int64)
+			p.lastOK, p.replyTime = time.Now(), time.Now()
+			p.masterDown = down == 1
+			if leader != "*" {
+				p.leader, p.leaderEpoch = leader, epoch
+			}
+		})
+	}
+}
+
+// parseInfo returns the fields of an INFO reply.
+func parseInfo(info string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// parseReplicaLine returns the fields of a slaveN line of INFO, such as
+// "ip=127.0.0.1,port=6380,state=online,offset=42,lag=0".
+func parseReplicaLine(line string) map[string]string {
+	fields := make(map[string]string)
+	for _, part := range strings.Split(line, ",") {
+		if key, value, ok := strings.Cut(part, "="); ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
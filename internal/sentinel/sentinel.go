@@ -0,0 +1,635 @@
+// File: internal/sentinel/sentinel.go
+
+// Package sentinel monitors primaries and their replicas and fails a
+// primary over to one of its replicas when enough sentinels agree it is
+// down, as Redis Sentinel does. Sentinels talk RESP to the servers they
+// watch and to each other; clients ask any of them where a primary is
+// with SENTINEL GET-MASTER-ADDR-BY-NAME.
+//
+// The servers have no pub/sub, so rather than meeting on a channel of the
+// primary, sentinels send each other the same hello message directly with
+// SENTINEL HELLO. Each one greets the sentinels it was started with and
+// those it hears from, and learns the others from their replies.
+package sentinel
+
+import (
+	"basic-go-redis/pkg/client"
+	"basic-go-redis/pkg/logger"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Periods of the background tasks, as Redis Sentinel has them.
+const (
+	pingPeriod      = time.Second      // PING every instance
+	infoPeriod      = 10 * time.Second // INFO every instance, every second in a failover
+	helloPeriod     = 2 * time.Second  // greet every sentinel
+	askPeriod       = time.Second      // ask the others about a primary that looks down
+	askValidity     = 5 * time.Second  // how long another sentinel's answer counts
+	reconfigureWait = 4 * helloPeriod  // how long an instance must misreport its role before we fix it
+	maxDesync       = time.Second      // random delay that keeps sentinels from all starting at once
+	electionTimeout = 10 * time.Second // at most; failover-timeout if shorter
+	requestTimeout  = time.Second
+)
+
+// Defaults of the MasterConfig fields.
+const (
+	DefaultDownAfter       = 30 * time.Second
+	DefaultFailoverTimeout = 3 * time.Minute
+)
+
+// Config configures a Sentinel.
+type Config struct {
+	// Port is the port the sentinel listens on, 26379 if zero.
+	Port int
+	// AnnounceIP is the address other sentinels reach this one at,
+	// 127.0.0.1 if empty.
+	AnnounceIP string
+	// Masters are the primaries to monitor.
+	Masters []MasterConfig
+	// Sentinels are the host:port addresses of other sentinels to greet
+	// at first. The rest are learnt from them.
+	Sentinels []string
+	// StateFile, if set, is where the sentinel keeps its run ID, its
+	// epochs and where each primary is now, so that it survives a
+	// restart. Once the file exists it takes over from Masters.
+	StateFile string
+}
+
+// MasterConfig names a primary to monitor.
+type MasterConfig struct {
+	Name string
+	Host string
+	Port int
+	// Quorum is how many sentinels must find the primary down before
+	// one of them fails it over.
+	Quorum int
+	// DownAfter is how long the primary may go without answering PING
+	// before a sentinel finds it down.
+	DownAfter time.Duration
+	// FailoverTimeout bounds a failover; a failed one is retried after
+	// twice as long.
+	FailoverTimeout time.Duration
+}
+
+// Sentinel monitors primaries and fails them over.
+type Sentinel struct {
+	cfg   Config
+	runID string
+	addr  string // host:port other sentinels reach us at
+
+	mu           sync.Mutex
+	currentEpoch int64
+	masters      map[string]*master
+	seeds        map[string]bool // addresses of sentinels to greet besides the known ones
+	clients      map[string]*client.Client
+
+	listener net.Listener
+	helloNow chan struct{}
+	shutdown chan struct{}
+	closed   sync.Once
+	wg       sync.WaitGroup
+}
+
+// Failover states of a master.
+const (
+	failoverNone      = iota
+	failoverWaitStart // waiting to be elected leader
+	failoverRunning   // promoting a replica and reconfiguring the rest
+)
+
+var failoverStateNames = []string{"none", "wait_start", "running"}
+
+// master is a monitored primary with what the sentinel knows around it.
+// Its fields are guarded by Sentinel.mu.
+type master struct {
+	name            string
+	quorum          int
+	downAfter       time.Duration
+	failoverTimeout time.Duration
+	configEpoch     int64
+
+	inst      *instance
+	replicas  map[string]*instance // by host:port
+	sentinels map[string]*peer     // by host:port
+
+	// The leader this sentinel voted for, and in which epoch
+	leader      string
+	leaderEpoch int64
+
+	odown         bool
+	startAt       time.Time // when to start the failover a quorum asked for
+	lastAsk       time.Time
+	failoverState int
+	failoverEpoch int64
+	failoverStart time.Time // of the last attempt, or the block a vote for another set
+	promoted      *instance
+}
+
+// instance is a server the sentinel watches, the primary or one of its
+// replicas. Its fields are guarded by Sentinel.mu.
+type instance struct {
+	host, port string
+	addr       string
+	stop       chan struct{}
+
+	lastOK        time.Time // last valid reply to PING
+	pingSent      time.Time // of the oldest PING not answered yet, zero if none
+	sdown         bool
+	infoTime      time.Time
+	runID         string
+	role          string
+	masterAddr    string // the primary a replica follows
+	linkUp        bool
+	offset        int64
+	priority      int
+	reportedSince time.Time // when the role or the primary it reported last changed
+	lastReconf    time.Time
+}
+
+// peer is another sentinel monitoring the same primary. Its fields are
+// guarded by Sentinel.mu.
+type peer struct {
+	addr      string
+	runID     string
+	lastHello time.Time
+	lastOK    time.Time // last reply to anything we asked
+
+	// Its last answer to SENTINEL IS-MASTER-DOWN-BY-ADDR
+	asking      bool
+	replyTime   time.Time
+	masterDown  bool
+	leader      string
+	leaderEpoch int64
+}
+
+// New returns a sentinel for cfg, with its state loaded from
+// cfg.StateFile if that exists.
+func New(cfg Config) (*Sentinel, error) {
+	if cfg.Port == 0 {
+		cfg.Port = 26379
+	}
+	if cfg.AnnounceIP == "" {
+		cfg.AnnounceIP = "127.0.0.1"
+	}
+	s := &Sentinel{
+		cfg:      cfg,
+		runID:    newRunID(),
+		addr:     net.JoinHostPort(cfg.AnnounceIP, strconv.Itoa(cfg.Port)),
+		masters:  make(map[string]*master),
+		seeds:    make(map[string]bool),
+		clients:  make(map[string]*client.Client),
+		helloNow: make(chan struct{}, 1),
+		shutdown: make(chan struct{}),
+	}
+	for _, addr := range cfg.Sentinels {
+		if addr != s.addr {
+			s.seeds[addr] = true
+		}
+	}
+	loaded, err := s.loadState()
+	if err != nil {
+		return nil, err
+	}
+	if !loaded {
+		for _, mc := range cfg.Masters {
+			if err := s.addMaster(mc); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// addMaster starts monitoring the primary mc describes. The caller holds
+// s.mu or the sentinel hasn't started.
+func (s *Sentinel) addMaster(mc MasterConfig) error {
+	if mc.Name == "" {
+		return errors.New("a master needs a name")
+	}
+	if _, ok := s.masters[mc.Name]; ok {
+		return fmt.Errorf("duplicated master name %q", mc.Name)
+	}
+	if mc.Port <= 0 || mc.Port > 65535 {
+		return fmt.Errorf("master %s: invalid port %d", mc.Name, mc.Port)
+	}
+	if mc.Quorum <= 0 {
+		return fmt.Errorf("master %s: quorum must be 1 or greater", mc.Name)
+	}
+	if mc.DownAfter <= 0 {
+		mc.DownAfter = DefaultDownAfter
+	}
+	if mc.FailoverTimeout <= 0 {
+		mc.FailoverTimeout = DefaultFailoverTimeout
+	}
+	m := &master{
+		name:            mc.Name,
+		quorum:          mc.Quorum,
+		downAfter:       mc.DownAfter,
+		failoverTimeout: mc.FailoverTimeout,
+		replicas:        make(map[string]*instance),
+		sentinels:       make(map[string]*peer),
+	}
+	m.inst = newInstance(net.JoinHostPort(mc.Host, strconv.Itoa(mc.Port)))
+	s.masters[m.name] = m
+	return nil
+}
+
+func newInstance(addr string) *instance {
+	host, port, _ := net.SplitHostPort(addr)
+	now := time.Now()
+	return &instance{host: host, port: port, addr: addr, stop: make(chan struct{}), pingSent: now, priority: 100}
+}
+
+// Start listens for clients and other sentinels and starts monitoring.
+// It returns once the listener is open.
+func (s *Sentinel) Start() error {
+	var err error
+	s.listener, err = net.Listen("tcp", ":"+strconv.Itoa(s.cfg.Port))
+	if err != nil {
+		return err
+	}
+	logger.Notice("Sentinel listening", "port", s.cfg.Port, "id", s.runID)
+
+	s.mu.Lock()
+	for _, m := range s.masters {
+		logger.Notice("+monitor", "master", m.name, "addr", m.inst.addr, "quorum", m.quorum)
+		s.watchAll(m)
+	}
+	s.persistOrWarn()
+	s.mu.Unlock()
+
+	s.wg.Add(3)
+	go s.acceptLoop()
+	go s.timer()
+	go s.greeter()
+	return nil
+}
+
+// Addr returns the address the sentinel listens on.
+func (s *Sentinel) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops the sentinel and waits for its goroutines.
+func (s *Sentinel) Close() error {
+	var err error
+	s.closed.Do(func() {
+		close(s.shutdown)
+		if s.listener != nil {
+			err = s.listener.Close()
+		}
+		s.wg.Wait()
+		s.mu.Lock()
+		for _, c := range s.clients {
+			c.Close()
+		}
+		s.mu.Unlock()
+	})
+	return err
+}
+
+// watchAll starts watching a master's instances. The caller holds s.mu.
+func (s *Sentinel) watchAll(m *master) {
+	s.watch(m, m.inst)
+	for _, inst := range m.replicas {
+		s.watch(m, inst)
+	}
+}
+
+// client returns the client for the server or sentinel at addr. The
+// caller holds s.mu.
+func (s *Sentinel) client(addr string) *client.Client {
+	c, ok := s.clients[addr]
+	if !ok {
+		c = client.New(&client.Options{
+			Addr:        addr,
+			DialTimeout: requestTimeout,
+			ReadTimeout: requestTimeout,
+			PoolSize:    4,
+			IdleTimeout: -1,
+		})
+		s.clients[addr] = c
+	}
+	return c
+}
+
+// do runs a command on the server or sentinel at addr.
+func (s *Sentinel) do(addr string, args ...string) *client.Cmd {
+	s.mu.Lock()
+	c := s.client(addr)
+	s.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	return c.Do(ctx, args...)
+}
+
+// goTask runs fn in a goroutine Close waits for.
+func (s *Sentinel) goTask(fn func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		fn()
+	}()
+}
+
+// greeter sends every other sentinel this one knows its hello for each
+// primary, every helloPeriod or as soon as a primary moved.
+func (s *Sentinel) greeter() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(helloPeriod)
+	defer ticker.Stop()
+	for {
+		s.greet()
+		select {
+		case <-s.shutdown:
+			return
+		case <-ticker.C:
+		case <-s.helloNow:
+		}
+	}
+}
+
+// announce asks the greeter to send hellos now.
+func (s *Sentinel) announce() {
+	select {
+	case s.helloNow <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Sentinel) greet() {
+	s.mu.Lock()
+	targets := make(map[string]bool)
+	for addr := range s.seeds {
+		targets[addr] = true
+	}
+	for _, m := range s.masters {
+		for addr := range m.sentinels {
+			targets[addr] = true
+		}
+	}
+	var hellos [][]string
+	for _, m := range s.masters {
+		hellos = append(hellos, []string{"SENTINEL", "HELLO",
+			s.cfg.AnnounceIP, strconv.Itoa(s.cfg.Port), s.runID, strconv.FormatInt(s.currentEpoch, 10),
+			m.name, m.inst.host, m.inst.port, strconv.FormatInt(m.configEpoch, 10)})
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for addr := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, hello := range hellos {
+				s.sendHello(addr, hello)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// sendHello sends one hello and adds the sentinels the reply names to
+// those to greet.
+func (s *Sentinel) sendHello(addr string, hello []string) {
+	known, err := s.do(addr, hello...).Strings()
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m := s.masters[hello[6]]; m != nil {
+		if p := m.sentinels[addr]; p != nil {
+			p.lastOK = time.Now()
+		}
+	}
+	for _, other := range known {
+		if other != s.addr {
+			s.seeds[other] = true
+		}
+	}
+}
+
+// hello handles another sentinel's hello: it learns of the sentinel, of
+// a newer epoch and of where the primary is, if the sentinel's
+// configuration of it is newer than ours. It returns the other sentinels
+// we know for the primary.
+func (s *Sentinel) hello(host, port, runID string, currentEpoch int64, name, masterHost, masterPort string, configEpoch int64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.masters[name]
+	if m == nil {
+		return nil, errNoSuchMaster
+	}
+	addr := net.JoinHostPort(host, port)
+	if runID == s.runID || addr == s.addr {
+		return nil, nil
+	}
+	now := time.Now()
+	changed := false
+	p := m.sentinels[addr]
+	if p == nil || p.runID != runID {
+		// A sentinel that moved, or restarted with a new ID, replaces its
+		// old entry
+		for other, q := range m.sentinels {
+			if q.runID == runID && other != addr {
+				delete(m.sentinels, other)
+			}
+		}
+		if p == nil {
+			p = &peer{addr: addr}
+			m.sentinels[addr] = p
+		}
+		p.runID = runID
+		changed = true
+		logger.Notice("+sentinel", "master", m.name, "addr", addr, "id", runID)
+	}
+	p.lastHello, p.lastOK = now, now
+	delete(s.seeds, addr)
+
+	if currentEpoch > s.currentEpoch {
+		s.currentEpoch = currentEpoch
+		changed = true
+		logger.Notice("+new-epoch", "epoch", currentEpoch)
+	}
+	if configEpoch > m.configEpoch {
+		newAddr := net.JoinHostPort(masterHost, masterPort)
+		logger.Notice("+config-update-from", "master", m.name, "sentinel", addr, "epoch", configEpoch)
+		if newAddr != m.inst.addr {
+			s.switchMaster(m, newAddr)
+		}
+		m.configEpoch = configEpoch
+		if m.failoverState != failoverNone && m.failoverEpoch < configEpoch {
+			m.failoverState, m.promoted = failoverNone, nil
+		}
+		changed = true
+	}
+	if changed {
+		s.persistOrWarn()
+	}
+
+	known := make([]string, 0, len(m.sentinels))
+	for other := range m.sentinels {
+		if other != addr {
+			known = append(known, other)
+		}
+	}
+	sort.Strings(known)
+	return known, nil
+}
+
+// switchMaster makes the instance at addr the primary of m, and the
+// former primary one of its replicas. The caller holds s.mu.
+func (s *Sentinel) switchMaster(m *master, addr string) {
+	old := m.inst
+	logger.Notice("+switch-master", "master", m.name, "from", old.addr, "to", addr)
+	inst := m.replicas[addr]
+	if inst != nil {
+		delete(m.replicas, addr)
+	} else {
+		inst = newInstance(addr)
+		s.watch(m, inst)
+	}
+	m.inst = inst
+	inst.sdown = false
+
+	// The former primary is a replica now, as it will be told once it
+	// is back
+	old.role, old.masterAddr, old.reportedSince = "", "", time.Now()
+	m.replicas[old.addr] = old
+	m.odown, m.startAt = false, time.Time{}
+	for _, p := range m.sentinels {
+		p.masterDown = false
+	}
+}
+
+// state is what the state file holds.
+type state struct {
+	RunID        string        `json:"run_id"`
+	CurrentEpoch int64         `json:"current_epoch"`
+	Masters      []masterState `json:"masters"`
+}
+
+type masterState struct {
+	Name              string            `json:"name"`
+	Host              string            `json:"host"`
+	Port              int               `json:"port"`
+	Quorum            int               `json:"quorum"`
+	DownAfterMillis   int64             `json:"down_after_milliseconds"`
+	FailoverTimeoutMs int64             `json:"failover_timeout"`
+	ConfigEpoch       int64             `json:"config_epoch"`
+	LeaderEpoch       int64             `json:"leader_epoch"`
+	Replicas          []string          `json:"known_replicas,omitempty"`
+	Sentinels         map[string]string `json:"known_sentinels,omitempty"` // host:port to run ID
+}
+
+// persist writes the state file, if there is one. The caller holds s.mu.
+func (s *Sentinel) persist() error {
+	if s.cfg.StateFile == "" {
+		return nil
+	}
+	st := state{RunID: s.runID, CurrentEpoch: s.currentEpoch}
+	for _, m := range s.sortedMasters() {
+		port, _ := strconv.Atoi(m.inst.port)
+		ms := masterState{
+			Name:              m.name,
+			Host:              m.inst.host,
+			Port:              port,
+			Quorum:            m.quorum,
+			DownAfterMillis:   m.downAfter.Milliseconds(),
+			FailoverTimeoutMs: m.failoverTimeout.Milliseconds(),
+			ConfigEpoch:       m.configEpoch,
+			LeaderEpoch:       m.leaderEpoch,
+			Sentinels:         make(map[string]string),
+		}
+		for addr := range m.replicas {
+			ms.Replicas = append(ms.Replicas, addr)
+		}
+		sort.Strings(ms.Replicas)
+		for addr, p := range m.sentinels {
+			ms.Sentinels[addr] = p.runID
+		}
+		st.Masters = append(st.Masters, ms)
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.cfg.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.cfg.StateFile)
+}
+
+// loadState reads the state file, reporting whether there was one.
+func (s *Sentinel) loadState() (bool, error) {
+	if s.cfg.StateFile == "" {
+		return false, nil
+	}
+	data, err := os.ReadFile(s.cfg.StateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return false, fmt.Errorf("%s: %w", s.cfg.StateFile, err)
+	}
+	if st.RunID != "" {
+		s.runID = st.RunID
+	}
+	s.currentEpoch = st.CurrentEpoch
+	for _, ms := range st.Masters {
+		err := s.addMaster(MasterConfig{
+			Name:            ms.Name,
+			Host:            ms.Host,
+			Port:            ms.Port,
+			Quorum:          ms.Quorum,
+			DownAfter:       time.Duration(ms.DownAfterMillis) * time.Millisecond,
+			FailoverTimeout: time.Duration(ms.FailoverTimeoutMs) * time.Millisecond,
+		})
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", s.cfg.StateFile, err)
+		}
+		m := s.masters[ms.Name]
+		m.configEpoch, m.leaderEpoch = ms.ConfigEpoch, ms.LeaderEpoch
+		for _, addr := range ms.Replicas {
+			m.replicas[addr] = newInstance(addr)
+		}
+		for addr, runID := range ms.Sentinels {
+			m.sentinels[addr] = &peer{addr: addr, runID: runID}
+		}
+	}
+	return true, nil
+}
+
+// sortedMasters returns the masters ordered by name. The caller holds s.mu.
+func (s *Sentinel) sortedMasters() []*master {
+	list := make([]*master, 0, len(s.masters))
+	for _, m := range s.masters {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
+
+// newRunID returns 40 random hex characters, as Redis's run ids are.
+func newRunID() string {
+	b := make([]byte, 20)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
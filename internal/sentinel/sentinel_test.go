@@ -0,0 +1,115 @@
+package sentinel
+
+import (
+	"basic-go-redis/internal/server"
+	"basic-go-redis/pkg/client"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eventually polls cond for up to timeout.
+func eventually(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func do(addr string, args ...string) *client.Cmd {
+	c := client.New(&client.Options{Addr: addr})
+	defer c.Close()
+	return c.Do(context.Background(), args...)
+}
+
+func TestFailover(t *testing.T) {
+	ports := []string{"12418", "12419", "12420"}
+	servers := make([]*server.Server, len(ports))
+	for i, port := range ports {
+		servers[i] = server.NewServer(port)
+		go servers[i].Start()
+		if i > 0 {
+			defer servers[i].Close() // The primary is closed below
+		}
+	}
+	time.Sleep(500 * time.Millisecond)
+	for _, port := range ports[1:] {
+		if err := do("127.0.0.1:"+port, "REPLICAOF", "127.0.0.1", ports[0]).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := do("127.0.0.1:"+ports[0], "SET", "k", "v").Err(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, 5*time.Second, "the replicas to sync", func() bool {
+		info, _ := do("127.0.0.1:"+ports[0], "INFO", "replication").Text()
+		return strings.Count(info, "state=online") == 2
+	})
+
+	// Three sentinels, each started knowing only the first
+	sentinels := make([]*Sentinel, 3)
+	for i := range sentinels {
+		s, err := New(Config{
+			Port:      12421 + i,
+			Masters:   []MasterConfig{{Name: "mymaster", Host: "127.0.0.1", Port: 12418, Quorum: 2, DownAfter: time.Second, FailoverTimeout: 5 * time.Second}},
+			Sentinels: []string{"127.0.0.1:12421"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		sentinels[i] = s
+	}
+	for i := range sentinels {
+		addr := fmt.Sprintf("127.0.0.1:%d", 12421+i)
+		eventually(t, 10*time.Second, "sentinels and replicas to be discovered", func() bool {
+			info, _ := do(addr, "INFO").Text()
+			return strings.Contains(info, "status=ok,address=127.0.0.1:12418,slaves=2,sentinels=3")
+		})
+	}
+	if reply, _ := do("127.0.0.1:12421", "SENTINEL", "CKQUORUM", "mymaster").Text(); !strings.HasPrefix(reply, "OK 3 usable Sentinels") {
+		t.Errorf("CKQUORUM = %q", reply)
+	}
+	if err := do("127.0.0.1:12421", "SENTINEL", "GET-MASTER-ADDR-BY-NAME", "nosuch").Err(); err != client.Nil {
+		t.Errorf("GET-MASTER-ADDR-BY-NAME of an unknown master: %v", err)
+	}
+
+	// Once the primary goes away, every sentinel agrees on one replica
+	// and the other replica follows it
+	servers[0].Close()
+	var newPort string
+	eventually(t, 15*time.Second, "the failover", func() bool {
+		var addrs []string
+		for i := range sentinels {
+			addr, err := do(fmt.Sprintf("127.0.0.1:%d", 12421+i), "SENTINEL", "GET-MASTER-ADDR-BY-NAME", "mymaster").Strings()
+			if err != nil || addr[1] == ports[0] {
+				return false
+			}
+			addrs = append(addrs, addr[1])
+		}
+		newPort = addrs[0]
+		return addrs[1] == newPort && addrs[2] == newPort
+	})
+	other := ports[1]
+	if newPort == ports[1] {
+		other = ports[2]
+	}
+	if role, _ := do("127.0.0.1:"+newPort, "ROLE").Strings(); role[0] != "master" {
+		t.Errorf("ROLE of the promoted replica = %q", role)
+	}
+	eventually(t, 5*time.Second, "the other replica to follow the new primary", func() bool {
+		role, _ := do("127.0.0.1:"+other, "ROLE").Strings()
+		return len(role) == 5 && role[2] == newPort && role[3] == "connected"
+	})
+	if v, _ := do("127.0.0.1:"+other, "GET", "k").Text(); v != "v" {
+		t.Errorf("GET k on the other replica = %q", v)
+	}
+}
@@ -0,0 +1,487 @@
+// File: internal/server/aof.go
+
+package server
+
+import (
+	"basic-go-redis/internal/protocol"
+	"basic-go-redis/internal/store"
+	"basic-go-redis/pkg/logger"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// aofItemsPerCommand is how many members the ZADD commands rebuilding a
+// sorted set add at a time.
+const aofItemsPerCommand = 64
+
+// aofRewriteDrainSize is how much of the writes buffered during a rewrite
+// may be left to append to the new file while writes wait.
+const aofRewriteDrainSize = 64 * 1024
+
+var errRewriteInProgress = errors.New("Background append only file rewriting already in progress")
+
+// aofState is the append-only file, which logs every write command.
+type aofState struct {
+	mu        sync.Mutex
+	file      *os.File // nil while the AOF is off
+	pending   []byte   // Commands not yet written to the file
+	size      int64
+	writeErr  error // The last write failed, so write commands are refused
+	fsyncing  bool  // An appendfsync everysec fsync is running
+	lastFsync time.Time
+
+	// A rewrite writes the dataset to a new file while the writes made
+	// meanwhile are kept in rewriteBuf, to be appended to it
+	rewriting       bool
+	rewriteBuf      []byte
+	rewriteStarted  time.Time
+	lastRewriteOK   bool
+	lastRewriteTime time.Duration
+	rewrites        int64
+	baseSize        int64 // Size after the last rewrite, which growth is measured from
+}
+
+func (s *Server) aofPath() string {
+	return filepath.Join(s.config.Get("dir"), s.config.Get("appendfilename"))
+}
+
+// feedAOF logs a write command that succeeded. With appendfsync always,
+// the file is synced before the reply is sent.
+func (s *Server) feedAOF(args [][]byte) {
+	a := &s.aof
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return
+	}
+	start := len(a.pending)
+	a.pending = protocol.AppendCommand(a.pending, args)
+	if a.rewriting {
+		a.rewriteBuf = append(a.rewriteBuf, a.pending[start:]...)
+	}
+	s.writeAOF(s.config.Get("appendfsync") == "always")
+}
+
+// writeAOF writes the pending commands, syncing the file if asked. What a
+// failed write leaves is kept for the next try. The caller holds a.mu.
+func (s *Server) writeAOF(sync bool) {
+	a := &s.aof
+	n, err := a.file.Write(a.pending)
+	a.size += int64(n)
+	a.pending = a.pending[:copy(a.pending, a.pending[n:])]
+	if err == nil && sync {
+		if err = a.file.Sync(); err == nil {
+			a.lastFsync = time.Now()
+		}
+	}
+	if err != nil {
+		if a.writeErr == nil {
+			logger.Warning("Error writing to the AOF file, refusing writes", "err", err)
+		}
+		a.writeErr = err
+		return
+	}
+	if a.writeErr != nil {
+		logger.Notice("AOF write error looks solved, accepting writes again")
+		a.writeErr = nil
+	}
+}
+
+// aofError returns the error that makes write commands refused, if any.
+func (s *Server) aofError() error {
+	s.aof.mu.Lock()
+	defer s.aof.mu.Unlock()
+	return s.aof.writeErr
+}
+
+// aofCron retries a failed write and, with appendfsync everysec, syncs the
+// file in the background. cron calls it every second.
+func (s *Server) aofCron() {
+	a := &s.aof
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return
+	}
+	if len(a.pending) > 0 {
+		s.writeAOF(false)
+	}
+	if s.config.Get("appendfsync") != "everysec" || a.fsyncing || a.writeErr != nil {
+		return
+	}
+	a.fsyncing = true
+	file := a.file
+	go func() {
+		err := file.Sync()
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.fsyncing = false
+		if a.file != file {
+			return // Closed meanwhile
+		}
+		if err != nil {
+			logger.Warning("Error syncing the AOF file", "err", err)
+			return
+		}
+		a.lastFsync = time.Now()
+	}()
+}
+
+// openAOF starts logging write commands to the end of path.
+func (s *Server) openAOF(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.aof.mu.Lock()
+	s.aof.file, s.aof.size, s.aof.baseSize = file, info.Size(), info.Size()
+	s.aof.mu.Unlock()
+	return nil
+}
+
+// rewriteAOF starts writing a new AOF holding the fewest commands that
+// rebuild the dataset, and fails if a rewrite is running already. The
+// writes made meanwhile are buffered and appended to the new file, which
+// then replaces the old one.
+func (s *Server) rewriteAOF() error {
+	// No write runs between taking the snapshot and buffering the writes
+	// that follow it
+	s.writeOrder.Lock()
+	a := &s.aof
+	a.mu.Lock()
+	if a.rewriting {
+		a.mu.Unlock()
+		s.writeOrder.Unlock()
+		return errRewriteInProgress
+	}
+	a.rewriting, a.rewriteBuf, a.rewriteStarted = true, nil, time.Now()
+	snap := s.store.Snapshot()
+	a.mu.Unlock()
+	s.writeOrder.Unlock()
+
+	path := s.aofPath()
+	logger.Notice("Background append only file rewriting started", "path", path)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		err := s.finishRewrite(snap, path)
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.rewriting, a.rewriteBuf = false, nil
+		a.lastRewriteTime = time.Since(a.rewriteStarted)
+		a.lastRewriteOK = err == nil
+		if err != nil {
+			logger.Warning("Background append only file rewriting failed", "path", path, "err", err)
+			return
+		}
+		a.rewrites++
+		logger.Notice("Background AOF rewrite finished successfully", "path", path, "size", a.size)
+	}()
+	return nil
+}
+
+// finishRewrite writes snap and the writes buffered since to a new file
+// and moves it over path.
+func (s *Server) finishRewrite(snap *store.Snapshot, path string) error {
+	tmp, err := writeAOFTemp(snap, path)
+	snap.Release()
+	if err != nil {
+		return err
+	}
+	if err := s.appendRewriteBuffer(tmp, path); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// appendRewriteBuffer appends the writes buffered during a rewrite to tmp
+// and moves it over path, making it the AOF.
+func (s *Server) appendRewriteBuffer(tmp *os.File, path string) error {
+	// Append what was buffered while writes carry on, until little is
+	// left, then the rest with writes held back
+	a := &s.aof
+	for {
+		a.mu.Lock()
+		buffered := a.rewriteBuf
+		if len(buffered) <= aofRewriteDrainSize {
+			break
+		}
+		a.rewriteBuf = nil
+		a.mu.Unlock()
+		if _, err := tmp.Write(buffered); err != nil {
+			return err
+		}
+	}
+	defer a.mu.Unlock()
+	if _, err := tmp.Write(a.rewriteBuf); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// The new file replaces the old one, and stays open for appending
+	if a.file == nil {
+		tmp.Close()
+	} else {
+		a.file.Close()
+		a.file, a.pending = tmp, a.pending[:0]
+	}
+	a.size, a.baseSize = info.Size(), info.Size()
+	return nil
+}
+
+// rewriteAOFOnGrowth starts a rewrite once the AOF has grown by
+// auto-aof-rewrite-percentage since the last one and is at least
+// auto-aof-rewrite-min-size. cron calls it every second.
+func (s *Server) rewriteAOFOnGrowth() {
+	percentage := s.config.Int("auto-aof-rewrite-percentage")
+	a := &s.aof
+	a.mu.Lock()
+	size, base, due := a.size, a.baseSize, a.file != nil && !a.rewriting && percentage > 0
+	a.mu.Unlock()
+	if !due || size < s.config.Int("auto-aof-rewrite-min-size") {
+		return
+	}
+	if base == 0 {
+		base = 1
+	}
+	if growth := (size - base) * 100 / base; growth >= percentage {
+		logger.Notice("Starting automatic rewriting of AOF", "growth_percent", growth)
+		s.rewriteAOF()
+	}
+}
+
+// closeAOF writes what is pending, syncs the file and closes it.
+func (s *Server) closeAOF() error {
+	a := &s.aof
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	if len(a.pending) > 0 {
+		s.writeAOF(false)
+	}
+	err := a.file.Sync()
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	a.file = nil
+	return err
+}
+
+// writeAOFFile writes the commands rebuilding snap to a temporary file,
+// which is then renamed to path.
+func writeAOFFile(snap *store.Snapshot, path string) error {
+	tmp, err := writeAOFTemp(snap, path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = tmp.Sync()
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeAOFTemp writes the commands rebuilding snap to a temporary file
+// next to path, and returns it open for appending more.
+func writeAOFTemp(snap *store.Snapshot, path string) (*os.File, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "temp-rewriteaof-*.aof")
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriterSize(tmp, 64*1024)
+	err = writeDatasetCommands(w, snap)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// writeDatasetCommands writes the fewest commands that rebuild snap: a SET
+// or ZADDs for each key, and PEXPIREAT for those with a TTL.
+func writeDatasetCommands(w *bufio.Writer, snap *store.Snapshot) error {
+	var buf []byte
+	return snap.Each(func(e store.Entry) error {
+		key := []byte(e.Key)
+		buf = buf[:0]
+		if e.ZSet == nil {
+			buf = protocol.AppendCommand(buf, [][]byte{[]byte("SET"), key, []byte(e.String)})
+		} else {
+			args := [][]byte{[]byte("ZADD"), key}
+			for member, score := range e.ZSet {
+				args = append(args, []byte(strconv.FormatFloat(score, 'g', -1, 64)), []byte(member))
+				if len(args) == 2+2*aofItemsPerCommand {
+					buf = protocol.AppendCommand(buf, args)
+					args = args[:2]
+				}
+			}
+			if len(args) > 2 {
+				buf = protocol.AppendCommand(buf, args)
+			}
+		}
+		if !e.ExpireAt.IsZero() {
+			at := strconv.FormatInt(e.ExpireAt.UnixMilli(), 10)
+			buf = protocol.AppendCommand(buf, [][]byte{[]byte("PEXPIREAT"), key, []byte(at)})
+		}
+		_, err := w.Write(buf)
+		return err
+	})
+}
+
+// startAOF loads the dataset when the AOF is on: from the AOF if there is
+// one, and otherwise from the snapshot, which starts a new AOF.
+func (s *Server) startAOF() error {
+	path := s.aofPath()
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		if err := s.loadRDB(); err != nil {
+			return err
+		}
+		snap := s.store.Snapshot()
+		err := writeAOFFile(snap, path)
+		snap.Release()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		logger.Notice("Created the append only file", "path", path)
+	} else if err != nil {
+		return err
+	} else {
+		start := time.Now()
+		commands, err := s.loadAOF(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		logger.Notice("DB loaded from append only file", "path", path, "commands", commands, "seconds", time.Since(start).Seconds())
+	}
+	return s.openAOF(path)
+}
+
+// loadAOF runs the commands of an AOF and returns how many it ran. A file
+// that ends in the middle of a command, as a crash can leave it, is cut
+// back to the last whole command if aof-load-truncated allows it.
+func (s *Server) loadAOF(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	var read atomic.Int64
+	reader := protocol.NewReader(countingReader{f, &read})
+	// Commands are run for a client without a connection. The file holds
+	// writes already accepted, so like those from the primary's link they
+	// skip the checks made on clients' writes, and cluster redirects: the
+	// slots aren't loaded yet
+	fake := &client{log: logger.With("aof", path), master: true}
+	valid, commands := int64(0), 0
+	for {
+		args, err := reader.ReadCommand()
+		if err != nil {
+			if valid == info.Size() {
+				break
+			}
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return commands, fmt.Errorf("bad file format at byte %d: %w", valid, err)
+			}
+			if !s.config.Bool("aof-load-truncated") {
+				return commands, fmt.Errorf("the file is truncated at byte %d; set aof-load-truncated to yes to load it anyway", valid)
+			}
+			logger.Warning("The append only file is truncated, removing the last incomplete command", "path", path, "offset", valid)
+			if err := os.Truncate(path, valid); err != nil {
+				return commands, err
+			}
+			break
+		}
+		if len(args) > 0 {
+			if reply := s.executeCommand(fake, args); len(reply) > 0 && reply[0] == '-' {
+				fake.log.Warning("Command in the append only file failed", "command", string(args[0]), "reply", reply[1:len(reply)-2])
+			}
+			commands++
+		}
+		valid = read.Load() - int64(reader.Buffered())
+	}
+	s.dirty.Store(0)
+	return commands, nil
+}
+
+func writeAOFInfo(s *Server, b *infoBuilder) {
+	a := &s.aof
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	enabled, status := 0, "ok"
+	if a.file != nil {
+		enabled = 1
+	}
+	if a.writeErr != nil {
+		status = "err"
+	}
+	rewriting, current, last, rewriteStatus := 0, int64(-1), int64(-1), "ok"
+	if a.rewriting {
+		rewriting, current = 1, int64(time.Since(a.rewriteStarted).Seconds())
+	}
+	if a.rewrites > 0 || !a.lastRewriteOK {
+		last = int64(a.lastRewriteTime.Seconds())
+	}
+	if !a.lastRewriteOK {
+		rewriteStatus = "err"
+	}
+	b.field("aof_enabled", enabled)
+	b.field("aof_rewrite_in_progress", rewriting)
+	b.field("aof_rewrites", a.rewrites)
+	b.field("aof_last_rewrite_time_sec", last)
+	b.field("aof_current_rewrite_time_sec", current)
+	b.field("aof_last_bgrewrite_status", rewriteStatus)
+	b.field("aof_last_write_status", status)
+	if a.file != nil {
+		b.field("aof_current_size", a.size)
+		b.field("aof_base_size", a.baseSize)
+		b.field("aof_buffer_length", len(a.pending))
+		b.field("aof_rewrite_buffer_length", len(a.rewriteBuf))
+	}
+}
+
+func bgrewriteaofCommand(s *Server, c *client, args [][]byte) string {
+	if err := s.rewriteAOF(); err != nil {
+		return protocol.ErrorReply("ERR " + err.Error())
+	}
+	return protocol.SimpleString("Background append only file rewriting started")
+}
@@ -0,0 +1,489 @@
+// File: internal/server/client.go
+
+package server
+
+import (
+	"basic-go-redis/internal/protocol"
+	"basic-go-redis/pkg/logger"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// client is a connection to the server and what it knows about it.
+type client struct {
+	id      int64
+	conn    net.Conn
+	addr    string // Remote address, ip:port
+	laddr   string // Local address the client connected to
+	created time.Time
+	log     *logger.Logger // Adds the client's id and address to messages
+
+	// Reported by CLIENT LIST and changed as commands run, guarded by mu
+	mu              sync.Mutex
+	name            string
+	db              int
+	lastCmd         string
+	lastInteraction time.Time
+	queryBuffer     int // Bytes received and not yet executed
+	outputBuffer    int // Bytes of replies not yet sent
+	noEvict         bool
+	master          bool     // The link to this replica's primary, or the AOF being loaded
+	replica         *replica // Set once a replica's PSYNC succeeded
+
+	// Only touched by the connection's own goroutine
+	replyOff        bool     // CLIENT REPLY OFF
+	skipReply       bool     // CLIENT REPLY SKIP: drop the next reply
+	closeAfterReply bool     // CLIENT KILL of itself
+	rewritten       [][]byte // The running command as the AOF logs it, if not as sent
+	listeningPort   string   // Sent by a replica with REPLCONF
+	writeOffset     int64    // Replication offset after the client's last write, for WAIT
+	asking          bool     // ASKING: the next command may use a slot being imported
+}
+
+// newClient registers a client for conn.
+func (s *Server) newClient(conn net.Conn) *client {
+	now := time.Now()
+	c := &client{
+		id:              s.nextClientID.Add(1),
+		conn:            conn,
+		addr:            conn.RemoteAddr().String(),
+		laddr:           conn.LocalAddr().String(),
+		created:         now,
+		lastInteraction: now,
+	}
+	c.log = logger.With("client_id", c.id, "addr", c.addr)
+	s.connLock.Lock()
+	s.clients[c.id] = c
+	s.connLock.Unlock()
+	return c
+}
+
+// rewriteArgs makes the AOF log the running command as args, such as an
+// expiry relative to now as the time it expires at. Without args the
+// command isn't logged, nor counted as a change.
+func (c *client) rewriteArgs(args ...string) {
+	c.rewritten = make([][]byte, len(args))
+	for i, arg := range args {
+		c.rewritten[i] = []byte(arg)
+	}
+}
+
+// unlinkClient forgets c once its connection is closed.
+func (s *Server) unlinkClient(c *client) {
+	s.connLock.Lock()
+	delete(s.clients, c.id)
+	s.connLock.Unlock()
+}
+
+func (s *Server) clientCount() int {
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	return len(s.clients)
+}
+
+// clientList returns the clients ordered by ID.
+func (s *Server) clientList() []*client {
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	list := make([]*client, 0, len(s.clients))
+	for _, c := range s.clients {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+	return list
+}
+
+// setName changes the name CLIENT LIST shows for c.
+func (c *client) setName(name string) {
+	c.mu.Lock()
+	c.name = name
+	c.mu.Unlock()
+}
+
+func (c *client) getName() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.name
+}
+
+// flags are the letters CLIENT LIST shows for the client's state, N when
+// there are none.
+func (c *client) flags() string {
+	var flags string
+	if c.master {
+		flags += "M"
+	}
+	if c.replica != nil {
+		flags += "S"
+	}
+	if c.noEvict {
+		flags += "e"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+	return flags
+}
+
+// info describes c in the format of CLIENT LIST and CLIENT INFO.
+func (c *client) info() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	cmd := c.lastCmd
+	if cmd == "" {
+		cmd = "NULL"
+	}
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s age=%d idle=%d flags=%s db=%d sub=0 psub=0 multi=-1 qbuf=%d obl=%d oll=0 omem=0 events=r cmd=%s user=default resp=2",
+		c.id, c.addr, c.laddr, c.name,
+		int64(now.Sub(c.created).Seconds()), int64(now.Sub(c.lastInteraction).Seconds()),
+		c.flags(), c.db, c.queryBuffer, c.outputBuffer, cmd)
+}
+
+// validClientName reports whether name may be set with CLIENT SETNAME,
+// which like Redis refuses spaces, newlines and other special characters.
+func validClientName(name string) bool {
+	return !strings.ContainsFunc(name, func(r rune) bool { return r < '!' || r > '~' })
+}
+
+// pauseState is the pause set by CLIENT PAUSE.
+type pauseState struct {
+	mu      sync.Mutex
+	end     time.Time
+	all     bool          // Every command is held back, not only writes
+	resumed chan struct{} // Closed by CLIENT UNPAUSE
+}
+
+// pauseClients holds back writes, or every command, for d. A pause already
+// in effect is extended, never shortened or relaxed.
+func (s *Server) pauseClients(d time.Duration, all bool) {
+	p := &s.pause
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	end := time.Now().Add(d)
+	if time.Now().Before(p.end) {
+		all = all || p.all
+		if p.end.After(end) {
+			end = p.end
+		}
+	}
+	if p.resumed == nil {
+		p.resumed = make(chan struct{})
+	}
+	p.end, p.all = end, all
+}
+
+// unpauseClients lets the commands held back by CLIENT PAUSE run.
+func (s *Server) unpauseClients() {
+	p := &s.pause
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumed != nil {
+		close(p.resumed)
+		p.resumed = nil
+	}
+	p.end = time.Time{}
+}
+
+// paused reports whether a CLIENT PAUSE is in effect.
+func (s *Server) paused() bool {
+	s.pause.mu.Lock()
+	defer s.pause.mu.Unlock()
+	return time.Now().Before(s.pause.end)
+}
+
+// waitWhilePaused blocks while a pause holds cmd back.
+func (s *Server) waitWhilePaused(cmd *command) {
+	for {
+		p := &s.pause
+		p.mu.Lock()
+		remaining := time.Until(p.end)
+		holds := remaining > 0 && (p.all || cmd.flags&flagWrite != 0)
+		resumed := p.resumed
+		p.mu.Unlock()
+		if !holds {
+			return
+		}
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-resumed:
+		case <-timer.C:
+		case <-s.shutdownChan:
+		}
+		timer.Stop()
+		select {
+		case <-s.shutdownChan:
+			return
+		default:
+		}
+	}
+}
+
+// killClient closes target's connection. A client killing itself gets the
+// reply first.
+func killClient(c, target *client) {
+	if target == c {
+		c.closeAfterReply = true
+		return
+	}
+	target.conn.Close()
+}
+
+func clientIDCommand(s *Server, c *client, args [][]byte) string {
+	return protocol.Integer(c.id)
+}
+
+func clientGetNameCommand(s *Server, c *client, args [][]byte) string {
+	if name := c.getName(); name != "" {
+		return protocol.BulkString(name)
+	}
+	return protocol.NullBulkString
+}
+
+func clientSetNameCommand(s *Server, c *client, args [][]byte) string {
+	name := string(args[2])
+	if !validClientName(name) {
+		return protocol.ErrorReply("ERR Client names cannot contain spaces, newlines or special characters.")
+	}
+	c.setName(name)
+	return protocol.OK
+}
+
+func clientInfoCommand(s *Server, c *client, args [][]byte) string {
+	return protocol.BulkString(c.info() + "\n")
+}
+
+// clientListCommand lists the clients, or those of a TYPE or with the given IDs.
+func clientListCommand(s *Server, c *client, args [][]byte) string {
+	var ids map[int64]bool
+	switch {
+	case len(args) == 2:
+	case len(args) == 4 && strings.EqualFold(string(args[2]), "type"):
+		switch typ := strings.ToLower(string(args[3])); typ {
+		case "normal":
+		case "master", "replica", "slave", "pubsub":
+			return protocol.BulkString("") // Every client is a normal one
+		default:
+			return protocol.ErrorReply(fmt.Sprintf("ERR Unknown client type '%s'", args[3]))
+		}
+	case len(args) > 3 && strings.EqualFold(string(args[2]), "id"):
+		ids = make(map[int64]bool)
+		for _, arg := range args[3:] {
+			id, err := strconv.ParseInt(string(arg), 10, 64)
+			if err != nil || id <= 0 {
+				return protocol.ErrorReply("ERR Invalid client ID")
+			}
+			ids[id] = true
+		}
+	default:
+		return syntaxError
+	}
+
+	var b strings.Builder
+	for _, other := range s.clientList() {
+		if ids == nil || ids[other.id] {
+			b.WriteString(other.info())
+			b.WriteByte('\n')
+		}
+	}
+	return protocol.BulkString(b.String())
+}
+
+// clientKillCommand closes connections. CLIENT KILL addr closes one, while
+// filters (ID, ADDR, LADDR, USER, SKIPME, TYPE, MAXAGE) close every client
+// matching them all and count those closed.
+func clientKillCommand(s *Server, c *client, args [][]byte) string {
+	if len(args) == 3 {
+		addr := string(args[2])
+		for _, other := range s.clientList() {
+			if other.addr == addr {
+				killClient(c, other)
+				return protocol.OK
+			}
+		}
+		return protocol.ErrorReply("ERR No such client")
+	}
+	if len(args)%2 != 0 {
+		return syntaxError
+	}
+
+	var filters []func(*client) bool
+	skipMe := true
+	for i := 2; i < len(args); i += 2 {
+		value := string(args[i+1])
+		switch strings.ToLower(string(args[i])) {
+		case "id":
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				return protocol.ErrorReply("ERR client-id should be greater than 0")
+			}
+			filters = append(filters, func(other *client) bool { return other.id == id })
+		case "addr":
+			filters = append(filters, func(other *client) bool { return other.addr == value })
+		case "laddr":
+			filters = append(filters, func(other *client) bool { return other.laddr == value })
+		case "user":
+			filters = append(filters, func(other *client) bool { return value == "default" })
+		case "type":
+			switch strings.ToLower(value) {
+			case "normal":
+			case "master", "replica", "slave", "pubsub":
+				filters = append(filters, func(other *client) bool { return false })
+			default:
+				return protocol.ErrorReply(fmt.Sprintf("ERR Unknown client type '%s'", value))
+			}
+		case "skipme":
+			switch strings.ToLower(value) {
+			case "yes":
+				skipMe = true
+			case "no":
+				skipMe = false
+			default:
+				return syntaxError
+			}
+		case "maxage":
+			maxAge, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return syntaxError
+			}
+			filters = append(filters, func(other *client) bool {
+				return time.Since(other.created) >= time.Duration(maxAge)*time.Second
+			})
+		default:
+			return syntaxError
+		}
+	}
+
+	killed := 0
+	for _, other := range s.clientList() {
+		if skipMe && other == c {
+			continue
+		}
+		matches := true
+		for _, filter := range filters {
+			matches = matches && filter(other)
+		}
+		if matches {
+			killClient(c, other)
+			killed++
+		}
+	}
+	return protocol.Integer(int64(killed))
+}
+
+// clientPauseCommand holds back the commands of every client, or only the
+// writes, for the given milliseconds.
+func clientPauseCommand(s *Server, c *client, args [][]byte) string {
+	ms, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return protocol.ErrorReply("ERR timeout is not an integer or out of range")
+	}
+	if ms < 0 {
+		return protocol.ErrorReply("ERR timeout is negative")
+	}
+	all := true
+	if len(args) == 4 {
+		switch strings.ToLower(string(args[3])) {
+		case "all":
+		case "write":
+			all = false
+		default:
+			return syntaxError
+		}
+	} else if len(args) > 4 {
+		return syntaxError
+	}
+	s.pauseClients(time.Duration(ms)*time.Millisecond, all)
+	return protocol.OK
+}
+
+func clientUnpauseCommand(s *Server, c *client, args [][]byte) string {
+	s.unpauseClients()
+	return protocol.OK
+}
+
+// clientNoEvictCommand records whether the client is protected from
+// eviction, which CLIENT LIST shows with the e flag.
+func clientNoEvictCommand(s *Server, c *client, args [][]byte) string {
+	var noEvict bool
+	switch strings.ToLower(string(args[2])) {
+	case "on":
+		noEvict = true
+	case "off":
+	default:
+		return syntaxError
+	}
+	c.mu.Lock()
+	c.noEvict = noEvict
+	c.mu.Unlock()
+	return protocol.OK
+}
+
+// clientReplyCommand turns the client's replies off or on, or skips the
+// reply to the next command. Only ON is answered.
+func clientReplyCommand(s *Server, c *client, args [][]byte) string {
+	switch strings.ToLower(string(args[2])) {
+	case "on":
+		c.replyOff = false
+		return protocol.OK
+	case "off":
+		c.replyOff = true
+	case "skip":
+		c.skipReply = !c.replyOff
+	default:
+		return syntaxError
+	}
+	return ""
+}
+
+func clientHelpCommand(s *Server, c *client, args [][]byte) string {
+	return simpleStringArray(strings.Split(`CLIENT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:
+GETNAME
+    Return the name of the current connection.
+ID
+    Return the ID of the current connection.
+INFO
+    Return information about the current client connection.
+KILL <ip:port>
+    Kill connection made from <ip:port>.
+KILL <option> <value> [<option> <value> [...]]
+    Kill connections. Options are:
+    * ADDR (<ip:port>|<unixsocket>:0)
+      Kill connections made from the specified address
+    * LADDR (<ip:port>|<unixsocket>:0)
+      Kill connections made to specified local address
+    * TYPE (NORMAL|MASTER|REPLICA|PUBSUB)
+      Kill connections by type.
+    * USER <username>
+      Kill connections authenticated by <username>.
+    * SKIPME (YES|NO)
+      Skip killing current connection (default: yes).
+    * ID <client-id>
+      Kill connections by client id.
+    * MAXAGE <maxage>
+      Kill connections older than the specified age.
+LIST [options ...]
+    Return information about client connections. Options:
+    * TYPE (NORMAL|MASTER|REPLICA|PUBSUB)
+      Return clients of specified type.
+    * ID <client-id> [<client-id> ...]
+      Return clients of specified IDs only.
+PAUSE <timeout> [WRITE|ALL]
+    Suspend all, or just write, clients for <timeout> milliseconds.
+UNPAUSE
+    Stop the current client pause, resuming traffic.
+NO-EVICT (ON|OFF)
+    Protect current client connection from eviction.
+REPLY (ON|OFF|SKIP)
+    Control the replies sent to the current connection.
+SETNAME <name>
+    Assign the name <name> to the current connection.
+HELP
+    Print this help.`, "\n"))
+}
@@ -0,0 +1,992 @@
+// File: internal/server/cluster.go
+
+package server
+
+import (
+	"basic-go-redis/internal/protocol"
+	"basic-go-redis/pkg/logger"
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	clusterDisabledError = protocol.ErrorReply("ERR This instance has cluster support disabled")
+	crossSlotError       = protocol.ErrorReply("CROSSSLOT Keys in request don't hash to the same slot")
+	clusterDownError     = protocol.ErrorReply("CLUSTERDOWN The cluster is down")
+	slotUnboundError     = protocol.ErrorReply("CLUSTERDOWN Hash slot not served")
+	tryAgainError        = protocol.ErrorReply("TRYAGAIN Multiple keys request during rehashing of slot")
+)
+
+// forgetTTL is how long a node CLUSTER FORGET removed isn't added back
+// by gossip.
+const forgetTTL = time.Minute
+
+// nodeFlags are the states of a cluster node, as CLUSTER NODES lists them.
+type nodeFlags uint
+
+const (
+	nodeMyself    nodeFlags = 1 << iota
+	nodeMaster              // every node is one: there are no cluster replicas
+	nodePFail               // not answering, as far as this node knows
+	nodeFail                // not answering, as a majority of masters agrees
+	nodeHandshake           // met, but its ID isn't known yet
+)
+
+var nodeFlagNames = []struct {
+	flag nodeFlags
+	name string
+}{
+	{nodeMyself, "myself"},
+	{nodeMaster, "master"},
+	{nodePFail, "fail?"},
+	{nodeFail, "fail"},
+	{nodeHandshake, "handshake"},
+}
+
+func (f nodeFlags) String() string {
+	var names []string
+	for _, entry := range nodeFlagNames {
+		if f&entry.flag != 0 {
+			names = append(names, entry.name)
+		}
+	}
+	if len(names) == 0 {
+		return "noflags"
+	}
+	return strings.Join(names, ",")
+}
+
+// clusterNode is a node of the cluster, this one included. Its fields are
+// guarded by clusterState.mu.
+type clusterNode struct {
+	id          string
+	ip          string
+	port        int
+	flags       nodeFlags
+	configEpoch int64
+	numSlots    int
+
+	created      time.Time
+	pingSent     time.Time // of the oldest ping not answered yet, zero if none
+	pongReceived time.Time
+	lastAttempt  time.Time
+	failTime     time.Time
+	failReports  map[string]time.Time // by ID of the master reporting it
+
+	// The connection this node pings the other over. Only the goroutine
+	// running an exchange, while inflight is set, uses it.
+	inflight bool
+	conn     net.Conn
+	reader   *bufio.Reader
+}
+
+func (n *clusterNode) addr() string {
+	return net.JoinHostPort(n.ip, strconv.Itoa(n.port))
+}
+
+// clusterState is this node's view of the cluster.
+type clusterState struct {
+	mu            sync.Mutex
+	myself        *clusterNode
+	nodes         map[string]*clusterNode
+	forgotten     map[string]time.Time // IDs of nodes CLUSTER FORGET removed, until when
+	currentEpoch  int64
+	lastVoteEpoch int64
+	slots         [clusterSlots]*clusterNode
+	migrating     [clusterSlots]*clusterNode // slot to the node its keys move to
+	importing     [clusterSlots]*clusterNode // slot to the node its keys come from
+
+	ok   bool // cluster_state, whether this node serves queries
+	size int  // masters serving at least one slot
+	tick int
+
+	dirty    bool // the configuration changed since it was saved
+	sent     map[string]int64
+	received map[string]int64
+}
+
+// initCluster sets up cluster mode if cluster-enabled is on. The node has
+// a new ID until Start loads the one nodes.conf keeps.
+func (s *Server) initCluster() {
+	if !s.config.Bool("cluster-enabled") {
+		return
+	}
+	port, _ := strconv.Atoi(s.port)
+	myself := &clusterNode{id: newRunID(), ip: s.config.Get("cluster-announce-ip"), port: port, flags: nodeMyself | nodeMaster, created: time.Now()}
+	s.cluster = &clusterState{
+		myself:    myself,
+		nodes:     map[string]*clusterNode{myself.id: myself},
+		forgotten: make(map[string]time.Time),
+		sent:      make(map[string]int64),
+		received:  make(map[string]int64),
+	}
+	s.cluster.updateState(s.config.Bool("cluster-require-full-coverage"))
+}
+
+// clusterConfigPath is where the cluster configuration is saved.
+func (s *Server) clusterConfigPath() string {
+	return filepath.Join(s.config.Get("dir"), s.config.Get("cluster-config-file"))
+}
+
+// startCluster loads the cluster configuration, or saves a new one for a
+// node starting out.
+func (s *Server) startCluster() error {
+	cl := s.cluster
+	if cl == nil {
+		return nil
+	}
+	if s.config.Get("replicaof") != "" {
+		return errors.New("replicaof can't be set in cluster mode")
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	path := s.clusterConfigPath()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		logger.Notice("No cluster configuration found, I'm " + cl.myself.id)
+		return s.saveClusterConfig()
+	} else if err != nil {
+		return err
+	}
+	if err := cl.load(string(data)); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if ip := s.config.Get("cluster-announce-ip"); ip != "" {
+		cl.myself.ip = ip
+	}
+	cl.updateState(s.config.Bool("cluster-require-full-coverage"))
+	logger.Notice("Node configuration loaded, I'm " + cl.myself.id)
+	return nil
+}
+
+// saveClusterConfig writes the configuration as CLUSTER NODES lists it,
+// with the epochs after it, as Redis's nodes.conf holds it. The caller
+// holds cluster.mu.
+func (s *Server) saveClusterConfig() error {
+	cl := s.cluster
+	content := cl.nodesDescription(true) + fmt.Sprintf("vars currentEpoch %d lastVoteEpoch %d\n", cl.currentEpoch, cl.lastVoteEpoch)
+	path := s.clusterConfigPath()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	cl.dirty = false
+	return nil
+}
+
+// load reads a configuration saveClusterConfig wrote. The caller holds
+// cl.mu.
+func (cl *clusterState) load(data string) error {
+	nodes := make(map[string]*clusterNode)
+	var myself *clusterNode
+	type pending struct {
+		slot   int
+		nodeID string
+		into   *[clusterSlots]*clusterNode
+	}
+	var migrations []pending
+	owners := make(map[int]string)
+	for i, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "vars" {
+			for j := 1; j+1 < len(fields); j += 2 {
+				value, err := strconv.ParseInt(fields[j+1], 10, 64)
+				if err != nil {
+					return fmt.Errorf("line %d: bad %s", i+1, fields[j])
+				}
+				switch fields[j] {
+				case "currentEpoch":
+					cl.currentEpoch = value
+				case "lastVoteEpoch":
+					cl.lastVoteEpoch = value
+				}
+			}
+			continue
+		}
+		if len(fields) < 8 {
+			return fmt.Errorf("line %d: too few fields", i+1)
+		}
+		n := &clusterNode{id: fields[0], created: time.Now(), flags: nodeMaster}
+		hostPort, _, _ := strings.Cut(fields[1], "@")
+		host, port, err := net.SplitHostPort(hostPort)
+		if err != nil {
+			return fmt.Errorf("line %d: bad address %q", i+1, fields[1])
+		}
+		n.ip = host
+		n.port, _ = strconv.Atoi(port)
+		for _, flag := range strings.Split(fields[2], ",") {
+			if flag == "myself" {
+				n.flags |= nodeMyself
+				myself = n
+			}
+		}
+		if n.configEpoch, err = strconv.ParseInt(fields[6], 10, 64); err != nil {
+			return fmt.Errorf("line %d: bad config epoch", i+1)
+		}
+		for _, token := range fields[8:] {
+			if strings.HasPrefix(token, "[") {
+				// A migration: [slot->-target] or [slot-<-source]
+				token = strings.Trim(token, "[]")
+				into := &cl.migrating
+				slotStr, nodeID, ok := strings.Cut(token, "->-")
+				if !ok {
+					into = &cl.importing
+					slotStr, nodeID, ok = strings.Cut(token, "-<-")
+				}
+				slot, err := strconv.Atoi(slotStr)
+				if !ok || err != nil || slot < 0 || slot >= clusterSlots {
+					return fmt.Errorf("line %d: bad migration %q", i+1, token)
+				}
+				migrations = append(migrations, pending{slot, nodeID, into})
+				continue
+			}
+			first, last, err := parseSlotRange(token)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", i+1, err)
+			}
+			for slot := first; slot <= last; slot++ {
+				owners[slot] = n.id
+			}
+		}
+		nodes[n.id] = n
+	}
+	if myself == nil {
+		return errors.New("no node is marked myself")
+	}
+	myself.port = cl.myself.port
+	cl.myself, cl.nodes = myself, nodes
+	cl.slots = [clusterSlots]*clusterNode{}
+	for slot, id := range owners {
+		cl.assignSlot(slot, nodes[id])
+	}
+	for _, m := range migrations {
+		if n := nodes[m.nodeID]; n != nil {
+			m.into[m.slot] = n
+		}
+	}
+	return nil
+}
+
+// parseSlotRange reads "first-last" or a single slot.
+func parseSlotRange(token string) (int, int, error) {
+	firstStr, lastStr, isRange := strings.Cut(token, "-")
+	if !isRange {
+		lastStr = firstStr
+	}
+	first, err1 := strconv.Atoi(firstStr)
+	last, err2 := strconv.Atoi(lastStr)
+	if err1 != nil || err2 != nil || first < 0 || last >= clusterSlots || first > last {
+		return 0, 0, fmt.Errorf("bad slot range %q", token)
+	}
+	return first, last, nil
+}
+
+// assignSlot makes n, or nobody if nil, the owner of slot. The caller
+// holds cl.mu.
+func (cl *clusterState) assignSlot(slot int, n *clusterNode) {
+	if old := cl.slots[slot]; old != nil {
+		old.numSlots--
+	}
+	cl.slots[slot] = n
+	if n != nil {
+		n.numSlots++
+	}
+	cl.dirty = true
+}
+
+// slotRanges returns the slots n owns as ranges of consecutive slots.
+// The caller holds cl.mu.
+func (cl *clusterState) slotRanges(n *clusterNode) [][2]int {
+	var ranges [][2]int
+	for slot := 0; slot < clusterSlots; slot++ {
+		if cl.slots[slot] != n {
+			continue
+		}
+		if len(ranges) > 0 && ranges[len(ranges)-1][1] == slot-1 {
+			ranges[len(ranges)-1][1] = slot
+		} else {
+			ranges = append(ranges, [2]int{slot, slot})
+		}
+	}
+	return ranges
+}
+
+// updateState works out whether the cluster is up: every slot must be
+// served by a node that hasn't failed, unless full coverage isn't
+// required, and this node must reach a majority of the masters. The
+// caller holds cl.mu.
+func (cl *clusterState) updateState(requireFullCoverage bool) {
+	ok := true
+	if requireFullCoverage {
+		for _, n := range cl.slots {
+			if n == nil || n.flags&nodeFail != 0 {
+				ok = false
+				break
+			}
+		}
+	}
+	size, reachable := 0, 0
+	for _, n := range cl.nodes {
+		if n.numSlots > 0 {
+			size++
+			if n.flags&(nodePFail|nodeFail) == 0 {
+				reachable++
+			}
+		}
+	}
+	cl.size = size
+	if reachable < size/2+1 {
+		ok = false
+	}
+	if ok != cl.ok {
+		cl.ok = ok
+		state := "fail"
+		if ok {
+			state = "ok"
+		}
+		logger.Notice("Cluster state changed: " + state)
+	}
+}
+
+// clusterRedirect returns the reply sending c to the node that serves the
+// keys of the request, or "" if this node runs it. A request whose keys
+// are in different slots is refused. While a slot moves, a key the
+// source no longer has is asked for at the target with ASK, and the
+// target answers a client that sent ASKING first.
+func (s *Server) clusterRedirect(cmd *command, args [][]byte, asking bool) string {
+	positions := cmd.keysOf(args)
+	if len(positions) == 0 {
+		return ""
+	}
+	slot := keyHashSlot(string(args[positions[0]]))
+	for _, pos := range positions[1:] {
+		if keyHashSlot(string(args[pos])) != slot {
+			return crossSlotError
+		}
+	}
+
+	cl := s.cluster
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if !cl.ok {
+		return clusterDownError
+	}
+	n := cl.slots[slot]
+	if n == nil {
+		return slotUnboundError
+	}
+	migrating, importing := n == cl.myself && cl.migrating[slot] != nil, cl.importing[slot] != nil
+	missing := 0
+	if migrating || importing {
+		for _, pos := range positions {
+			if s.store.Type(string(args[pos])) == "none" {
+				missing++
+			}
+		}
+	}
+	switch {
+	case migrating && missing > 0:
+		if missing < len(positions) {
+			return tryAgainError
+		}
+		return protocol.ErrorReply(fmt.Sprintf("ASK %d %s", slot, cl.migrating[slot].addr()))
+	case importing && (asking || cmd.flags&flagAsking != 0):
+		if len(positions) > 1 && missing > 0 {
+			return tryAgainError
+		}
+		return ""
+	case n != cl.myself:
+		return protocol.ErrorReply(fmt.Sprintf("MOVED %d %s", slot, n.addr()))
+	}
+	return ""
+}
+
+// nodesDescription lists the nodes as CLUSTER NODES does, and nodes.conf
+// keeps them. The caller holds cl.mu.
+func (cl *clusterState) nodesDescription(forFile bool) string {
+	var b strings.Builder
+	for _, n := range cl.sortedNodes() {
+		if forFile && n.flags&nodeHandshake != 0 {
+			continue
+		}
+		link := "disconnected"
+		if n == cl.myself || (n.conn != nil && n.pingSent.IsZero()) {
+			link = "connected"
+		}
+		pingSent, pongReceived := int64(0), int64(0)
+		if n != cl.myself {
+			if !n.pingSent.IsZero() {
+				pingSent = n.pingSent.UnixMilli()
+			}
+			if !n.pongReceived.IsZero() {
+				pongReceived = n.pongReceived.UnixMilli()
+			}
+		}
+		fmt.Fprintf(&b, "%s %s:%d@%d %s - %d %d %d %s", n.id, n.ip, n.port, n.port, n.flags, pingSent, pongReceived, n.configEpoch, link)
+		for _, r := range cl.slotRanges(n) {
+			if r[0] == r[1] {
+				fmt.Fprintf(&b, " %d", r[0])
+			} else {
+				fmt.Fprintf(&b, " %d-%d", r[0], r[1])
+			}
+		}
+		if n == cl.myself {
+			for slot := 0; slot < clusterSlots; slot++ {
+				if target := cl.migrating[slot]; target != nil {
+					fmt.Fprintf(&b, " [%d->-%s]", slot, target.id)
+				}
+				if source := cl.importing[slot]; source != nil {
+					fmt.Fprintf(&b, " [%d-<-%s]", slot, source.id)
+				}
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// sortedNodes returns the nodes ordered by ID. The caller holds cl.mu.
+func (cl *clusterState) sortedNodes() []*clusterNode {
+	list := make([]*clusterNode, 0, len(cl.nodes))
+	for _, n := range cl.nodes {
+		list = append(list, n)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+	return list
+}
+
+// clusterOrError returns the state of an enabled cluster, or the error
+// a CLUSTER command replies with when cluster mode is off.
+func (s *Server) clusterOrError() (*clusterState, string) {
+	if s.cluster == nil {
+		return nil, clusterDisabledError
+	}
+	return s.cluster, ""
+}
+
+// saveClusterConfigOrError saves the configuration a CLUSTER command
+// changed before it replies. The caller holds cluster.mu.
+func (s *Server) saveClusterConfigOrError() string {
+	s.cluster.updateState(s.config.Bool("cluster-require-full-coverage"))
+	if err := s.saveClusterConfig(); err != nil {
+		return protocol.ErrorReply("ERR Error saving the cluster configuration: " + err.Error())
+	}
+	return protocol.OK
+}
+
+func askingCommand(s *Server, c *client, args [][]byte) string {
+	if s.cluster == nil {
+		return clusterDisabledError
+	}
+	c.asking = true
+	return protocol.OK
+}
+
+func clusterInfoCommand(s *Server, c *client, args [][]byte) string {
+	cl, errReply := s.clusterOrError()
+	if cl == nil {
+		return errReply
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	assigned, pfail, fail := 0, 0, 0
+	for _, n := range cl.slots {
+		if n == nil {
+			continue
+		}
+		assigned++
+		switch {
+		case n.flags&nodeFail != 0:
+			fail++
+		case n.flags&nodePFail != 0:
+			pfail++
+		}
+	}
+	state := "fail"
+	if cl.ok {
+		state = "ok"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "cluster_state:%s\r\n", state)
+	fmt.Fprintf(&b, "cluster_slots_assigned:%d\r\n", assigned)
+	fmt.Fprintf(&b, "cluster_slots_ok:%d\r\n", assigned-pfail-fail)
+	fmt.Fprintf(&b, "cluster_slots_pfail:%d\r\n", pfail)
+	fmt.Fprintf(&b, "cluster_slots_fail:%d\r\n", fail)
+	fmt.Fprintf(&b, "cluster_known_nodes:%d\r\n", len(cl.nodes))
+	fmt.Fprintf(&b, "cluster_size:%d\r\n", cl.size)
+	fmt.Fprintf(&b, "cluster_current_epoch:%d\r\n", cl.currentEpoch)
+	fmt.Fprintf(&b, "cluster_my_epoch:%d\r\n", cl.myself.configEpoch)
+	var sent, received int64
+	for _, typ := range busMessageTypes {
+		sent += cl.sent[typ]
+		received += cl.received[typ]
+	}
+	for _, typ := range busMessageTypes {
+		if cl.sent[typ] > 0 {
+			fmt.Fprintf(&b, "cluster_stats_messages_%s_sent:%d\r\n", typ, cl.sent[typ])
+		}
+	}
+	fmt.Fprintf(&b, "cluster_stats_messages_sent:%d\r\n", sent)
+	for _, typ := range busMessageTypes {
+		if cl.received[typ] > 0 {
+			fmt.Fprintf(&b, "cluster_stats_messages_%s_received:%d\r\n", typ, cl.received[typ])
+		}
+	}
+	fmt.Fprintf(&b, "cluster_stats_messages_received:%d\r\n", received)
+	return protocol.BulkString(b.String())
+}
+
+func clusterMyIDCommand(s *Server, c *client, args [][]byte) string {
+	cl, errReply := s.clusterOrError()
+	if cl == nil {
+		return errReply
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return protocol.BulkString(cl.myself.id)
+}
+
+func clusterNodesCommand(s *Server, c *client, args [][]byte) string {
+	cl, errReply := s.clusterOrError()
+	if cl == nil {
+		return errReply
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return protocol.BulkString(cl.nodesDescription(false))
+}
+
+// nodeEntry describes a node in CLUSTER SLOTS: its address and ID.
+func nodeEntry(n *clusterNode) string {
+	return protocol.Array(protocol.BulkString(n.ip), protocol.Integer(int64(n.port)), protocol.BulkString(n.id))
+}
+
+// clusterSlotsCommand replies with a range of consecutive slots per
+// entry, with the node serving it.
+func clusterSlotsCommand(s *Server, c *client, args [][]byte) string {
+	cl, errReply := s.clusterOrError()
+	if cl == nil {
+		return errReply
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	var entries []string
+	for slot := 0; slot < clusterSlots; {
+		n := cl.slots[slot]
+		end := slot
+		for end+1 < clusterSlots && cl.slots[end+1] == n {
+			end++
+		}
+		if n != nil {
+			entries = append(entries, protocol.Array(protocol.Integer(int64(slot)), protocol.Integer(int64(end)), nodeEntry(n)))
+		}
+		slot = end + 1
+	}
+	return protocol.Array(entries...)
+}
+
+// clusterShardsCommand replies with a shard per master, with its slots
+// and its nodes. Without cluster replicas, a shard has one node.
+func clusterShardsCommand(s *Server, c *client, args [][]byte) string {
+	cl, errReply := s.clusterOrError()
+	if cl == nil {
+		return errReply
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	var shards []string
+	for _, n := range cl.sortedNodes() {
+		if n.flags&nodeHandshake != 0 {
+			continue
+		}
+		var slots []string
+		for _, r := range cl.slotRanges(n) {
+			slots = append(slots, protocol.Integer(int64(r[0])), protocol.Integer(int64(r[1])))
+		}
+		health := "online"
+		if n.flags&(nodePFail|nodeFail) != 0 {
+			health = "failed"
+		}
+		offset := int64(0)
+		if n == cl.myself {
+			s.repl.mu.Lock()
+			offset = s.repl.offset
+			s.repl.mu.Unlock()
+		}
+		node := protocol.Array(
+			protocol.BulkString("id"), protocol.BulkString(n.id),
+			protocol.BulkString("port"), protocol.Integer(int64(n.port)),
+			protocol.BulkString("ip"), protocol.BulkString(n.ip),
+			protocol.BulkString("endpoint"), protocol.BulkString(n.ip),
+			protocol.BulkString("role"), protocol.BulkString("master"),
+			protocol.BulkString("replication-offset"), protocol.Integer(offset),
+			protocol.BulkString("health"), protocol.BulkString(health),
+		)
+		shards = append(shards, protocol.Array(
+			protocol.BulkString("slots"), protocol.Array(slots...),
+			protocol.BulkString("nodes"), protocol.Array(node),
+		))
+	}
+	return protocol.Array(shards...)
+}
+
+func clusterKeySlotCommand(s *Server, c *client, args [][]byte) string {
+	if s.cluster == nil {
+		return clusterDisabledError
+	}
+	return protocol.Integer(int64(keyHashSlot(string(args[2]))))
+}
+
+// parseSlot reads a slot number argument.
+func parseSlot(arg []byte) (int, string) {
+	slot, err := strconv.Atoi(string(arg))
+	if err != nil || slot < 0 || slot >= clusterSlots {
+		return 0, protocol.ErrorReply("ERR Invalid or out of range slot")
+	}
+	return slot, ""
+}
+
+// keysInSlot returns up to count keys of slot, or all of them if count is
+// negative. Keys aren't indexed by slot, so this looks at every key.
+func (s *Server) keysInSlot(slot, count int) []string {
+	var keys []string
+	for _, key := range s.store.Keys("*") {
+		if count >= 0 && len(keys) == count {
+			break
+		}
+		if keyHashSlot(key) == slot {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func clusterCountKeysInSlotCommand(s *Server, c *client, args [][]byte) string {
+	if s.cluster == nil {
+		return clusterDisabledError
+	}
+	slot, errReply := parseSlot(args[2])
+	if errReply != "" {
+		return errReply
+	}
+	return protocol.Integer(int64(len(s.keysInSlot(slot, -1))))
+}
+
+func clusterGetKeysInSlotCommand(s *Server, c *client, args [][]byte) string {
+	if s.cluster == nil {
+		return clusterDisabledError
+	}
+	slot, errReply := parseSlot(args[2])
+	if errReply != "" {
+		return errReply
+	}
+	count, err := strconv.Atoi(string(args[3]))
+	if err != nil || count < 0 {
+		return protocol.ErrorReply("ERR Invalid number of keys")
+	}
+	return protocol.BulkStringArray(s.keysInSlot(slot, count))
+}
+
+// addOrDeleteSlots assigns the slots to this node, or with del unassigns
+// them, all of them or none.
+func (s *Server) addOrDeleteSlots(slots []int, del bool) string {
+	cl := s.cluster
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	seen := make(map[int]bool, len(slots))
+	for _, slot := range slots {
+		if seen[slot] {
+			return protocol.ErrorReply(fmt.Sprintf("ERR Slot %d specified multiple times", slot))
+		}
+		seen[slot] = true
+		if del && cl.slots[slot] == nil {
+			return protocol.ErrorReply(fmt.Sprintf("ERR Slot %d is already unassigned", slot))
+		}
+		if !del && cl.slots[slot] != nil {
+			return protocol.ErrorReply(fmt.Sprintf("ERR Slot %d is already busy", slot))
+		}
+	}
+	for _, slot := range slots {
+		if del {
+			cl.assignSlot(slot, nil)
+			cl.migrating[slot], cl.importing[slot] = nil, nil
+		} else {
+			cl.assignSlot(slot, cl.myself)
+			cl.importing[slot] = nil
+		}
+	}
+	return s.saveClusterConfigOrError()
+}
+
+func clusterAddSlotsCommand(s *Server, c *client, args [][]byte) string {
+	return clusterSlotsChange(s, args, false, false)
+}
+
+func clusterAddSlotsRangeCommand(s *Server, c *client, args [][]byte) string {
+	return clusterSlotsChange(s, args, true, false)
+}
+
+func clusterDelSlotsCommand(s *Server, c *client, args [][]byte) string {
+	return clusterSlotsChange(s, args, false, true)
+}
+
+func clusterDelSlotsRangeCommand(s *Server, c *client, args [][]byte) string {
+	return clusterSlotsChange(s, args, true, true)
+}
+
+// clusterSlotsChange parses the slots, or with ranges the start and end
+// slot pairs, of ADDSLOTS, DELSLOTS and their RANGE forms.
+func clusterSlotsChange(s *Server, args [][]byte, ranges, del bool) string {
+	if s.cluster == nil {
+		return clusterDisabledError
+	}
+	var slots []int
+	if ranges {
+		if len(args)%2 != 0 {
+			return arityError(strings.ToLower("cluster|" + string(args[1])))
+		}
+		for i := 2; i < len(args); i += 2 {
+			first, errReply := parseSlot(args[i])
+			if errReply != "" {
+				return errReply
+			}
+			last, errReply := parseSlot(args[i+1])
+			if errReply != "" {
+				return errReply
+			}
+			if first > last {
+				return protocol.ErrorReply(fmt.Sprintf("ERR start slot number %d is greater than end slot number %d", first, last))
+			}
+			for slot := first; slot <= last; slot++ {
+				slots = append(slots, slot)
+			}
+		}
+	} else {
+		for _, arg := range args[2:] {
+			slot, errReply := parseSlot(arg)
+			if errReply != "" {
+				return errReply
+			}
+			slots = append(slots, slot)
+		}
+	}
+	return s.addOrDeleteSlots(slots, del)
+}
+
+// clusterSetSlotCommand moves a slot between nodes: MIGRATING and
+// IMPORTING mark it on the source and target while its keys move with
+// MIGRATE, NODE assigns it once they have, and STABLE clears the marks.
+func clusterSetSlotCommand(s *Server, c *client, args [][]byte) string {
+	cl, errReply := s.clusterOrError()
+	if cl == nil {
+		return errReply
+	}
+	slot, errReply := parseSlot(args[2])
+	if errReply != "" {
+		return errReply
+	}
+	action := strings.ToUpper(string(args[3]))
+	if action == "STABLE" {
+		if len(args) != 4 {
+			return syntaxError
+		}
+	} else if len(args) != 5 {
+		return syntaxError
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	var n *clusterNode
+	if action != "STABLE" {
+		n = cl.nodes[string(args[4])]
+		if n == nil {
+			return protocol.ErrorReply("ERR I don't know about node " + string(args[4]))
+		}
+	}
+	switch action {
+	case "MIGRATING":
+		if cl.slots[slot] != cl.myself {
+			return protocol.ErrorReply(fmt.Sprintf("ERR I'm not the owner of hash slot %d", slot))
+		}
+		if n == cl.myself {
+			return protocol.ErrorReply("ERR Target node can't be myself")
+		}
+		cl.migrating[slot] = n
+	case "IMPORTING":
+		if cl.slots[slot] == cl.myself {
+			return protocol.ErrorReply(fmt.Sprintf("ERR I'm already the owner of hash slot %d", slot))
+		}
+		if n == cl.myself {
+			return protocol.ErrorReply("ERR Source node can't be myself")
+		}
+		cl.importing[slot] = n
+	case "STABLE":
+		cl.migrating[slot], cl.importing[slot] = nil, nil
+	case "NODE":
+		if cl.slots[slot] == cl.myself && n != cl.myself && len(s.keysInSlot(slot, 1)) > 0 {
+			return protocol.ErrorReply(fmt.Sprintf("ERR Can't assign hashslot %d to a different node while I still hold keys for this hash slot.", slot))
+		}
+		if n != cl.myself {
+			cl.migrating[slot] = nil
+		}
+		if n == cl.myself && cl.importing[slot] != nil {
+			// The slot is ours now: a new epoch makes the other nodes
+			// take our claim over the source's
+			cl.importing[slot] = nil
+			cl.bumpConfigEpoch()
+		}
+		cl.assignSlot(slot, n)
+	default:
+		return protocol.ErrorReply("ERR Invalid CLUSTER SETSLOT action or number of arguments. Try CLUSTER HELP")
+	}
+	cl.dirty = true
+	return s.saveClusterConfigOrError()
+}
+
+// bumpConfigEpoch gives this node the next epoch, unless its epoch is the
+// greatest already, without asking the others. The caller holds cl.mu.
+func (cl *clusterState) bumpConfigEpoch() {
+	maxEpoch := int64(0)
+	for _, n := range cl.nodes {
+		maxEpoch = max(maxEpoch, n.configEpoch)
+	}
+	if cl.myself.configEpoch == 0 || cl.myself.configEpoch != maxEpoch {
+		cl.currentEpoch++
+		cl.myself.configEpoch = cl.currentEpoch
+		cl.dirty = true
+		logger.Notice("New configEpoch set", "epoch", cl.myself.configEpoch)
+	}
+}
+
+// clusterMeetCommand adds the node at ip:port to the cluster. The nodes
+// learn each other's IDs in the handshake that follows, and the rest of
+// the cluster through gossip.
+func clusterMeetCommand(s *Server, c *client, args [][]byte) string {
+	cl, errReply := s.clusterOrError()
+	if cl == nil {
+		return errReply
+	}
+	ip := string(args[2])
+	port, err := strconv.Atoi(string(args[3]))
+	if err != nil || port <= 0 || port > 65535 || net.ParseIP(ip) == nil {
+		return protocol.ErrorReply(fmt.Sprintf("ERR Invalid node address specified: %s:%s", args[2], args[3]))
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.startHandshake(ip, port)
+	return protocol.OK
+}
+
+func clusterForgetCommand(s *Server, c *client, args [][]byte) string {
+	cl, errReply := s.clusterOrError()
+	if cl == nil {
+		return errReply
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	n := cl.nodes[string(args[2])]
+	if n == nil {
+		return protocol.ErrorReply("ERR Unknown node " + string(args[2]))
+	}
+	if n == cl.myself {
+		return protocol.ErrorReply("ERR I tried hard but I can't forget myself...")
+	}
+	cl.forgotten[n.id] = time.Now().Add(forgetTTL)
+	cl.deleteNode(n)
+	return s.saveClusterConfigOrError()
+}
+
+func clusterSaveConfigCommand(s *Server, c *client, args [][]byte) string {
+	cl, errReply := s.clusterOrError()
+	if cl == nil {
+		return errReply
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return s.saveClusterConfigOrError()
+}
+
+// deleteNode forgets n and unassigns its slots. The caller holds cl.mu.
+func (cl *clusterState) deleteNode(n *clusterNode) {
+	for slot := range clusterSlots {
+		if cl.slots[slot] == n {
+			cl.assignSlot(slot, nil)
+		}
+		if cl.migrating[slot] == n {
+			cl.migrating[slot] = nil
+		}
+		if cl.importing[slot] == n {
+			cl.importing[slot] = nil
+		}
+	}
+	for _, other := range cl.nodes {
+		delete(other.failReports, n.id)
+	}
+	delete(cl.nodes, n.id)
+	if n.conn != nil && !n.inflight {
+		n.conn.Close()
+		n.conn = nil
+	}
+	cl.dirty = true
+}
+
+func clusterHelpCommand(s *Server, c *client, args [][]byte) string {
+	return simpleStringArray(strings.Split(`CLUSTER <subcommand> [<arg> [value] [opt] ...]. Subcommands are:
+ADDSLOTS <slot> [<slot> ...]
+    Assign slots to current node.
+ADDSLOTSRANGE <start slot> <end slot> [<start slot> <end slot> ...]
+    Assign slots which are between <start-slot> and <end-slot> to current node.
+COUNTKEYSINSLOT <slot>
+    Return the number of keys in <slot>.
+DELSLOTS <slot> [<slot> ...]
+    Delete slots information from current node.
+DELSLOTSRANGE <start slot> <end slot> [<start slot> <end slot> ...]
+    Delete slots information which are between <start-slot> and <end-slot>.
+FORGET <node-id>
+    Remove a node from the cluster.
+GETKEYSINSLOT <slot> <count>
+    Return key names stored by current node in a slot.
+INFO
+    Return information about the cluster.
+KEYSLOT <key>
+    Return the hash slot for <key>.
+MEET <ip> <port>
+    Connect nodes into a working cluster.
+MYID
+    Return the node id.
+NODES
+    Return cluster configuration seen by node. Output format:
+    <id> <ip:port@bus-port> <flags> <master> <pings> <pongs> <epoch> <link> <slot> ...
+SAVECONFIG
+    Force saving cluster configuration on disk.
+SETSLOT <slot> (IMPORTING <node-id>|MIGRATING <node-id>|STABLE|NODE <node-id>)
+    Set slot state.
+SHARDS
+    Return information about slot range mappings and the nodes associated with them.
+SLOTS
+    Return information about slots range mappings. Each range is made of:
+    start, end, master and replicas IP addresses, ports and ids
+HELP
+    Print this help.`, "\n"))
+}
+
+func writeClusterInfo(s *Server, b *infoBuilder) {
+	b.field("cluster_enabled", boolInt(s.cluster != nil))
+}
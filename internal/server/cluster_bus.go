@@ -0,0 +1,492 @@
+// File: internal/server/cluster_bus.go
+
+package server
+
+import (
+	"basic-go-redis/internal/protocol"
+	"basic-go-redis/pkg/logger"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+)
+
+// The nodes of a cluster gossip over their client port: a message is the
+// JSON argument of CLUSTER BUS, and the reply to a meet or a ping is the
+// pong of the node pinged.
+var busMessageTypes = []string{"ping", "pong", "meet", "fail"}
+
+// busMessage is what nodes tell each other about themselves and the
+// cluster.
+type busMessage struct {
+	Type         string        `json:"type"`
+	Sender       string        `json:"sender"`
+	IP           string        `json:"ip,omitempty"` // empty if the sender doesn't know it
+	Port         int           `json:"port"`
+	CurrentEpoch int64         `json:"current_epoch"`
+	ConfigEpoch  int64         `json:"config_epoch"`
+	Slots        [][2]int      `json:"slots,omitempty"` // ranges the sender serves
+	Gossip       []gossipEntry `json:"gossip,omitempty"`
+	Failing      string        `json:"failing,omitempty"` // the node a fail message is about
+}
+
+// gossipEntry is what the sender knows of another node.
+type gossipEntry struct {
+	ID    string `json:"id"`
+	IP    string `json:"ip"`
+	Port  int    `json:"port"`
+	Flags string `json:"flags"`
+}
+
+// failReportValidity is how many node timeouts a master's report that a
+// node is failing counts for.
+const failReportValidity = 2
+
+// nodeTimeout is how long a node may go without answering before it's
+// considered failing.
+func (s *Server) nodeTimeout() time.Duration {
+	return time.Duration(s.config.Int("cluster-node-timeout")) * time.Millisecond
+}
+
+// clusterCron pings the other nodes, detects those that fail and saves
+// the configuration once it changed. It runs on every cron tick.
+func (s *Server) clusterCron(now time.Time) {
+	cl := s.cluster
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.tick++
+	timeout := s.nodeTimeout()
+	retry := min(time.Second, timeout/2)
+
+	for id, until := range cl.forgotten {
+		if now.After(until) {
+			delete(cl.forgotten, id)
+		}
+	}
+
+	var candidates []*clusterNode
+	for _, n := range cl.nodes {
+		if n == cl.myself || n.inflight {
+			continue
+		}
+		if n.flags&nodeHandshake != 0 {
+			// A node that doesn't answer the handshake is forgotten
+			if now.Sub(n.created) > max(timeout, time.Second) {
+				logger.Verbose("Handshake timed out", "addr", n.addr())
+				cl.deleteNode(n)
+			} else if now.Sub(n.lastAttempt) >= retry {
+				s.sendPing(n, "meet")
+			}
+			continue
+		}
+		switch {
+		case !n.pingSent.IsZero():
+			if now.Sub(n.lastAttempt) >= retry {
+				s.sendPing(n, "ping")
+			}
+		case now.Sub(n.pongReceived) > timeout/2:
+			s.sendPing(n, "ping")
+		default:
+			candidates = append(candidates, n)
+		}
+	}
+
+	// Every second, one of a few random nodes, the one heard from least
+	// recently, is pinged
+	if cl.tick%hz == 0 && len(candidates) > 0 {
+		rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		oldest := candidates[0]
+		for _, n := range candidates[1:min(5, len(candidates))] {
+			if n.pongReceived.Before(oldest.pongReceived) {
+				oldest = n
+			}
+		}
+		s.sendPing(oldest, "ping")
+	}
+
+	for _, n := range cl.nodes {
+		if n == cl.myself || n.flags&(nodeHandshake|nodePFail|nodeFail) != 0 || n.pingSent.IsZero() {
+			continue
+		}
+		if now.Sub(n.pingSent) > timeout {
+			logger.Debug("Node is possibly failing", "id", n.id)
+			n.flags |= nodePFail
+		}
+	}
+	for _, n := range cl.nodes {
+		s.markFailing(n)
+	}
+
+	cl.updateState(s.config.Bool("cluster-require-full-coverage"))
+	if cl.dirty {
+		if err := s.saveClusterConfig(); err != nil {
+			logger.Warning("Can't save the cluster configuration", "err", err)
+		}
+	}
+}
+
+// sendPing sends n a ping, or a meet while in the handshake, from a
+// goroutine of its own. The caller holds cluster.mu.
+func (s *Server) sendPing(n *clusterNode, typ string) {
+	cl := s.cluster
+	now := time.Now()
+	n.inflight = true
+	n.lastAttempt = now
+	if n.pingSent.IsZero() {
+		n.pingSent = now
+	}
+	msg := cl.message(typ, n)
+	cl.sent[typ]++
+	go s.exchange(n, msg)
+}
+
+// exchange sends msg over n's link, connecting it first if need be, and
+// handles the pong it gets back.
+func (s *Server) exchange(n *clusterNode, msg *busMessage) {
+	timeout := max(s.nodeTimeout()/2, 100*time.Millisecond)
+	conn, reader := n.conn, n.reader
+	var reply *busMessage
+	var err error
+	if conn == nil {
+		conn, err = net.DialTimeout("tcp", n.addr(), timeout)
+		if err == nil {
+			reader = bufio.NewReader(conn)
+		}
+	}
+	if err == nil {
+		s.learnMyIP(conn.LocalAddr())
+		if msg.IP == "" {
+			msg.IP = s.clusterIP()
+		}
+		reply, err = roundTrip(conn, reader, msg, timeout)
+	}
+
+	cl := s.cluster
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	n.inflight = false
+	select {
+	case <-s.shutdownChan:
+		err = net.ErrClosed
+	default:
+	}
+	if err != nil || cl.nodes[n.id] != n {
+		if conn != nil {
+			conn.Close()
+		}
+		n.conn, n.reader = nil, nil
+		if err != nil {
+			logger.Debug("Cluster bus exchange failed", "addr", n.addr(), "err", err)
+		}
+		return
+	}
+	n.conn, n.reader = conn, reader
+	cl.received[reply.Type]++
+	s.handlePong(n, reply)
+}
+
+// roundTrip sends msg as CLUSTER BUS and reads the message it gets back.
+func roundTrip(conn net.Conn, reader *bufio.Reader, msg *busMessage, timeout time.Duration) (*busMessage, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+	request := protocol.AppendCommand(nil, [][]byte{[]byte("CLUSTER"), []byte("BUS"), payload})
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+	value, err := protocol.ReadValue(reader)
+	if err != nil {
+		return nil, err
+	}
+	if value.IsError() {
+		return nil, errors.New(value.Str)
+	}
+	if value.Kind != protocol.KindBulkString || value.Null {
+		return nil, errors.New("unexpected reply to CLUSTER BUS")
+	}
+	var reply busMessage
+	if err := json.Unmarshal([]byte(value.Str), &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// learnMyIP takes the address other nodes reach this one at from a
+// connection between them, unless it's known already.
+func (s *Server) learnMyIP(addr net.Addr) {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return
+	}
+	cl := s.cluster
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.myself.ip == "" {
+		cl.myself.ip = host
+		cl.dirty = true
+		logger.Notice("IP address for this node updated", "ip", host)
+	}
+}
+
+func (s *Server) clusterIP() string {
+	s.cluster.mu.Lock()
+	defer s.cluster.mu.Unlock()
+	return s.cluster.myself.ip
+}
+
+// message describes this node and what it knows of the others but to,
+// for a message of type typ. The caller holds cl.mu.
+func (cl *clusterState) message(typ string, to *clusterNode) *busMessage {
+	msg := &busMessage{
+		Type:         typ,
+		Sender:       cl.myself.id,
+		IP:           cl.myself.ip,
+		Port:         cl.myself.port,
+		CurrentEpoch: cl.currentEpoch,
+		ConfigEpoch:  cl.myself.configEpoch,
+		Slots:        cl.slotRanges(cl.myself),
+	}
+	for _, n := range cl.nodes {
+		if n == cl.myself || n == to || n.flags&nodeHandshake != 0 {
+			continue
+		}
+		msg.Gossip = append(msg.Gossip, gossipEntry{ID: n.id, IP: n.ip, Port: n.port, Flags: n.flags.String()})
+	}
+	return msg
+}
+
+// handlePong takes in the pong n replied with. The caller holds
+// cluster.mu.
+func (s *Server) handlePong(n *clusterNode, msg *busMessage) {
+	cl := s.cluster
+	if n.flags&nodeHandshake != 0 {
+		// The handshake is over once the node tells its ID
+		_, forgotten := cl.forgotten[msg.Sender]
+		if known := cl.nodes[msg.Sender]; known != nil || forgotten || msg.Sender == "" {
+			cl.deleteNode(n)
+			return
+		}
+		delete(cl.nodes, n.id)
+		n.id = msg.Sender
+		n.flags &^= nodeHandshake
+		cl.nodes[n.id] = n
+		cl.dirty = true
+		logger.Notice("Handshake with node completed", "id", n.id, "addr", n.addr())
+	}
+	now := time.Now()
+	n.pingSent = time.Time{}
+	n.pongReceived = now
+	if n.flags&nodePFail != 0 {
+		n.flags &^= nodePFail
+		logger.Debug("Node is reachable again", "id", n.id)
+	}
+	if n.flags&nodeFail != 0 && (n.numSlots == 0 || now.Sub(n.failTime) > failReportValidity*s.nodeTimeout()) {
+		n.flags &^= nodeFail
+		cl.dirty = true
+		logger.Notice("Clear FAIL state for node: it is reachable again", "id", n.id)
+	}
+	s.handleMessage(n, msg)
+}
+
+// clusterBusCommand takes in a message from another node and replies
+// with a pong. A meet adds its sender to the cluster; other messages
+// from nodes this one doesn't know only get the pong.
+func clusterBusCommand(s *Server, c *client, args [][]byte) string {
+	cl, errReply := s.clusterOrError()
+	if cl == nil {
+		return errReply
+	}
+	var msg busMessage
+	if err := json.Unmarshal(args[2], &msg); err != nil || msg.Sender == "" {
+		return protocol.ErrorReply("ERR Invalid cluster bus message")
+	}
+	if host, _, err := net.SplitHostPort(c.laddr); err == nil && s.config.Get("cluster-announce-ip") == "" {
+		s.learnMyIP(&net.TCPAddr{IP: net.ParseIP(host)})
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.received[msg.Type]++
+	sender := cl.nodes[msg.Sender]
+	_, forgotten := cl.forgotten[msg.Sender]
+	if sender == nil && msg.Type == "meet" && !forgotten && msg.Sender != cl.myself.id {
+		ip := msg.IP
+		if ip == "" {
+			ip, _, _ = net.SplitHostPort(c.addr)
+		}
+		sender = &clusterNode{id: msg.Sender, ip: ip, port: msg.Port, flags: nodeMaster, created: time.Now()}
+		cl.nodes[sender.id] = sender
+		cl.dirty = true
+		logger.Notice("Node met us", "id", sender.id, "addr", sender.addr())
+	}
+	if sender != nil && sender != cl.myself {
+		s.handleMessage(sender, &msg)
+	}
+	cl.sent["pong"]++
+	payload, _ := json.Marshal(cl.message("pong", sender))
+	return protocol.BulkString(string(payload))
+}
+
+// handleMessage updates this node's view of the cluster with what a
+// message from sender says. The caller holds cluster.mu.
+func (s *Server) handleMessage(sender *clusterNode, msg *busMessage) {
+	cl := s.cluster
+	if msg.CurrentEpoch > cl.currentEpoch {
+		cl.currentEpoch = msg.CurrentEpoch
+		cl.dirty = true
+	}
+	if msg.ConfigEpoch > sender.configEpoch {
+		sender.configEpoch = msg.ConfigEpoch
+		cl.dirty = true
+	}
+
+	if msg.Type == "fail" {
+		if n := cl.nodes[msg.Failing]; n != nil && n != cl.myself && n.flags&nodeFail == 0 {
+			logger.Notice("FAIL message received about node", "id", n.id, "from", sender.id)
+			n.flags = n.flags&^nodePFail | nodeFail
+			n.failTime = time.Now()
+			cl.dirty = true
+		}
+		return
+	}
+
+	s.claimSlots(sender, msg.Slots)
+	cl.resolveEpochCollision(sender)
+
+	now := time.Now()
+	for _, g := range msg.Gossip {
+		if g.ID == cl.myself.id {
+			continue
+		}
+		if n := cl.nodes[g.ID]; n != nil {
+			if strings.Contains(g.Flags, "fail") {
+				if n.failReports == nil {
+					n.failReports = make(map[string]time.Time)
+				}
+				n.failReports[sender.id] = now
+			} else {
+				delete(n.failReports, sender.id)
+			}
+			s.markFailing(n)
+			continue
+		}
+		if _, forgotten := cl.forgotten[g.ID]; !forgotten && !strings.Contains(g.Flags, "fail") && g.IP != "" {
+			cl.startHandshake(g.IP, g.Port)
+		}
+	}
+}
+
+// claimSlots gives sender the slots it serves, unless nodes with a
+// greater config epoch serve them. Slots this node imports are left
+// alone: the slot is moved to it in the end. The caller holds
+// cluster.mu.
+func (s *Server) claimSlots(sender *clusterNode, ranges [][2]int) {
+	cl := s.cluster
+	for _, r := range ranges {
+		if r[0] < 0 || r[1] >= clusterSlots {
+			continue
+		}
+		for slot := r[0]; slot <= r[1]; slot++ {
+			owner := cl.slots[slot]
+			if owner == sender || cl.importing[slot] != nil {
+				continue
+			}
+			if owner == nil || owner.configEpoch < sender.configEpoch {
+				if owner == cl.myself {
+					logger.Notice("Slot taken over by a node with a greater config epoch", "slot", slot, "node", sender.id)
+					cl.migrating[slot] = nil
+				}
+				cl.assignSlot(slot, sender)
+			}
+		}
+	}
+}
+
+// resolveEpochCollision gives this node a new config epoch if sender has
+// the same one and the smaller ID, as Redis does, so that no two masters
+// claim slots with equal epochs. The caller holds cl.mu.
+func (cl *clusterState) resolveEpochCollision(sender *clusterNode) {
+	if sender.configEpoch != cl.myself.configEpoch || cl.myself.id > sender.id {
+		return
+	}
+	cl.currentEpoch++
+	cl.myself.configEpoch = cl.currentEpoch
+	cl.dirty = true
+	logger.Verbose("configEpoch collision with node, configEpoch set", "node", sender.id, "epoch", cl.myself.configEpoch)
+}
+
+// markFailing marks n as failing once enough masters, this one included,
+// report it as failing, and tells every node so. The caller holds
+// cluster.mu.
+func (s *Server) markFailing(n *clusterNode) {
+	cl := s.cluster
+	if n.flags&nodePFail == 0 || n.flags&nodeFail != 0 {
+		return
+	}
+	validity := failReportValidity * s.nodeTimeout()
+	for id, reported := range n.failReports {
+		if time.Since(reported) > validity || cl.nodes[id] == nil {
+			delete(n.failReports, id)
+		}
+	}
+	if len(n.failReports)+1 < cl.size/2+1 {
+		return
+	}
+	logger.Notice("Marking node as failing (quorum reached)", "id", n.id)
+	n.flags = n.flags&^nodePFail | nodeFail
+	n.failTime = time.Now()
+	cl.dirty = true
+
+	msg := cl.message("fail", nil)
+	msg.Gossip, msg.Slots, msg.Failing = nil, nil, n.id
+	timeout := max(s.nodeTimeout()/2, 100*time.Millisecond)
+	for _, other := range cl.nodes {
+		if other == cl.myself || other == n || other.flags&nodeHandshake != 0 {
+			continue
+		}
+		cl.sent["fail"]++
+		go func(addr string) {
+			conn, err := net.DialTimeout("tcp", addr, timeout)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			roundTrip(conn, bufio.NewReader(conn), msg, timeout)
+		}(other.addr())
+	}
+}
+
+// startHandshake adds the node at ip:port, with an ID of its own until it
+// tells its own, unless it's known already. The caller holds cl.mu.
+func (cl *clusterState) startHandshake(ip string, port int) {
+	for _, n := range cl.nodes {
+		if n.ip == ip && n.port == port {
+			return
+		}
+	}
+	n := &clusterNode{id: newRunID(), ip: ip, port: port, flags: nodeHandshake | nodeMaster, created: time.Now()}
+	cl.nodes[n.id] = n
+	logger.Verbose("Starting handshake with node", "addr", n.addr())
+}
+
+// closeCluster closes the links to the other nodes.
+func (s *Server) closeCluster() {
+	cl := s.cluster
+	if cl == nil {
+		return
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	for _, n := range cl.nodes {
+		if n.conn != nil && !n.inflight {
+			n.conn.Close()
+			n.conn, n.reader = nil, nil
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// File: internal/server/command_info.go
+
+package server
+
+import (
+	"basic-go-redis/internal/protocol"
+	"sort"
+	"strings"
+)
+
+// groupCategories maps a command group to the ACL category Redis files it under.
+var groupCategories = map[string]string{
+	"generic":    "@keyspace",
+	"string":     "@string",
+	"sorted-set": "@sortedset",
+	"connection": "@connection",
+}
+
+// categories returns the ACL categories of cmd, derived from its flags and group.
+func (cmd *command) categories() []string {
+	var categories []string
+	if cmd.flags&flagWrite != 0 {
+		categories = append(categories, "@write")
+	}
+	if cmd.flags&flagReadonly != 0 {
+		categories = append(categories, "@read")
+	}
+	if category, ok := groupCategories[cmd.group]; ok {
+		categories = append(categories, category)
+	}
+	if cmd.flags&flagFast != 0 {
+		categories = append(categories, "@fast")
+	} else {
+		categories = append(categories, "@slow")
+	}
+	if cmd.flags&flagBlocking != 0 {
+		categories = append(categories, "@blocking")
+	}
+	return categories
+}
+
+// simpleStringArray encodes items as an array of simple strings.
+func simpleStringArray(items []string) string {
+	elems := make([]string, len(items))
+	for i, item := range items {
+		elems[i] = protocol.SimpleString(item)
+	}
+	return protocol.Array(elems...)
+}
+
+// keySpecsReply describes the command's key positions in the key-spec
+// format of Redis 7: an index to begin the search at and a range of keys.
+func (cmd *command) keySpecsReply() string {
+	if cmd.firstKey == 0 {
+		return protocol.EmptyArray
+	}
+	flags := []string{"RO", "ACCESS"}
+	if cmd.flags&flagWrite != 0 {
+		flags = []string{"RW", "UPDATE"}
+	}
+	lastKey := cmd.lastKey
+	if lastKey >= 0 {
+		lastKey -= cmd.firstKey // Relative to the index the search begins at
+	}
+	spec := protocol.Array(
+		protocol.BulkString("flags"), simpleStringArray(flags),
+		protocol.BulkString("begin_search"), protocol.Array(
+			protocol.BulkString("type"), protocol.BulkString("index"),
+			protocol.BulkString("spec"), protocol.Array(
+				protocol.BulkString("index"), protocol.Integer(int64(cmd.firstKey)),
+			),
+		),
+		protocol.BulkString("find_keys"), protocol.Array(
+			protocol.BulkString("type"), protocol.BulkString("range"),
+			protocol.BulkString("spec"), protocol.Array(
+				protocol.BulkString("lastkey"), protocol.Integer(int64(lastKey)),
+				protocol.BulkString("keystep"), protocol.Integer(int64(cmd.keyStep)),
+				protocol.BulkString("limit"), protocol.Integer(0),
+			),
+		),
+	)
+	return protocol.Array(spec)
+}
+
+// infoReply is the entry COMMAND and COMMAND INFO report for cmd.
+func (cmd *command) infoReply() string {
+	subcommands := make([]string, len(cmd.subcommands))
+	for i, sub := range cmd.subcommands {
+		subcommands[i] = sub.infoReply()
+	}
+	return protocol.Array(
+		protocol.BulkString(cmd.fullName()),
+		protocol.Integer(int64(cmd.arity)),
+		simpleStringArray(cmd.flags.names()),
+		protocol.Integer(int64(cmd.firstKey)),
+		protocol.Integer(int64(cmd.lastKey)),
+		protocol.Integer(int64(cmd.keyStep)),
+		simpleStringArray(cmd.categories()),
+		protocol.EmptyArray, // Tips
+		cmd.keySpecsReply(),
+		protocol.Array(subcommands...),
+	)
+}
+
+// docsReply is the documentation map COMMAND DOCS reports for cmd.
+func (cmd *command) docsReply() string {
+	elems := []string{
+		protocol.BulkString("summary"), protocol.BulkString(cmd.summary),
+		protocol.BulkString("since"), protocol.BulkString(cmd.since),
+		protocol.BulkString("group"), protocol.BulkString(cmd.group),
+		protocol.BulkString("complexity"), protocol.BulkString(cmd.complexity),
+	}
+	if len(cmd.arguments) > 0 {
+		elems = append(elems, protocol.BulkString("arguments"), argumentsReply(cmd.arguments))
+	}
+	if len(cmd.subcommands) > 0 {
+		subcommands := make([]string, 0, 2*len(cmd.subcommands))
+		for _, sub := range cmd.subcommands {
+			subcommands = append(subcommands, protocol.BulkString(sub.fullName()), sub.docsReply())
+		}
+		elems = append(elems, protocol.BulkString("subcommands"), protocol.Array(subcommands...))
+	}
+	return protocol.Array(elems...)
+}
+
+// argumentsReply documents args the way COMMAND DOCS does.
+func argumentsReply(args []commandArg) string {
+	elems := make([]string, len(args))
+	for i, arg := range args {
+		fields := []string{
+			protocol.BulkString("name"), protocol.BulkString(arg.name),
+			protocol.BulkString("type"), protocol.BulkString(arg.typ),
+		}
+		if arg.token != "" {
+			fields = append(fields, protocol.BulkString("token"), protocol.BulkString(arg.token))
+		}
+		var flags []string
+		if arg.optional {
+			flags = append(flags, "optional")
+		}
+		if arg.multiple {
+			flags = append(flags, "multiple")
+		}
+		if len(flags) > 0 {
+			fields = append(fields, protocol.BulkString("flags"), simpleStringArray(flags))
+		}
+		if len(arg.args) > 0 {
+			fields = append(fields, protocol.BulkString("arguments"), argumentsReply(arg.args))
+		}
+		elems[i] = protocol.Array(fields...)
+	}
+	return protocol.Array(elems...)
+}
+
+// sortedCommands returns the top-level commands ordered by name.
+func sortedCommands() []*command {
+	commands := make([]*command, 0, len(commandTable))
+	for _, cmd := range commandTable {
+		commands = append(commands, cmd)
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].name < commands[j].name })
+	return commands
+}
+
+func commandCommand(s *Server, c *client, args [][]byte) string {
+	commands := sortedCommands()
+	elems := make([]string, len(commands))
+	for i, cmd := range commands {
+		elems[i] = cmd.infoReply()
+	}
+	return protocol.Array(elems...)
+}
+
+func commandCountCommand(s *Server, c *client, args [][]byte) string {
+	return protocol.Integer(int64(len(commandTable)))
+}
+
+func commandInfoCommand(s *Server, c *client, args [][]byte) string {
+	if len(args) == 2 {
+		return commandCommand(s, c, args)
+	}
+	elems := make([]string, 0, len(args)-2)
+	for _, name := range args[2:] {
+		if cmd := lookupCommandByFullName(string(name)); cmd != nil {
+			elems = append(elems, cmd.infoReply())
+		} else {
+			elems = append(elems, protocol.NullArray)
+		}
+	}
+	return protocol.Array(elems...)
+}
+
+func commandDocsCommand(s *Server, c *client, args [][]byte) string {
+	var commands []*command
+	if len(args) == 2 {
+		commands = sortedCommands()
+	} else {
+		for _, name := range args[2:] {
+			if cmd := lookupCommandByFullName(string(name)); cmd != nil {
+				commands = append(commands, cmd)
+			}
+		}
+	}
+	elems := make([]string, 0, 2*len(commands))
+	for _, cmd := range commands {
+		elems = append(elems, protocol.BulkString(cmd.fullName()), cmd.docsReply())
+	}
+	return protocol.Array(elems...)
+}
+
+func commandGetKeysCommand(s *Server, c *client, args [][]byte) string {
+	request := args[2:]
+	cmd := lookupCommand(request[0])
+	if cmd != nil && len(cmd.subcommands) > 0 && len(request) > 1 {
+		cmd = cmd.subcommand(request[1])
+	}
+	if cmd == nil {
+		return protocol.ErrorReply("ERR Invalid command specified")
+	}
+	if !cmd.checkArity(len(request)) {
+		return protocol.ErrorReply("ERR Invalid number of arguments specified for command")
+	}
+	positions := cmd.keysOf(request)
+	if len(positions) == 0 {
+		return protocol.ErrorReply("ERR The command has no key arguments")
+	}
+	keys := make([]string, len(positions))
+	for i, pos := range positions {
+		keys[i] = string(request[pos])
+	}
+	return protocol.BulkStringArray(keys)
+}
+
+func commandHelpCommand(s *Server, c *client, args [][]byte) string {
+	return simpleStringArray(strings.Split(`COMMAND <subcommand> [<arg> [value] [opt] ...]. Subcommands are:
+(no subcommand)
+    Return details about all commands.
+COUNT
+    Return the total number of commands in this server.
+DOCS [<command-name> ...]
+    Return documentation details about multiple commands.
+    If no command names are given, documentation details for all
+    commands are returned.
+GETKEYS <full-command>
+    Return the keys from a full command.
+INFO [<command-name> ...]
+    Return details about multiple commands.
+    If no command names are given, details about all commands
+    are returned.
+HELP
+    Print this help.`, "\n"))
+}
@@ -0,0 +1,817 @@
+// File: internal/server/commands.go
+
+package server
+
+import (
+	"basic-go-redis/internal/protocol"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// commandFlag describes a property of a command that the dispatcher and
+// other parts of the server can act on without knowing the command itself.
+type commandFlag uint
+
+const (
+	flagWrite    commandFlag = 1 << iota // may modify the dataset
+	flagReadonly                         // only reads the dataset
+	flagDenyOOM                          // may grow the dataset, refused when over maxmemory
+	flagFast                             // runs in O(1) or O(log N)
+	flagBlocking                         // may block the client
+	flagLoading                          // allowed while the dataset is loading
+	flagStale                            // allowed on a replica with stale data
+	flagAsking                           // may use a slot being imported without ASKING
+)
+
+// commandFlagNames lists the flags in the order Redis reports them.
+var commandFlagNames = []struct {
+	flag commandFlag
+	name string
+}{
+	{flagWrite, "write"},
+	{flagReadonly, "readonly"},
+	{flagDenyOOM, "denyoom"},
+	{flagFast, "fast"},
+	{flagBlocking, "blocking"},
+	{flagLoading, "loading"},
+	{flagStale, "stale"},
+	{flagAsking, "asking"},
+}
+
+// names returns the flags set in f, using Redis's names for them.
+func (f commandFlag) names() []string {
+	var names []string
+	for _, entry := range commandFlagNames {
+		if f&entry.flag != 0 {
+			names = append(names, entry.name)
+		}
+	}
+	return names
+}
+
+// commandHandler executes a command sent by c. args holds the whole request,
+// with the command name at index 0, as views into the connection's read buffer.
+type commandHandler func(s *Server, c *client, args [][]byte) string
+
+// command is one entry of the command table.
+type command struct {
+	name  string // lower-case name, as Redis reports it
+	arity int    // exact number of arguments including the name, or -N for at least N
+	flags commandFlag
+
+	// Positions of the key arguments: the first and last key (a negative
+	// last key counts from the end of the request) and the step between keys.
+	// Commands without keys leave all three at zero.
+	firstKey int
+	lastKey  int
+	keyStep  int
+
+	// getKeys finds the keys of commands the positions above can't
+	// describe, such as MIGRATE with KEYS.
+	getKeys func(args [][]byte) []int
+
+	handler commandHandler
+
+	// Container commands such as COMMAND dispatch on their first argument.
+	// A subcommand's arity and key positions count the container's name too.
+	subcommands []*command
+	parent      *command
+
+	// Documentation reported by COMMAND DOCS.
+	summary    string
+	since      string
+	group      string
+	complexity string
+	arguments  []commandArg
+}
+
+// commandArg documents one argument of a command, in the shape COMMAND DOCS
+// reports. Arguments of type "oneof" and "block" nest further arguments.
+type commandArg struct {
+	name     string
+	typ      string // key, string, integer, double, pattern, pure-token, oneof or block
+	token    string // literal keyword preceding the value, if any
+	optional bool
+	multiple bool
+	args     []commandArg
+}
+
+// fullName is the name Redis uses in replies and errors, e.g. "command|info".
+func (cmd *command) fullName() string {
+	if cmd.parent != nil {
+		return cmd.parent.name + "|" + cmd.name
+	}
+	return cmd.name
+}
+
+// subcommand finds a subcommand of cmd by name regardless of its case.
+func (cmd *command) subcommand(name []byte) *command {
+	for _, sub := range cmd.subcommands {
+		if bytes.EqualFold(name, []byte(sub.name)) {
+			return sub
+		}
+	}
+	return nil
+}
+
+// commandTable maps lower-case command names to their entries.
+var commandTable = make(map[string]*command)
+
+// registerCommand adds cmd to the command table.
+func registerCommand(cmd *command) {
+	if _, exists := commandTable[cmd.name]; exists {
+		panic(fmt.Sprintf("command %q registered twice", cmd.name))
+	}
+	for _, sub := range cmd.subcommands {
+		sub.parent = cmd
+		if sub.group == "" {
+			sub.group = cmd.group
+		}
+	}
+	commandTable[cmd.name] = cmd
+}
+
+// maxCommandNameLength bounds the names lookupCommand folds on the stack.
+const maxCommandNameLength = 32
+
+// lookupCommand finds a command by name regardless of its case.
+func lookupCommand(name []byte) *command {
+	if len(name) > maxCommandNameLength {
+		return nil
+	}
+	var lower [maxCommandNameLength]byte
+	for i, c := range name {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+	return commandTable[string(lower[:len(name)])]
+}
+
+// lookupCommandByFullName finds a command or, given "container|sub", a subcommand.
+func lookupCommandByFullName(name string) *command {
+	container, sub, isSub := strings.Cut(name, "|")
+	cmd := lookupCommand([]byte(container))
+	if cmd == nil || !isSub {
+		return cmd
+	}
+	return cmd.subcommand([]byte(sub))
+}
+
+// keyPositions returns the indexes of the key arguments in a request of argc
+// arguments, using the command's first key, last key and step.
+func (cmd *command) keyPositions(argc int) []int {
+	if cmd.firstKey == 0 {
+		return nil
+	}
+	last := cmd.lastKey
+	if last < 0 {
+		last += argc
+	}
+	var positions []int
+	for i := cmd.firstKey; i <= last && i < argc; i += cmd.keyStep {
+		positions = append(positions, i)
+	}
+	return positions
+}
+
+// keysOf returns the indexes of the key arguments of the request args.
+func (cmd *command) keysOf(args [][]byte) []int {
+	if cmd.getKeys != nil {
+		return cmd.getKeys(args)
+	}
+	return cmd.keyPositions(len(args))
+}
+
+// checkArity reports whether a request of argc arguments, name included, fits cmd.
+func (cmd *command) checkArity(argc int) bool {
+	if cmd.arity >= 0 {
+		return argc == cmd.arity
+	}
+	return argc >= -cmd.arity
+}
+
+// arityError is the reply Redis gives when a command has the wrong number of arguments.
+func arityError(name string) string {
+	return protocol.ErrorReply(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+}
+
+// unknownCommandError is the reply Redis gives for a command it doesn't know.
+// It echoes the name and the start of the arguments, each cut at 128 bytes.
+func unknownCommandError(args [][]byte) string {
+	var argList strings.Builder
+	for _, arg := range args[1:] {
+		if argList.Len() >= 128 {
+			break
+		}
+		fmt.Fprintf(&argList, "'%.*s' ", 128-argList.Len(), arg)
+	}
+	return protocol.ErrorReply(fmt.Sprintf("ERR unknown command '%.128s', with args beginning with: %s", args[0], argList.String()))
+}
+
+// unknownSubcommandError is the reply Redis gives for a container command
+// called with a subcommand it doesn't have.
+func unknownSubcommandError(cmd *command, sub []byte) string {
+	return protocol.ErrorReply(fmt.Sprintf("ERR unknown subcommand '%.128s'. Try %s HELP.", sub, strings.ToUpper(cmd.name)))
+}
+
+// keyArg is the documentation of a single key argument.
+var keyArg = commandArg{name: "key", typ: "key"}
+
+// slotRangeArg is the start and end slot pairs of the cluster's RANGE
+// subcommands.
+var slotRangeArg = commandArg{name: "range", typ: "block", multiple: true, args: []commandArg{
+	{name: "start-slot", typ: "integer"},
+	{name: "end-slot", typ: "integer"},
+}}
+
+func init() {
+	for _, cmd := range []*command{
+		{
+			name: "ping", arity: -1, flags: flagFast | flagLoading | flagStale, handler: pingCommand,
+			summary: "Returns the server's liveliness response.",
+			since:   "1.0.0", group: "connection", complexity: "O(1)",
+			arguments: []commandArg{{name: "message", typ: "string", optional: true}},
+		},
+		{
+			name: "echo", arity: 2, flags: flagFast | flagLoading | flagStale, handler: echoCommand,
+			summary: "Returns the given string.",
+			since:   "1.0.0", group: "connection", complexity: "O(1)",
+			arguments: []commandArg{{name: "message", typ: "string"}},
+		},
+		{
+			name: "select", arity: 2, flags: flagFast | flagLoading | flagStale, handler: selectCommand,
+			summary: "Changes the selected database.",
+			since:   "1.0.0", group: "connection", complexity: "O(1)",
+			arguments: []commandArg{{name: "index", typ: "integer"}},
+		},
+		{
+			name: "auth", arity: -2, flags: flagFast | flagLoading | flagStale, handler: authCommand,
+			summary: "Authenticates the connection.",
+			since:   "1.0.0", group: "connection", complexity: "O(N) where N is the number of passwords defined for the user",
+			arguments: []commandArg{
+				{name: "username", typ: "string", optional: true},
+				{name: "password", typ: "string"},
+			},
+		},
+		{
+			name: "set", arity: -3, flags: flagWrite | flagDenyOOM, firstKey: 1, lastKey: 1, keyStep: 1, handler: setCommand,
+			summary: "Sets the string value of a key, ignoring its type. The key is created if it doesn't exist.",
+			since:   "1.0.0", group: "string", complexity: "O(1)",
+			arguments: []commandArg{
+				keyArg,
+				{name: "value", typ: "string"},
+				{name: "condition", typ: "oneof", optional: true, args: []commandArg{
+					{name: "nx", typ: "pure-token", token: "NX"},
+					{name: "xx", typ: "pure-token", token: "XX"},
+				}},
+				{name: "expiration", typ: "oneof", optional: true, args: []commandArg{
+					{name: "seconds", typ: "integer", token: "EX"},
+					{name: "milliseconds", typ: "integer", token: "PX"},
+					{name: "unix-time-seconds", typ: "unix-time", token: "EXAT"},
+					{name: "unix-time-milliseconds", typ: "unix-time", token: "PXAT"},
+					{name: "keepttl", typ: "pure-token", token: "KEEPTTL"},
+				}},
+			},
+		},
+		{
+			name: "get", arity: 2, flags: flagReadonly | flagFast, firstKey: 1, lastKey: 1, keyStep: 1, handler: getCommand,
+			summary: "Returns the string value of a key.",
+			since:   "1.0.0", group: "string", complexity: "O(1)",
+			arguments: []commandArg{keyArg},
+		},
+		{
+			name: "del", arity: -2, flags: flagWrite, firstKey: 1, lastKey: -1, keyStep: 1, handler: delCommand,
+			summary: "Deletes one or more keys.",
+			since:   "1.0.0", group: "generic", complexity: "O(N) where N is the number of keys that will be removed.",
+			arguments: []commandArg{{name: "key", typ: "key", multiple: true}},
+		},
+		{
+			name: "keys", arity: 2, flags: flagReadonly, handler: keysCommand,
+			summary: "Returns all key names that match a pattern.",
+			since:   "1.0.0", group: "generic", complexity: "O(N) with N being the number of keys in the database.",
+			arguments: []commandArg{{name: "pattern", typ: "pattern"}},
+		},
+		{
+			name: "type", arity: 2, flags: flagReadonly | flagFast, firstKey: 1, lastKey: 1, keyStep: 1, handler: typeCommand,
+			summary: "Determines the type of value stored at a key.",
+			since:   "1.0.0", group: "generic", complexity: "O(1)",
+			arguments: []commandArg{keyArg},
+		},
+		{
+			name: "scan", arity: -2, flags: flagReadonly, handler: scanCommand,
+			summary: "Iterates over the key names in the database.",
+			since:   "2.8.0", group: "generic", complexity: "O(1) for every call. O(N) for a complete iteration, including enough command calls for the cursor to return back to 0. N is the number of elements inside the collection.",
+			arguments: []commandArg{
+				{name: "cursor", typ: "integer"},
+				{name: "pattern", typ: "pattern", token: "MATCH", optional: true},
+				{name: "count", typ: "integer", token: "COUNT", optional: true},
+				{name: "type", typ: "string", token: "TYPE", optional: true},
+			},
+		},
+		{
+			name: "export", arity: -2, flags: flagReadonly, handler: exportCommand,
+			summary: "Iterates over the keys in the database, returning them with their values and TTLs as NDJSON.",
+			since:   "7.0.0", group: "generic", complexity: "O(1) for every call. O(N) for a complete iteration, N being the number of keys and their elements.",
+			arguments: []commandArg{
+				{name: "cursor", typ: "integer"},
+				{name: "pattern", typ: "pattern", token: "MATCH", optional: true},
+				{name: "count", typ: "integer", token: "COUNT", optional: true},
+			},
+		},
+		{
+			name: "import", arity: -2, flags: flagWrite | flagDenyOOM, handler: importCommand,
+			summary: "Adds the keys of an NDJSON payload, as EXPORT returns them, to the database.",
+			since:   "7.0.0", group: "generic", complexity: "O(N) where N is the number of keys and their elements in the payload.",
+			arguments: []commandArg{
+				{name: "payload", typ: "string"},
+				{name: "conflict", typ: "oneof", token: "CONFLICT", optional: true, args: []commandArg{
+					{name: "fail", typ: "pure-token", token: "FAIL"},
+					{name: "skip", typ: "pure-token", token: "SKIP"},
+					{name: "overwrite", typ: "pure-token", token: "OVERWRITE"},
+				}},
+				{name: "pattern", typ: "pattern", token: "MATCH", optional: true},
+			},
+		},
+		{
+			name: "dump", arity: 2, flags: flagReadonly, firstKey: 1, lastKey: 1, keyStep: 1, handler: dumpCommand,
+			summary: "Returns a serialized representation of the value stored at a key.",
+			since:   "2.6.0", group: "generic", complexity: "O(1) to access the key and additional O(N*M) to serialize it, where N is the number of Redis objects composing the value and M their average size.",
+			arguments: []commandArg{keyArg},
+		},
+		{
+			name: "restore", arity: -4, flags: flagWrite | flagDenyOOM, firstKey: 1, lastKey: 1, keyStep: 1, handler: restoreCommand,
+			summary: "Creates a key from the serialized representation of a value.",
+			since:   "2.6.0", group: "generic", complexity: "O(1) to create the new key and additional O(N*M) to reconstruct the serialized value, where N is the number of Redis objects composing the value and M their average size.",
+			arguments: []commandArg{
+				keyArg,
+				{name: "ttl", typ: "integer"},
+				{name: "serialized-value", typ: "string"},
+				{name: "replace", typ: "pure-token", token: "REPLACE", optional: true},
+				{name: "absttl", typ: "pure-token", token: "ABSTTL", optional: true},
+				{name: "seconds", typ: "integer", token: "IDLETIME", optional: true},
+				{name: "frequency", typ: "integer", token: "FREQ", optional: true},
+			},
+		},
+		{
+			name: "migrate", arity: -6, flags: flagWrite, firstKey: 3, lastKey: 3, keyStep: 1, getKeys: migrateKeys, handler: migrateCommand,
+			summary: "Atomically transfers a key from one instance to another.",
+			since:   "2.6.0", group: "generic", complexity: "This command actually executes a DUMP+DEL in the source instance, and a RESTORE in the target instance.",
+			arguments: []commandArg{
+				{name: "host", typ: "string"},
+				{name: "port", typ: "integer"},
+				{name: "key-selector", typ: "oneof", args: []commandArg{
+					keyArg,
+					{name: "empty-string", typ: "pure-token", token: `""`},
+				}},
+				{name: "destination-db", typ: "integer"},
+				{name: "timeout", typ: "integer"},
+				{name: "copy", typ: "pure-token", token: "COPY", optional: true},
+				{name: "replace", typ: "pure-token", token: "REPLACE", optional: true},
+				{name: "authentication", typ: "oneof", optional: true, args: []commandArg{
+					{name: "auth", typ: "string", token: "AUTH"},
+					{name: "auth2", typ: "block", token: "AUTH2", args: []commandArg{
+						{name: "username", typ: "string"},
+						{name: "password", typ: "string"},
+					}},
+				}},
+				{name: "keys", typ: "key", token: "KEYS", optional: true, multiple: true},
+			},
+		},
+		{
+			name: "dbsize", arity: 1, flags: flagReadonly | flagFast, handler: dbsizeCommand,
+			summary: "Returns the number of keys in the database.",
+			since:   "1.0.0", group: "server", complexity: "O(1)",
+		},
+		{
+			name: "expire", arity: 3, flags: flagWrite | flagFast, firstKey: 1, lastKey: 1, keyStep: 1, handler: expireCommand,
+			summary: "Sets the expiration time of a key in seconds.",
+			since:   "1.0.0", group: "generic", complexity: "O(1)",
+			arguments: []commandArg{keyArg, {name: "seconds", typ: "integer"}},
+		},
+		{
+			name: "pexpireat", arity: 3, flags: flagWrite | flagFast, firstKey: 1, lastKey: 1, keyStep: 1, handler: pexpireatCommand,
+			summary: "Sets the expiration time of a key to a Unix milliseconds timestamp.",
+			since:   "2.6.0", group: "generic", complexity: "O(1)",
+			arguments: []commandArg{keyArg, {name: "unix-time-milliseconds", typ: "unix-time"}},
+		},
+		{
+			name: "ttl", arity: 2, flags: flagReadonly | flagFast, firstKey: 1, lastKey: 1, keyStep: 1, handler: ttlCommand,
+			summary: "Returns the expiration time in seconds of a key.",
+			since:   "1.0.0", group: "generic", complexity: "O(1)",
+			arguments: []commandArg{keyArg},
+		},
+		{
+			name: "strlen", arity: 2, flags: flagReadonly | flagFast, firstKey: 1, lastKey: 1, keyStep: 1, handler: strlenCommand,
+			summary: "Returns the length of a string value.",
+			since:   "2.2.0", group: "string", complexity: "O(1)",
+			arguments: []commandArg{keyArg},
+		},
+		{
+			name: "zadd", arity: -4, flags: flagWrite | flagDenyOOM | flagFast, firstKey: 1, lastKey: 1, keyStep: 1, handler: zaddCommand,
+			summary: "Adds one or more members to a sorted set, or updates their scores. Creates the key if it doesn't exist.",
+			since:   "1.2.0", group: "sorted-set", complexity: "O(log(N)) for each item added, where N is the number of elements in the sorted set.",
+			arguments: []commandArg{keyArg, {name: "data", typ: "block", multiple: true, args: []commandArg{
+				{name: "score", typ: "double"},
+				{name: "member", typ: "string"},
+			}}},
+		},
+		{
+			name: "zcard", arity: 2, flags: flagReadonly | flagFast, firstKey: 1, lastKey: 1, keyStep: 1, handler: zcardCommand,
+			summary: "Returns the number of members in a sorted set.",
+			since:   "1.2.0", group: "sorted-set", complexity: "O(1)",
+			arguments: []commandArg{keyArg},
+		},
+		{
+			name: "zrange", arity: 4, flags: flagReadonly, firstKey: 1, lastKey: 1, keyStep: 1, handler: zrangeCommand,
+			summary: "Returns members in a sorted set within a range of indexes.",
+			since:   "1.2.0", group: "sorted-set", complexity: "O(log(N)+M) with N being the number of elements in the sorted set and M the number of elements returned.",
+			arguments: []commandArg{keyArg, {name: "start", typ: "integer"}, {name: "stop", typ: "integer"}},
+		},
+		{
+			name: "command", arity: -1, flags: flagLoading | flagStale, handler: commandCommand,
+			summary: "Returns detailed information about all commands.",
+			since:   "2.8.13", group: "server", complexity: "O(N) where N is the total number of Redis commands",
+			subcommands: []*command{
+				{
+					name: "count", arity: 2, flags: flagLoading | flagStale, handler: commandCountCommand,
+					summary: "Returns a count of commands.", since: "2.8.13", complexity: "O(1)",
+				},
+				{
+					name: "info", arity: -2, flags: flagLoading | flagStale, handler: commandInfoCommand,
+					summary: "Returns information about one, multiple or all commands.",
+					since:   "2.8.13", complexity: "O(N) where N is the number of commands to look up",
+					arguments: []commandArg{{name: "command-name", typ: "string", optional: true, multiple: true}},
+				},
+				{
+					name: "docs", arity: -2, flags: flagLoading | flagStale, handler: commandDocsCommand,
+					summary: "Returns documentary information about one, multiple or all commands.",
+					since:   "7.0.0", complexity: "O(N) where N is the number of commands to look up",
+					arguments: []commandArg{{name: "command-name", typ: "string", optional: true, multiple: true}},
+				},
+				{
+					name: "getkeys", arity: -3, handler: commandGetKeysCommand,
+					summary: "Extracts the key names from an arbitrary command.",
+					since:   "2.8.13", complexity: "O(N) where N is the number of arguments to the command",
+					arguments: []commandArg{{name: "command", typ: "string"}, {name: "arg", typ: "string", optional: true, multiple: true}},
+				},
+				{
+					name: "help", arity: 2, flags: flagLoading | flagStale, handler: commandHelpCommand,
+					summary: "Returns helpful text about the different subcommands.", since: "5.0.0", complexity: "O(1)",
+				},
+			},
+		},
+		{
+			name: "client", arity: -2, handler: clientHelpCommand,
+			summary: "A container for client connection commands.",
+			since:   "2.4.0", group: "connection", complexity: "Depends on subcommand.",
+			subcommands: []*command{
+				{
+					name: "id", arity: 2, flags: flagLoading | flagStale, handler: clientIDCommand,
+					summary: "Returns the unique client ID of the connection.", since: "5.0.0", complexity: "O(1)",
+				},
+				{
+					name: "getname", arity: 2, flags: flagLoading | flagStale, handler: clientGetNameCommand,
+					summary: "Returns the name of the connection.", since: "2.6.9", complexity: "O(1)",
+				},
+				{
+					name: "setname", arity: 3, flags: flagLoading | flagStale, handler: clientSetNameCommand,
+					summary: "Sets the connection name.", since: "2.6.9", complexity: "O(1)",
+					arguments: []commandArg{{name: "connection-name", typ: "string"}},
+				},
+				{
+					name: "info", arity: 2, flags: flagLoading | flagStale, handler: clientInfoCommand,
+					summary: "Returns information about the connection.", since: "6.2.0", complexity: "O(1)",
+				},
+				{
+					name: "list", arity: -2, flags: flagLoading | flagStale, handler: clientListCommand,
+					summary: "Lists open connections.", since: "2.4.0", complexity: "O(N) where N is the number of client connections",
+					arguments: []commandArg{
+						{name: "client-type", typ: "oneof", token: "TYPE", optional: true, args: []commandArg{
+							{name: "normal", typ: "pure-token", token: "NORMAL"},
+							{name: "master", typ: "pure-token", token: "MASTER"},
+							{name: "replica", typ: "pure-token", token: "REPLICA"},
+							{name: "pubsub", typ: "pure-token", token: "PUBSUB"},
+						}},
+						{name: "client-id", typ: "integer", token: "ID", optional: true, multiple: true},
+					},
+				},
+				{
+					name: "kill", arity: -3, flags: flagLoading | flagStale, handler: clientKillCommand,
+					summary: "Terminates open connections.", since: "2.4.0", complexity: "O(N) where N is the number of client connections",
+					arguments: []commandArg{{name: "filter", typ: "oneof", args: []commandArg{
+						{name: "old-format", typ: "string"},
+						{name: "new-format", typ: "oneof", multiple: true, args: []commandArg{
+							{name: "client-id", typ: "integer", token: "ID", optional: true},
+							{name: "client-type", typ: "string", token: "TYPE", optional: true},
+							{name: "username", typ: "string", token: "USER", optional: true},
+							{name: "addr", typ: "string", token: "ADDR", optional: true},
+							{name: "laddr", typ: "string", token: "LADDR", optional: true},
+							{name: "skipme", typ: "string", token: "SKIPME", optional: true},
+							{name: "maxage", typ: "integer", token: "MAXAGE", optional: true},
+						}},
+					}}},
+				},
+				{
+					name: "pause", arity: -3, flags: flagLoading | flagStale, handler: clientPauseCommand,
+					summary: "Suspends commands processing.", since: "3.0.0", complexity: "O(1)",
+					arguments: []commandArg{
+						{name: "timeout", typ: "integer"},
+						{name: "mode", typ: "oneof", optional: true, args: []commandArg{
+							{name: "write", typ: "pure-token", token: "WRITE"},
+							{name: "all", typ: "pure-token", token: "ALL"},
+						}},
+					},
+				},
+				{
+					name: "unpause", arity: 2, flags: flagLoading | flagStale, handler: clientUnpauseCommand,
+					summary: "Resumes processing commands from paused clients.", since: "6.2.0", complexity: "O(N) Where N is the number of paused clients",
+				},
+				{
+					name: "no-evict", arity: 3, flags: flagLoading | flagStale, handler: clientNoEvictCommand,
+					summary: "Sets the client eviction mode of the connection.", since: "7.0.0", complexity: "O(1)",
+					arguments: []commandArg{{name: "enabled", typ: "oneof", args: []commandArg{
+						{name: "on", typ: "pure-token", token: "ON"},
+						{name: "off", typ: "pure-token", token: "OFF"},
+					}}},
+				},
+				{
+					name: "reply", arity: 3, flags: flagLoading | flagStale, handler: clientReplyCommand,
+					summary: "Instructs the server whether to reply to commands.", since: "3.2.0", complexity: "O(1)",
+					arguments: []commandArg{{name: "action", typ: "oneof", args: []commandArg{
+						{name: "on", typ: "pure-token", token: "ON"},
+						{name: "off", typ: "pure-token", token: "OFF"},
+						{name: "skip", typ: "pure-token", token: "SKIP"},
+					}}},
+				},
+				{
+					name: "help", arity: 2, flags: flagLoading | flagStale, handler: clientHelpCommand,
+					summary: "Returns helpful text about the different subcommands.", since: "5.0.0", complexity: "O(1)",
+				},
+			},
+		},
+		{
+			name: "config", arity: -2, handler: configHelpCommand,
+			summary: "A container for server configuration commands.",
+			since:   "2.0.0", group: "server", complexity: "Depends on subcommand.",
+			subcommands: []*command{
+				{
+					name: "get", arity: -3, flags: flagLoading | flagStale, handler: configGetCommand,
+					summary: "Returns the effective values of configuration parameters.",
+					since:   "2.0.0", complexity: "O(N) when N is the number of configuration parameters provided",
+					arguments: []commandArg{{name: "parameter", typ: "string", multiple: true}},
+				},
+				{
+					name: "set", arity: -4, flags: flagLoading | flagStale, handler: configSetCommand,
+					summary: "Sets configuration parameters in-flight.",
+					since:   "2.0.0", complexity: "O(N) when N is the number of configuration parameters provided",
+					arguments: []commandArg{{name: "data", typ: "block", multiple: true, args: []commandArg{
+						{name: "parameter", typ: "string"},
+						{name: "value", typ: "string"},
+					}}},
+				},
+				{
+					name: "resetstat", arity: 2, flags: flagLoading | flagStale, handler: configResetStatCommand,
+					summary: "Resets the server's statistics.", since: "2.0.0", complexity: "O(1)",
+				},
+				{
+					name: "rewrite", arity: 2, flags: flagLoading | flagStale, handler: configRewriteCommand,
+					summary: "Persists the effective configuration to file.", since: "2.8.0", complexity: "O(1)",
+				},
+				{
+					name: "help", arity: 2, flags: flagLoading | flagStale, handler: configHelpCommand,
+					summary: "Returns helpful text about the different subcommands.", since: "5.0.0", complexity: "O(1)",
+				},
+			},
+		},
+		{
+			name: "info", arity: -1, flags: flagLoading | flagStale, handler: infoCommand,
+			summary: "Returns information and statistics about the server.",
+			since:   "1.0.0", group: "server", complexity: "O(1)",
+			arguments: []commandArg{{name: "section", typ: "string", optional: true, multiple: true}},
+		},
+		{
+			name: "memory", arity: -2, handler: memoryHelpCommand,
+			summary: "A container for memory diagnostics commands.",
+			since:   "4.0.0", group: "server", complexity: "Depends on subcommand.",
+			subcommands: []*command{
+				{
+					name: "usage", arity: -3, flags: flagReadonly, firstKey: 2, lastKey: 2, keyStep: 1, handler: memoryUsageCommand,
+					summary: "Estimates the memory usage of a key.",
+					since:   "4.0.0", complexity: "O(N) where N is the number of samples.",
+					arguments: []commandArg{keyArg, {name: "count", typ: "integer", token: "SAMPLES", optional: true}},
+				},
+				{
+					name: "help", arity: 2, flags: flagLoading | flagStale, handler: memoryHelpCommand,
+					summary: "Returns helpful text about the different subcommands.", since: "4.0.0", complexity: "O(1)",
+				},
+			},
+		},
+		{
+			name: "save", arity: 1, handler: saveCommand,
+			summary: "Synchronously saves the database(s) to disk.",
+			since:   "1.0.0", group: "server", complexity: "O(N) where N is the total number of keys in all databases",
+		},
+		{
+			name: "bgsave", arity: -1, handler: bgsaveCommand,
+			summary: "Asynchronously saves the database(s) to disk.",
+			since:   "1.0.0", group: "server", complexity: "O(1)",
+			arguments: []commandArg{{name: "schedule", typ: "pure-token", token: "SCHEDULE", optional: true}},
+		},
+		{
+			name: "bgrewriteaof", arity: 1, handler: bgrewriteaofCommand,
+			summary: "Asynchronously rewrites the append-only file to disk.",
+			since:   "1.0.0", group: "server", complexity: "O(1)",
+		},
+		{
+			name: "lastsave", arity: 1, flags: flagFast | flagLoading | flagStale, handler: lastsaveCommand,
+			summary: "Returns the Unix timestamp of the last successful save to disk.",
+			since:   "1.0.0", group: "server", complexity: "O(1)",
+		},
+		{
+			name: "replicaof", arity: 3, flags: flagStale, handler: replicaofCommand,
+			summary: "Configures a server as replica of another, or promotes it to a master.",
+			since:   "5.0.0", group: "server", complexity: "O(1)",
+			arguments: []commandArg{
+				{name: "args", typ: "oneof", args: []commandArg{
+					{name: "host-port", typ: "block", args: []commandArg{
+						{name: "host", typ: "string"},
+						{name: "port", typ: "integer"},
+					}},
+					{name: "no-one", typ: "block", args: []commandArg{
+						{name: "no", typ: "pure-token", token: "NO"},
+						{name: "one", typ: "pure-token", token: "ONE"},
+					}},
+				}},
+			},
+		},
+		{
+			name: "slaveof", arity: 3, flags: flagStale, handler: replicaofCommand,
+			summary: "Sets a Redis server as a replica of another, or promotes it to being a master.",
+			since:   "1.0.0", group: "server", complexity: "O(1)",
+			arguments: []commandArg{
+				{name: "args", typ: "oneof", args: []commandArg{
+					{name: "host-port", typ: "block", args: []commandArg{
+						{name: "host", typ: "string"},
+						{name: "port", typ: "integer"},
+					}},
+					{name: "no-one", typ: "block", args: []commandArg{
+						{name: "no", typ: "pure-token", token: "NO"},
+						{name: "one", typ: "pure-token", token: "ONE"},
+					}},
+				}},
+			},
+		},
+		{
+			name: "role", arity: 1, flags: flagFast | flagLoading | flagStale, handler: roleCommand,
+			summary: "Returns the replication role.",
+			since:   "2.8.12", group: "server", complexity: "O(1)",
+		},
+		{
+			name: "wait", arity: 3, flags: flagBlocking, handler: waitCommand,
+			summary: "Blocks until the asynchronous replication of all preceding write commands sent by the connection is completed.",
+			since:   "3.0.0", group: "generic", complexity: "O(1)",
+			arguments: []commandArg{
+				{name: "numreplicas", typ: "integer"},
+				{name: "timeout", typ: "integer"},
+			},
+		},
+		{
+			name: "replconf", arity: -1, flags: flagLoading | flagStale, handler: replconfCommand,
+			summary: "An internal command for configuring the replication stream.",
+			since:   "3.0.0", group: "server", complexity: "O(1)",
+		},
+		{
+			name: "psync", arity: -3, handler: psyncCommand,
+			summary: "An internal command used in replication.",
+			since:   "2.8.0", group: "server", complexity: "",
+			arguments: []commandArg{
+				{name: "replicationid", typ: "string"},
+				{name: "offset", typ: "integer"},
+			},
+		},
+		{
+			name: "sync", arity: 1, handler: syncCommand,
+			summary: "An internal command used in replication.",
+			since:   "1.0.0", group: "server", complexity: "",
+		},
+		{
+			name: "restore-asking", arity: -4, flags: flagWrite | flagDenyOOM | flagAsking, firstKey: 1, lastKey: 1, keyStep: 1, handler: restoreCommand,
+			summary: "An internal command for migrating keys in a cluster.",
+			since:   "3.0.0", group: "server", complexity: "O(1) to create the new key and additional O(N*M) to reconstruct the serialized value, where N is the number of Redis objects composing the value and M their average size.",
+			arguments: []commandArg{
+				keyArg,
+				{name: "ttl", typ: "integer"},
+				{name: "serialized-value", typ: "string"},
+				{name: "replace", typ: "pure-token", token: "REPLACE", optional: true},
+				{name: "absttl", typ: "pure-token", token: "ABSTTL", optional: true},
+				{name: "seconds", typ: "integer", token: "IDLETIME", optional: true},
+				{name: "frequency", typ: "integer", token: "FREQ", optional: true},
+			},
+		},
+		{
+			name: "asking", arity: 1, flags: flagFast, handler: askingCommand,
+			summary: "Signals that a cluster client is following an -ASK redirect.",
+			since:   "3.0.0", group: "cluster", complexity: "O(1)",
+		},
+		{
+			name: "cluster", arity: -2, handler: clusterHelpCommand,
+			summary: "A container for Redis Cluster commands.",
+			since:   "3.0.0", group: "cluster", complexity: "Depends on subcommand.",
+			subcommands: []*command{
+				{
+					name: "info", arity: 2, flags: flagStale, handler: clusterInfoCommand,
+					summary: "Returns information about the state of a node.", since: "3.0.0", complexity: "O(1)",
+				},
+				{
+					name: "myid", arity: 2, flags: flagStale, handler: clusterMyIDCommand,
+					summary: "Returns the ID of a node.", since: "3.0.0", complexity: "O(1)",
+				},
+				{
+					name: "nodes", arity: 2, flags: flagStale, handler: clusterNodesCommand,
+					summary: "Returns the cluster configuration for a node.", since: "3.0.0", complexity: "O(N) where N is the total number of Cluster nodes",
+				},
+				{
+					name: "slots", arity: 2, flags: flagStale, handler: clusterSlotsCommand,
+					summary: "Returns the mapping of cluster slots to nodes.", since: "3.0.0", complexity: "O(N) where N is the total number of Cluster nodes",
+				},
+				{
+					name: "shards", arity: 2, flags: flagStale, handler: clusterShardsCommand,
+					summary: "Returns the mapping of cluster slots to shards.", since: "7.0.0", complexity: "O(N) where N is the total number of cluster nodes",
+				},
+				{
+					name: "keyslot", arity: 3, flags: flagStale, handler: clusterKeySlotCommand,
+					summary: "Returns the hash slot for a key.", since: "3.0.0", complexity: "O(N) where N is the number of bytes in the key",
+					arguments: []commandArg{{name: "key", typ: "string"}},
+				},
+				{
+					name: "countkeysinslot", arity: 3, flags: flagStale, handler: clusterCountKeysInSlotCommand,
+					summary: "Returns the number of keys in a hash slot.", since: "3.0.0", complexity: "O(N) where N is the number of keys in the database",
+					arguments: []commandArg{{name: "slot", typ: "integer"}},
+				},
+				{
+					name: "getkeysinslot", arity: 4, flags: flagStale, handler: clusterGetKeysInSlotCommand,
+					summary: "Returns the key names in a hash slot.", since: "3.0.0", complexity: "O(N) where N is the number of keys in the database",
+					arguments: []commandArg{{name: "slot", typ: "integer"}, {name: "count", typ: "integer"}},
+				},
+				{
+					name: "addslots", arity: -3, flags: flagStale, handler: clusterAddSlotsCommand,
+					summary: "Assigns new hash slots to a node.", since: "3.0.0", complexity: "O(N) where N is the total number of hash slot arguments",
+					arguments: []commandArg{{name: "slot", typ: "integer", multiple: true}},
+				},
+				{
+					name: "addslotsrange", arity: -4, flags: flagStale, handler: clusterAddSlotsRangeCommand,
+					summary: "Assigns new hash slot ranges to a node.", since: "7.0.0", complexity: "O(N) where N is the total number of the slots between the start slot and end slot arguments.",
+					arguments: []commandArg{slotRangeArg},
+				},
+				{
+					name: "delslots", arity: -3, flags: flagStale, handler: clusterDelSlotsCommand,
+					summary: "Sets hash slots as unbound for a node.", since: "3.0.0", complexity: "O(N) where N is the total number of hash slot arguments",
+					arguments: []commandArg{{name: "slot", typ: "integer", multiple: true}},
+				},
+				{
+					name: "delslotsrange", arity: -4, flags: flagStale, handler: clusterDelSlotsRangeCommand,
+					summary: "Sets hash slot ranges as unbound for a node.", since: "7.0.0", complexity: "O(N) where N is the total number of the slots between the start slot and end slot arguments.",
+					arguments: []commandArg{slotRangeArg},
+				},
+				{
+					name: "setslot", arity: -4, flags: flagStale, handler: clusterSetSlotCommand,
+					summary: "Binds a hash slot to a node.", since: "3.0.0", complexity: "O(1)",
+					arguments: []commandArg{{name: "slot", typ: "integer"}, {name: "subcommand", typ: "oneof", args: []commandArg{
+						{name: "node-id", typ: "string", token: "IMPORTING"},
+						{name: "node-id", typ: "string", token: "MIGRATING"},
+						{name: "node-id", typ: "string", token: "NODE"},
+						{name: "stable", typ: "pure-token", token: "STABLE"},
+					}}},
+				},
+				{
+					name: "meet", arity: 4, flags: flagStale, handler: clusterMeetCommand,
+					summary: "Forces a node to handshake with another node.", since: "3.0.0", complexity: "O(1)",
+					arguments: []commandArg{{name: "ip", typ: "string"}, {name: "port", typ: "integer"}},
+				},
+				{
+					name: "forget", arity: 3, flags: flagStale, handler: clusterForgetCommand,
+					summary: "Removes a node from the nodes table.", since: "3.0.0", complexity: "O(1)",
+					arguments: []commandArg{{name: "node-id", typ: "string"}},
+				},
+				{
+					name: "saveconfig", arity: 2, flags: flagStale, handler: clusterSaveConfigCommand,
+					summary: "Forces a node to save the cluster configuration to disk.", since: "3.0.0", complexity: "O(1)",
+				},
+				{
+					name: "bus", arity: 3, flags: flagLoading | flagStale, handler: clusterBusCommand,
+					summary: "An internal command carrying the messages nodes gossip with.", since: "3.0.0", complexity: "O(N) where N is the total number of Cluster nodes",
+					arguments: []commandArg{{name: "message", typ: "string"}},
+				},
+				{
+					name: "help", arity: 2, flags: flagLoading | flagStale, handler: clusterHelpCommand,
+					summary: "Returns helpful text about the different subcommands.", since: "5.0.0", complexity: "O(1)",
+				},
+			},
+		},
+	} {
+		registerCommand(cmd)
+	}
+}
@@ -0,0 +1,1239 @@
+package server
+
+import (
+	"basic-go-redis/internal/protocol"
+	"basic-go-redis/internal/rdb"
+	"basic-go-redis/pkg/config"
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// request splits a space separated command line into request arguments.
+func request(line string) [][]byte {
+	var args [][]byte
+	for _, field := range strings.Fields(line) {
+		args = append(args, []byte(field))
+	}
+	return args
+}
+
+// newTestClient registers a client on one end of an in-memory connection.
+func newTestClient(s *Server) *client {
+	conn, _ := net.Pipe()
+	return s.newClient(conn)
+}
+
+func TestLookupCommandIsCaseInsensitive(t *testing.T) {
+	for _, name := range []string{"get", "GET", "Get", "gEt"} {
+		cmd := lookupCommand([]byte(name))
+		if cmd == nil || cmd.name != "get" {
+			t.Errorf("lookupCommand(%q) = %v, want the get command", name, cmd)
+		}
+	}
+	if cmd := lookupCommand([]byte("nosuchcommand")); cmd != nil {
+		t.Errorf("lookupCommand(%q) = %v, want nil", "nosuchcommand", cmd)
+	}
+}
+
+func TestExecuteCommand(t *testing.T) {
+	s := NewServer("0")
+	c := newTestClient(s)
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"set Key value", "+OK\r\n"},
+		{"GeT Key", "$5\r\nvalue\r\n"},
+		{"get missing", "$-1\r\n"},
+		{"get", "-ERR wrong number of arguments for 'get' command\r\n"},
+		{"GET a b", "-ERR wrong number of arguments for 'get' command\r\n"},
+		{"SET a", "-ERR wrong number of arguments for 'set' command\r\n"},
+		{"DEL", "-ERR wrong number of arguments for 'del' command\r\n"},
+		{"del Key missing", ":1\r\n"},
+		{"FOO bar baz", "-ERR unknown command 'FOO', with args beginning with: 'bar' 'baz' \r\n"},
+		{"foo", "-ERR unknown command 'foo', with args beginning with: \r\n"},
+		{"SELECT 0", "+OK\r\n"},
+		{"select 1", "-ERR DB index is out of range\r\n"},
+		{"select x", "-ERR invalid DB index\r\n"},
+		{"AUTH default secret", "+OK\r\n"},
+		{"AUTH alice secret", "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+	}
+	for _, tt := range tests {
+		if got := s.executeCommand(c, request(tt.line)); got != tt.want {
+			t.Errorf("executeCommand(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestCommandTableIsConsistent(t *testing.T) {
+	for name, cmd := range commandTable {
+		if name != strings.ToLower(name) || name != cmd.name {
+			t.Errorf("command %q is registered under %q", cmd.name, name)
+		}
+		if cmd.arity == 0 || cmd.handler == nil {
+			t.Errorf("command %q has arity %d and handler %v", name, cmd.arity, cmd.handler != nil)
+		}
+		if cmd.flags&flagWrite != 0 && cmd.flags&flagReadonly != 0 {
+			t.Errorf("command %q is flagged both write and readonly", name)
+		}
+	}
+}
+
+func TestCommandIntrospection(t *testing.T) {
+	s := NewServer("0")
+	c := newTestClient(s)
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"COMMAND COUNT", fmt.Sprintf(":%d\r\n", len(commandTable))},
+		{"command getkeys DEL a b c", "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{"COMMAND GETKEYS set k v NX", "*1\r\n$1\r\nk\r\n"},
+		{"COMMAND GETKEYS KEYS *", "-ERR The command has no key arguments\r\n"},
+		{"COMMAND GETKEYS GET", "-ERR Invalid number of arguments specified for command\r\n"},
+		{"COMMAND GETKEYS nosuch k", "-ERR Invalid command specified\r\n"},
+		{"COMMAND INFO nosuch", "*1\r\n*-1\r\n"},
+		{"COMMAND COUNT extra", "-ERR wrong number of arguments for 'command|count' command\r\n"},
+		{"COMMAND nosuch", "-ERR unknown subcommand 'nosuch'. Try COMMAND HELP.\r\n"},
+	}
+	for _, tt := range tests {
+		if got := s.executeCommand(c, request(tt.line)); got != tt.want {
+			t.Errorf("executeCommand(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	info := s.executeCommand(c, request("COMMAND INFO get"))
+	want := "*1\r\n*10\r\n$3\r\nget\r\n:2\r\n*2\r\n+readonly\r\n+fast\r\n:1\r\n:1\r\n:1\r\n"
+	if !strings.HasPrefix(info, want) {
+		t.Errorf("COMMAND INFO get = %q, want prefix %q", info, want)
+	}
+
+	docs := s.executeCommand(c, request("COMMAND DOCS command"))
+	for _, part := range []string{"$7\r\ncommand\r\n", "$7\r\nsummary\r\n", "$11\r\nsubcommands\r\n", "$13\r\ncommand|count\r\n"} {
+		if !strings.Contains(docs, part) {
+			t.Errorf("COMMAND DOCS command = %q, want it to contain %q", docs, part)
+		}
+	}
+}
+
+func TestKeyspaceCommands(t *testing.T) {
+	s := NewServer("0")
+	c := newTestClient(s)
+	for i := 0; i < 250; i++ {
+		s.executeCommand(c, request(fmt.Sprintf("set key:%d value", i)))
+	}
+	s.executeCommand(c, request("zadd myzset 1 a 2 b"))
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"dbsize", ":251\r\n"},
+		{"type key:1", "+string\r\n"},
+		{"TYPE myzset", "+zset\r\n"},
+		{"type missing", "+none\r\n"},
+		{"strlen key:1", ":5\r\n"},
+		{"strlen myzset", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"zcard myzset", ":2\r\n"},
+		{"zcard missing", ":0\r\n"},
+		{"memory usage missing", "$-1\r\n"},
+		{"scan x", "-ERR invalid cursor\r\n"},
+		{"scan 0 count 0", "-ERR syntax error\r\n"},
+		{"scan 0 match", "-ERR syntax error\r\n"},
+		{"memory foo", "-ERR unknown subcommand 'foo'. Try MEMORY HELP.\r\n"},
+	}
+	for _, tt := range tests {
+		if got := s.executeCommand(c, request(tt.line)); got != tt.want {
+			t.Errorf("executeCommand(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+	if got := s.executeCommand(c, request("memory usage key:1 samples 5")); !strings.HasPrefix(got, ":") {
+		t.Errorf("MEMORY USAGE = %q, want an integer", got)
+	}
+
+	// A full iteration returns every key exactly once
+	for _, line := range []string{"scan %s count 7", "scan %s count 1000", "scan %s match key:1* count 20", "scan %s type zset"} {
+		seen := make(map[string]int)
+		cursor := "0"
+		for calls := 0; ; calls++ {
+			if calls > 1000 {
+				t.Fatalf("%s: the cursor never returned to 0", line)
+			}
+			reply, err := protocol.ReadValue(bufio.NewReader(strings.NewReader(s.executeCommand(c, request(fmt.Sprintf(line, cursor))))))
+			if err != nil || len(reply.Elems) != 2 {
+				t.Fatalf("%s: reply %+v, %v", line, reply, err)
+			}
+			for _, key := range reply.Elems[1].Elems {
+				seen[key.Str]++
+			}
+			if cursor = reply.Elems[0].Str; cursor == "0" {
+				break
+			}
+		}
+		want := 251
+		switch {
+		case strings.Contains(line, "match"):
+			want = 111 // key:1, key:10-19 and key:100-199
+		case strings.Contains(line, "zset"):
+			want = 1
+		}
+		if len(seen) != want {
+			t.Errorf("%s: found %d keys, want %d", line, len(seen), want)
+		}
+		for key, n := range seen {
+			if n != 1 {
+				t.Errorf("%s: key %q returned %d times", line, key, n)
+			}
+		}
+	}
+}
+
+func TestInfo(t *testing.T) {
+	s := NewServer("0")
+	c := newTestClient(s)
+	for _, line := range []string{"set a 1", "set b 2", "expire b 100", "get a", "get missing", "zadd z 1 m"} {
+		s.executeCommand(c, request(line))
+	}
+
+	reply, err := protocol.ReadValue(bufio.NewReader(strings.NewReader(s.executeCommand(c, request("info")))))
+	if err != nil || reply.Kind != protocol.KindBulkString {
+		t.Fatalf("INFO = %+v, %v", reply, err)
+	}
+	fields := make(map[string]string)
+	var sections []string
+	for _, line := range strings.Split(reply.Str, "\r\n") {
+		if name, ok := strings.CutPrefix(line, "# "); ok {
+			sections = append(sections, name)
+		} else if name, value, ok := strings.Cut(line, ":"); ok {
+			fields[name] = value
+		}
+	}
+	if got := strings.Join(sections, ","); got != "Server,Clients,Memory,Persistence,Stats,Replication,Cluster,Keyspace" {
+		t.Errorf("INFO sections = %s", got)
+	}
+	for name, want := range map[string]string{
+		"total_commands_processed":    "6",
+		"keyspace_hits":               "1",
+		"keyspace_misses":             "1",
+		"expired_keys":                "0",
+		"connected_clients":           "1",
+		"rdb_changes_since_last_save": "4",
+		"role":                        "master",
+		"redis_mode":                  "standalone",
+		"cluster_enabled":             "0",
+		"db0":                         "keys=3,expires=1,avg_ttl=",
+	} {
+		if got := fields[name]; !strings.HasPrefix(got, want) {
+			t.Errorf("INFO %s = %q, want %q", name, got, want)
+		}
+	}
+	if _, ok := fields["used_memory"]; !ok {
+		t.Error("INFO has no used_memory")
+	}
+
+	// Sections can be picked by name, in any case
+	got := s.executeCommand(c, request("info KEYSPACE stats"))
+	if !strings.Contains(got, "# Stats\r\n") || !strings.Contains(got, "# Keyspace\r\n") || strings.Contains(got, "# Server") {
+		t.Errorf("INFO KEYSPACE stats = %q", got)
+	}
+	if got := s.executeCommand(c, request("info nosuchsection")); got != "$0\r\n\r\n" {
+		t.Errorf("INFO nosuchsection = %q, want an empty bulk string", got)
+	}
+}
+
+func TestClientCommands(t *testing.T) {
+	s := NewServer("0")
+	c := newTestClient(s)
+	other := newTestClient(s)
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"client id", fmt.Sprintf(":%d\r\n", c.id)},
+		{"client getname", "$-1\r\n"},
+		{"client setname worker-1", "+OK\r\n"},
+		{"client getname", "$8\r\nworker-1\r\n"},
+		{"client setname", "-ERR wrong number of arguments for 'client|setname' command\r\n"},
+		{"client list type pubsub", "$0\r\n\r\n"},
+		{"client list type nosuch", "-ERR Unknown client type 'nosuch'\r\n"},
+		{"client list id x", "-ERR Invalid client ID\r\n"},
+		{"client kill id 0", "-ERR client-id should be greater than 0\r\n"},
+		{"client kill 127.0.0.1:1", "-ERR No such client\r\n"},
+		{"client kill id 1 skipme", "-ERR syntax error\r\n"},
+		{"client kill maxage 100", ":0\r\n"},
+		{"client pause -1", "-ERR timeout is negative\r\n"},
+		{"client pause 10 sometimes", "-ERR syntax error\r\n"},
+		{"client no-evict maybe", "-ERR syntax error\r\n"},
+		{"client no-evict on", "+OK\r\n"},
+		{"client nosuch", "-ERR unknown subcommand 'nosuch'. Try CLIENT HELP.\r\n"},
+	}
+	for _, tt := range tests {
+		if got := s.executeCommand(c, request(tt.line)); got != tt.want {
+			t.Errorf("executeCommand(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+	if got := s.executeCommand(c, [][]byte{[]byte("client"), []byte("setname"), []byte("two words")}); !strings.HasPrefix(got, "-ERR Client names cannot contain spaces") {
+		t.Errorf("CLIENT SETNAME with a space = %q", got)
+	}
+
+	info := s.executeCommand(c, request("client info"))
+	for _, field := range []string{fmt.Sprintf("id=%d ", c.id), " name=worker-1 ", " flags=e ", " db=0 ", " cmd=client|info "} {
+		if !strings.Contains(info, field) {
+			t.Errorf("CLIENT INFO = %q, want %q in it", info, field)
+		}
+	}
+	if got := s.executeCommand(c, request(fmt.Sprintf("client list id %d", other.id))); !strings.Contains(got, fmt.Sprintf("id=%d ", other.id)) || strings.Contains(got, "worker-1") {
+		t.Errorf("CLIENT LIST ID %d = %q", other.id, got)
+	}
+}
+
+func TestConfigCommands(t *testing.T) {
+	s := NewServer("0")
+	c := newTestClient(s)
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"config get maxclients", "*2\r\n$10\r\nmaxclients\r\n$5\r\n10000\r\n"},
+		{"config get MAXMEMORY-p* timeout maxmemory-policy", "*4\r\n$16\r\nmaxmemory-policy\r\n$10\r\nnoeviction\r\n$7\r\ntimeout\r\n$1\r\n0\r\n"},
+		{"config get nosuch", "*0\r\n"},
+		{"config set timeout 10 maxclients 50", "+OK\r\n"},
+		{"config get timeout", "*2\r\n$7\r\ntimeout\r\n$2\r\n10\r\n"},
+		{"config set timeout", "-ERR wrong number of arguments for 'config|set' command\r\n"},
+		{"config set timeout 1 maxclients", "-ERR wrong number of arguments for 'config|set' command\r\n"},
+		{"config set nosuch 1", "-ERR Unknown option or number of arguments for CONFIG SET - 'nosuch'\r\n"},
+		{"config set port 7000", "-ERR CONFIG SET failed (possibly related to argument 'port') - can't set immutable config\r\n"},
+		{"config set maxclients 0", "-ERR CONFIG SET failed (possibly related to argument 'maxclients') - argument must be between 1 and 2147483648 inclusive\r\n"},
+		{"config rewrite", "-ERR The server is running without a config file\r\n"},
+		{"config get timeout", "*2\r\n$7\r\ntimeout\r\n$2\r\n10\r\n"},
+		{"set a 1", "+OK\r\n"},
+		{"config resetstat", "+OK\r\n"},
+	}
+	for _, tt := range tests {
+		if got := s.executeCommand(c, request(tt.line)); got != tt.want {
+			t.Errorf("executeCommand(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+	// CONFIG RESETSTAT itself is counted
+	if got := s.executeCommand(c, request("info stats")); !strings.Contains(got, "total_commands_processed:1\r\n") {
+		t.Errorf("INFO after CONFIG RESETSTAT = %q", got)
+	}
+}
+
+func TestMaxMemory(t *testing.T) {
+	s := NewServer("0")
+	c := newTestClient(s)
+	for i := 0; i < 100; i++ {
+		s.executeCommand(c, request(fmt.Sprintf("set key:%d value", i)))
+	}
+
+	// Any heap is over a limit of one byte
+	s.executeCommand(c, request("config set maxmemory 1"))
+	s.enforceMaxMemory()
+	if got := s.executeCommand(c, request("set another value")); got != oomError {
+		t.Errorf("SET over maxmemory = %q, want the OOM error", got)
+	}
+	if got := s.executeCommand(c, request("del key:1")); got != ":1\r\n" {
+		t.Errorf("DEL over maxmemory = %q, want :1", got)
+	}
+
+	s.executeCommand(c, request("config set maxmemory-policy allkeys-random"))
+	s.enforceMaxMemory()
+	if got := s.executeCommand(c, request("dbsize")); got != ":0\r\n" {
+		t.Errorf("DBSIZE after evicting = %q, want every key evicted", got)
+	}
+	if got := s.store.Stats().EvictedKeys; got != 99 {
+		t.Errorf("EvictedKeys = %d, want 99", got)
+	}
+
+	s.executeCommand(c, request("config set maxmemory 0"))
+	s.enforceMaxMemory()
+	if got := s.executeCommand(c, request("set another value")); got != "+OK\r\n" {
+		t.Errorf("SET without maxmemory = %q", got)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	s := NewServer("0")
+	c := newTestClient(s)
+	for _, line := range []string{
+		"config set dir " + dir + " dbfilename test.rdb",
+		"set plain value",
+		"set number 42",
+		"set temp value EX 100",
+		"zadd board 1.5 alice",
+		"zadd board 2 bob",
+	} {
+		if got := s.executeCommand(c, request(line)); strings.HasPrefix(got, "-") {
+			t.Fatalf("%s: %q", line, got)
+		}
+	}
+	if got := s.executeCommand(c, request("config set dbfilename a/b.rdb")); !strings.HasPrefix(got, "-ERR") {
+		t.Errorf("CONFIG SET dbfilename to a path = %q", got)
+	}
+	if got := s.executeCommand(c, request("save")); got != "+OK\r\n" {
+		t.Fatalf("SAVE = %q", got)
+	}
+	if got := s.executeCommand(c, request("info persistence")); !strings.Contains(got, "rdb_changes_since_last_save:0\r\n") {
+		t.Errorf("INFO after SAVE = %q", got)
+	}
+
+	// A BGSAVE snapshot doesn't see writes made after it started
+	s.executeCommand(c, request("set plain changed"))
+	if got := s.executeCommand(c, request("bgsave")); got != "+Background saving started\r\n" {
+		t.Fatalf("BGSAVE = %q", got)
+	}
+	s.executeCommand(c, request("set plain after"))
+	s.executeCommand(c, request("zadd board 3 carol"))
+	for strings.Contains(s.executeCommand(c, request("info persistence")), "rdb_bgsave_in_progress:1") {
+		time.Sleep(time.Millisecond)
+	}
+
+	loaded := NewServer("0")
+	loaded.config.SetRuntime("dir", dir, "dbfilename", "test.rdb")
+	if err := loaded.LoadData(); err != nil {
+		t.Fatalf("LoadData: %v", err)
+	}
+	lc := newTestClient(loaded)
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"get plain", "$7\r\nchanged\r\n"},
+		{"get number", "$2\r\n42\r\n"},
+		{"ttl temp", ":99\r\n"},
+		{"zrange board 0 -1", "*2\r\n$5\r\nalice\r\n$3\r\nbob\r\n"},
+		{"dbsize", ":4\r\n"},
+	}
+	for _, tt := range tests {
+		if got := loaded.executeCommand(lc, request(tt.line)); got != tt.want {
+			t.Errorf("after loading, %q = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+	if got := s.executeCommand(c, request("lastsave")); got == ":0\r\n" || got[0] != ':' {
+		t.Errorf("LASTSAVE = %q", got)
+	}
+}
+
+func TestImportRDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redis.rdb")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := rdb.NewEncoder(f)
+	enc.Header("redis-ver", "7.2.4")
+	enc.SelectDB(0, 3, 1)
+	enc.String("greeting", "hello", time.Time{})
+	enc.String("temp", "value", time.Now().Add(time.Hour))
+	enc.String("gone", "value", time.Now().Add(-time.Hour))
+	enc.ZSet("board", map[string]float64{"alice": 1}, time.Time{})
+	enc.SelectDB(1, 1, 0)
+	enc.String("other", "value", time.Time{})
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	s := NewServer("0")
+	c := newTestClient(s)
+	s.executeCommand(c, request("set greeting old"))
+	s.executeCommand(c, request("set kept value"))
+	if err := s.ImportRDB(path, 0); err != nil {
+		t.Fatalf("ImportRDB: %v", err)
+	}
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"get greeting", "$5\r\nhello\r\n"},
+		{"get kept", "$5\r\nvalue\r\n"},
+		{"ttl temp", ":3599\r\n"},
+		{"type gone", "+none\r\n"},
+		{"type other", "+none\r\n"},
+		{"zrange board 0 -1", "*1\r\n$5\r\nalice\r\n"},
+	}
+	for _, tt := range tests {
+		if got := s.executeCommand(c, request(tt.line)); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+	if got := s.executeCommand(c, request("info persistence")); !strings.Contains(got, "rdb_changes_since_last_save:5\r\n") {
+		t.Errorf("INFO after import = %q", got)
+	}
+	if err := s.ImportRDB(filepath.Join(t.TempDir(), "missing.rdb"), 0); err == nil {
+		t.Error("importing a missing file succeeded")
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.New()
+	cfg.Set("dir", dir)
+	cfg.Set("appendonly", "yes")
+	s := NewServerWithConfig(cfg)
+	if err := s.LoadData(); err != nil {
+		t.Fatalf("LoadData: %v", err)
+	}
+	c := newTestClient(s)
+	for _, line := range []string{"set user:1 alice", "set temp value EX 100", "zadd user:board 1.5 alice 2 bob", "set other x"} {
+		s.executeCommand(c, request(line))
+	}
+
+	reply := s.executeCommand(c, request("export 0 match user:*"))
+	want := "*2\r\n$1\r\n0\r\n"
+	if !strings.HasPrefix(reply, want) {
+		t.Fatalf("EXPORT = %q", reply)
+	}
+	for _, line := range []string{
+		`{"key":"user:1","type":"string","value":"alice"}` + "\n",
+		`{"key":"user:board","type":"zset","value":[{"member":"alice","score":1.5},{"member":"bob","score":2}]}` + "\n",
+	} {
+		if !strings.Contains(reply, line) {
+			t.Errorf("EXPORT doesn't hold %s: %q", line, reply)
+		}
+	}
+	if strings.Contains(reply, "other") || strings.Contains(reply, "temp") {
+		t.Errorf("EXPORT ignored MATCH: %q", reply)
+	}
+
+	payload := `{"key":"user:1","type":"string","value":"changed"}
+{"key":"user:2","type":"string","value":"carol","ttl":60000}
+{"key":"expired","type":"string","value":"x","expire_at":1000}
+`
+	importArgs := func(opts ...string) [][]byte {
+		args := [][]byte{[]byte("import"), []byte(payload)}
+		for _, opt := range opts {
+			args = append(args, []byte(opt))
+		}
+		return args
+	}
+	tests := []struct {
+		args [][]byte
+		want string
+	}{
+		{importArgs(), "-BUSYKEY Target key name already exists.\r\n"},
+		{[][]byte{[]byte("get"), []byte("user:2")}, "$-1\r\n"},
+		{importArgs("CONFLICT", "skip"), ":1\r\n"},
+		{[][]byte{[]byte("get"), []byte("user:1")}, "$5\r\nalice\r\n"},
+		{[][]byte{[]byte("ttl"), []byte("user:2")}, ":59\r\n"},
+		{importArgs("CONFLICT", "overwrite", "MATCH", "user:1"), ":1\r\n"},
+		{[][]byte{[]byte("get"), []byte("user:1")}, "$7\r\nchanged\r\n"},
+		{[][]byte{[]byte("type"), []byte("expired")}, "+none\r\n"},
+		{importArgs("CONFLICT", "maybe"), "-ERR syntax error\r\n"},
+		{[][]byte{[]byte("import"), []byte("{\"key\":\"a\"}")}, "-ERR invalid payload: line 1: no value\r\n"},
+	}
+	for i, tt := range tests {
+		if got := s.executeCommand(c, tt.args); got != tt.want {
+			t.Errorf("%d: %s = %q, want %q", i, tt.args[0], got, tt.want)
+		}
+	}
+	s.Close()
+
+	// The AOF logs the keys written, which replay to the same dataset
+	loaded := NewServerWithConfig(cfg)
+	if err := loaded.LoadData(); err != nil {
+		t.Fatalf("LoadData: %v", err)
+	}
+	defer loaded.Close()
+	lc := newTestClient(loaded)
+	for line, want := range map[string]string{
+		"get user:1":   "$7\r\nchanged\r\n",
+		"get user:2":   "$5\r\ncarol\r\n",
+		"ttl user:2":   ":59\r\n",
+		"type expired": "+none\r\n",
+	} {
+		if got := loaded.executeCommand(lc, request(line)); got != want {
+			t.Errorf("after reload, %s = %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestDumpRestoreMigrate(t *testing.T) {
+	s := NewServer("0")
+	c := newTestClient(s)
+	s.executeCommand(c, request("set greeting hello"))
+	s.executeCommand(c, request("zadd board 1.5 alice 2 bob"))
+	s.executeCommand(c, request("expire board 100"))
+
+	payload := s.executeCommand(c, request("dump board"))
+	if !strings.HasPrefix(payload, "$") {
+		t.Fatalf("DUMP = %q", payload)
+	}
+	value := []byte(strings.SplitN(payload, "\r\n", 2)[1])
+	value = value[:len(value)-2]
+	restore := func(key, ttl string, opts ...string) string {
+		args := [][]byte{[]byte("restore"), []byte(key), []byte(ttl), value}
+		for _, opt := range opts {
+			args = append(args, []byte(opt))
+		}
+		return s.executeCommand(c, args)
+	}
+	damaged := append([]byte(nil), value...)
+	damaged[2] ^= 1
+	// A list and a sorted set of 2^31 entries, with a valid checksum
+	hugeList := []byte("\x01\x80\x7f\xff\xff\xff\t\x00\a\xb1^\xe1\x9cy\xbc\x1e")
+	hugeZSet := []byte("\x05\x80\x7f\xff\xff\xff\t\x00\x17\xa0\xe3\xc4\xcby\xc8\xfe")
+	tests := []struct {
+		reply string
+		want  string
+	}{
+		{s.executeCommand(c, request("dump missing")), "$-1\r\n"},
+		{restore("board", "0"), "-BUSYKEY Target key name already exists.\r\n"},
+		{restore("copy", "-1"), "-ERR Invalid TTL value, must be >= 0\r\n"},
+		{restore("copy", "5000", "IDLETIME", "10"), "+OK\r\n"},
+		{s.executeCommand(c, request("ttl copy")), ":4\r\n"},
+		{s.executeCommand(c, request("zrange copy 0 -1")), "*2\r\n$5\r\nalice\r\n$3\r\nbob\r\n"},
+		{restore("copy", "1000", "ABSTTL", "REPLACE"), "+OK\r\n"},
+		{s.executeCommand(c, request("type copy")), "+none\r\n"},
+		{s.executeCommand(c, [][]byte{[]byte("restore"), []byte("x"), []byte("0"), damaged}), "-ERR DUMP payload version or checksum are wrong\r\n"},
+		{s.executeCommand(c, [][]byte{[]byte("restore"), []byte("x"), []byte("0"), hugeList}), "-ERR Bad data format\r\n"},
+		{s.executeCommand(c, [][]byte{[]byte("restore"), []byte("x"), []byte("0"), hugeZSet}), "-ERR Bad data format\r\n"},
+		{s.executeCommand(c, request("migrate 127.0.0.1 12413 missing 0 1000")), "+NOKEY\r\n"},
+	}
+	for i, tt := range tests {
+		if tt.reply != tt.want {
+			t.Errorf("%d: got %q, want %q", i, tt.reply, tt.want)
+		}
+	}
+
+	target := startTestServer("12413")
+	defer target.Close()
+	tc := newTestClient(target)
+	target.executeCommand(tc, request("set greeting taken"))
+	migrateKeys := request("migrate 127.0.0.1 12413 - 0 1000 KEYS board greeting")
+	migrateKeys[3] = nil
+	if got := s.executeCommand(c, migrateKeys); !strings.HasPrefix(got, "-ERR Target instance replied with error: BUSYKEY") {
+		t.Errorf("MIGRATE onto an existing key = %q", got)
+	}
+	// The key the target took is moved, the other kept
+	if got := s.executeCommand(c, request("type board")); got != "+none\r\n" {
+		t.Errorf("board after MIGRATE = %q", got)
+	}
+	// startTestServer waited a second
+	if got := target.executeCommand(tc, request("ttl board")); got != ":98\r\n" && got != ":99\r\n" {
+		t.Errorf("TTL on the target = %q", got)
+	}
+	if got := s.executeCommand(c, request("migrate 127.0.0.1 12413 greeting 0 1000 COPY REPLACE")); got != "+OK\r\n" {
+		t.Errorf("MIGRATE COPY REPLACE = %q", got)
+	}
+	if got := s.executeCommand(c, request("get greeting")); got != "$5\r\nhello\r\n" {
+		t.Errorf("greeting after COPY = %q", got)
+	}
+	if got := target.executeCommand(tc, request("get greeting")); got != "$5\r\nhello\r\n" {
+		t.Errorf("greeting on the target = %q", got)
+	}
+	if got := s.executeCommand(c, request("migrate 127.0.0.1 12413 greeting 3 1000")); !strings.HasPrefix(got, "-ERR Target instance replied with error: ERR DB index") {
+		t.Errorf("MIGRATE to db 3 = %q", got)
+	}
+}
+
+func TestAppendOnlyFile(t *testing.T) {
+	dir := t.TempDir()
+	newAOFServer := func() *Server {
+		cfg := config.New()
+		cfg.Set("dir", dir)
+		cfg.Set("appendonly", "yes")
+		cfg.Set("appendfsync", "always")
+		s := NewServerWithConfig(cfg)
+		if err := s.LoadData(); err != nil {
+			t.Fatalf("LoadData: %v", err)
+		}
+		return s
+	}
+
+	s := newAOFServer()
+	c := newTestClient(s)
+	for _, line := range []string{
+		"set plain value",
+		"set temp value EX 100",
+		"set gone value",
+		"del gone",
+		"zadd board 1.5 alice 2 bob",
+		"expire board 200",
+		"get plain",
+		// Writes that change nothing aren't logged nor counted
+		"del missing",
+		"expire missing 10",
+		"zadd board 2 bob",
+	} {
+		s.executeCommand(c, request(line))
+	}
+	if dirty := s.dirty.Load(); dirty != 6 {
+		t.Errorf("%d changes counted, want 6", dirty)
+	}
+	s.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, "appendonly.aof"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"$4\r\nPXAT\r\n", "$9\r\nPEXPIREAT\r\n", "$3\r\ndel\r\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("AOF doesn't hold %q:\n%q", want, data)
+		}
+	}
+	if strings.Contains(string(data), "get") {
+		t.Errorf("AOF logged a read:\n%q", data)
+	}
+	if strings.Contains(string(data), "missing") || strings.Count(string(data), "zadd") != 1 {
+		t.Errorf("AOF logged writes that changed nothing:\n%q", data)
+	}
+
+	// A crash in the middle of a write leaves an incomplete command
+	f, _ := os.OpenFile(filepath.Join(dir, "appendonly.aof"), os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString("*3\r\n$3\r\nSET\r\n$3\r\nabc\r\n$5\r\nval")
+	f.Close()
+
+	s = newAOFServer()
+	c = newTestClient(s)
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"get plain", "$5\r\nvalue\r\n"},
+		{"ttl temp", ":99\r\n"},
+		{"type gone", "+none\r\n"},
+		{"zrange board 0 -1", "*2\r\n$5\r\nalice\r\n$3\r\nbob\r\n"},
+		{"ttl board", ":199\r\n"},
+		{"dbsize", ":3\r\n"},
+	}
+	for _, tt := range tests {
+		if got := s.executeCommand(c, request(tt.line)); got != tt.want {
+			t.Errorf("after replaying, %q = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+	if info, _ := os.Stat(filepath.Join(dir, "appendonly.aof")); info.Size() != int64(len(data)) {
+		t.Errorf("AOF is %d bytes after repair, want %d", info.Size(), len(data))
+	}
+	s.Close()
+
+	f, _ = os.OpenFile(filepath.Join(dir, "appendonly.aof"), os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString("*2\r\n$3\r\nDEL")
+	f.Close()
+	cfg := config.New()
+	cfg.Set("dir", dir)
+	cfg.Set("appendonly", "yes")
+	cfg.Set("aof-load-truncated", "no")
+	if err := NewServerWithConfig(cfg).LoadData(); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("LoadData of a truncated AOF with aof-load-truncated no: %v", err)
+	}
+}
+
+func TestAOFReplaySkipsWriteChecks(t *testing.T) {
+	dir := t.TempDir()
+	newAOFServer := func(minReplicas string) *Server {
+		cfg := config.New()
+		cfg.Set("dir", dir)
+		cfg.Set("appendonly", "yes")
+		cfg.Set("min-replicas-to-write", minReplicas)
+		s := NewServerWithConfig(cfg)
+		if err := s.LoadData(); err != nil {
+			t.Fatalf("LoadData: %v", err)
+		}
+		return s
+	}
+	s := newAOFServer("0")
+	s.executeCommand(newTestClient(s), request("set greeting hello"))
+	s.Close()
+
+	// The file's writes are replayed though clients' writes are refused
+	s = newAOFServer("1")
+	defer s.Close()
+	c := newTestClient(s)
+	if got := s.executeCommand(c, request("get greeting")); got != "$5\r\nhello\r\n" {
+		t.Errorf("GET after replaying with min-replicas-to-write 1 = %q", got)
+	}
+	if got := s.executeCommand(c, request("set x y")); got != noReplicasError {
+		t.Errorf("write without replicas = %q", got)
+	}
+}
+
+func TestClusterNodeAOF(t *testing.T) {
+	dir := t.TempDir()
+	newNode := func() *Server {
+		cfg := config.New()
+		cfg.Set("dir", dir)
+		cfg.Set("appendonly", "yes")
+		cfg.Set("cluster-enabled", "yes")
+		s := NewServerWithConfig(cfg)
+		// As main does, the data is loaded before Start loads the slots
+		if err := s.LoadData(); err != nil {
+			t.Fatalf("LoadData: %v", err)
+		}
+		if err := s.startCluster(); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	s := newNode()
+	c := newTestClient(s)
+	for _, line := range []string{"cluster addslotsrange 0 16383", "set foo bar", "set {b}a 1"} {
+		if got := s.executeCommand(c, request(line)); got != "+OK\r\n" {
+			t.Fatalf("%s = %q", line, got)
+		}
+	}
+	s.Close()
+
+	s = newNode()
+	defer s.Close()
+	c = newTestClient(s)
+	if got := s.executeCommand(c, request("get foo")); got != "$3\r\nbar\r\n" {
+		t.Errorf("GET foo after a restart = %q", got)
+	}
+	if got := s.executeCommand(c, request("dbsize")); got != ":2\r\n" {
+		t.Errorf("DBSIZE after a restart = %q", got)
+	}
+}
+
+func TestRewriteAOF(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "appendonly.aof")
+	cfg := config.New()
+	cfg.Set("dir", dir)
+	cfg.Set("appendonly", "yes")
+	s := NewServerWithConfig(cfg)
+	if err := s.LoadData(); err != nil {
+		t.Fatalf("LoadData: %v", err)
+	}
+	c := newTestClient(s)
+	waitForRewrite := func() {
+		for strings.Contains(s.executeCommand(c, request("info persistence")), "aof_rewrite_in_progress:1") {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		s.executeCommand(c, request(fmt.Sprintf("set counter %d", i)))
+		s.executeCommand(c, request(fmt.Sprintf("zadd board %d member", i)))
+	}
+	before, _ := os.Stat(path)
+	if got := s.executeCommand(c, request("bgrewriteaof")); got != "+Background append only file rewriting started\r\n" {
+		t.Fatalf("BGREWRITEAOF = %q", got)
+	}
+	s.executeCommand(c, request("set during rewrite"))
+	waitForRewrite()
+	s.executeCommand(c, request("set after rewrite"))
+
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size()/10 {
+		t.Errorf("AOF is %d bytes after rewriting, was %d", after.Size(), before.Size())
+	}
+	if info := s.executeCommand(c, request("info persistence")); !strings.Contains(info, "aof_rewrites:1\r\n") {
+		t.Errorf("INFO after BGREWRITEAOF = %q", info)
+	}
+	s.Close()
+
+	loaded := NewServerWithConfig(cfg)
+	if err := loaded.LoadData(); err != nil {
+		t.Fatalf("LoadData: %v", err)
+	}
+	lc := newTestClient(loaded)
+	for line, want := range map[string]string{
+		"get counter":       "$2\r\n99\r\n",
+		"zrange board 0 -1": "*1\r\n$6\r\nmember\r\n",
+		"get during":        "$7\r\nrewrite\r\n",
+		"get after":         "$7\r\nrewrite\r\n",
+	} {
+		if got := loaded.executeCommand(lc, request(line)); got != want {
+			t.Errorf("after loading the rewritten AOF, %q = %q, want %q", line, got, want)
+		}
+	}
+
+	// Growth past auto-aof-rewrite-percentage starts a rewrite
+	loaded.config.SetRuntime("auto-aof-rewrite-min-size", "0", "auto-aof-rewrite-percentage", "50")
+	for i := 0; i < 20; i++ {
+		loaded.executeCommand(lc, request(fmt.Sprintf("set counter %d", i)))
+	}
+	loaded.rewriteAOFOnGrowth()
+	for strings.Contains(loaded.executeCommand(lc, request("info persistence")), "aof_rewrite_in_progress:1") {
+		time.Sleep(time.Millisecond)
+	}
+	if info := loaded.executeCommand(lc, request("info persistence")); !strings.Contains(info, "aof_rewrites:1\r\n") {
+		t.Errorf("no automatic rewrite: %q", info)
+	}
+	loaded.Close()
+}
+
+func TestReplication(t *testing.T) {
+	primary := startTestServer("12414")
+	defer primary.Close()
+	pc := newTestClient(primary)
+	primary.executeCommand(pc, request("set greeting hello"))
+	primary.executeCommand(pc, request("zadd board 1.5 alice 2 bob"))
+
+	replica := startTestServer("12415")
+	defer replica.Close()
+	rc := newTestClient(replica)
+	// eventually polls the replica until a command gets the reply wanted
+	eventually := func(line, want string) {
+		t.Helper()
+		var got string
+		for range 150 {
+			if got = replica.executeCommand(rc, request(line)); got == want {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Errorf("%s on the replica = %q, want %q", line, got, want)
+	}
+
+	if got := replica.executeCommand(rc, request("replicaof 127.0.0.1 12414")); got != "+OK\r\n" {
+		t.Fatalf("REPLICAOF = %q", got)
+	}
+	if got := replica.executeCommand(rc, request("replicaof 127.0.0.1 12414")); got != "+OK Already connected to specified master\r\n" {
+		t.Errorf("REPLICAOF again = %q", got)
+	}
+	eventually("zrange board 0 -1", "*2\r\n$5\r\nalice\r\n$3\r\nbob\r\n")
+	eventually("get greeting", "$5\r\nhello\r\n")
+
+	// Then writes are streamed, expiries as the time they happen at
+	primary.executeCommand(pc, request("set temp value EX 100"))
+	primary.executeCommand(pc, request("del greeting"))
+	eventually("get greeting", "$-1\r\n")
+	eventually("ttl temp", ":99\r\n")
+	if got := replica.executeCommand(rc, request("set x y")); got != readonlyError {
+		t.Errorf("write on the replica = %q", got)
+	}
+	if got := replica.executeCommand(rc, request("role")); !strings.HasPrefix(got, "*5\r\n$5\r\nslave\r\n$9\r\n127.0.0.1\r\n:12414\r\n$9\r\nconnected\r\n") {
+		t.Errorf("ROLE on the replica = %q", got)
+	}
+
+	// A replica that loses its link continues from the backlog
+	primary.repl.mu.Lock()
+	for rep := range primary.repl.replicas {
+		rep.c.conn.Close()
+	}
+	primary.repl.mu.Unlock()
+	primary.executeCommand(pc, request("set later value"))
+	eventually("get later", "$5\r\nvalue\r\n")
+	if full, partial := primary.stats.syncFull.Load(), primary.stats.syncPartialOK.Load(); full != 1 || partial != 1 {
+		t.Errorf("%d full and %d partial syncs, want 1 and 1", full, partial)
+	}
+	primary.repl.mu.Lock()
+	offset := primary.repl.offset
+	primary.repl.mu.Unlock()
+	replica.repl.mu.Lock()
+	if replica.repl.offset != offset {
+		t.Errorf("replica offset %d, primary %d", replica.repl.offset, offset)
+	}
+	replica.repl.mu.Unlock()
+
+	// Once promoted, the replica takes writes and keeps the stream's history
+	replID := primary.executeCommand(pc, request("info replication"))
+	if got := replica.executeCommand(rc, request("replicaof no one")); got != "+OK\r\n" {
+		t.Errorf("REPLICAOF NO ONE = %q", got)
+	}
+	if got := replica.executeCommand(rc, request("set x y")); got != "+OK\r\n" {
+		t.Errorf("write once promoted = %q", got)
+	}
+	info := replica.executeCommand(rc, request("info replication"))
+	if !strings.Contains(info, "role:master") || !strings.Contains(replID, "master_replid:"+infoField(info, "master_replid2")) {
+		t.Errorf("INFO once promoted:\n%s", info)
+	}
+}
+
+// infoField returns a field of an INFO reply.
+func infoField(info, field string) string {
+	for _, line := range strings.Split(info, "\r\n") {
+		if value, ok := strings.CutPrefix(line, field+":"); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+func TestWaitAndMinReplicas(t *testing.T) {
+	primary := startTestServer("12416")
+	defer primary.Close()
+	pc := newTestClient(primary)
+	replica := startTestServer("12417")
+	defer replica.Close()
+	rc := newTestClient(replica)
+
+	if got := primary.executeCommand(pc, request("wait 0 0")); got != ":0\r\n" {
+		t.Errorf("WAIT 0 0 without replicas = %q", got)
+	}
+	replica.executeCommand(rc, request("replicaof 127.0.0.1 12416"))
+	for range 150 {
+		if strings.Contains(primary.executeCommand(pc, request("info replication")), "state=online") {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	primary.executeCommand(pc, request("set greeting hello"))
+	start := time.Now()
+	if got := primary.executeCommand(pc, request("wait 1 5000")); got != ":1\r\n" {
+		t.Errorf("WAIT 1 = %q", got)
+	}
+	// GETACK had the replica acknowledge at once
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("WAIT 1 took %v", elapsed)
+	}
+	if got := replica.executeCommand(rc, request("get greeting")); got != "$5\r\nhello\r\n" {
+		t.Errorf("greeting on the replica after WAIT = %q", got)
+	}
+	start = time.Now()
+	if got := primary.executeCommand(pc, request("wait 2 100")); got != ":1\r\n" {
+		t.Errorf("WAIT 2 = %q", got)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("WAIT 2 returned after %v, before its timeout", elapsed)
+	}
+	if got := replica.executeCommand(rc, request("wait 1 0")); !strings.HasPrefix(got, "-ERR WAIT cannot be used with replica instances") {
+		t.Errorf("WAIT on the replica = %q", got)
+	}
+
+	primary.executeCommand(pc, request("config set min-replicas-to-write 2"))
+	if got := primary.executeCommand(pc, request("set x y")); got != noReplicasError {
+		t.Errorf("write with 1 of 2 replicas = %q", got)
+	}
+	if got := primary.executeCommand(pc, request("get greeting")); got != "$5\r\nhello\r\n" {
+		t.Errorf("read with 1 of 2 replicas = %q", got)
+	}
+	primary.executeCommand(pc, request("config set min-replicas-to-write 1"))
+	if got := primary.executeCommand(pc, request("set x y")); got != "+OK\r\n" {
+		t.Errorf("write with 1 of 1 replica = %q", got)
+	}
+	// A primary that loses its replica stops taking writes
+	replica.executeCommand(rc, request("replicaof no one"))
+	var got string
+	for range 150 {
+		if got = primary.executeCommand(pc, request("set x z")); got == noReplicasError {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got != noReplicasError {
+		t.Errorf("write once the replica left = %q", got)
+	}
+}
+
+// startClusterNode starts a server in cluster mode, keeping its
+// configuration in dir.
+func startClusterNode(port, dir string) *Server {
+	cfg := config.New()
+	cfg.Set("port", port)
+	cfg.Set("dir", dir)
+	cfg.Set("cluster-enabled", "yes")
+	cfg.Set("cluster-node-timeout", "500")
+	s := NewServerWithConfig(cfg)
+	go func() {
+		if err := s.Start(); err != nil {
+			panic(fmt.Sprintf("Failed to start server: %v", err))
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	return s
+}
+
+func TestCluster(t *testing.T) {
+	plain := NewServer("0")
+	if got := plain.executeCommand(newTestClient(plain), request("cluster info")); got != clusterDisabledError {
+		t.Errorf("CLUSTER INFO without cluster mode = %q", got)
+	}
+
+	ports := []string{"12424", "12425", "12426"}
+	dirs := make([]string, len(ports))
+	nodes := make([]*Server, len(ports))
+	clients := make([]*client, len(ports))
+	ids := make([]string, len(ports))
+	for i, port := range ports {
+		dirs[i] = t.TempDir()
+		nodes[i] = startClusterNode(port, dirs[i])
+		if i < 2 {
+			defer nodes[i].Close() // The last one is closed below
+		}
+		clients[i] = newTestClient(nodes[i])
+		id := nodes[i].executeCommand(clients[i], request("cluster myid"))
+		ids[i] = strings.SplitN(id, "\r\n", 3)[1]
+	}
+	exec := func(i int, line string) string {
+		return nodes[i].executeCommand(clients[i], request(line))
+	}
+	// eventually polls node i until cond holds for the reply to line
+	eventually := func(i int, line string, cond func(string) bool) {
+		t.Helper()
+		var got string
+		for range 150 {
+			if got = exec(i, line); cond(got) {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("%s on node %d = %q", line, i, got)
+	}
+
+	fooSlot := keyHashSlot("foo")
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"cluster keyslot foo", ":12182\r\n"},
+		{"cluster keyslot 123456789", ":12739\r\n"},
+		{"cluster keyslot {user1000}.following", fmt.Sprintf(":%d\r\n", keyHashSlot("user1000"))},
+		{"cluster keyslot {}user1000", fmt.Sprintf(":%d\r\n", keyHashSlot("{}user1000"))},
+		{"get foo", clusterDownError},
+		{"cluster addslots 16384", "-ERR Invalid or out of range slot\r\n"},
+		{"cluster addslots 1 1", "-ERR Slot 1 specified multiple times\r\n"},
+		{"cluster delslots 1", "-ERR Slot 1 is already unassigned\r\n"},
+		{"cluster addslotsrange 0 8191", "+OK\r\n"},
+		{"cluster addslots 100", "-ERR Slot 100 is already busy\r\n"},
+		{"cluster meet 127.0.0.1 12425", "+OK\r\n"},
+		{"cluster meet 127.0.0.1 12426", "+OK\r\n"},
+		{"asking", "+OK\r\n"},
+	}
+	for _, tt := range tests {
+		if got := exec(0, tt.line); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+	if got := infoField(exec(0, "info server"), "redis_mode"); got != "cluster" {
+		t.Errorf("INFO redis_mode in cluster mode = %q", got)
+	}
+	if got := exec(1, "cluster addslotsrange 8192 16383"); got != "+OK\r\n" {
+		t.Fatalf("ADDSLOTSRANGE = %q", got)
+	}
+
+	// The nodes each met one node, and learn the third one by gossip
+	for i := range nodes {
+		eventually(i, "cluster info", func(info string) bool {
+			return strings.Contains(info, "cluster_state:ok") && strings.Contains(info, "cluster_known_nodes:3") && strings.Contains(info, "cluster_size:2")
+		})
+	}
+	nodesReply := exec(2, "cluster nodes")
+	for i, id := range ids {
+		if !strings.Contains(nodesReply, fmt.Sprintf("%s 127.0.0.1:%s@%s", id, ports[i], ports[i])) {
+			t.Errorf("CLUSTER NODES on the third node has no line for node %d:\n%s", i, nodesReply)
+		}
+	}
+	if !strings.Contains(nodesReply, ids[1]+" 127.0.0.1:12425@12425 master - ") || !strings.Contains(nodesReply, "connected 8192-16383") {
+		t.Errorf("CLUSTER NODES = %s", nodesReply)
+	}
+	wantSlots := "*2\r\n" +
+		"*3\r\n:0\r\n:8191\r\n*3\r\n$9\r\n127.0.0.1\r\n:12424\r\n$40\r\n" + ids[0] + "\r\n" +
+		"*3\r\n:8192\r\n:16383\r\n*3\r\n$9\r\n127.0.0.1\r\n:12425\r\n$40\r\n" + ids[1] + "\r\n"
+	if got := exec(2, "cluster slots"); got != wantSlots {
+		t.Errorf("CLUSTER SLOTS = %q", got)
+	}
+
+	moved := fmt.Sprintf("-MOVED %d 127.0.0.1:12425\r\n", fooSlot)
+	for _, tt := range []struct {
+		line string
+		want string
+	}{
+		{"set foo bar", moved},
+		{"set {b}a 1", "+OK\r\n"},
+		{"set {b}b 2", "+OK\r\n"},
+		{"del a b", crossSlotError},
+		{"del {b}b {b}c", ":1\r\n"},
+		{"cluster countkeysinslot " + strconv.Itoa(keyHashSlot("b")), ":1\r\n"},
+		{"cluster getkeysinslot " + strconv.Itoa(keyHashSlot("b")) + " 1", "*1\r\n$4\r\n{b}a\r\n"},
+		{"command getkeys migrate 127.0.0.1 1 \"\" 0 10 KEYS a b", "*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+	} {
+		if tt.line == "command getkeys migrate 127.0.0.1 1 \"\" 0 10 KEYS a b" {
+			args := request(tt.line)
+			args[5] = nil
+			if got := nodes[0].executeCommand(clients[0], args); got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.line, got, tt.want)
+			}
+			continue
+		}
+		if got := exec(0, tt.line); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+	if got := exec(1, "set foo bar"); got != "+OK\r\n" {
+		t.Errorf("SET foo on its node = %q", got)
+	}
+
+	// Moving foo's slot to the third node: while it moves, keys the source
+	// no longer has are asked for at the target
+	for _, step := range []struct {
+		node int
+		line string
+	}{
+		{2, fmt.Sprintf("cluster setslot %d importing %s", fooSlot, ids[1])},
+		{1, fmt.Sprintf("cluster setslot %d migrating %s", fooSlot, ids[2])},
+	} {
+		if got := exec(step.node, step.line); got != "+OK\r\n" {
+			t.Fatalf("%s = %q", step.line, got)
+		}
+	}
+	ask := fmt.Sprintf("-ASK %d 127.0.0.1:12426\r\n", fooSlot)
+	if got := exec(1, "get foo"); got != "$3\r\nbar\r\n" {
+		t.Errorf("GET foo on the source = %q", got)
+	}
+	if got := exec(1, "get {foo}x"); got != ask {
+		t.Errorf("GET of a missing key on the source = %q", got)
+	}
+	if got := exec(2, "get {foo}x"); got != fmt.Sprintf("-MOVED %d 127.0.0.1:12425\r\n", fooSlot) {
+		t.Errorf("GET on the target without ASKING = %q", got)
+	}
+	exec(2, "asking")
+	if got := exec(2, "get {foo}x"); got != "$-1\r\n" {
+		t.Errorf("GET on the target after ASKING = %q", got)
+	}
+	if got := exec(1, "migrate 127.0.0.1 12426 foo 0 1000"); got != "+OK\r\n" {
+		t.Errorf("MIGRATE = %q", got)
+	}
+	if got := exec(1, "get foo"); got != ask {
+		t.Errorf("GET foo once migrated = %q", got)
+	}
+	for _, i := range []int{2, 1} {
+		if got := exec(i, fmt.Sprintf("cluster setslot %d node %s", fooSlot, ids[2])); got != "+OK\r\n" {
+			t.Fatalf("SETSLOT NODE on node %d = %q", i, got)
+		}
+	}
+	if got := exec(2, "get foo"); got != "$3\r\nbar\r\n" {
+		t.Errorf("GET foo on its new node = %q", got)
+	}
+	// The new owner's greater epoch wins it the slot on the first node too
+	eventually(0, "get foo", func(reply string) bool {
+		return reply == fmt.Sprintf("-MOVED %d 127.0.0.1:12426\r\n", fooSlot)
+	})
+
+	// Once the third node goes away, the others agree it failed
+	nodes[2].Close()
+	for i := range 2 {
+		eventually(i, "cluster nodes", func(reply string) bool {
+			return strings.Contains(reply, ids[2]+" 127.0.0.1:12426@12426 master,fail ")
+		})
+		eventually(i, "cluster info", func(info string) bool {
+			return strings.Contains(info, "cluster_state:fail")
+		})
+	}
+	if got := exec(0, "get {b}a"); got != clusterDownError {
+		t.Errorf("GET while the cluster is down = %q", got)
+	}
+
+	// The configuration is kept across restarts
+	cfg := config.New()
+	cfg.Set("port", ports[0])
+	cfg.Set("dir", dirs[0])
+	cfg.Set("cluster-enabled", "yes")
+	restarted := NewServerWithConfig(cfg)
+	if err := restarted.startCluster(); err != nil {
+		t.Fatal(err)
+	}
+	rc := newTestClient(restarted)
+	if got := restarted.executeCommand(rc, request("cluster myid")); !strings.Contains(got, ids[0]) {
+		t.Errorf("CLUSTER MYID after a restart = %q, want %s", got, ids[0])
+	}
+	if got := restarted.executeCommand(rc, request("cluster nodes")); !strings.Contains(got, "connected 0-8191") || !strings.Contains(got, ids[0]+" 127.0.0.1:12424@12424 myself,master - 0 0 ") || strings.Count(got, "master") != 3 {
+		t.Errorf("CLUSTER NODES after a restart:\n%s", got)
+	}
+}
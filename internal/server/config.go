@@ -0,0 +1,86 @@
+// File: internal/server/config.go
+
+package server
+
+import (
+	"basic-go-redis/internal/protocol"
+	"basic-go-redis/pkg/config"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// configGetCommand returns the parameters matching any of the glob
+// patterns, as name and value pairs.
+func configGetCommand(s *Server, c *client, args [][]byte) string {
+	seen := make(map[string]bool)
+	var pairs []string
+	for _, pattern := range args[2:] {
+		for _, name := range s.config.Match(string(pattern)) {
+			if !seen[name] {
+				seen[name] = true
+				pairs = append(pairs, name, s.config.Get(name))
+			}
+		}
+	}
+	return protocol.BulkStringArray(pairs)
+}
+
+// configSetCommand sets parameters from name and value pairs, all of them
+// or, when one is refused, none.
+func configSetCommand(s *Server, c *client, args [][]byte) string {
+	if len(args)%2 != 0 {
+		return arityError("config|set")
+	}
+	pairs := make([]string, len(args)-2)
+	for i, arg := range args[2:] {
+		pairs[i] = string(arg)
+	}
+
+	err := s.config.SetRuntime(pairs...)
+	var paramErr *config.ParamError
+	switch {
+	case err == nil:
+		return protocol.OK
+	case errors.Is(err, config.ErrUnknown) && errors.As(err, &paramErr):
+		return protocol.ErrorReply(fmt.Sprintf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", paramErr.Name))
+	case errors.As(err, &paramErr):
+		return protocol.ErrorReply(fmt.Sprintf("ERR CONFIG SET failed (possibly related to argument '%s') - %v", paramErr.Name, paramErr.Err))
+	default:
+		return protocol.ErrorReply("ERR " + err.Error())
+	}
+}
+
+// configResetStatCommand zeroes the counters INFO reports.
+func configResetStatCommand(s *Server, c *client, args [][]byte) string {
+	s.stats.reset()
+	s.store.ResetStats()
+	return protocol.OK
+}
+
+// configRewriteCommand saves the running configuration to the config file.
+func configRewriteCommand(s *Server, c *client, args [][]byte) string {
+	err := s.config.Rewrite()
+	switch {
+	case err == nil:
+		return protocol.OK
+	case errors.Is(err, config.ErrNoFile):
+		return protocol.ErrorReply("ERR The server is running without a config file")
+	default:
+		return protocol.ErrorReply("ERR Rewriting config file: " + err.Error())
+	}
+}
+
+func configHelpCommand(s *Server, c *client, args [][]byte) string {
+	return simpleStringArray(strings.Split(`CONFIG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:
+GET <pattern>
+    Return parameters matching the glob-like <pattern> and their values.
+SET <directive> <value>
+    Set the configuration <directive> to <value>.
+RESETSTAT
+    Reset statistics reported by the INFO command.
+REWRITE
+    Rewrite the configuration file.
+HELP
+    Print this help.`, "\n"))
+}
@@ -0,0 +1,45 @@
+// File: internal/server/crc16.go
+
+package server
+
+import "strings"
+
+// clusterSlots is the number of hash slots the keyspace is split into.
+const clusterSlots = 16384
+
+// crc16Table is the table of CRC-16/XMODEM, the checksum Redis Cluster
+// hashes keys with: polynomial 0x1021, initial value 0.
+var crc16Table = func() (table [256]uint16) {
+	for i := range table {
+		crc := uint16(i) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+	return crc
+}
+
+// keyHashSlot returns the slot of key. A key holding a non-empty hash tag,
+// such as {user1000}.following, is hashed by the tag alone, so that keys
+// sharing it land in the same slot.
+func keyHashSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) & (clusterSlots - 1))
+}
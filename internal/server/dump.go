@@ -0,0 +1,148 @@
+// File: internal/server/dump.go
+
+package server
+
+import (
+	"basic-go-redis/internal/dump"
+	"basic-go-redis/internal/protocol"
+	"basic-go-redis/internal/store"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Conflict modes of IMPORT, for keys that exist already.
+const (
+	conflictFail      = "FAIL"
+	conflictSkip      = "SKIP"
+	conflictOverwrite = "OVERWRITE"
+)
+
+var busyKeyError = protocol.ErrorReply("BUSYKEY Target key name already exists.")
+
+// recordOf turns a store entry into a dump record, with the TTL left at
+// now. A TTL about to run out is kept as a millisecond.
+func recordOf(e store.Entry, now time.Time) dump.Record {
+	r := dump.Record{Key: e.Key, Type: "string", String: e.String}
+	if e.ZSet != nil {
+		r.Type, r.ZSet = "zset", e.ZSet
+	}
+	if !e.ExpireAt.IsZero() {
+		r.TTL = max(e.ExpireAt.Sub(now), time.Millisecond)
+	}
+	return r
+}
+
+// exportCommand is SCAN returning the keys' values: the reply is the next
+// cursor and the NDJSON records of this step's keys.
+func exportCommand(s *Server, c *client, args [][]byte) string {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.ErrorReply("ERR invalid cursor")
+	}
+	pattern, count := "*", 100
+	for i := 2; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return syntaxError
+		}
+		value := string(args[i+1])
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = value
+		case "COUNT":
+			if count, err = strconv.Atoi(value); err != nil {
+				return notIntegerError
+			}
+			if count < 1 {
+				return syntaxError
+			}
+		default:
+			return syntaxError
+		}
+	}
+
+	next, keys := s.store.Scan(cursor, pattern, count, "")
+	now := time.Now()
+	var out []byte
+	for _, key := range keys {
+		e, ok := s.store.Lookup(key)
+		if !ok {
+			continue
+		}
+		if out, err = dump.Append(out, recordOf(e, now)); err != nil {
+			return protocol.ErrorReply("ERR " + err.Error())
+		}
+	}
+	return protocol.Array(protocol.BulkString(strconv.FormatUint(next, 10)), protocol.BulkString(string(out)))
+}
+
+// importCommand adds the keys of an NDJSON payload, those matching MATCH
+// if it is given. Every record is read before any key is written, so a
+// mistake in the payload or, with CONFLICT FAIL, an existing key leaves the
+// dataset as it was. CONFLICT SKIP keeps existing keys and OVERWRITE
+// replaces them. The reply is the number of keys written.
+//
+// The AOF logs the keys written, with their TTLs as absolute times, so that
+// replaying it later gives the same dataset.
+func importCommand(s *Server, c *client, args [][]byte) string {
+	mode, pattern := conflictFail, "*"
+	for i := 2; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return syntaxError
+		}
+		value := string(args[i+1])
+		switch strings.ToUpper(string(args[i])) {
+		case "CONFLICT":
+			mode = strings.ToUpper(value)
+			if mode != conflictFail && mode != conflictSkip && mode != conflictOverwrite {
+				return syntaxError
+			}
+		case "MATCH":
+			pattern = value
+		default:
+			return syntaxError
+		}
+	}
+
+	records, err := dump.ReadAll(bytes.NewReader(args[1]))
+	if err != nil {
+		return protocol.ErrorReply("ERR invalid payload: " + err.Error())
+	}
+	match := store.Matcher(pattern)
+	now := time.Now()
+	entries := make([]store.Entry, 0, len(records))
+	for _, r := range records {
+		if pattern != "*" && !match(r.Key) {
+			continue
+		}
+		if mode == conflictFail && s.store.Type(r.Key) != "none" {
+			return busyKeyError
+		}
+		entries = append(entries, store.Entry{Key: r.Key, ExpireAt: r.Deadline(now), String: r.String, ZSet: r.ZSet})
+	}
+
+	var logged []byte
+	imported := 0
+	for _, e := range entries {
+		if mode == conflictSkip && s.store.Type(e.Key) != "none" {
+			continue
+		}
+		if !s.store.Put(e) {
+			continue // Expired already
+		}
+		imported++
+		r := recordOf(e, now)
+		r.TTL, r.ExpireAt = 0, e.ExpireAt
+		logged, _ = dump.Append(logged, r)
+	}
+	if imported == 0 {
+		c.rewriteArgs() // Nothing changed
+		return protocol.Integer(0)
+	}
+	c.rewriteArgs("IMPORT", string(logged), "CONFLICT", conflictOverwrite)
+	// Each key written is a change for the save rules, and executeCommand
+	// counts one
+	s.dirty.Add(int64(imported) - 1)
+	return protocol.Integer(int64(imported))
+}
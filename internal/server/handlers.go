@@ -0,0 +1,312 @@
+// File: internal/server/handlers.go
+
+package server
+
+import (
+	"basic-go-redis/internal/protocol"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error replies shared by several commands, worded as Redis words them.
+var (
+	syntaxError     = protocol.ErrorReply("ERR syntax error")
+	notIntegerError = protocol.ErrorReply("ERR value is not an integer or out of range")
+	wrongTypeError  = protocol.ErrorReply("WRONGTYPE Operation against a key holding the wrong kind of value")
+)
+
+// setCommand parses SET's options and passes them on to the store in the
+// form it understands: NX, XX, KEEPTTL and PXAT<unix time in milliseconds>.
+func setCommand(s *Server, c *client, args [][]byte) string {
+	key := string(args[1])
+	value := string(args[2])
+
+	var flags []string
+	var condition, expiry string
+	for i := 3; i < len(args); i++ {
+		switch option := strings.ToUpper(string(args[i])); option {
+		case "NX", "XX":
+			if condition != "" && condition != option {
+				return syntaxError
+			}
+			condition = option
+			flags = append(flags, option)
+		case "KEEPTTL", "EX", "PX", "EXAT", "PXAT":
+			if expiry != "" {
+				return syntaxError
+			}
+			expiry = option
+			if option == "KEEPTTL" {
+				flags = append(flags, option)
+				continue
+			}
+			if i+1 == len(args) {
+				return syntaxError
+			}
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return notIntegerError
+			}
+			if n <= 0 {
+				return protocol.ErrorReply("ERR invalid expire time in 'set' command")
+			}
+			// Every form is turned into the time the key expires at, in
+			// milliseconds, which is also how the AOF logs it
+			var at int64
+			switch option {
+			case "EX":
+				at = time.Now().UnixMilli() + n*1000
+			case "PX":
+				at = time.Now().UnixMilli() + n
+			case "EXAT":
+				at = n * 1000
+			case "PXAT":
+				at = n
+			}
+			flags = append(flags, "PXAT"+strconv.FormatInt(at, 10))
+		default:
+			return syntaxError
+		}
+	}
+
+	// The store answers +0 when the NX or XX condition isn't met
+	response := s.store.Set(key, value, flags...)
+	if response == "+0\r\n" {
+		return protocol.NullBulkString
+	}
+	if expiry != "" && expiry != "KEEPTTL" {
+		rewritten := []string{"SET", key, value}
+		if condition != "" {
+			rewritten = append(rewritten, condition)
+		}
+		at := flags[len(flags)-1][len("PXAT"):]
+		c.rewriteArgs(append(rewritten, "PXAT", at)...)
+	}
+	return response
+}
+
+func pingCommand(s *Server, c *client, args [][]byte) string {
+	if len(args) == 2 {
+		return protocol.BulkString(string(args[1]))
+	}
+	return protocol.SimpleString("PONG")
+}
+
+func echoCommand(s *Server, c *client, args [][]byte) string {
+	return protocol.BulkString(string(args[1]))
+}
+
+// selectCommand accepts only database 0, the one database the server keeps.
+func selectCommand(s *Server, c *client, args [][]byte) string {
+	index, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return protocol.ErrorReply("ERR invalid DB index")
+	}
+	if index != 0 {
+		return protocol.ErrorReply("ERR DB index is out of range")
+	}
+	c.mu.Lock()
+	c.db = index
+	c.mu.Unlock()
+	return protocol.OK
+}
+
+// authCommand answers as Redis does for a default user without a password:
+// AUTH with only a password is a configuration mistake, while the default
+// user with any password is let in.
+func authCommand(s *Server, c *client, args [][]byte) string {
+	switch len(args) {
+	case 2:
+		return protocol.ErrorReply("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	case 3:
+		if string(args[1]) == "default" {
+			return protocol.OK
+		}
+		return protocol.ErrorReply("WRONGPASS invalid username-password pair or user is disabled.")
+	default:
+		return syntaxError
+	}
+}
+
+func getCommand(s *Server, c *client, args [][]byte) string {
+	value, ok := s.store.GetString(string(args[1]))
+	if !ok {
+		return protocol.NullBulkString
+	}
+	return protocol.BulkString(value)
+}
+
+func delCommand(s *Server, c *client, args [][]byte) string {
+	keys := make([]string, len(args)-1)
+	for i, key := range args[1:] {
+		keys[i] = string(key)
+	}
+	deleted := s.store.Del(keys)
+	if deleted == 0 {
+		c.rewriteArgs() // Nothing changed
+	}
+	return protocol.Integer(int64(deleted))
+}
+
+func keysCommand(s *Server, c *client, args [][]byte) string {
+	return protocol.BulkStringArray(s.store.Keys(string(args[1])))
+}
+
+func typeCommand(s *Server, c *client, args [][]byte) string {
+	return protocol.SimpleString(s.store.Type(string(args[1])))
+}
+
+func dbsizeCommand(s *Server, c *client, args [][]byte) string {
+	return protocol.Integer(int64(s.store.DBSize()))
+}
+
+// scanCommand parses SCAN's MATCH, COUNT and TYPE options. The reply is the
+// next cursor and the keys of this step.
+func scanCommand(s *Server, c *client, args [][]byte) string {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.ErrorReply("ERR invalid cursor")
+	}
+	pattern, count, typ := "*", 10, ""
+	for i := 2; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return syntaxError
+		}
+		value := string(args[i+1])
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = value
+		case "COUNT":
+			if count, err = strconv.Atoi(value); err != nil {
+				return notIntegerError
+			}
+			if count < 1 {
+				return syntaxError
+			}
+		case "TYPE":
+			typ = strings.ToLower(value)
+		default:
+			return syntaxError
+		}
+	}
+	next, keys := s.store.Scan(cursor, pattern, count, typ)
+	return protocol.Array(protocol.BulkString(strconv.FormatUint(next, 10)), protocol.BulkStringArray(keys))
+}
+
+func strlenCommand(s *Server, c *client, args [][]byte) string {
+	key := string(args[1])
+	if t := s.store.Type(key); t != "string" && t != "none" {
+		return wrongTypeError
+	}
+	return protocol.Integer(int64(s.store.StrLen(key)))
+}
+
+func zcardCommand(s *Server, c *client, args [][]byte) string {
+	key := string(args[1])
+	if t := s.store.Type(key); t != "zset" && t != "none" {
+		return wrongTypeError
+	}
+	return protocol.Integer(int64(s.store.ZCard(key)))
+}
+
+// memoryUsageCommand accepts SAMPLES for compatibility; the estimate always
+// counts every element.
+func memoryUsageCommand(s *Server, c *client, args [][]byte) string {
+	switch {
+	case len(args) == 5 && strings.EqualFold(string(args[3]), "SAMPLES"):
+		if _, err := strconv.Atoi(string(args[4])); err != nil {
+			return notIntegerError
+		}
+	case len(args) != 3:
+		return syntaxError
+	}
+	size, ok := s.store.MemoryUsage(string(args[2]))
+	if !ok {
+		return protocol.NullBulkString
+	}
+	return protocol.Integer(int64(size))
+}
+
+func memoryHelpCommand(s *Server, c *client, args [][]byte) string {
+	return simpleStringArray(strings.Split(`MEMORY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:
+USAGE <key> [SAMPLES <count>]
+    Return memory in bytes used by <key> and its value.
+HELP
+    Print this help.`, "\n"))
+}
+
+func expireCommand(s *Server, c *client, args [][]byte) string {
+	seconds, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return notIntegerError
+	}
+	at := time.Now().UnixMilli() + seconds*1000
+	if s.store.ExpireAt(string(args[1]), time.UnixMilli(at)) == 0 {
+		c.rewriteArgs() // No such key
+		return protocol.Integer(0)
+	}
+	c.rewriteArgs("PEXPIREAT", string(args[1]), strconv.FormatInt(at, 10))
+	return protocol.Integer(1)
+}
+
+// pexpireatCommand sets the Unix time in milliseconds a key expires at,
+// the form the AOF logs every expiry in.
+func pexpireatCommand(s *Server, c *client, args [][]byte) string {
+	at, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return notIntegerError
+	}
+	if s.store.ExpireAt(string(args[1]), time.UnixMilli(at)) == 0 {
+		c.rewriteArgs() // No such key
+		return protocol.Integer(0)
+	}
+	return protocol.Integer(1)
+}
+
+func ttlCommand(s *Server, c *client, args [][]byte) string {
+	ttl := s.store.TTL(string(args[1]))
+	return protocol.Integer(int64(ttl))
+}
+
+func zaddCommand(s *Server, c *client, args [][]byte) string {
+	if len(args)%2 != 0 {
+		return syntaxError
+	}
+	// Validate every score before adding anything
+	scores := make([]float64, 0, (len(args)-2)/2)
+	for i := 2; i < len(args); i += 2 {
+		score, err := strconv.ParseFloat(string(args[i]), 64)
+		if err != nil {
+			return protocol.ErrorReply("ERR value is not a valid float")
+		}
+		scores = append(scores, score)
+	}
+	key := string(args[1])
+	added, changed := 0, false
+	for i, score := range scores {
+		isNew, isChanged := s.store.ZAddChanged(key, score, string(args[3+2*i]))
+		if isNew {
+			added++
+		}
+		changed = changed || isChanged
+	}
+	if !changed {
+		c.rewriteArgs() // Every member had its score already
+	}
+	return protocol.Integer(int64(added))
+}
+
+func zrangeCommand(s *Server, c *client, args [][]byte) string {
+	start, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return notIntegerError
+	}
+	stop, err := strconv.Atoi(string(args[3]))
+	if err != nil {
+		return notIntegerError
+	}
+	members := s.store.ZRange(string(args[1]), start, stop)
+	return protocol.BulkStringArray(members)
+}
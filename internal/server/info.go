@@ -0,0 +1,167 @@
+// File: internal/server/info.go
+
+package server
+
+import (
+	"basic-go-redis/internal/protocol"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisVersion is the Redis release whose commands and replies the server
+// follows, reported to clients that check it.
+const redisVersion = "7.0.0"
+
+// infoSection is a section of the INFO reply.
+type infoSection struct {
+	name      string
+	isDefault bool // Included when INFO is called without arguments
+	write     func(s *Server, b *infoBuilder)
+}
+
+// infoSections are in the order INFO prints them.
+var infoSections = []infoSection{
+	{"server", true, writeServerInfo},
+	{"clients", true, writeClientsInfo},
+	{"memory", true, writeMemoryInfo},
+	{"persistence", true, writePersistenceInfo},
+	{"stats", true, writeStatsInfo},
+	{"replication", true, writeReplicationInfo},
+	{"cluster", true, writeClusterInfo},
+	{"keyspace", true, writeKeyspaceInfo},
+}
+
+// infoBuilder writes INFO's field:value lines.
+type infoBuilder struct {
+	strings.Builder
+}
+
+func (b *infoBuilder) field(name string, value any) {
+	fmt.Fprintf(b, "%s:%v\r\n", name, value)
+}
+
+// infoCommand reports the sections named by its arguments: "default", the
+// default when there are none, "all" and "everything" pick several.
+func infoCommand(s *Server, c *client, args [][]byte) string {
+	picked := make(map[string]bool)
+	all, defaults := false, len(args) == 1
+	for _, arg := range args[1:] {
+		switch name := strings.ToLower(string(arg)); name {
+		case "all", "everything":
+			all = true
+		case "default":
+			defaults = true
+		default:
+			picked[name] = true
+		}
+	}
+
+	var b infoBuilder
+	for _, section := range infoSections {
+		if !all && !(defaults && section.isDefault) && !picked[section.name] {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("# " + strings.ToUpper(section.name[:1]) + section.name[1:] + "\r\n")
+		section.write(s, &b)
+	}
+	return protocol.BulkString(b.String())
+}
+
+func writeServerInfo(s *Server, b *infoBuilder) {
+	uptime := time.Since(s.startTime)
+	executable, _ := os.Executable()
+	mode := "standalone"
+	if s.cluster != nil {
+		mode = "cluster"
+	}
+	b.field("redis_version", redisVersion)
+	b.field("redis_mode", mode)
+	b.field("os", runtime.GOOS+" "+runtime.GOARCH)
+	b.field("arch_bits", strconv.IntSize)
+	b.field("go_version", runtime.Version())
+	b.field("process_id", os.Getpid())
+	b.field("run_id", s.runID)
+	b.field("tcp_port", s.port)
+	b.field("server_time_usec", time.Now().UnixMicro())
+	b.field("uptime_in_seconds", int64(uptime.Seconds()))
+	b.field("uptime_in_days", int64(uptime.Hours()/24))
+	b.field("hz", hz)
+	b.field("executable", executable)
+}
+
+func writeClientsInfo(s *Server, b *infoBuilder) {
+	b.field("connected_clients", s.clientCount())
+	b.field("maxclients", s.config.Get("maxclients"))
+	b.field("blocked_clients", s.blockedClients.Load())
+}
+
+func writeMemoryInfo(s *Server, b *infoBuilder) {
+	used, sys := s.usedMemory()
+	peak := s.stats.peakMemory.Load()
+	b.field("used_memory", used)
+	b.field("used_memory_human", bytesToHuman(used))
+	b.field("used_memory_rss", sys)
+	b.field("used_memory_rss_human", bytesToHuman(sys))
+	b.field("used_memory_peak", peak)
+	b.field("used_memory_peak_human", bytesToHuman(peak))
+	maxMemory := uint64(s.config.Int("maxmemory"))
+	b.field("maxmemory", maxMemory)
+	b.field("maxmemory_human", bytesToHuman(maxMemory))
+	b.field("maxmemory_policy", s.config.Get("maxmemory-policy"))
+	b.field("mem_allocator", "go")
+}
+
+func writePersistenceInfo(s *Server, b *infoBuilder) {
+	b.field("loading", boolInt(s.loading.Load()))
+	writeRDBInfo(s, b)
+	writeAOFInfo(s, b)
+}
+
+func writeStatsInfo(s *Server, b *infoBuilder) {
+	st := s.store.Stats()
+	b.field("total_connections_received", s.stats.connectionsReceived.Load())
+	b.field("total_commands_processed", s.stats.commandsProcessed.Load())
+	b.field("instantaneous_ops_per_sec", int64(s.stats.opsPerSec.rate()))
+	b.field("total_net_input_bytes", s.stats.netInputBytes.Load())
+	b.field("total_net_output_bytes", s.stats.netOutputBytes.Load())
+	b.field("instantaneous_input_kbps", fmt.Sprintf("%.2f", s.stats.inputRate.rate()/1024))
+	b.field("instantaneous_output_kbps", fmt.Sprintf("%.2f", s.stats.outputRate.rate()/1024))
+	b.field("rejected_connections", s.stats.rejectedConnections.Load())
+	b.field("sync_full", s.stats.syncFull.Load())
+	b.field("sync_partial_ok", s.stats.syncPartialOK.Load())
+	b.field("sync_partial_err", s.stats.syncPartialErr.Load())
+	b.field("expired_keys", st.ExpiredKeys)
+	b.field("evicted_keys", st.EvictedKeys)
+	b.field("keyspace_hits", st.KeyspaceHits)
+	b.field("keyspace_misses", st.KeyspaceMisses)
+	b.field("total_error_replies", s.stats.errorReplies.Load())
+}
+
+func writeKeyspaceInfo(s *Server, b *infoBuilder) {
+	keys, expires, avgTTL := s.store.KeyspaceInfo()
+	if keys > 0 {
+		b.field("db0", fmt.Sprintf("keys=%d,expires=%d,avg_ttl=%d", keys, expires, avgTTL.Milliseconds()))
+	}
+}
+
+// bytesToHuman formats a byte count as Redis does: 512B, 1.50K, 3.20M.
+func bytesToHuman(n uint64) string {
+	value := float64(n)
+	for _, unit := range []string{"B", "K", "M", "G", "T"} {
+		if value < 1024 || unit == "T" {
+			if unit == "B" {
+				return strconv.FormatUint(n, 10) + unit
+			}
+			return strconv.FormatFloat(value, 'f', 2, 64) + unit
+		}
+		value /= 1024
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+// File: internal/server/maxmemory.go
+
+package server
+
+import (
+	"basic-go-redis/internal/protocol"
+	"runtime"
+	"time"
+)
+
+// oomError is the reply to a command that would grow the dataset while the
+// server is over maxmemory.
+var oomError = protocol.ErrorReply("OOM command not allowed when used memory > 'maxmemory'.")
+
+// memoryState follows the heap between cron ticks. Only cron touches it.
+type memoryState struct {
+	// Bytes evicted since the last garbage collection, which the heap
+	// still counts
+	pendingFree uint64
+	numGC       uint32
+	lastGC      time.Time
+}
+
+// enforceMaxMemory keeps the heap under maxmemory by evicting keys as the
+// policy allows, and records whether it is still over, in which case
+// commands that grow the dataset are refused. The heap counts garbage
+// until it is collected, so a collection is forced, at most once a second,
+// before deciding the server is over.
+func (s *Server) enforceMaxMemory() {
+	limit := uint64(max(s.config.Int("maxmemory"), 0))
+	if limit == 0 {
+		s.overMemory.Store(false)
+		return
+	}
+
+	used := s.heapInUse()
+	if used > limit && time.Since(s.mem.lastGC) >= time.Second {
+		runtime.GC()
+		s.mem.lastGC = time.Now()
+		used = s.heapInUse()
+	}
+	// A replica deletes the keys its primary evicts, when the primary does
+	if used > limit && !s.isReplica() {
+		if policy := s.config.Get("maxmemory-policy"); policy != "noeviction" {
+			samples := int(s.config.Int("maxmemory-samples"))
+			s.writeOrder.Lock()
+			freed, keys := s.store.Evict(policy, samples, int(used-limit))
+			if len(keys) > 0 {
+				s.propagate(delArgs(keys))
+			}
+			s.writeOrder.Unlock()
+			s.mem.pendingFree += uint64(freed)
+			used -= min(uint64(freed), used)
+		}
+	}
+	s.overMemory.Store(used > limit)
+}
+
+// heapInUse returns the bytes allocated on the heap, less those evicted
+// since the last garbage collection.
+func (s *Server) heapInUse() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	if m.NumGC != s.mem.numGC {
+		s.mem.numGC, s.mem.pendingFree = m.NumGC, 0
+	}
+	return m.HeapAlloc - min(s.mem.pendingFree, m.HeapAlloc)
+}
+
+// closeIdleClients closes the connections idle for longer than timeout.
+// Clients waiting on a pause aren't idle, and replication links, which
+// have timeouts of their own, are left alone.
+func (s *Server) closeIdleClients() {
+	timeout := time.Duration(s.config.Int("timeout")) * time.Second
+	if timeout == 0 || s.paused() {
+		return
+	}
+	now := time.Now()
+	for _, c := range s.clientList() {
+		c.mu.Lock()
+		idle := now.Sub(c.lastInteraction)
+		replication := c.master || c.replica != nil
+		c.mu.Unlock()
+		if idle > timeout && !replication {
+			c.conn.Close()
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// File: internal/server/migrate.go
+
+package server
+
+import (
+	"basic-go-redis/internal/protocol"
+	"basic-go-redis/internal/rdb"
+	"basic-go-redis/internal/store"
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rdbEntryOf returns a store entry as the rdb package takes it.
+func rdbEntryOf(e store.Entry) *rdb.Entry {
+	if e.ZSet != nil {
+		return &rdb.Entry{Key: e.Key, Type: rdb.TypeZSet, ZSet: e.ZSet, ExpireAt: e.ExpireAt}
+	}
+	return &rdb.Entry{Key: e.Key, Type: rdb.TypeString, String: e.String, ExpireAt: e.ExpireAt}
+}
+
+// dumpCommand replies with the key's value serialized as Redis does, which
+// RESTORE reads back here or in Redis.
+func dumpCommand(s *Server, c *client, args [][]byte) string {
+	e, ok := s.store.Lookup(string(args[1]))
+	if !ok {
+		return protocol.NullBulkString
+	}
+	payload, err := rdb.Dump(rdbEntryOf(e))
+	if err != nil {
+		return protocol.ErrorReply("ERR " + err.Error())
+	}
+	return protocol.BulkString(string(payload))
+}
+
+// restoreCommand creates a key from a DUMP payload, expiring after ttl
+// milliseconds, or at ttl with ABSTTL, unless ttl is 0. IDLETIME and FREQ
+// are accepted for compatibility; the server keeps neither.
+func restoreCommand(s *Server, c *client, args [][]byte) string {
+	key := string(args[1])
+	ttl, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return notIntegerError
+	}
+	replace, absTTL := false, false
+	for i := 4; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absTTL = true
+		case "IDLETIME", "FREQ":
+			if i+1 == len(args) {
+				return syntaxError
+			}
+			if _, err := strconv.ParseInt(string(args[i+1]), 10, 64); err != nil {
+				return notIntegerError
+			}
+			i++
+		default:
+			return syntaxError
+		}
+	}
+	if ttl < 0 {
+		return protocol.ErrorReply("ERR Invalid TTL value, must be >= 0")
+	}
+	if !replace && s.store.Type(key) != "none" {
+		return busyKeyError
+	}
+
+	value, err := rdb.Restore(args[3])
+	if errors.Is(err, rdb.ErrDumpPayload) {
+		return protocol.ErrorReply("ERR " + err.Error())
+	}
+	if err != nil || (value.Type != rdb.TypeString && value.Type != rdb.TypeZSet) {
+		return protocol.ErrorReply("ERR Bad data format")
+	}
+	var expireAt time.Time
+	if ttl > 0 {
+		if absTTL {
+			expireAt = time.UnixMilli(ttl)
+		} else {
+			expireAt = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		}
+	}
+	if !s.store.Put(store.Entry{Key: key, ExpireAt: expireAt, String: value.String, ZSet: value.ZSet}) {
+		// Expired already, so the key isn't created but REPLACE still
+		// removes the old one
+		if replace && s.store.Del([]string{key}) > 0 {
+			c.rewriteArgs("DEL", key)
+		} else {
+			c.rewriteArgs()
+		}
+		return protocol.OK
+	}
+	if ttl > 0 && !absTTL {
+		c.rewriteArgs("RESTORE", key, strconv.FormatInt(expireAt.UnixMilli(), 10), string(args[3]), "REPLACE", "ABSTTL")
+	}
+	return protocol.OK
+}
+
+// migrateKeys finds the key of MIGRATE, or with KEYS, the keys after it.
+func migrateKeys(args [][]byte) []int {
+	if len(args) > 3 && len(args[3]) > 0 {
+		return []int{3}
+	}
+	for i := 6; i < len(args); i++ {
+		if strings.EqualFold(string(args[i]), "KEYS") {
+			var positions []int
+			for j := i + 1; j < len(args); j++ {
+				positions = append(positions, j)
+			}
+			return positions
+		}
+	}
+	return nil
+}
+
+// migrateCommand moves keys to another server: it sends them with
+// RESTORE, in one round trip, and deletes those the target restored unless
+// COPY is given. No other write runs meanwhile, so each key is either on
+// the target or still here, as it was.
+//
+// The AOF and replicas get the DEL of the keys moved, not MIGRATE itself.
+func migrateCommand(s *Server, c *client, args [][]byte) string {
+	addr := net.JoinHostPort(string(args[1]), string(args[2]))
+	db, err := strconv.Atoi(string(args[4]))
+	if err != nil {
+		return notIntegerError
+	}
+	timeoutMs, err := strconv.ParseInt(string(args[5]), 10, 64)
+	if err != nil {
+		return notIntegerError
+	}
+	if timeoutMs <= 0 {
+		timeoutMs = 1000
+	}
+	timeout := time.Duration(timeoutMs) * time.Millisecond
+
+	copyKeys, replace := false, false
+	var auth [][]byte
+	keys := [][]byte{args[3]}
+	for i := 6; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "COPY":
+			copyKeys = true
+		case "REPLACE":
+			replace = true
+		case "AUTH":
+			if i+1 >= len(args) {
+				return syntaxError
+			}
+			auth = [][]byte{[]byte("AUTH"), args[i+1]}
+			i++
+		case "AUTH2":
+			if i+2 >= len(args) {
+				return syntaxError
+			}
+			auth = [][]byte{[]byte("AUTH"), args[i+1], args[i+2]}
+			i += 2
+		case "KEYS":
+			if len(args[3]) != 0 {
+				return protocol.ErrorReply("ERR When using MIGRATE KEYS option, the key argument must be set to the empty string")
+			}
+			keys = args[i+1:]
+			i = len(args)
+		default:
+			return syntaxError
+		}
+	}
+
+	// The commands to send: AUTH and SELECT, then a RESTORE per key. In
+	// cluster mode RESTORE-ASKING reaches a target importing the slot.
+	restoreName := []byte("RESTORE")
+	if s.cluster != nil {
+		restoreName = []byte("RESTORE-ASKING")
+	}
+	var out []byte
+	preamble := 0
+	if auth != nil {
+		out = protocol.AppendCommand(out, auth)
+		preamble++
+	}
+	if db != 0 {
+		out = protocol.AppendCommand(out, [][]byte{[]byte("SELECT"), []byte(strconv.Itoa(db))})
+		preamble++
+	}
+	var found []string
+	now := time.Now()
+	for _, key := range keys {
+		e, ok := s.store.Lookup(string(key))
+		if !ok {
+			continue
+		}
+		payload, err := rdb.Dump(rdbEntryOf(e))
+		if err != nil {
+			return protocol.ErrorReply("ERR " + err.Error())
+		}
+		var ttl int64
+		if !e.ExpireAt.IsZero() {
+			ttl = max(e.ExpireAt.Sub(now).Milliseconds(), 1)
+		}
+		restore := [][]byte{restoreName, key, []byte(strconv.FormatInt(ttl, 10)), payload}
+		if replace {
+			restore = append(restore, []byte("REPLACE"))
+		}
+		out = protocol.AppendCommand(out, restore)
+		found = append(found, e.Key)
+	}
+	// Nothing changes here, whatever happens next
+	c.rewriteArgs()
+	if len(found) == 0 {
+		return protocol.SimpleString("NOKEY")
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return protocol.ErrorReply("IOERR error or timeout connecting to the client")
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(out); err != nil {
+		return protocol.ErrorReply("IOERR error or timeout writing to target instance")
+	}
+
+	reader := bufio.NewReader(conn)
+	readReply := func() (protocol.Value, error) {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		return protocol.ReadValue(reader)
+	}
+	for range preamble {
+		reply, err := readReply()
+		if err != nil {
+			return protocol.ErrorReply("IOERR error or timeout reading to target instance")
+		}
+		if reply.IsError() {
+			return protocol.ErrorReply("ERR Target instance replied with error: " + reply.Str)
+		}
+	}
+	var moved []string
+	var targetErr string
+	for _, key := range found {
+		reply, err := readReply()
+		if err != nil {
+			// Keys whose reply didn't come may or may not have been
+			// restored, so they are kept
+			targetErr = "IOERR error or timeout reading to target instance"
+			break
+		}
+		if reply.IsError() {
+			if targetErr == "" {
+				targetErr = "ERR Target instance replied with error: " + reply.Str
+			}
+			continue
+		}
+		moved = append(moved, key)
+	}
+
+	if !copyKeys && len(moved) > 0 {
+		s.store.Del(moved)
+		// Logged here, as an error reply isn't
+		c.writeOffset = s.propagate(delArgs(moved))
+	}
+	if targetErr != "" {
+		return protocol.ErrorReply(targetErr)
+	}
+	return protocol.OK
+}
@@ -0,0 +1,378 @@
+// File: internal/server/rdb.go
+
+package server
+
+import (
+	"basic-go-redis/internal/protocol"
+	"basic-go-redis/internal/rdb"
+	"basic-go-redis/internal/store"
+	"basic-go-redis/pkg/config"
+	"basic-go-redis/pkg/logger"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bgsaveRetryDelay is how long the save rules wait to try again after a
+// background save failed.
+const bgsaveRetryDelay = 5 * time.Second
+
+var errSaveInProgress = errors.New("Background save already in progress")
+
+// rdbState follows the snapshots of the dataset written to disk.
+type rdbState struct {
+	mu           sync.Mutex
+	inProgress   bool // SAVE or BGSAVE is writing a snapshot
+	background   bool // It is a BGSAVE
+	scheduled    bool // BGSAVE SCHEDULE asked for one once it is done
+	started      time.Time
+	lastSave     time.Time // When the last successful snapshot was taken
+	lastTry      time.Time
+	lastOK       bool
+	lastDuration time.Duration
+	saves        int64
+}
+
+// rdbPath returns where snapshots are saved and loaded.
+func (s *Server) rdbPath() string {
+	return filepath.Join(s.config.Get("dir"), s.config.Get("dbfilename"))
+}
+
+// checkSnapshotPath refuses a dir that isn't a directory or a dbfilename
+// that is a path, as CONFIG SET changes them.
+func (s *Server) checkSnapshotPath(cfg *config.Registry) {
+	cfg.OnChange("dir", func(dir string) error {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		return nil
+	})
+	cfg.OnChange("dbfilename", func(name string) error {
+		if name == "" || strings.ContainsRune(name, filepath.Separator) || strings.ContainsRune(name, '/') {
+			return errors.New("dbfilename can't be a path, just a filename")
+		}
+		return nil
+	})
+}
+
+// save writes a snapshot of the dataset, in a goroutine when background is
+// set, and fails if one is being written already. The snapshot is taken at
+// once, so writes after save returns aren't in it.
+func (s *Server) save(background bool) error {
+	s.rdb.mu.Lock()
+	if s.rdb.inProgress {
+		s.rdb.mu.Unlock()
+		return errSaveInProgress
+	}
+	s.rdb.inProgress, s.rdb.background, s.rdb.scheduled = true, background, false
+	s.rdb.started = time.Now()
+	s.rdb.mu.Unlock()
+
+	// Writes counted after this are at most also in the snapshot, so the
+	// count left once it is saved errs on the side of saving again
+	dirty := s.dirty.Load()
+	snap := s.store.Snapshot()
+	path := s.rdbPath()
+	if !background {
+		return s.finishSave(snap, path, dirty)
+	}
+	logger.Notice("Background saving started", "path", path)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.finishSave(snap, path, dirty)
+	}()
+	return nil
+}
+
+func (s *Server) finishSave(snap *store.Snapshot, path string, dirty int64) error {
+	err := writeSnapshot(snap, path)
+	snap.Release()
+
+	s.rdb.mu.Lock()
+	defer s.rdb.mu.Unlock()
+	s.rdb.inProgress = false
+	s.rdb.lastDuration = time.Since(s.rdb.started)
+	s.rdb.lastTry = time.Now()
+	s.rdb.lastOK = err == nil
+	if err != nil {
+		logger.Warning("Failed saving the DB", "path", path, "err", err)
+		return err
+	}
+	s.dirty.Add(-dirty)
+	s.rdb.lastSave = snap.Taken()
+	s.rdb.saves++
+	logger.Notice("DB saved on disk", "path", path, "seconds", s.rdb.lastDuration.Seconds())
+	return nil
+}
+
+// writeSnapshot saves snap in RDB format to a temporary file, which is
+// then renamed to path, so a crash leaves either the old file or the new.
+func writeSnapshot(snap *store.Snapshot, path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "temp-*.rdb")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = encodeSnapshot(tmp, snap)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// encodeSnapshot writes snap to w in RDB format.
+func encodeSnapshot(w io.Writer, snap *store.Snapshot) error {
+	enc := rdb.NewEncoder(w)
+	enc.Header(
+		"redis-ver", redisVersion,
+		"redis-bits", strconv.Itoa(strconv.IntSize),
+		"ctime", strconv.FormatInt(snap.Taken().Unix(), 10),
+	)
+	if keys, expires := snap.Len(); keys > 0 {
+		enc.SelectDB(0, keys, expires)
+	}
+	err := snap.Each(func(e store.Entry) error {
+		if e.ZSet != nil {
+			return enc.ZSet(e.Key, e.ZSet, e.ExpireAt)
+		}
+		return enc.String(e.Key, e.String, e.ExpireAt)
+	})
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// LoadData loads the dataset saved by an earlier run, from the AOF when
+// appendonly is on and otherwise from the snapshot, if there is one. It is
+// called before Start.
+func (s *Server) LoadData() error {
+	if s.config.Bool("appendonly") {
+		return s.startAOF()
+	}
+	return s.loadRDB()
+}
+
+func (s *Server) loadRDB() error {
+	path := s.rdbPath()
+	start := time.Now()
+	stats, err := s.loadSnapshot(path, 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	stats.logSkipped(path)
+	logger.Notice("DB loaded from disk", "path", path, "keys", stats.keys, "seconds", time.Since(start).Seconds())
+	return nil
+}
+
+// ImportRDB adds the keys of database db of an RDB file, such as one Redis
+// wrote, to the dataset. Keys of types the server doesn't have are left
+// out with a warning. It is called after LoadData, and rewrites the AOF
+// when appendonly is on so that the imported keys are kept.
+func (s *Server) ImportRDB(path string, db int) error {
+	start := time.Now()
+	stats, err := s.loadSnapshot(path, db)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	stats.logSkipped(path)
+	logger.Notice("RDB file imported", "path", path, "db", db, "keys", stats.keys, "seconds", time.Since(start).Seconds())
+	s.dirty.Add(int64(stats.keys))
+	if s.config.Bool("appendonly") && stats.keys > 0 {
+		return s.rewriteAOF()
+	}
+	return nil
+}
+
+// loadStats counts the keys of an RDB file that were loaded, and those
+// left out by the reason why.
+type loadStats struct {
+	keys    int
+	skipped map[string]int
+}
+
+func (st *loadStats) skip(reason string) {
+	if st.skipped == nil {
+		st.skipped = make(map[string]int)
+	}
+	st.skipped[reason]++
+}
+
+func (st *loadStats) logSkipped(path string) {
+	reasons := make([]string, 0, len(st.skipped))
+	for reason := range st.skipped {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		logger.Warning("Keys left out of the dataset", "path", path, "reason", reason, "keys", st.skipped[reason])
+	}
+}
+
+// loadSnapshot adds the keys of database db of an RDB file to the store,
+// leaving out those that have expired since and those of other databases
+// or of types the store doesn't have.
+func (s *Server) loadSnapshot(path string, db int) (loadStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return loadStats{}, err
+	}
+	defer f.Close()
+	return s.loadSnapshotFrom(f, db)
+}
+
+// loadSnapshotFrom is loadSnapshot reading the RDB data from r.
+func (s *Server) loadSnapshotFrom(r io.Reader, db int) (loadStats, error) {
+	var stats loadStats
+	dec, err := rdb.NewDecoder(r)
+	if err != nil {
+		return stats, err
+	}
+	for {
+		e, err := dec.Next()
+		if err == io.EOF {
+			return stats, nil
+		}
+		if err != nil {
+			return stats, err
+		}
+		switch {
+		case e.DB != db:
+			stats.skip(fmt.Sprintf("in db %d", e.DB))
+		case e.Type != rdb.TypeString && e.Type != rdb.TypeZSet:
+			stats.skip(rdb.TypeName(e.Type) + " type not supported")
+		case s.store.Put(store.Entry{Key: e.Key, ExpireAt: e.ExpireAt, String: e.String, ZSet: e.ZSet}):
+			stats.keys++
+		}
+	}
+}
+
+// saveOnRules starts a background save when a save rule asks for one, or
+// BGSAVE SCHEDULE did. cron calls it every second.
+func (s *Server) saveOnRules(now time.Time) {
+	rules, _ := config.ParseSaveRules(s.config.Get("save"))
+	s.rdb.mu.Lock()
+	if s.rdb.inProgress {
+		s.rdb.mu.Unlock()
+		return
+	}
+	start := s.rdb.scheduled
+	lastSave, lastTry, lastOK := s.rdb.lastSave, s.rdb.lastTry, s.rdb.lastOK
+	s.rdb.mu.Unlock()
+
+	dirty := s.dirty.Load()
+	for _, rule := range rules {
+		if start {
+			break
+		}
+		// After a failure, wait a little before trying again
+		if dirty >= rule.Changes && now.Sub(lastSave) >= time.Duration(rule.Seconds)*time.Second &&
+			(lastOK || now.Sub(lastTry) >= bgsaveRetryDelay) {
+			logger.Notice("Save rule reached, saving", "changes", rule.Changes, "seconds", rule.Seconds)
+			start = true
+		}
+	}
+	if start {
+		s.save(true)
+	}
+}
+
+// Shutdown saves the dataset when save rules are configured, once any
+// background save has finished, and closes the server. The server closes
+// even if saving fails.
+func (s *Server) Shutdown() error {
+	var err error
+	if s.config.Get("save") != "" {
+		logger.Notice("Saving the final RDB snapshot before exiting")
+		for {
+			if err = s.save(false); err != errSaveInProgress {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if closeErr := s.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func saveCommand(s *Server, c *client, args [][]byte) string {
+	if err := s.save(false); err != nil {
+		return protocol.ErrorReply("ERR " + err.Error())
+	}
+	return protocol.OK
+}
+
+func bgsaveCommand(s *Server, c *client, args [][]byte) string {
+	schedule := false
+	if len(args) == 2 {
+		if !strings.EqualFold(string(args[1]), "schedule") {
+			return protocol.ErrorReply("ERR syntax error")
+		}
+		schedule = true
+	}
+	err := s.save(true)
+	if err == errSaveInProgress && schedule {
+		s.rdb.mu.Lock()
+		s.rdb.scheduled = true
+		s.rdb.mu.Unlock()
+		return protocol.SimpleString("Background saving scheduled")
+	}
+	if err != nil {
+		return protocol.ErrorReply("ERR " + err.Error())
+	}
+	return protocol.SimpleString("Background saving started")
+}
+
+func lastsaveCommand(s *Server, c *client, args [][]byte) string {
+	s.rdb.mu.Lock()
+	defer s.rdb.mu.Unlock()
+	return protocol.Integer(s.rdb.lastSave.Unix())
+}
+
+func writeRDBInfo(s *Server, b *infoBuilder) {
+	s.rdb.mu.Lock()
+	defer s.rdb.mu.Unlock()
+	bgsave, current := 0, int64(-1)
+	if s.rdb.inProgress && s.rdb.background {
+		bgsave, current = 1, int64(time.Since(s.rdb.started).Seconds())
+	}
+	status, last := "ok", int64(-1)
+	if !s.rdb.lastOK {
+		status = "err"
+	}
+	if !s.rdb.lastTry.IsZero() {
+		last = int64(s.rdb.lastDuration.Seconds())
+	}
+	b.field("rdb_changes_since_last_save", s.dirty.Load())
+	b.field("rdb_bgsave_in_progress", bgsave)
+	b.field("rdb_last_save_time", s.rdb.lastSave.Unix())
+	b.field("rdb_last_bgsave_status", status)
+	b.field("rdb_last_bgsave_time_sec", last)
+	b.field("rdb_current_bgsave_time_sec", current)
+	b.field("rdb_saves", s.rdb.saves)
+}
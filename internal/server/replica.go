@@ -0,0 +1,447 @@
+// File: internal/server/replica.go
+
+package server
+
+import (
+	"basic-go-redis/internal/protocol"
+	"basic-go-redis/pkg/logger"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// States of the link to the primary, as ROLE reports them.
+const (
+	linkConnect    = "connect"    // Waiting to connect again
+	linkConnecting = "connecting" // Connecting and asking for the stream
+	linkSync       = "sync"       // Receiving the snapshot
+	linkConnected  = "connected"  // Receiving the stream
+)
+
+var masterDownError = protocol.ErrorReply("MASTERDOWN Link with MASTER is down and replica-serve-stale-data is set to 'no'.")
+
+var loadingError = protocol.ErrorReply("LOADING Redis is loading the dataset in memory")
+
+// linkRetryDelay is how long a replica waits to connect to its primary
+// again after the link failed.
+const linkRetryDelay = time.Second
+
+// masterLink is a replica's connection to its primary. Its fields are
+// guarded by repl.mu.
+type masterLink struct {
+	host, port string
+	state      string
+	conn       net.Conn
+	client     *client // Runs the stream's commands, once connected
+	lastIO     time.Time
+	downSince  time.Time
+
+	writeMu  sync.Mutex // Held while writing to conn
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{} // Closed when the link's goroutine returns
+}
+
+// close stops the link, which its goroutine notices at once.
+func (link *masterLink) close() {
+	link.stopOnce.Do(func() { close(link.stop) })
+}
+
+// replicaofCommand makes the server a replica of another, keeping its
+// dataset until the primary sends its own, or with NO ONE a primary again.
+// A promoted replica's replicas stay connected, and those of its former
+// primary can continue from it.
+func replicaofCommand(s *Server, c *client, args [][]byte) string {
+	if s.cluster != nil {
+		return protocol.ErrorReply("ERR REPLICAOF not allowed in cluster mode.")
+	}
+	host, port := string(args[1]), string(args[2])
+	if strings.EqualFold(host, "no") && strings.EqualFold(port, "one") {
+		if s.promote() {
+			c.log.Notice("MASTER MODE enabled")
+		}
+		return protocol.OK
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return protocol.ErrorReply("ERR Invalid master port")
+	}
+	if !s.replicate(host, port) {
+		return protocol.SimpleString("OK Already connected to specified master")
+	}
+	c.log.Notice("REPLICAOF enabled", "master", net.JoinHostPort(host, port))
+	return protocol.OK
+}
+
+// startConfiguredReplication connects to the primary the replicaof
+// parameter names, as "host port", if it names one.
+func (s *Server) startConfiguredReplication() error {
+	value := s.config.Get("replicaof")
+	if value == "" {
+		return nil
+	}
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return fmt.Errorf("replicaof must be \"host port\", got %q", value)
+	}
+	if n, err := strconv.Atoi(fields[1]); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("replicaof: invalid port %q", fields[1])
+	}
+	s.replicate(fields[0], fields[1])
+	return nil
+}
+
+// replicate makes the server a replica of host:port, unless it is one
+// already, in which case it reports false. The replicas of this server
+// are disconnected, to sync again with what it will have.
+func (s *Server) replicate(host, port string) bool {
+	r := &s.repl
+	r.roleMu.Lock()
+	defer r.roleMu.Unlock()
+	r.mu.Lock()
+	old := r.master
+	if old != nil && old.host == host && old.port == port {
+		r.mu.Unlock()
+		return false
+	}
+	r.mu.Unlock()
+	s.stopLink(old)
+
+	link := &masterLink{
+		host: host, port: port, state: linkConnect, downSince: time.Now(),
+		stop: make(chan struct{}), done: make(chan struct{}),
+	}
+	r.mu.Lock()
+	r.master = link
+	r.replica.Store(true)
+	s.disconnectReplicas()
+	r.mu.Unlock()
+	s.config.Set("replicaof", host+" "+port)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(link.done)
+		s.runLink(link)
+	}()
+	return true
+}
+
+// promote makes a replica a primary, reporting false if it is one already.
+func (s *Server) promote() bool {
+	r := &s.repl
+	r.roleMu.Lock()
+	defer r.roleMu.Unlock()
+	r.mu.Lock()
+	link := r.master
+	r.mu.Unlock()
+	if link == nil {
+		return false
+	}
+	s.stopLink(link)
+
+	r.mu.Lock()
+	r.master = nil
+	r.replica.Store(false)
+	if r.backlog == nil {
+		s.createBacklog()
+	}
+	s.shiftReplID()
+	r.mu.Unlock()
+	s.config.Set("replicaof", "")
+	return true
+}
+
+// stopLink closes the link to the primary and waits for its goroutine to
+// return, so that no more of the stream is run. The caller holds roleMu
+// but not mu.
+func (s *Server) stopLink(link *masterLink) {
+	if link == nil {
+		return
+	}
+	link.close()
+	<-link.done
+}
+
+// runLink keeps the replica connected to its primary until the link is
+// stopped or the server shuts down, connecting again when it fails.
+func (s *Server) runLink(link *masterLink) {
+	addr := net.JoinHostPort(link.host, link.port)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Stopping the link or the server closes the connection, which ends
+	// whatever is waiting on it
+	go func() {
+		select {
+		case <-link.stop:
+		case <-s.shutdownChan:
+		case <-ctx.Done():
+		}
+		cancel()
+		s.repl.mu.Lock()
+		if link.conn != nil {
+			link.conn.Close()
+		}
+		s.repl.mu.Unlock()
+	}()
+
+	for {
+		err := s.syncWithMaster(ctx, link, addr)
+		s.repl.mu.Lock()
+		if link.state == linkConnected {
+			link.downSince = time.Now()
+		}
+		link.state, link.conn, link.client = linkConnect, nil, nil
+		s.repl.mu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warning("Connection with master lost or failed", "master", addr, "err", err)
+
+		select {
+		case <-time.After(linkRetryDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// timeoutConn fails reads and writes that take longer than timeout.
+type timeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c timeoutConn) Read(p []byte) (int, error) {
+	c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(p)
+}
+
+func (c timeoutConn) Write(p []byte) (int, error) {
+	c.Conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(p)
+}
+
+// syncWithMaster connects to the primary and asks for the stream with
+// PSYNC: from where this server's stream is, which the primary continues
+// if it has it, or else from a snapshot, which replaces the dataset. It
+// then runs the stream until the connection fails.
+func (s *Server) syncWithMaster(ctx context.Context, link *masterLink, addr string) error {
+	timeout := time.Duration(s.config.Int("repl-timeout")) * time.Second
+	dialer := net.Dialer{Timeout: timeout}
+	raw, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	conn := timeoutConn{raw, timeout}
+	r := &s.repl
+	r.mu.Lock()
+	link.conn, link.state = raw, linkConnecting
+	replID, offset := r.replID, r.offset+1
+	if r.backlog == nil {
+		replID, offset = "?", -1
+	}
+	r.mu.Unlock()
+	if ctx.Err() != nil {
+		raw.Close()
+		return ctx.Err()
+	}
+	defer raw.Close()
+	logger.Notice("Connecting to MASTER", "master", addr)
+
+	rd := bufio.NewReader(conn)
+	send := func(args ...string) (protocol.Value, error) {
+		req := make([][]byte, len(args))
+		for i, arg := range args {
+			req[i] = []byte(arg)
+		}
+		if _, err := conn.Write(protocol.AppendCommand(nil, req)); err != nil {
+			return protocol.Value{}, err
+		}
+		return protocol.ReadValue(rd)
+	}
+	reply, err := send("PING")
+	if err != nil {
+		return err
+	}
+	if reply.IsError() {
+		return fmt.Errorf("error reply to PING from master: %s", reply.Str)
+	}
+	if reply, err = send("REPLCONF", "listening-port", s.port); err != nil {
+		return err
+	} else if reply.IsError() {
+		logger.Warning("Master does not understand REPLCONF listening-port", "reply", reply.Str)
+	}
+	if _, err = send("REPLCONF", "capa", "psync2"); err != nil {
+		return err
+	}
+	if reply, err = send("PSYNC", replID, strconv.FormatInt(offset, 10)); err != nil {
+		return err
+	}
+	if reply.IsError() {
+		return fmt.Errorf("error reply to PSYNC from master: %s", reply.Str)
+	}
+
+	switch fields := strings.Fields(reply.Str); {
+	case len(fields) == 3 && fields[0] == "FULLRESYNC":
+		masterOffset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad FULLRESYNC reply from master: %q", reply.Str)
+		}
+		logger.Notice("Full resync from master", "replid", fields[1], "offset", masterOffset)
+		if err := s.loadFromMaster(rd, link, fields[1], masterOffset); err != nil {
+			return err
+		}
+	case len(fields) >= 1 && fields[0] == "CONTINUE":
+		r.mu.Lock()
+		if len(fields) == 2 && fields[1] != r.replID {
+			// The primary was promoted since: its history is ours up to here
+			s.shiftReplID()
+			r.replID = fields[1]
+		}
+		r.mu.Unlock()
+		logger.Notice("Successful partial resynchronization with master", "offset", offset)
+	default:
+		return fmt.Errorf("unexpected reply to PSYNC from master: %q", reply.Str)
+	}
+
+	// The stream's commands are run for a client of their own, which
+	// CLIENT LIST shows with the M flag
+	mc := s.newClient(raw)
+	mc.mu.Lock()
+	mc.master = true
+	mc.mu.Unlock()
+	defer s.unlinkClient(mc)
+	r.mu.Lock()
+	link.state, link.client, link.lastIO = linkConnected, mc, time.Now()
+	r.mu.Unlock()
+	s.sendAck()
+	logger.Notice("MASTER <-> REPLICA sync: Finished with success", "master", addr)
+	return s.runStream(link, protocol.NewReader(countingReader{rd, &s.stats.netInputBytes}))
+}
+
+// loadFromMaster replaces the dataset with the snapshot the primary sends
+// after FULLRESYNC, as a bulk string without the final CRLF, and starts
+// the stream at offset. Commands other than those allowed while loading
+// are refused meanwhile.
+func (s *Server) loadFromMaster(rd *bufio.Reader, link *masterLink, replID string, offset int64) error {
+	r := &s.repl
+	r.mu.Lock()
+	link.state = linkSync
+	r.mu.Unlock()
+
+	// The primary may send newlines while it prepares the snapshot
+	var line string
+	for line == "" {
+		text, err := rd.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(text, "\r\n")
+	}
+	size, err := strconv.ParseInt(strings.TrimPrefix(line, "$"), 10, 64)
+	if !strings.HasPrefix(line, "$") || err != nil || size < 0 {
+		return fmt.Errorf("bad snapshot header from master: %q", line)
+	}
+
+	start := time.Now()
+	s.writeOrder.Lock()
+	s.loading.Store(true)
+	s.store.Flush()
+	payload := io.LimitReader(rd, size)
+	stats, err := s.loadSnapshotFrom(payload, 0)
+	io.Copy(io.Discard, payload)
+	s.loading.Store(false)
+	if err != nil {
+		s.store.Flush()
+		s.writeOrder.Unlock()
+		return fmt.Errorf("loading the snapshot from master: %w", err)
+	}
+	s.stats.netInputBytes.Add(size)
+	stats.logSkipped("master")
+
+	r.mu.Lock()
+	r.replID, r.replID2, r.offset, r.secondOffset = replID, noReplID, offset, -1
+	s.createBacklog()
+	// Their history isn't this server's any more
+	s.disconnectReplicas()
+	r.mu.Unlock()
+	s.dirty.Add(int64(stats.keys))
+	s.writeOrder.Unlock()
+	logger.Notice("MASTER <-> REPLICA sync: Loaded the snapshot", "keys", stats.keys, "bytes", size, "seconds", time.Since(start).Seconds())
+
+	// The AOF starts again from the new dataset
+	if s.config.Bool("appendonly") {
+		if err := s.rewriteAOF(); err != nil && !errors.Is(err, errRewriteInProgress) {
+			logger.Warning("Rewriting the AOF after the sync failed", "err", err)
+		}
+	}
+	return nil
+}
+
+// runStream runs the commands the primary sends and passes them on, as
+// they came, to this server's own backlog and replicas.
+func (s *Server) runStream(link *masterLink, reader *protocol.Reader) error {
+	r := &s.repl
+	for {
+		args, err := reader.ReadCommand()
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			continue
+		}
+		now := time.Now()
+		link.client.mu.Lock()
+		link.client.lastInteraction = now
+		link.client.mu.Unlock()
+
+		data := protocol.AppendCommand(nil, args)
+		s.writeOrder.Lock()
+		if reply := s.executeCommand(link.client, args); strings.HasPrefix(reply, "-") {
+			link.client.log.Warning("Command from the master failed", "command", string(args[0]), "reply", strings.TrimSpace(reply[1:]))
+		}
+		r.mu.Lock()
+		s.feedStream(data)
+		link.lastIO = now
+		r.mu.Unlock()
+		s.writeOrder.Unlock()
+	}
+}
+
+// sendAck tells the primary how much of the stream this replica has run.
+func (s *Server) sendAck() {
+	r := &s.repl
+	r.mu.Lock()
+	link := r.master
+	if link == nil || link.state != linkConnected {
+		r.mu.Unlock()
+		return
+	}
+	conn := link.conn
+	ack := protocol.AppendCommand(nil, [][]byte{[]byte("REPLCONF"), []byte("ACK"), []byte(strconv.FormatInt(r.offset, 10))})
+	r.mu.Unlock()
+
+	link.writeMu.Lock()
+	defer link.writeMu.Unlock()
+	timeout := time.Duration(s.config.Int("repl-timeout")) * time.Second
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	conn.Write(ack)
+}
+
+// staleData reports whether commands that need fresh data are refused: on
+// a replica whose link is down, unless replica-serve-stale-data allows it.
+func (s *Server) staleData() bool {
+	if !s.isReplica() || s.config.Bool("replica-serve-stale-data") {
+		return false
+	}
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+	return s.repl.master != nil && s.repl.master.state != linkConnected
+}
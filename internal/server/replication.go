@@ -0,0 +1,622 @@
+// File: internal/server/replication.go
+
+package server
+
+import (
+	"basic-go-redis/internal/protocol"
+	"basic-go-redis/internal/store"
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// replicaOutputLimit is how much of the stream may wait to be sent to a
+// replica before it is disconnected, as Redis's client-output-buffer-limit
+// does for replicas.
+const replicaOutputLimit = 256 << 20
+
+// noReplID is the replication ID reported when there is no second one.
+const noReplID = "0000000000000000000000000000000000000000"
+
+var readonlyError = protocol.ErrorReply("READONLY You can't write against a read only replica.")
+
+var noReplicasError = protocol.ErrorReply("NOREPLICAS Not enough good replicas to write.")
+
+// replState is the server's part in replication: the stream of writes it
+// sends its replicas and, on a replica, the link to its primary. The
+// stream is the write commands in RESP, as the AOF logs them.
+type replState struct {
+	mu sync.Mutex
+
+	// The stream is named by replID and offset counts its bytes. Once a
+	// replica is promoted, the replicas of its former primary may still
+	// continue with replID2, up to secondOffset.
+	replID       string
+	replID2      string
+	offset       int64
+	secondOffset int64
+
+	// backlog keeps the end of the stream, a circular buffer for replicas
+	// that reconnect to continue where they were. It is created with the
+	// first replica, and the stream isn't counted until then.
+	backlog     []byte
+	backlogNext int   // Where the next byte goes
+	backlogLen  int64 // Bytes of the stream it holds
+
+	replicas map[*replica]bool
+	lastPing time.Time
+	acked    chan struct{} // Closed, and replaced, when a replica acknowledges more
+
+	master  *masterLink // nil on a primary
+	roleMu  sync.Mutex  // Held by REPLICAOF, so that role changes don't overlap
+	replica atomic.Bool // Whether master is set, read by every write
+}
+
+// replica is a replica connected to this server, which sends it a
+// snapshot, unless it continued from the backlog, and then the stream.
+type replica struct {
+	c         *client
+	port      string          // Where the replica listens, from REPLCONF
+	snap      *store.Snapshot // To send first, nil once sent
+	pending   []byte          // Stream not yet sent, guarded by repl.mu
+	online    bool            // The snapshot was sent
+	ackOffset int64
+	lastAck   time.Time
+	wake      chan struct{} // Signalled when pending grows
+}
+
+// initReplication starts the server as a primary with a new replication ID.
+func (s *Server) initReplication() {
+	r := &s.repl
+	r.replID, r.replID2, r.secondOffset = newRunID(), noReplID, -1
+	r.replicas = make(map[*replica]bool)
+	r.acked = make(chan struct{})
+	s.config.OnChange("repl-backlog-size", func(value string) error {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		r.mu.Lock()
+		s.resizeBacklog(int(size))
+		r.mu.Unlock()
+		return nil
+	})
+}
+
+// isReplica reports whether the server replicates a primary.
+func (s *Server) isReplica() bool {
+	return s.repl.replica.Load()
+}
+
+// propagate counts a write that changed the dataset, logs it to the AOF
+// and, on a primary, sends it to the replicas. A replica passes on its
+// primary's stream instead. It returns the offset of the stream once the
+// write is in it. The caller holds writeOrder.
+func (s *Server) propagate(args [][]byte) int64 {
+	s.dirty.Add(1)
+	s.feedAOF(args)
+	r := &s.repl
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.master == nil {
+		s.feedStream(protocol.AppendCommand(nil, args))
+	}
+	return r.offset
+}
+
+// delArgs returns a DEL of keys, as propagate takes it.
+func delArgs(keys []string) [][]byte {
+	args := make([][]byte, 0, len(keys)+1)
+	args = append(args, []byte("DEL"))
+	for _, key := range keys {
+		args = append(args, []byte(key))
+	}
+	return args
+}
+
+// feedStream adds data to the stream: to the backlog and to what waits to
+// be sent to each replica. The caller holds repl.mu.
+func (s *Server) feedStream(data []byte) {
+	r := &s.repl
+	if r.backlog == nil {
+		return
+	}
+	r.offset += int64(len(data))
+	r.backlogLen = min(r.backlogLen+int64(len(data)), int64(len(r.backlog)))
+	for rest := data; len(rest) > 0; {
+		n := copy(r.backlog[r.backlogNext:], rest)
+		r.backlogNext = (r.backlogNext + n) % len(r.backlog)
+		rest = rest[n:]
+	}
+
+	for rep := range r.replicas {
+		if len(rep.pending)+len(data) > replicaOutputLimit {
+			rep.c.log.Warning("Replica is too far behind, disconnecting it", "pending", len(rep.pending))
+			rep.c.conn.Close()
+			continue
+		}
+		rep.pending = append(rep.pending, data...)
+		select {
+		case rep.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// createBacklog starts keeping the stream from the current offset. The
+// caller holds repl.mu.
+func (s *Server) createBacklog() {
+	r := &s.repl
+	r.backlog = make([]byte, max(s.config.Int("repl-backlog-size"), 1))
+	r.backlogNext, r.backlogLen = 0, 0
+}
+
+// resizeBacklog changes the size of the backlog, keeping as much of the
+// stream as fits. The caller holds repl.mu.
+func (s *Server) resizeBacklog(size int) {
+	r := &s.repl
+	if r.backlog == nil || size == len(r.backlog) {
+		return
+	}
+	keep := min(r.backlogLen, int64(size))
+	data := s.backlogFrom(r.offset - keep + 1)
+	r.backlog = make([]byte, size)
+	r.backlogNext = copy(r.backlog, data) % size
+	r.backlogLen = keep
+}
+
+// backlogFrom returns the stream from offset to its end. The caller holds
+// repl.mu and has checked the backlog holds it.
+func (s *Server) backlogFrom(offset int64) []byte {
+	r := &s.repl
+	n := int(r.offset - offset + 1)
+	out := make([]byte, 0, n)
+	start := (r.backlogNext - n + len(r.backlog)) % len(r.backlog)
+	if start+n <= len(r.backlog) {
+		return append(out, r.backlog[start:start+n]...)
+	}
+	out = append(out, r.backlog[start:]...)
+	return append(out, r.backlog[:n-(len(r.backlog)-start)]...)
+}
+
+// canContinue reports whether a replica that has the stream named replID
+// up to offset, excluded, can continue from the backlog. The caller holds
+// repl.mu.
+func (s *Server) canContinue(replID string, offset int64) bool {
+	r := &s.repl
+	if replID != r.replID && (replID != r.replID2 || offset > r.secondOffset) {
+		return false
+	}
+	first := r.offset - r.backlogLen + 1
+	return r.backlog != nil && offset >= first && offset <= r.offset+1
+}
+
+// shiftReplID gives the stream a new ID once the server is promoted, so
+// that the replicas of its former primary may continue with it.
+// The caller holds repl.mu.
+func (s *Server) shiftReplID() {
+	r := &s.repl
+	r.replID2, r.secondOffset = r.replID, r.offset+1
+	r.replID = newRunID()
+}
+
+// disconnectReplicas closes the connections of every replica, which then
+// sync again. The caller holds repl.mu.
+func (s *Server) disconnectReplicas() {
+	for rep := range s.repl.replicas {
+		rep.c.conn.Close()
+	}
+}
+
+// replconfCommand configures the replica sending it, before PSYNC, and
+// later acknowledges the stream it has processed. The primary doesn't
+// reply to ACK, and a replica answers GETACK with an ACK.
+func replconfCommand(s *Server, c *client, args [][]byte) string {
+	if len(args)%2 == 0 {
+		return syntaxError
+	}
+	for i := 1; i < len(args); i += 2 {
+		value := string(args[i+1])
+		switch strings.ToLower(string(args[i])) {
+		case "listening-port":
+			if _, err := strconv.Atoi(value); err != nil {
+				return protocol.ErrorReply("ERR Invalid listening-port")
+			}
+			c.listeningPort = value
+		case "ip-address", "capa":
+			// The address is the connection's, and the stream needs none of
+			// the capabilities Redis replicas announce
+		case "ack":
+			offset, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || c.replica == nil {
+				return ""
+			}
+			s.repl.mu.Lock()
+			if offset > c.replica.ackOffset {
+				c.replica.ackOffset = offset
+				close(s.repl.acked)
+				s.repl.acked = make(chan struct{})
+			}
+			c.replica.lastAck = time.Now()
+			s.repl.mu.Unlock()
+			return ""
+		case "getack":
+			if c.master {
+				s.sendAck()
+			}
+			return ""
+		default:
+			return protocol.ErrorReply(fmt.Sprintf("ERR Unrecognized REPLCONF option: %s", args[i]))
+		}
+	}
+	return protocol.OK
+}
+
+// psyncCommand starts sending the stream to a replica: from the backlog
+// when it has the stream up to a point the backlog holds, and otherwise
+// after a snapshot of the dataset. The snapshot is taken while no write
+// runs, so the stream goes on exactly from it.
+func psyncCommand(s *Server, c *client, args [][]byte) string {
+	if c.replica != nil || c.master {
+		return protocol.ErrorReply("ERR Replica already connected")
+	}
+	replID := string(args[1])
+	offset, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		offset = -1
+	}
+
+	s.writeOrder.Lock()
+	defer s.writeOrder.Unlock()
+	r := &s.repl
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.master != nil && r.master.state != linkConnected {
+		return protocol.ErrorReply("NOMASTERLINK Can't SYNC while not connected with my master")
+	}
+
+	rep := &replica{c: c, port: c.listeningPort, lastAck: time.Now(), wake: make(chan struct{}, 1)}
+	var reply string
+	if s.canContinue(replID, offset) {
+		rep.pending = s.backlogFrom(offset)
+		rep.online = true
+		reply = protocol.SimpleString("CONTINUE " + r.replID)
+		s.stats.syncPartialOK.Add(1)
+		c.log.Notice("Partial resynchronization accepted", "offset", offset, "backlog_bytes", len(rep.pending))
+	} else {
+		if r.backlog == nil {
+			s.createBacklog()
+		}
+		rep.snap = s.store.Snapshot()
+		s.stats.syncFull.Add(1)
+		if replID != "?" {
+			s.stats.syncPartialErr.Add(1)
+		}
+		reply = protocol.SimpleString(fmt.Sprintf("FULLRESYNC %s %d", r.replID, r.offset))
+		c.log.Notice("Full resync requested by replica", "replid", replID, "offset", offset)
+	}
+	r.replicas[rep] = true
+	c.mu.Lock()
+	c.replica = rep
+	c.mu.Unlock()
+	return reply
+}
+
+// syncCommand is the PSYNC of old replicas, which always sync in full.
+func syncCommand(s *Server, c *client, args [][]byte) string {
+	reply := psyncCommand(s, c, [][]byte{[]byte("PSYNC"), []byte("?"), []byte("-1")})
+	if strings.HasPrefix(reply, "+") {
+		return "" // The snapshot comes without the FULLRESYNC line
+	}
+	return reply
+}
+
+// serveReplica sends the stream to a replica once PSYNC has replied, while
+// the connection's own goroutine goes on reading the replica's ACKs.
+func (s *Server) serveReplica(c *client, reader *protocol.Reader, writer *bufio.Writer) {
+	rep := c.replica
+	done := make(chan struct{})
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		if err := s.sendStream(rep, writer, done); err != nil {
+			c.log.Warning("Error sending the stream to the replica", "err", err)
+		}
+		c.conn.Close()
+	}()
+
+	for {
+		args, err := reader.ReadCommand()
+		if err != nil {
+			break
+		}
+		if len(args) > 0 {
+			c.mu.Lock()
+			c.lastInteraction = time.Now()
+			c.mu.Unlock()
+			s.executeCommand(c, args)
+		}
+	}
+	close(done)
+	<-sent
+
+	s.repl.mu.Lock()
+	delete(s.repl.replicas, rep)
+	s.repl.mu.Unlock()
+	if rep.snap != nil {
+		rep.snap.Release()
+	}
+	c.log.Notice("Connection with replica lost")
+}
+
+// sendStream writes the snapshot, if the replica needs one, and then the
+// stream as it grows, until done is closed or writing fails.
+func (s *Server) sendStream(rep *replica, w *bufio.Writer, done <-chan struct{}) error {
+	conn := rep.c.conn
+	timeout := time.Duration(s.config.Int("repl-timeout")) * time.Second
+	if rep.snap != nil {
+		var buf bytes.Buffer
+		err := encodeSnapshot(&buf, rep.snap)
+		rep.snap.Release()
+		rep.snap = nil
+		if err != nil {
+			return err
+		}
+		conn.SetWriteDeadline(time.Now().Add(timeout + time.Duration(buf.Len()>>20)*time.Second))
+		fmt.Fprintf(w, "$%d\r\n", buf.Len())
+		w.Write(buf.Bytes())
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		s.stats.netOutputBytes.Add(int64(buf.Len()))
+		s.repl.mu.Lock()
+		rep.online, rep.lastAck = true, time.Now()
+		s.repl.mu.Unlock()
+		rep.c.log.Notice("Synchronization with replica succeeded", "bytes", buf.Len())
+	}
+
+	for {
+		s.repl.mu.Lock()
+		data := rep.pending
+		rep.pending = nil
+		s.repl.mu.Unlock()
+		if len(data) == 0 {
+			select {
+			case <-rep.wake:
+				continue
+			case <-done:
+				return nil
+			}
+		}
+		conn.SetWriteDeadline(time.Now().Add(timeout))
+		w.Write(data)
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		s.stats.netOutputBytes.Add(int64(len(data)))
+	}
+}
+
+// waitCommand blocks until numreplicas replicas have acknowledged the
+// writes the client made, or for timeout milliseconds, and replies with
+// how many have. A timeout of 0 waits for as long as it takes. Replicas
+// acknowledge every second, and are asked to at once.
+func waitCommand(s *Server, c *client, args [][]byte) string {
+	if s.isReplica() {
+		return protocol.ErrorReply("ERR WAIT cannot be used with replica instances. Please also note that since Redis 4.0 if a replica is configured to be writable (which is not the default) writes to replicas are just local and are not propagated.")
+	}
+	numReplicas, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return notIntegerError
+	}
+	timeoutMs, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return notIntegerError
+	}
+	if timeoutMs < 0 {
+		return protocol.ErrorReply("ERR timeout is negative")
+	}
+	var expired <-chan time.Time
+	if timeoutMs > 0 {
+		timer := time.NewTimer(time.Duration(timeoutMs) * time.Millisecond)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	s.blockedClients.Add(1)
+	defer s.blockedClients.Add(-1)
+	r := &s.repl
+	getAck := protocol.AppendCommand(nil, [][]byte{[]byte("REPLCONF"), []byte("GETACK"), []byte("*")})
+	asked, timedOut := false, false
+	for {
+		r.mu.Lock()
+		n := s.ackedReplicas(c.writeOffset)
+		acked := r.acked
+		if n < numReplicas && !asked {
+			s.feedStream(getAck)
+			asked = true
+		}
+		r.mu.Unlock()
+		if n >= numReplicas || timedOut {
+			return protocol.Integer(int64(n))
+		}
+
+		select {
+		case <-acked:
+		case <-expired:
+			timedOut = true
+		case <-s.shutdownChan:
+			timedOut = true
+		}
+	}
+}
+
+// ackedReplicas counts the replicas that have acknowledged the stream up
+// to offset. The caller holds repl.mu.
+func (s *Server) ackedReplicas(offset int64) int {
+	n := 0
+	for rep := range s.repl.replicas {
+		if rep.online && rep.ackOffset >= offset {
+			n++
+		}
+	}
+	return n
+}
+
+// goodReplicas counts the replicas that acknowledged the stream in the
+// last maxLag seconds. The caller holds repl.mu.
+func (s *Server) goodReplicas(now time.Time, maxLag int64) int {
+	n := 0
+	for rep := range s.repl.replicas {
+		if rep.online && int64(now.Sub(rep.lastAck).Seconds()) <= maxLag {
+			n++
+		}
+	}
+	return n
+}
+
+// enoughGoodReplicas reports whether a primary may take writes: with
+// min-replicas-to-write and min-replicas-max-lag set, a primary cut off
+// from its replicas refuses them, rather than take writes they'll miss.
+func (s *Server) enoughGoodReplicas() bool {
+	minReplicas, maxLag := s.config.Int("min-replicas-to-write"), s.config.Int("min-replicas-max-lag")
+	if minReplicas == 0 || maxLag == 0 || s.isReplica() {
+		return true
+	}
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+	return int64(s.goodReplicas(time.Now(), maxLag)) >= minReplicas
+}
+
+// replicationCron pings the replicas every repl-ping-replica-period, which
+// tells them the primary is alive, and disconnects those that haven't
+// acknowledged the stream for repl-timeout. On a replica, it acknowledges
+// the stream to the primary. cron calls it every second.
+func (s *Server) replicationCron(now time.Time) {
+	timeout := time.Duration(s.config.Int("repl-timeout")) * time.Second
+	period := time.Duration(s.config.Int("repl-ping-replica-period")) * time.Second
+	r := &s.repl
+
+	if s.isReplica() {
+		s.sendAck()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.master == nil && len(r.replicas) > 0 && now.Sub(r.lastPing) >= period {
+		s.feedStream(protocol.AppendCommand(nil, [][]byte{[]byte("PING")}))
+		r.lastPing = now
+	}
+	for rep := range r.replicas {
+		if rep.online && now.Sub(rep.lastAck) > timeout {
+			rep.c.log.Warning("Disconnecting timedout replica")
+			rep.c.conn.Close()
+		}
+	}
+}
+
+// info describes a replica for INFO and ROLE. The caller holds
+// repl.mu.
+func (rep *replica) info(now time.Time) (ip, port, state string, lag int64) {
+	ip, _, _ = net.SplitHostPort(rep.c.addr)
+	state = "wait_bgsave"
+	if rep.online {
+		state = "online"
+	}
+	return ip, rep.port, state, int64(now.Sub(rep.lastAck).Seconds())
+}
+
+// roleCommand replies with the server's role: a primary's offset and its
+// replicas, or a replica's primary and the state of its link.
+func roleCommand(s *Server, c *client, args [][]byte) string {
+	r := &s.repl
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if link := r.master; link != nil {
+		port, _ := strconv.ParseInt(link.port, 10, 64)
+		return protocol.Array(
+			protocol.BulkString("slave"),
+			protocol.BulkString(link.host),
+			protocol.Integer(port),
+			protocol.BulkString(link.state),
+			protocol.Integer(r.offset),
+		)
+	}
+	now := time.Now()
+	var replicas []string
+	for _, rep := range s.replicaList() {
+		ip, port, _, _ := rep.info(now)
+		replicas = append(replicas, protocol.BulkStringArray([]string{ip, port, strconv.FormatInt(rep.ackOffset, 10)}))
+	}
+	return protocol.Array(protocol.BulkString("master"), protocol.Integer(r.offset), protocol.Array(replicas...))
+}
+
+// replicaList returns the replicas ordered by client ID. The caller holds
+// repl.mu.
+func (s *Server) replicaList() []*replica {
+	list := make([]*replica, 0, len(s.repl.replicas))
+	for rep := range s.repl.replicas {
+		list = append(list, rep)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].c.id < list[j].c.id })
+	return list
+}
+
+func writeReplicationInfo(s *Server, b *infoBuilder) {
+	r := &s.repl
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if link := r.master; link != nil {
+		b.field("role", "slave")
+		b.field("master_host", link.host)
+		b.field("master_port", link.port)
+		status, lastIO := "down", int64(-1)
+		if link.state == linkConnected {
+			status, lastIO = "up", int64(now.Sub(link.lastIO).Seconds())
+		}
+		b.field("master_link_status", status)
+		b.field("master_last_io_seconds_ago", lastIO)
+		b.field("master_sync_in_progress", boolInt(link.state == linkSync))
+		b.field("slave_read_repl_offset", r.offset)
+		b.field("slave_repl_offset", r.offset)
+		if link.state != linkConnected {
+			b.field("master_link_down_since_seconds", int64(now.Sub(link.downSince).Seconds()))
+		}
+		b.field("slave_priority", s.config.Int("replica-priority"))
+		b.field("slave_read_only", boolInt(s.config.Bool("replica-read-only")))
+	} else {
+		b.field("role", "master")
+	}
+	b.field("connected_slaves", len(r.replicas))
+	minReplicas, maxLag := s.config.Int("min-replicas-to-write"), s.config.Int("min-replicas-max-lag")
+	if r.master == nil && minReplicas > 0 && maxLag > 0 {
+		b.field("min_slaves_good_slaves", s.goodReplicas(now, maxLag))
+	}
+	for i, rep := range s.replicaList() {
+		ip, port, state, lag := rep.info(now)
+		b.field(fmt.Sprintf("slave%d", i), fmt.Sprintf("ip=%s,port=%s,state=%s,offset=%d,lag=%d", ip, port, state, rep.ackOffset, lag))
+	}
+	b.field("master_replid", r.replID)
+	b.field("master_replid2", r.replID2)
+	b.field("master_repl_offset", r.offset)
+	b.field("second_repl_offset", r.secondOffset)
+	b.field("repl_backlog_active", boolInt(r.backlog != nil))
+	b.field("repl_backlog_size", s.config.Int("repl-backlog-size"))
+	b.field("repl_backlog_first_byte_offset", r.offset-r.backlogLen+1)
+	b.field("repl_backlog_histlen", r.backlogLen)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -5,41 +5,107 @@ package server
 import (
 	"basic-go-redis/internal/protocol"
 	"basic-go-redis/internal/store"
+	"basic-go-redis/pkg/config"
 	"basic-go-redis/pkg/logger"
 	"bufio"
-	"fmt"
+	"errors"
+	"io"
 	"net"
-	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Server struct {
 	store        *store.InMemoryStore
+	config       *config.Registry
 	port         string
-	connections  map[net.Conn]bool
-	connLock     sync.Mutex
+	clients      map[int64]*client
+	connLock     sync.Mutex // Guards clients
 	shutdownChan chan struct{}
 	listener     net.Listener
 	wg           sync.WaitGroup // WaitGroup to wait for goroutines to finish
+
+	nextClientID atomic.Int64
+	pause        pauseState
+
+	// Whether the heap is over maxmemory, so commands that grow the
+	// dataset are refused
+	overMemory atomic.Bool
+	mem        memoryState
+
+	// Reported by INFO
+	blockedClients atomic.Int64 // Clients waiting in WAIT
+	stats          serverStats
+	startTime      time.Time
+	runID          string
+
+	// dirty counts the writes since the dataset was last saved
+	dirty atomic.Int64
+	rdb   rdbState
+	aof   aofState
+	repl  replState
+
+	// Set in cluster mode
+	cluster *clusterState
+
+	// Set while a replica loads its primary's snapshot
+	loading atomic.Bool
+
+	// Held by write commands, so the AOF and replicas get them in the
+	// order they ran
+	writeOrder sync.Mutex
 }
 
+// NewServer returns a server listening on port with the default configuration.
 func NewServer(port string) *Server {
-	return &Server{
+	cfg := config.New()
+	cfg.Set("port", port)
+	s := NewServerWithConfig(cfg)
+	s.port = port
+	return s
+}
+
+// NewServerWithConfig returns a server configured by cfg, which CONFIG SET
+// changes as the server runs.
+func NewServerWithConfig(cfg *config.Registry) *Server {
+	cfg.OnChange("loglevel", logger.SetLevel)
+	logger.SetLevel(cfg.Get("loglevel"))
+
+	s := &Server{
 		store:        store.NewInMemoryStore(),
-		port:         port,
-		connections:  make(map[net.Conn]bool),
+		config:       cfg,
+		port:         cfg.Get("port"),
+		clients:      make(map[int64]*client),
 		shutdownChan: make(chan struct{}),
+		startTime:    time.Now(),
+		runID:        newRunID(),
 	}
+	s.rdb.lastSave, s.rdb.lastOK = s.startTime, true
+	s.aof.lastRewriteOK = true
+	s.checkSnapshotPath(cfg)
+	s.initReplication()
+	s.initCluster()
+	return s
 }
 
 func (s *Server) Start() error {
+	if err := s.startCluster(); err != nil {
+		return err
+	}
 	var err error
 	s.listener, err = net.Listen("tcp", ":"+s.port)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Server listening on port %s\n", s.port)
+	logger.Notice("Server listening", "port", s.port)
+	go s.cron()
+	if err := s.startConfiguredReplication(); err != nil {
+		s.listener.Close()
+		return err
+	}
 
 	for {
 		conn, err := s.listener.Accept()
@@ -47,41 +113,90 @@ func (s *Server) Start() error {
 			// Check if we should stop accepting new connections
 			select {
 			case <-s.shutdownChan:
-				fmt.Printf("Server is shutting down")
+				logger.Notice("Server is shutting down")
 				return nil // Server is shutting down, exit the loop
 			default:
-				fmt.Printf("Error accepting connection: %v\n", err)
+				logger.Warning("Error accepting connection", "err", err)
 				continue
 			}
 		}
 
-		s.connLock.Lock()
-		s.connections[conn] = true
-		s.connLock.Unlock()
-
-		go s.handleConnection(conn)
+		s.stats.connectionsReceived.Add(1)
+		if s.clientCount() >= int(s.config.Int("maxclients")) {
+			logger.Verbose("Refusing connection, max number of clients reached", "addr", conn.RemoteAddr().String())
+			conn.Write([]byte(protocol.ErrorReply("ERR max number of clients reached")))
+			conn.Close()
+			s.stats.rejectedConnections.Add(1)
+			continue
+		}
+		go s.handleConnection(s.newClient(conn))
 	}
 }
 
-func (s *Server) handleConnection(conn net.Conn) {
+func (s *Server) handleConnection(c *client) {
 	s.wg.Add(1)       // Increment the WaitGroup counter
 	defer s.wg.Done() // Decrement the counter when the goroutine completes
 
-	defer conn.Close()
+	c.log.Verbose("Accepted connection")
+	defer func() {
+		c.conn.Close()
+		s.unlinkClient(c)
+		c.log.Verbose("Connection closed")
+	}()
 
-	reader := bufio.NewReader(conn)
+	reader := protocol.NewReader(countingReader{c.conn, &s.stats.netInputBytes})
+	writer := bufio.NewWriterSize(c.conn, 16*1024)
 	for {
-		command, args, err := protocol.Deserialize(reader)
+		request, err := reader.ReadCommand()
 		if err != nil {
-			// Log error and exit the goroutine
-			logger.ErrorLogger.Printf("Error deserializing command: %v\n", err)
+			// A client going away is routine; anything else is a bad request
+			// or a broken connection
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				c.log.Debug("Client closed the connection")
+			} else {
+				c.log.Warning("Error reading command", "err", err)
+			}
 			return
 		}
+		if len(request) == 0 {
+			continue // Empty arrays are ignored, as Redis does
+		}
+
+		c.mu.Lock()
+		c.lastInteraction = time.Now()
+		c.queryBuffer = reader.Buffered()
+		c.mu.Unlock()
+
+		// CLIENT REPLY SKIP drops the reply to the command after it
+		skip := c.skipReply
+		c.skipReply = false
+		response := s.executeCommand(c, request)
+		if len(response) > 0 && response[0] == '-' {
+			s.stats.errorReplies.Add(1)
+		}
+		if !c.replyOff && !skip {
+			s.stats.netOutputBytes.Add(int64(len(response)))
+			writer.WriteString(response)
+		}
 
-		response := s.executeCommand(command, args)
-		if _, err := conn.Write([]byte(response)); err != nil {
-			// Log error and exit the goroutine
-			logger.ErrorLogger.Printf("Error in sending response: %v\n", err)
+		// Replies to a pipeline are sent together once the last request
+		// already received has been answered
+		if reader.Buffered() == 0 || c.closeAfterReply {
+			if err := writer.Flush(); err != nil {
+				c.log.Warning("Error sending reply", "err", err)
+				return
+			}
+		}
+		c.mu.Lock()
+		c.outputBuffer = writer.Buffered()
+		c.mu.Unlock()
+		if c.closeAfterReply {
+			return
+		}
+		if c.replica != nil {
+			// PSYNC made the connection a replica's, which gets the stream
+			writer.Flush()
+			s.serveReplica(c, reader, writer)
 			return
 		}
 	}
@@ -97,113 +212,87 @@ func (s *Server) Close() error {
 		}
 	}
 
+	s.closeCluster()
 	s.connLock.Lock()
-	for conn := range s.connections {
-		conn.Close() // Ignore error
-		delete(s.connections, conn)
+	for id, c := range s.clients {
+		c.conn.Close() // Ignore error
+		delete(s.clients, id)
 	}
 	s.connLock.Unlock()
 
 	// Wait for all handleConnection goroutines to finish
 	s.wg.Wait()
 
-	return nil
+	return s.closeAOF()
 }
 
-func (s *Server) executeCommand(command string, args []string) string {
-	switch command {
-	case "SET":
-		if len(args) < 2 {
-			return "-ERR wrong number of arguments for 'SET' command\r\n"
-		}
-
-		key := args[0]
-		value := args[1]
-		flags := args[2:] // All remaining arguments are considered as flags or TTL
-
-		// Call the Set function with flags
-		response := s.store.Set(key, value, flags...)
-		if response == "+0\r\n" {
-			return "-ERR condition not met for 'SET' command\r\n"
-		}
-		return response
-
-	case "GET":
-		if len(args) != 1 {
-			return "-ERR wrong number of arguments for 'GET' command\r\n"
-		}
-		return s.store.Get(args[0])
-
-	case "DEL":
-		if len(args) < 1 {
-			return "-ERR wrong number of arguments for 'DEL' command\r\n"
-		}
-		deleted := s.store.Del(args)
-		return fmt.Sprintf(":%d\r\n\r\n", deleted)
-
-	case "KEYS":
-		if len(args) != 1 {
-			return "-ERR wrong number of arguments for 'KEYS' command\r\n"
-		}
-		keys := s.store.Keys(args[0])
-		response := fmt.Sprintf("*%d\r\n", len(keys))
-		for _, key := range keys {
-			response += fmt.Sprintf("$%d\r\n%s\r\n", len(key), key)
-		}
-		response += "\r\n"
-		return response
-
-	case "EXPIRE":
-		if len(args) != 2 {
-			return "-ERR wrong number of arguments for 'EXPIRE' command\r\n"
-		}
-		seconds, err := strconv.Atoi(args[1])
-		if err != nil {
-			return "-ERR invalid integer\r\n"
-		}
-		result := s.store.Expire(args[0], seconds)
-		return fmt.Sprintf(":%d\r\n\r\n", result)
-
-	case "TTL":
-		if len(args) != 1 {
-			return "-ERR wrong number of arguments for 'TTL' command\r\n"
+// executeCommand looks the request up in the command table and runs it for
+// c, waiting first while CLIENT PAUSE holds the command back. The
+// arguments are views into the connection's read buffer, so anything kept
+// beyond the call must be copied.
+func (s *Server) executeCommand(c *client, args [][]byte) string {
+	// ASKING lasts for the command after it only
+	asking := c.asking
+	c.asking = false
+	cmd := lookupCommand(args[0])
+	if cmd == nil {
+		return unknownCommandError(args)
+	}
+	if len(cmd.subcommands) > 0 && len(args) > 1 {
+		sub := cmd.subcommand(args[1])
+		if sub == nil {
+			return unknownSubcommandError(cmd, args[1])
 		}
-		ttl := s.store.TTL(args[0])
-		return fmt.Sprintf(":%d\r\n\r\n", ttl)
-
-	case "ZADD":
-		if len(args) < 3 {
-			return "-ERR wrong number of arguments\r\n"
+		cmd = sub
+	}
+	if !cmd.checkArity(len(args)) {
+		return arityError(cmd.fullName())
+	}
+	c.mu.Lock()
+	c.lastCmd = cmd.fullName()
+	c.mu.Unlock()
+	if s.loading.Load() && cmd.flags&flagLoading == 0 {
+		return loadingError
+	}
+	if cmd.flags&flagStale == 0 && s.staleData() {
+		return masterDownError
+	}
+	if s.cluster != nil && !c.master {
+		if reply := s.clusterRedirect(cmd, args, asking); reply != "" {
+			return reply
 		}
-		score, err := strconv.ParseFloat(args[1], 64)
-		if err != nil {
-			return "-ERR invalid score\r\n"
+	}
+	s.waitWhilePaused(cmd)
+	// The primary's writes are run whatever the replica's state, and the
+	// link holds writeOrder itself, to pass them on in the same order
+	if cmd.flags&flagDenyOOM != 0 && s.overMemory.Load() && !c.master {
+		return oomError
+	}
+	write := cmd.flags&flagWrite != 0
+	if write && !c.master {
+		if s.isReplica() && s.config.Bool("replica-read-only") {
+			return readonlyError
 		}
-		added := s.store.ZAdd(args[0], score, args[2])
-		return fmt.Sprintf(":%d\r\n\r\n", added)
-
-	case "ZRANGE":
-		if len(args) != 3 {
-			return "-ERR wrong number of arguments\r\n"
+		if !s.enoughGoodReplicas() {
+			return noReplicasError
 		}
-		start, err := strconv.Atoi(args[1])
-		if err != nil {
-			return "-ERR invalid start argument\r\n"
+		if err := s.aofError(); err != nil {
+			return protocol.ErrorReply("MISCONF Errors writing to the AOF file: " + err.Error())
 		}
-		stop, err := strconv.Atoi(args[2])
-		if err != nil {
+		s.writeOrder.Lock()
+		defer s.writeOrder.Unlock()
+	}
 
-			return "-ERR invalid stop argument" + "\r\n"
+	c.rewritten = nil
+	reply := cmd.handler(s, c, args)
+	s.stats.commandsProcessed.Add(1)
+	if write && reply != protocol.NullBulkString && !strings.HasPrefix(reply, "-") {
+		if c.rewritten != nil {
+			args = c.rewritten
 		}
-		members := s.store.ZRange(args[0], start, stop)
-		response := fmt.Sprintf("*%d\r\n", len(members))
-		for _, key := range members {
-			response += fmt.Sprintf("$%d\r\n%s\r\n", len(key), key)
+		if len(args) > 0 {
+			c.writeOffset = s.propagate(args)
 		}
-		response += "\r\n"
-		return response
-
-	default:
-		return "-ERR unknown command\r\n"
 	}
+	return reply
 }
@@ -151,3 +151,92 @@ func TestServer_ZADD_ZRANGE(t *testing.T) {
 		t.Errorf("ZRANGE command failed: %v, response: %s", err, zrangeResponse)
 	}
 }
+
+func TestServer_CLIENT(t *testing.T) {
+	port := "12346"
+	server := startTestServer(port)
+	defer server.Close()
+
+	dial := func() (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%s", port))
+		if err != nil {
+			t.Fatalf("Failed to connect to server on port %s: %v", port, err)
+		}
+		return conn, bufio.NewReader(conn)
+	}
+	send := func(conn net.Conn, reader *bufio.Reader, commands ...string) string {
+		for _, command := range commands {
+			conn.Write([]byte(protocol.Serialize(strings.Fields(command)[0], strings.Fields(command)[1:])))
+		}
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		response, err := protocol.ReadFullResponse(reader)
+		if err != nil {
+			t.Fatalf("%q: %v", commands, err)
+		}
+		return response
+	}
+
+	admin, adminReader := dial()
+	defer admin.Close()
+	victim, victimReader := dial()
+	defer victim.Close()
+	send(victim, victimReader, "CLIENT SETNAME victim")
+
+	list := send(admin, adminReader, "CLIENT LIST")
+	if strings.Count(list, "id=") != 2 || !strings.Contains(list, " name=victim ") || !strings.Contains(list, " cmd=client|list ") {
+		t.Errorf("CLIENT LIST = %q", list)
+	}
+
+	// Replies are dropped until CLIENT REPLY ON, whose reply comes first
+	if got := send(victim, victimReader, "CLIENT REPLY OFF", "PING", "CLIENT REPLY SKIP", "PING", "CLIENT REPLY ON"); got != "+OK\r\n" {
+		t.Errorf("after CLIENT REPLY OFF, got %q, want +OK", got)
+	}
+	if got := send(victim, victimReader, "CLIENT REPLY SKIP", "PING", "ECHO back"); got != "$4\r\nback\r\n" {
+		t.Errorf("after CLIENT REPLY SKIP, got %q, want the ECHO", got)
+	}
+
+	// Writes wait for the pause to end, while reads carry on
+	send(admin, adminReader, "CLIENT PAUSE 300 WRITE")
+	start := time.Now()
+	if got := send(victim, victimReader, "GET key"); got != "$-1\r\n" || time.Since(start) > 200*time.Millisecond {
+		t.Errorf("GET during a write pause = %q after %v", got, time.Since(start))
+	}
+	if got := send(victim, victimReader, "SET key value"); got != "+OK\r\n" || time.Since(start) < 250*time.Millisecond {
+		t.Errorf("SET during a write pause = %q after %v", got, time.Since(start))
+	}
+
+	if got := send(admin, adminReader, "CLIENT KILL TYPE normal"); got != ":1\r\n" {
+		t.Errorf("CLIENT KILL TYPE normal = %q, want :1", got)
+	}
+	victim.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := victimReader.ReadByte(); err == nil {
+		t.Error("the killed client's connection is still open")
+	}
+}
+
+func TestServer_MaxClients(t *testing.T) {
+	port := "12347"
+	server := startTestServer(port)
+	defer server.Close()
+	server.config.SetRuntime("maxclients", "1")
+
+	first, err := net.Dial("tcp", fmt.Sprintf("localhost:%s", port))
+	if err != nil {
+		t.Fatalf("Failed to connect to server on port %s: %v", port, err)
+	}
+	defer first.Close()
+	if response, err := sendCommand(first, "*1\r\n$4\r\nPING\r\n"); err != nil || response != "+PONG\r\n" {
+		t.Fatalf("PING = %q, %v", response, err)
+	}
+
+	second, err := net.Dial("tcp", fmt.Sprintf("localhost:%s", port))
+	if err != nil {
+		t.Fatalf("Failed to connect to server on port %s: %v", port, err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	response, err := protocol.ReadFullResponse(bufio.NewReader(second))
+	if err != nil || response != "-ERR max number of clients reached\r\n" {
+		t.Errorf("connecting past maxclients = %q, %v", response, err)
+	}
+}
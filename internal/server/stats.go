@@ -0,0 +1,166 @@
+// File: internal/server/stats.go
+
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hz is how many times a second the server runs its background tasks.
+const hz = 10
+
+// serverStats are the counters INFO reports, reset by CONFIG RESETSTAT.
+type serverStats struct {
+	commandsProcessed   atomic.Int64
+	connectionsReceived atomic.Int64
+	rejectedConnections atomic.Int64
+	netInputBytes       atomic.Int64
+	netOutputBytes      atomic.Int64
+	errorReplies        atomic.Int64
+	peakMemory          atomic.Uint64
+	syncFull            atomic.Int64 // Replicas sent a snapshot
+	syncPartialOK       atomic.Int64 // Replicas that continued from the backlog
+	syncPartialErr      atomic.Int64 // Replicas that asked to continue and couldn't
+
+	opsPerSec  instantaneousMetric
+	inputRate  instantaneousMetric
+	outputRate instantaneousMetric
+}
+
+func (st *serverStats) reset() {
+	st.commandsProcessed.Store(0)
+	st.connectionsReceived.Store(0)
+	st.rejectedConnections.Store(0)
+	st.netInputBytes.Store(0)
+	st.netOutputBytes.Store(0)
+	st.errorReplies.Store(0)
+	st.peakMemory.Store(0)
+	st.syncFull.Store(0)
+	st.syncPartialOK.Store(0)
+	st.syncPartialErr.Store(0)
+	st.opsPerSec.reset()
+	st.inputRate.reset()
+	st.outputRate.reset()
+}
+
+// metricSamples is how many samples an instantaneous metric averages.
+const metricSamples = 16
+
+// instantaneousMetric turns a counter sampled over time into a rate per
+// second, averaged over the last few samples as Redis does.
+type instantaneousMetric struct {
+	mu        sync.Mutex
+	lastTime  time.Time
+	lastValue int64
+	samples   [metricSamples]float64
+	next      int
+}
+
+// track samples the counter's current value.
+func (m *instantaneousMetric) track(value int64, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.lastTime.IsZero() {
+		if elapsed := now.Sub(m.lastTime).Seconds(); elapsed > 0 {
+			m.samples[m.next] = float64(value-m.lastValue) / elapsed
+			m.next = (m.next + 1) % metricSamples
+		}
+	}
+	m.lastTime, m.lastValue = now, value
+}
+
+// rate returns the average rate per second over the samples.
+func (m *instantaneousMetric) rate() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var total float64
+	for _, sample := range m.samples {
+		total += sample
+	}
+	return total / metricSamples
+}
+
+func (m *instantaneousMetric) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastTime, m.lastValue = time.Time{}, 0
+	m.samples = [metricSamples]float64{}
+	m.next = 0
+}
+
+// countingReader counts the bytes read from a connection.
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// cron runs the server's background tasks hz times a second until the
+// server shuts down: deleting expired keys, enforcing maxmemory, closing
+// idle clients, saving as the save rules ask, syncing and rewriting the
+// AOF, keeping replication links alive and sampling the rates INFO
+// reports.
+func (s *Server) cron() {
+	ticker := time.NewTicker(time.Second / hz)
+	defer ticker.Stop()
+	for tick := 0; ; tick++ {
+		select {
+		case <-s.shutdownChan:
+			return
+		case now := <-ticker.C:
+			// Active expiry gets a quarter of each tick at most, and keys
+			// don't expire while clients are paused
+			if !s.paused() {
+				s.store.ActiveExpireCycle(time.Second / hz / 4)
+			}
+
+			s.stats.opsPerSec.track(s.stats.commandsProcessed.Load(), now)
+			s.stats.inputRate.track(s.stats.netInputBytes.Load(), now)
+			s.stats.outputRate.track(s.stats.netOutputBytes.Load(), now)
+			s.enforceMaxMemory()
+			if s.cluster != nil {
+				s.clusterCron(now)
+			}
+			if tick%hz == 0 {
+				s.usedMemory()
+				s.closeIdleClients()
+				s.saveOnRules(now)
+				s.aofCron()
+				s.rewriteAOFOnGrowth()
+				s.replicationCron(now)
+			}
+		}
+	}
+}
+
+// usedMemory returns the bytes allocated on the heap and the bytes
+// obtained from the operating system, updating the peak.
+func (s *Server) usedMemory() (used, sys uint64) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	for {
+		peak := s.stats.peakMemory.Load()
+		if m.HeapAlloc <= peak || s.stats.peakMemory.CompareAndSwap(peak, m.HeapAlloc) {
+			break
+		}
+	}
+	return m.HeapAlloc, m.Sys
+}
+
+// newRunID returns 40 random hex characters, as Redis's run ids are.
+func newRunID() string {
+	b := make([]byte, 20)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
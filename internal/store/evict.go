@@ -0,0 +1,60 @@
+// File: internal/store/evict.go
+
+package store
+
+// Evict deletes keys chosen by a maxmemory policy until the bytes they take,
+// as MemoryUsage estimates them, reach target, or no key is left for the
+// policy. allkeys-random picks any key, volatile-random any key with a TTL,
+// and volatile-ttl the key closest to expiring among samples keys with a
+// TTL. It returns the bytes freed and the keys evicted.
+func (store *InMemoryStore) Evict(policy string, samples, target int) (int, []string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	freed := 0
+	var keys []string
+	for freed < target {
+		key, ok := store.evictionCandidate(policy, samples)
+		if !ok {
+			break
+		}
+		size, _ := store.sizeOf(key)
+		store.removeKey(key)
+		store.stats.evicted.Add(1)
+		freed += size
+		keys = append(keys, key)
+	}
+	return freed, keys
+}
+
+// evictionCandidate picks the next key to evict. Map iteration starts at a
+// random key, which makes the first keys visited a random sample. The
+// caller holds the write lock.
+func (store *InMemoryStore) evictionCandidate(policy string, samples int) (string, bool) {
+	switch policy {
+	case "allkeys-random":
+		for key := range store.data {
+			return key, true
+		}
+		for key := range store.sortedSet {
+			return key, true
+		}
+	case "volatile-random":
+		for key := range store.expiration {
+			return key, true
+		}
+	case "volatile-ttl":
+		best, found := "", false
+		seen := 0
+		for key, deadline := range store.expiration {
+			if !found || deadline.Before(store.expiration[best]) {
+				best, found = key, true
+			}
+			if seen++; seen == samples {
+				break
+			}
+		}
+		return best, found
+	}
+	return "", false
+}
@@ -0,0 +1,148 @@
+// File: internal/store/expire.go
+
+package store
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats are the store's counters since it was created or they were reset.
+type Stats struct {
+	KeyspaceHits   int64 // Reads that found their key
+	KeyspaceMisses int64 // Reads that didn't
+	ExpiredKeys    int64 // Keys deleted because their TTL ran out
+	EvictedKeys    int64 // Keys deleted to stay under maxmemory
+}
+
+type storeStats struct {
+	hits, misses, expired, evicted atomic.Int64
+}
+
+// Stats returns the store's counters.
+func (store *InMemoryStore) Stats() Stats {
+	return Stats{
+		KeyspaceHits:   store.stats.hits.Load(),
+		KeyspaceMisses: store.stats.misses.Load(),
+		ExpiredKeys:    store.stats.expired.Load(),
+		EvictedKeys:    store.stats.evicted.Load(),
+	}
+}
+
+// ResetStats zeroes the store's counters.
+func (store *InMemoryStore) ResetStats() {
+	store.stats.hits.Store(0)
+	store.stats.misses.Store(0)
+	store.stats.expired.Store(0)
+	store.stats.evicted.Store(0)
+}
+
+// countLookup records a read of a key for the hit and miss counters.
+func (store *InMemoryStore) countLookup(found bool) {
+	if found {
+		store.stats.hits.Add(1)
+	} else {
+		store.stats.misses.Add(1)
+	}
+}
+
+// isExpired reports whether key has a TTL that has run out. The caller
+// holds the lock.
+func (store *InMemoryStore) isExpired(key string, now time.Time) bool {
+	deadline, ok := store.expiration[key]
+	return ok && !now.Before(deadline)
+}
+
+// removeKey deletes key whatever its type. The caller holds the write lock.
+func (store *InMemoryStore) removeKey(key string) {
+	delete(store.data, key)
+	delete(store.sortedSet, key)
+	delete(store.expiration, key)
+}
+
+// expireLocked deletes key if its TTL has run out and reports whether it
+// did. The caller holds the write lock.
+func (store *InMemoryStore) expireLocked(key string, now time.Time) bool {
+	if !store.isExpired(key, now) {
+		return false
+	}
+	store.removeKey(key)
+	store.stats.expired.Add(1)
+	return true
+}
+
+// expireIfNeeded deletes key if its TTL has run out, so reads find expired
+// keys gone. Only keys with a TTL need the write lock.
+func (store *InMemoryStore) expireIfNeeded(key string) {
+	now := time.Now()
+	store.mutex.RLock()
+	expired := store.isExpired(key, now)
+	store.mutex.RUnlock()
+	if expired {
+		store.mutex.Lock()
+		store.expireLocked(key, now)
+		store.mutex.Unlock()
+	}
+}
+
+// Active expiry samples this many keys with a TTL at a time, and samples
+// again while more than a quarter of a sample had expired.
+const (
+	expireSampleSize     = 20
+	expireRepeatFraction = 4
+)
+
+// ActiveExpireCycle deletes expired keys that nobody reads, as Redis does
+// in its background cycle: it samples keys with a TTL and deletes those
+// that have run out, repeating while many of them had, for at most budget.
+// It returns the number of keys deleted.
+func (store *InMemoryStore) ActiveExpireCycle(budget time.Duration) int {
+	start := time.Now()
+	deleted := 0
+	for {
+		store.mutex.Lock()
+		now := time.Now()
+		sampled, expired := 0, 0
+		// Map iteration starts at a random key, which makes this a sample
+		for key, deadline := range store.expiration {
+			if sampled == expireSampleSize {
+				break
+			}
+			sampled++
+			if !now.Before(deadline) {
+				store.removeKey(key)
+				expired++
+			}
+		}
+		store.mutex.Unlock()
+
+		store.stats.expired.Add(int64(expired))
+		deleted += expired
+		if expired*expireRepeatFraction <= sampled || time.Since(start) > budget {
+			return deleted
+		}
+	}
+}
+
+// KeyspaceInfo returns the number of keys, how many of them have a TTL,
+// and the average TTL left on those.
+func (store *InMemoryStore) KeyspaceInfo() (keys, expires int, avgTTL time.Duration) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	keys = store.dbSize()
+	expires = len(store.expiration)
+	now := time.Now()
+	var total time.Duration
+	live := 0
+	for _, deadline := range store.expiration {
+		if left := deadline.Sub(now); left > 0 {
+			total += left
+			live++
+		}
+	}
+	if live > 0 {
+		avgTTL = total / time.Duration(live)
+	}
+	return keys, expires, avgTTL
+}
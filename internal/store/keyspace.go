@@ -0,0 +1,181 @@
+// File: internal/store/keyspace.go
+
+package store
+
+import (
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+// Type returns the type of the value stored at key: "string", "zset", or
+// "none" when the key doesn't exist.
+func (store *InMemoryStore) Type(key string) string {
+	store.expireIfNeeded(key)
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return store.typeOf(key)
+}
+
+func (store *InMemoryStore) typeOf(key string) string {
+	if _, ok := store.data[key]; ok {
+		return "string"
+	}
+	if _, ok := store.sortedSet[key]; ok {
+		return "zset"
+	}
+	return "none"
+}
+
+// DBSize returns the number of keys.
+func (store *InMemoryStore) DBSize() int {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return store.dbSize()
+}
+
+// dbSize counts the keys. Like Redis it includes expired keys that haven't
+// been deleted yet. The caller holds the lock.
+func (store *InMemoryStore) dbSize() int {
+	count := len(store.data)
+	for key := range store.sortedSet {
+		if _, ok := store.data[key]; !ok {
+			count++
+		}
+	}
+	return count
+}
+
+// StrLen returns the length of the string stored at key, 0 if it doesn't exist.
+func (store *InMemoryStore) StrLen(key string) int {
+	store.expireIfNeeded(key)
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	value, ok := store.data[key]
+	store.countLookup(ok)
+	return len(value)
+}
+
+// ZCard returns the number of members of the sorted set stored at key.
+func (store *InMemoryStore) ZCard(key string) int {
+	store.expireIfNeeded(key)
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	members, ok := store.sortedSet[key]
+	store.countLookup(ok)
+	return len(members)
+}
+
+// Approximate bytes taken by the bookkeeping around keys and values: a map
+// entry with its string header, a string header, and a float64 score.
+const (
+	entryOverhead  = 48
+	stringOverhead = 16
+	scoreSize      = 8
+	expireOverhead = 40
+)
+
+// MemoryUsage estimates the bytes key and its value take, including the
+// map entries that hold them. It reports false if the key doesn't exist.
+func (store *InMemoryStore) MemoryUsage(key string) (int, bool) {
+	store.expireIfNeeded(key)
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return store.sizeOf(key)
+}
+
+// sizeOf is MemoryUsage for a caller holding the lock.
+func (store *InMemoryStore) sizeOf(key string) (int, bool) {
+	size := entryOverhead + len(key)
+	switch store.typeOf(key) {
+	case "string":
+		size += stringOverhead + len(store.data[key])
+	case "zset":
+		size += entryOverhead // The member map
+		for member := range store.sortedSet[key] {
+			size += entryOverhead + len(member) + scoreSize
+		}
+	default:
+		return 0, false
+	}
+	if _, ok := store.expiration[key]; ok {
+		size += expireOverhead + len(key)
+	}
+	return size, true
+}
+
+// keyHash orders keys for Scan.
+func keyHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// scanEntry is a key in the order Scan visits keys.
+type scanEntry struct {
+	hash uint64
+	key  string
+}
+
+// Scan returns about count keys, starting at cursor, and the cursor to
+// continue from, which is 0 once every key has been returned. Keys are
+// visited in the order of their hashes, which doesn't depend on the other
+// keys, so a key that exists for the whole iteration is returned exactly
+// once however the keyspace changes meanwhile. Keys matching pattern and,
+// unless typ is empty, of that type are kept from those visited.
+//
+// The keys are sorted by hash when an iteration starts, at cursor 0, and
+// later calls continue along that index. Keys created since may be
+// missed, which SCAN allows, and keys deleted since are skipped.
+func (store *InMemoryStore) Scan(cursor uint64, pattern string, count int, typ string) (uint64, []string) {
+	store.scanMutex.Lock()
+	defer store.scanMutex.Unlock()
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if cursor == 0 || store.scanIndex == nil {
+		store.buildScanIndex()
+	}
+	index := store.scanIndex
+	start := sort.Search(len(index), func(i int) bool { return index[i].hash >= cursor })
+
+	// Keys sharing a hash are returned together, as the cursor can't split them
+	end := min(start+count, len(index))
+	for end > start && end < len(index) && index[end].hash == index[end-1].hash {
+		end++
+	}
+	var next uint64
+	if end < len(index) {
+		next = index[end].hash
+	}
+
+	match := compilePattern(pattern)
+	now := time.Now()
+	keys := make([]string, 0, end-start)
+	for _, entry := range index[start:end] {
+		t := store.typeOf(entry.key)
+		if t == "none" || store.isExpired(entry.key, now) || (typ != "" && t != typ) {
+			continue
+		}
+		if pattern == "*" || match(entry.key) {
+			keys = append(keys, entry.key)
+		}
+	}
+	return next, keys
+}
+
+// buildScanIndex sorts every key by hash for Scan. The caller holds the
+// read lock and scanMutex.
+func (store *InMemoryStore) buildScanIndex() {
+	index := store.scanIndex[:0]
+	for key := range store.data {
+		index = append(index, scanEntry{keyHash(key), key})
+	}
+	for key := range store.sortedSet {
+		if _, ok := store.data[key]; !ok {
+			index = append(index, scanEntry{keyHash(key), key})
+		}
+	}
+	sort.Slice(index, func(i, j int) bool { return index[i].hash < index[j].hash })
+	store.scanIndex = index
+}
@@ -0,0 +1,162 @@
+// File: internal/store/snapshot.go
+
+package store
+
+import (
+	"maps"
+	"time"
+)
+
+// Entry is a key and its value, as snapshots save and load them.
+type Entry struct {
+	Key      string
+	ExpireAt time.Time // Zero without a TTL
+
+	String string             // Value of a string
+	ZSet   map[string]float64 // Members of a sorted set, nil for a string
+}
+
+// Snapshot is the store as it was when Snapshot was called, which writes
+// since then don't change. Taking one copies the maps of keys, which hold
+// the values by reference, so the lock is held briefly. A sorted set is
+// copied by the first write to it while snapshots are open.
+type Snapshot struct {
+	store      *InMemoryStore
+	taken      time.Time
+	data       map[string]string
+	sortedSet  map[string]map[string]float64
+	expiration map[string]time.Time
+}
+
+// Snapshot returns a snapshot of the store, to be released once read.
+func (store *InMemoryStore) Snapshot() *Snapshot {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.snapshots++
+	// Every sorted set is now shared with this snapshot, including those
+	// copied for an earlier one
+	store.ownedZSets = make(map[string]bool)
+	return &Snapshot{
+		store:      store,
+		taken:      time.Now(),
+		data:       maps.Clone(store.data),
+		sortedSet:  maps.Clone(store.sortedSet),
+		expiration: maps.Clone(store.expiration),
+	}
+}
+
+// Release ends the snapshot.
+func (snap *Snapshot) Release() {
+	snap.store.mutex.Lock()
+	defer snap.store.mutex.Unlock()
+	snap.store.snapshots--
+	if snap.store.snapshots == 0 {
+		snap.store.ownedZSets = nil
+	}
+}
+
+// Taken returns when the snapshot was taken.
+func (snap *Snapshot) Taken() time.Time { return snap.taken }
+
+// Len returns the number of keys, and how many of them have a TTL.
+func (snap *Snapshot) Len() (keys, expires int) {
+	keys = len(snap.data)
+	for key := range snap.sortedSet {
+		if _, ok := snap.data[key]; !ok {
+			keys++
+		}
+	}
+	return keys, len(snap.expiration)
+}
+
+// Each calls fn for every key that hadn't expired when the snapshot was
+// taken, stopping at the first error. fn must not change the sorted sets.
+func (snap *Snapshot) Each(fn func(e Entry) error) error {
+	for key, value := range snap.data {
+		if err := snap.visit(Entry{Key: key, String: value}, fn); err != nil {
+			return err
+		}
+	}
+	for key, members := range snap.sortedSet {
+		if _, ok := snap.data[key]; ok {
+			continue
+		}
+		if err := snap.visit(Entry{Key: key, ZSet: members}, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (snap *Snapshot) visit(e Entry, fn func(e Entry) error) error {
+	if deadline, ok := snap.expiration[e.Key]; ok {
+		if !snap.taken.Before(deadline) {
+			return nil
+		}
+		e.ExpireAt = deadline
+	}
+	return fn(e)
+}
+
+// ownZSet makes the sorted set at key safe to change, copying it if an
+// open snapshot may share it. The caller holds the write lock.
+func (store *InMemoryStore) ownZSet(key string) map[string]float64 {
+	members, ok := store.sortedSet[key]
+	if !ok {
+		members = make(map[string]float64)
+		store.sortedSet[key] = members
+	} else if store.snapshots > 0 && !store.ownedZSets[key] {
+		members = maps.Clone(members)
+		store.sortedSet[key] = members
+	}
+	if store.snapshots > 0 {
+		store.ownedZSets[key] = true
+	}
+	return members
+}
+
+// Put sets a key from a snapshot, replacing any value it had. A key whose
+// TTL has already run out is skipped, and Put reports false. The store
+// keeps e.ZSet.
+func (store *InMemoryStore) Put(e Entry) bool {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if !e.ExpireAt.IsZero() && !time.Now().Before(e.ExpireAt) {
+		return false
+	}
+	store.removeKey(e.Key)
+	if e.ZSet != nil {
+		store.sortedSet[e.Key] = e.ZSet
+		if store.snapshots > 0 {
+			store.ownedZSets[e.Key] = true
+		}
+	} else {
+		store.data[e.Key] = e.String
+	}
+	if !e.ExpireAt.IsZero() {
+		store.expiration[e.Key] = e.ExpireAt
+	}
+	return true
+}
+
+// Lookup returns the key's value, with a copy of a sorted set's members,
+// or false if it doesn't exist.
+func (store *InMemoryStore) Lookup(key string) (Entry, bool) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if store.isExpired(key, time.Now()) {
+		return Entry{}, false
+	}
+	e := Entry{Key: key, ExpireAt: store.expiration[key]}
+	if value, ok := store.data[key]; ok {
+		e.String = value
+	} else if members, ok := store.sortedSet[key]; ok {
+		e.ZSet = maps.Clone(members)
+	} else {
+		return Entry{}, false
+	}
+	return e, true
+}
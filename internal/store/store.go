@@ -17,6 +17,17 @@ type InMemoryStore struct {
 	sortedSet  map[string]map[string]float64
 	expiration map[string]time.Time
 	mutex      sync.RWMutex
+
+	// scanIndex holds the keys sorted by hash for SCAN, guarded by scanMutex
+	scanIndex []scanEntry
+	scanMutex sync.Mutex
+
+	stats storeStats
+
+	// Open snapshots, and the sorted sets written since the last one was
+	// taken, which no snapshot shares
+	snapshots  int
+	ownedZSets map[string]bool
 }
 
 func NewInMemoryStore() *InMemoryStore {
@@ -29,6 +40,18 @@ func NewInMemoryStore() *InMemoryStore {
 }
 
 func matchPattern(key, pattern string) bool {
+	return compilePattern(pattern)(key)
+}
+
+// Matcher returns a function reporting whether a key matches a glob
+// pattern, as KEYS and SCAN match them.
+func Matcher(pattern string) func(key string) bool {
+	return compilePattern(pattern)
+}
+
+// compilePattern turns a Redis glob pattern into a matcher, so a pattern
+// applied to many keys is only converted once.
+func compilePattern(pattern string) func(key string) bool {
 	// Convert the Redis pattern to a regular expression pattern
 	var regexPatternBuilder strings.Builder
 	for i := 0; i < len(pattern); i++ {
@@ -46,13 +69,12 @@ func matchPattern(key, pattern string) bool {
 		}
 	}
 
-	regexPattern, err := regexp.Compile("^" + regexPatternBuilder.String() + "$")
+	regexPattern, err := regexp.Compile("(?s)^" + regexPatternBuilder.String() + "$")
 	if err != nil {
 		// In case of regex compilation error, fallback to simple comparison
-		return key == pattern
+		return func(key string) bool { return key == pattern }
 	}
-
-	return regexPattern.MatchString(key)
+	return regexPattern.MatchString
 }
 
 // Set a key to hold the string value
@@ -63,7 +85,9 @@ func (store *InMemoryStore) Set(key, value string, flags ...string) string {
 	// Initialize variables for flags
 	setIfExists := false
 	setIfNotExists := false
-	var expiration int
+	keepTTL := false
+	var deadline time.Time
+	now := time.Now()
 
 	// Parse flags
 	for _, flag := range flags {
@@ -72,13 +96,25 @@ func (store *InMemoryStore) Set(key, value string, flags ...string) string {
 			setIfNotExists = true
 		case flag == "XX":
 			setIfExists = true
+		case flag == "KEEPTTL":
+			keepTTL = true
 		case strings.HasPrefix(flag, "EX"):
 			if ex, err := strconv.Atoi(flag[2:]); err == nil {
-				expiration = ex
+				deadline = now.Add(time.Duration(ex) * time.Second)
+			}
+		case strings.HasPrefix(flag, "PXAT"):
+			if at, err := strconv.ParseInt(flag[4:], 10, 64); err == nil {
+				deadline = time.UnixMilli(at)
+			}
+		case strings.HasPrefix(flag, "PX"):
+			if px, err := strconv.Atoi(flag[2:]); err == nil {
+				deadline = now.Add(time.Duration(px) * time.Millisecond)
 			}
 		}
 	}
 
+	store.expireLocked(key, now)
+
 	// Check conditions for NX and XX
 	if setIfNotExists && store.exists(key) {
 		return "+0\r\n" // Key exists, do not set
@@ -90,10 +126,11 @@ func (store *InMemoryStore) Set(key, value string, flags ...string) string {
 	// Set the key
 	store.data[key] = value
 
-	// Set expiration if needed
-	if expiration > 0 {
-		expirationTime := time.Now().Add(time.Duration(expiration) * time.Second)
-		store.expiration[key] = expirationTime
+	// Set expiration if needed; a plain SET discards any previous TTL
+	if !deadline.IsZero() {
+		store.expiration[key] = deadline
+	} else if !keepTTL {
+		delete(store.expiration, key)
 	}
 
 	return "+OK\r\n" // Success
@@ -107,6 +144,7 @@ func (store *InMemoryStore) exists(key string) bool {
 
 // Get the value of key
 func (store *InMemoryStore) Get(key string) string {
+	store.expireIfNeeded(key)
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
 
@@ -116,27 +154,56 @@ func (store *InMemoryStore) Get(key string) string {
 	return "$-1\r\n\r\n" // Correct RESP format for non-existent key
 }
 
+// GetString returns the value of key and whether it exists
+func (store *InMemoryStore) GetString(key string) (string, bool) {
+	store.expireIfNeeded(key)
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	value, ok := store.data[key]
+	store.countLookup(ok)
+	return value, ok
+}
+
 // Del removes the specified keys
 func (store *InMemoryStore) Del(keys []string) int {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
+	now := time.Now()
 	count := 0
 	for _, key := range keys {
-		if _, exists := store.data[key]; exists {
-			delete(store.data, key)
+		if store.expireLocked(key, now) {
+			continue
+		}
+		if store.typeOf(key) != "none" {
+			store.removeKey(key)
 			count++
 		}
 	}
 	return count
 }
 
+// Flush deletes every key.
+func (store *InMemoryStore) Flush() {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.data = make(map[string]string)
+	store.sortedSet = make(map[string]map[string]float64)
+	store.expiration = make(map[string]time.Time)
+	if store.snapshots > 0 {
+		store.ownedZSets = make(map[string]bool)
+	}
+}
+
 func (store *InMemoryStore) Keys(pattern string) []string {
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
 
+	match := compilePattern(pattern)
+	now := time.Now()
 	var keys []string
 	for key := range store.data {
-		if matchPattern(key, pattern) {
+		if match(key) && !store.isExpired(key, now) {
 			keys = append(keys, key)
 		}
 	}
@@ -144,54 +211,70 @@ func (store *InMemoryStore) Keys(pattern string) []string {
 }
 
 func (store *InMemoryStore) Expire(key string, seconds int) int {
+	return store.ExpireAt(key, time.Now().Add(time.Duration(seconds)*time.Second))
+}
+
+// ExpireAt sets the time key expires at, and returns 1, or 0 if the key
+// doesn't exist.
+func (store *InMemoryStore) ExpireAt(key string, deadline time.Time) int {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	if _, exists := store.data[key]; exists {
-		expirationTime := time.Now().Add(time.Duration(seconds) * time.Second)
-		store.expiration[key] = expirationTime
+	if store.expireLocked(key, time.Now()) {
+		return 0
+	}
+	if store.typeOf(key) != "none" {
+		store.expiration[key] = deadline
 		return 1
 	}
 	return 0
 }
 
 func (store *InMemoryStore) TTL(key string) int {
+	store.expireIfNeeded(key)
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
 
+	if store.typeOf(key) == "none" {
+		return -2 // Key does not exist, or has expired
+	}
 	if expirationTime, exists := store.expiration[key]; exists {
-		if time.Now().After(expirationTime) {
-			return -2 // Key has expired
-		}
 		return int(time.Until(expirationTime).Seconds())
 	}
-	return -1 // Key does not exist or has no associated expiration
+	return -1 // Key has no associated expiration
 }
 
 // ZAdd adds all the specified members with the specified scores to the sorted set stored at key
 func (store *InMemoryStore) ZAdd(key string, score float64, member string) int {
+	if added, _ := store.ZAddChanged(key, score, member); added {
+		return 1
+	}
+	return 0
+}
+
+// ZAddChanged adds member as ZAdd does, and also reports whether the set
+// changed: whether the member is new or had another score.
+func (store *InMemoryStore) ZAddChanged(key string, score float64, member string) (added, changed bool) {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	if _, ok := store.sortedSet[key]; !ok {
-		store.sortedSet[key] = make(map[string]float64)
-	}
-
-	_, memberExists := store.sortedSet[key][member]
-	store.sortedSet[key][member] = score
+	store.expireLocked(key, time.Now())
 
-	if memberExists {
-		return 0
-	}
-	return 1
+	members := store.ownZSet(key)
+	old, memberExists := members[member]
+	members[member] = score
+	return !memberExists, !memberExists || old != score
 }
 
 // ZRange returns the specified range of elements in the sorted set stored at key
 func (store *InMemoryStore) ZRange(key string, start, stop int) []string {
+	store.expireIfNeeded(key)
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
 
-	if sortedSet, ok := store.sortedSet[key]; ok {
+	sortedSet, ok := store.sortedSet[key]
+	store.countLookup(ok)
+	if ok {
 		// Convert map to slice of key-value pairs and sort by score
 		members := make([]string, 0, len(sortedSet))
 		for member, score := range sortedSet {
@@ -103,3 +103,61 @@ func TestZAddAndZRange(t *testing.T) {
 		t.Errorf("ZRange(%q, 0, -1) returned %d members, want %d", key, len(members), 3)
 	}
 }
+
+func TestExpiredKeysAreDeleted(t *testing.T) {
+	store := NewInMemoryStore()
+	store.Set("lazy", "value", "PX10")
+	store.Set("active", "value", "PX10")
+	store.Set("kept", "value", "EX100")
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := store.GetString("lazy"); ok {
+		t.Error("GetString returned an expired key")
+	}
+	if got := store.Stats(); got.ExpiredKeys != 1 || got.KeyspaceMisses != 1 {
+		t.Errorf("Stats() = %+v after reading an expired key, want 1 expired key and 1 miss", got)
+	}
+	store.ActiveExpireCycle(time.Second)
+	if keys, expires, _ := store.KeyspaceInfo(); keys != 1 || expires != 1 {
+		t.Errorf("KeyspaceInfo() = %d keys, %d expires, want 1 and 1", keys, expires)
+	}
+	if got := store.Stats().ExpiredKeys; got != 2 {
+		t.Errorf("ExpiredKeys = %d after the active cycle, want 2", got)
+	}
+}
+
+func TestSnapshotIsPointInTime(t *testing.T) {
+	store := NewInMemoryStore()
+	store.Set("a", "1")
+	store.ZAdd("z", 1, "one")
+	store.Set("gone", "x", "PX10")
+	time.Sleep(20 * time.Millisecond)
+
+	snap := store.Snapshot()
+	store.Set("a", "2")
+	store.Set("b", "new")
+	store.ZAdd("z", 2, "two")
+	store.Del([]string{"z"})
+
+	got := make(map[string]Entry)
+	snap.Each(func(e Entry) error {
+		got[e.Key] = e
+		return nil
+	})
+	snap.Release()
+	if len(got) != 2 || got["a"].String != "1" || len(got["z"].ZSet) != 1 {
+		t.Errorf("snapshot holds %+v, want a=1 and z with one member", got)
+	}
+
+	// Once released, writes change sorted sets in place again
+	store.ZAdd("z", 1, "one")
+	if n := store.ZCard("z"); n != 1 {
+		t.Errorf("ZCard(z) = %d, want 1", n)
+	}
+	if !store.Put(Entry{Key: "z", ZSet: map[string]float64{"x": 1, "y": 2}}) || store.ZCard("z") != 2 {
+		t.Error("Put didn't replace z")
+	}
+	if store.Put(Entry{Key: "old", String: "v", ExpireAt: time.Now().Add(-time.Second)}) {
+		t.Error("Put kept a key whose TTL had run out")
+	}
+}
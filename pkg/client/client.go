@@ -0,0 +1,96 @@
+// File: pkg/client/client.go
+
+// Package client is a Go client for the Go-Redis server. A Client is safe for
+// concurrent use: every call borrows a connection from a pool for as long as
+// it needs it.
+//
+//	c := client.New(&client.Options{Addr: "localhost:6379"})
+//	defer c.Close()
+//	err := c.Set(ctx, "greeting", "hello", time.Minute)
+//	greeting, err := c.Get(ctx, "greeting")
+//
+// Besides single commands, a Client runs pipelines, MULTI/EXEC transactions
+// and pub/sub subscriptions.
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+)
+
+// Client is a pool of connections to one server.
+type Client struct {
+	opt  *Options
+	pool *pool
+}
+
+// New returns a client for the server described by opt. Connections are
+// opened lazily, on first use.
+func New(opt *Options) *Client {
+	if opt == nil {
+		opt = &Options{}
+	}
+	opt = opt.withDefaults()
+	return &Client{opt: opt, pool: newPool(opt)}
+}
+
+// Options returns the options the client runs with, defaults filled in.
+func (c *Client) Options() Options {
+	return *c.opt
+}
+
+// Close closes the client's connections. Calls made afterwards fail with ErrClosed.
+func (c *Client) Close() error {
+	return c.pool.close()
+}
+
+// Do runs a command given as its name and arguments and returns it with its reply.
+func (c *Client) Do(ctx context.Context, args ...string) *Cmd {
+	cmd := NewCmd(args...)
+	_ = c.Process(ctx, cmd)
+	return cmd
+}
+
+// Process runs cmd and returns its error.
+func (c *Client) Process(ctx context.Context, cmd *Cmd) error {
+	err := c.withRetries(ctx, func(cn *conn) error {
+		return cn.roundTrip(ctx, []*Cmd{cmd})
+	})
+	if err != nil {
+		cmd.err = err
+	}
+	return cmd.err
+}
+
+// withRetries runs fn on a pooled connection, retrying network errors up to
+// MaxRetries times on a fresh connection.
+func (c *Client) withRetries(ctx context.Context, fn func(cn *conn) error) error {
+	var err error
+	for attempt := 0; attempt <= c.opt.MaxRetries; attempt++ {
+		var cn *conn
+		cn, err = c.pool.get(ctx)
+		if err != nil {
+			return err
+		}
+		err = fn(cn)
+		c.pool.put(cn)
+		if err == nil || !retryable(ctx, err) {
+			return err
+		}
+	}
+	return err
+}
+
+// retryable reports whether err is a network failure worth another attempt.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return !netErr.Timeout()
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed)
+}
@@ -0,0 +1,248 @@
+package client
+
+import (
+	"basic-go-redis/internal/protocol"
+	"basic-go-redis/internal/server"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Helper function to start a Go-Redis server for testing
+func startTestServer(t *testing.T, port string) *Client {
+	t.Helper()
+	srv := server.NewServer(port)
+	go func() {
+		if err := srv.Start(); err != nil {
+			panic(fmt.Sprintf("Failed to start server: %v", err))
+		}
+	}()
+	time.Sleep(100 * time.Millisecond) // Give the server time to start
+
+	c := New(&Options{Addr: "localhost:" + port, PoolSize: 4})
+	t.Cleanup(func() {
+		c.Close()
+		srv.Close()
+	})
+	return c
+}
+
+// startFakeServer serves canned replies: reply is called with each request
+// and returns the raw RESP to send back.
+func startFakeServer(t *testing.T, reply func(args []string) string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := protocol.NewReader(conn)
+				for {
+					request, err := reader.ReadCommand()
+					if err != nil {
+						return
+					}
+					args := make([]string, len(request))
+					for i, arg := range request {
+						args[i] = string(arg)
+					}
+					if _, err := conn.Write([]byte(reply(args))); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestClientStringCommands(t *testing.T) {
+	c := startTestServer(t, "12400")
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping() error: %v", err)
+	}
+	if err := c.Set(ctx, "greeting", "hello world", time.Minute); err != nil {
+		t.Fatalf("Set() error: %v", err)
+	}
+	if got, err := c.Get(ctx, "greeting"); err != nil || got != "hello world" {
+		t.Errorf("Get() = %q, %v, want %q", got, err, "hello world")
+	}
+	if ttl, err := c.TTL(ctx, "greeting"); err != nil || ttl <= 0 || ttl > time.Minute {
+		t.Errorf("TTL() = %v, %v, want at most a minute", ttl, err)
+	}
+	if _, err := c.Get(ctx, "missing"); err != Nil {
+		t.Errorf("Get(missing) error = %v, want Nil", err)
+	}
+	if ok, err := c.SetNX(ctx, "greeting", "again", 0); err != nil || ok {
+		t.Errorf("SetNX() on existing key = %v, %v, want false", ok, err)
+	}
+	if n, err := c.Del(ctx, "greeting", "missing"); err != nil || n != 1 {
+		t.Errorf("Del() = %d, %v, want 1", n, err)
+	}
+
+	var serverErr Error
+	if err := c.Do(ctx, "GET").Err(); !errors.As(err, &serverErr) || !strings.HasPrefix(string(serverErr), "ERR wrong number") {
+		t.Errorf("GET without key error = %v, want an arity error", err)
+	}
+}
+
+func TestClientSortedSet(t *testing.T) {
+	c := startTestServer(t, "12401")
+	ctx := context.Background()
+
+	added, err := c.ZAdd(ctx, "scores", Z{Score: 2, Member: "b"}, Z{Score: 1.5, Member: "a"})
+	if err != nil || added != 2 {
+		t.Fatalf("ZAdd() = %d, %v, want 2", added, err)
+	}
+	members, err := c.ZRange(ctx, "scores", 0, -1)
+	if err != nil || strings.Join(members, ",") != "a,b" {
+		t.Errorf("ZRange() = %v, %v, want [a b]", members, err)
+	}
+}
+
+func TestClientPipeline(t *testing.T) {
+	c := startTestServer(t, "12402")
+	ctx := context.Background()
+
+	pipe := c.Pipeline()
+	for i := 0; i < 100; i++ {
+		pipe.Do("SET", fmt.Sprintf("key:%d", i), fmt.Sprint(i))
+	}
+	get := pipe.Do("GET", "key:42")
+	cmds, err := pipe.Exec(ctx)
+	if err != nil || len(cmds) != 101 {
+		t.Fatalf("Exec() = %d commands, %v, want 101", len(cmds), err)
+	}
+	if v, err := get.Text(); err != nil || v != "42" {
+		t.Errorf("pipelined GET = %q, %v, want %q", v, err, "42")
+	}
+	if pipe.Len() != 0 {
+		t.Errorf("Len() after Exec = %d, want 0", pipe.Len())
+	}
+}
+
+func TestClientPoolIsSharedSafely(t *testing.T) {
+	c := startTestServer(t, "12403")
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("worker:%d", i)
+			for j := 0; j < 20; j++ {
+				if err := c.Set(ctx, key, fmt.Sprint(j), 0); err != nil {
+					t.Errorf("Set() error: %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if idle := c.pool.idleCount(); idle == 0 || idle > c.opt.PoolSize {
+		t.Errorf("idle connections = %d, want between 1 and %d", idle, c.opt.PoolSize)
+	}
+}
+
+func TestClientContextCancellation(t *testing.T) {
+	// The server never answers, so only the context ends the calls
+	release := make(chan struct{})
+	addr := startFakeServer(t, func(args []string) string {
+		<-release
+		return protocol.OK
+	})
+	t.Cleanup(func() { close(release) })
+	c := New(&Options{Addr: addr})
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Ping(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Ping() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := c.Ping(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Ping() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestClientTransaction(t *testing.T) {
+	addr := startFakeServer(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "MULTI":
+			return protocol.OK
+		case "EXEC":
+			return protocol.Array(protocol.OK, protocol.Integer(1))
+		default:
+			return protocol.SimpleString("QUEUED")
+		}
+	})
+	c := New(&Options{Addr: addr})
+	defer c.Close()
+
+	tx := c.TxPipeline()
+	set := tx.Do("SET", "a", "1")
+	incr := tx.Do("INCR", "a")
+	if _, err := tx.Exec(context.Background()); err != nil {
+		t.Fatalf("Exec() error: %v", err)
+	}
+	if v, err := set.Text(); err != nil || v != "OK" {
+		t.Errorf("SET in transaction = %q, %v, want OK", v, err)
+	}
+	if n, err := incr.Int(); err != nil || n != 1 {
+		t.Errorf("INCR in transaction = %d, %v, want 1", n, err)
+	}
+}
+
+func TestClientPubSub(t *testing.T) {
+	addr := startFakeServer(t, func(args []string) string {
+		if strings.ToUpper(args[0]) != "SUBSCRIBE" {
+			return protocol.ErrorReply("ERR unexpected")
+		}
+		return protocol.Array(protocol.BulkString("subscribe"), protocol.BulkString(args[1]), protocol.Integer(1)) +
+			protocol.Array(protocol.BulkString("message"), protocol.BulkString(args[1]), protocol.BulkString("hello"))
+	})
+	c := New(&Options{Addr: addr})
+	defer c.Close()
+
+	ctx := context.Background()
+	ps, err := c.Subscribe(ctx, "news")
+	if err != nil {
+		t.Fatalf("Subscribe() error: %v", err)
+	}
+	defer ps.Close()
+
+	event, err := ps.Receive(ctx)
+	if sub, ok := event.(*Subscription); err != nil || !ok || sub.Kind != "subscribe" || sub.Channel != "news" || sub.Count != 1 {
+		t.Errorf("Receive() = %#v, %v, want a subscribe confirmation", event, err)
+	}
+
+	select {
+	case msg := <-ps.Channel():
+		if msg.Channel != "news" || msg.Payload != "hello" {
+			t.Errorf("message = %+v, want hello on news", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+	}
+}
@@ -0,0 +1,167 @@
+// File: pkg/client/cmd.go
+
+package client
+
+import (
+	"basic-go-redis/internal/protocol"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Nil is returned when the server answers with a null reply, e.g. GET of a missing key.
+var Nil = errors.New("redis: nil")
+
+// Error is an error reply sent by the server, such as "ERR syntax error".
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// Cmd is a command and, once it has been run, its reply.
+type Cmd struct {
+	args  []string
+	reply protocol.Value
+	err   error
+}
+
+// NewCmd returns a command ready to be run with Client.Process or queued in a Pipeline.
+func NewCmd(args ...string) *Cmd {
+	return &Cmd{args: args}
+}
+
+// Args returns the command and its arguments.
+func (c *Cmd) Args() []string {
+	return c.args
+}
+
+// Err returns the error of the command: a network error, an Error reply or Nil.
+func (c *Cmd) Err() error {
+	return c.err
+}
+
+// setReply records the reply, turning error and null replies into errors.
+func (c *Cmd) setReply(v protocol.Value) {
+	c.reply = v
+	switch {
+	case v.IsError():
+		c.err = Error(v.Str)
+	case v.Null:
+		c.err = Nil
+	default:
+		c.err = nil
+	}
+}
+
+// Val returns the reply as a Go value: string, int64, bool, []interface{} or
+// nil. Maps are returned as []interface{} holding keys and values in turn,
+// doubles and big numbers as strings, and nested error replies as Error values.
+func (c *Cmd) Val() interface{} {
+	if c.err != nil {
+		return nil
+	}
+	return toInterface(c.reply)
+}
+
+// Result returns Val and Err.
+func (c *Cmd) Result() (interface{}, error) {
+	return c.Val(), c.err
+}
+
+func toInterface(v protocol.Value) interface{} {
+	switch {
+	case v.Null:
+		return nil
+	case v.IsError():
+		return Error(v.Str)
+	case v.Kind == protocol.KindInteger:
+		return v.Int
+	case v.Kind == protocol.KindBoolean:
+		return v.Int != 0
+	case v.IsAggregate():
+		elems := make([]interface{}, len(v.Elems))
+		for i, elem := range v.Elems {
+			elems[i] = toInterface(elem)
+		}
+		return elems
+	default:
+		return v.Str
+	}
+}
+
+// Text returns a string or bulk string reply.
+func (c *Cmd) Text() (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	switch c.reply.Kind {
+	case protocol.KindSimpleString, protocol.KindBulkString, protocol.KindVerbatim, protocol.KindDouble, protocol.KindBigNumber:
+		return c.reply.Str, nil
+	case protocol.KindInteger:
+		return strconv.FormatInt(c.reply.Int, 10), nil
+	}
+	return "", c.unexpected()
+}
+
+// Int returns an integer reply, or a string reply holding an integer.
+func (c *Cmd) Int() (int64, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	switch c.reply.Kind {
+	case protocol.KindInteger, protocol.KindBoolean:
+		return c.reply.Int, nil
+	case protocol.KindSimpleString, protocol.KindBulkString:
+		return strconv.ParseInt(c.reply.Str, 10, 64)
+	}
+	return 0, c.unexpected()
+}
+
+// Float returns a reply holding a floating point number.
+func (c *Cmd) Float() (float64, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	switch c.reply.Kind {
+	case protocol.KindInteger:
+		return float64(c.reply.Int), nil
+	case protocol.KindSimpleString, protocol.KindBulkString, protocol.KindDouble:
+		return strconv.ParseFloat(c.reply.Str, 64)
+	}
+	return 0, c.unexpected()
+}
+
+// Bool returns an integer reply as a boolean, true meaning non-zero.
+func (c *Cmd) Bool() (bool, error) {
+	n, err := c.Int()
+	return n != 0, err
+}
+
+// Strings returns an array reply of strings. Null elements become empty strings.
+func (c *Cmd) Strings() ([]string, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if !c.reply.IsAggregate() {
+		return nil, c.unexpected()
+	}
+	items := make([]string, len(c.reply.Elems))
+	for i, elem := range c.reply.Elems {
+		if elem.Kind == protocol.KindInteger {
+			items[i] = strconv.FormatInt(elem.Int, 10)
+		} else {
+			items[i] = elem.Str
+		}
+	}
+	return items, nil
+}
+
+func (c *Cmd) unexpected() error {
+	return fmt.Errorf("redis: unexpected reply type %q to %s", byte(c.reply.Kind), c.name())
+}
+
+func (c *Cmd) name() string {
+	if len(c.args) == 0 {
+		return ""
+	}
+	return c.args[0]
+}
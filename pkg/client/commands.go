@@ -0,0 +1,127 @@
+// File: pkg/client/commands.go
+
+package client
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Z is a member of a sorted set with its score.
+type Z struct {
+	Score  float64
+	Member string
+}
+
+// formatFloat renders a score the way the server parses it back.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Ping checks that the server is reachable.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.Do(ctx, "PING").Err()
+}
+
+// Echo returns message as echoed by the server.
+func (c *Client) Echo(ctx context.Context, message string) (string, error) {
+	return c.Do(ctx, "ECHO", message).Text()
+}
+
+// Get returns the value of key, or Nil if the key doesn't exist.
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	return c.Do(ctx, "GET", key).Text()
+}
+
+// setArgs builds a SET request with an optional expiration and condition.
+func setArgs(key, value string, expiration time.Duration, condition string) []string {
+	args := []string{"SET", key, value}
+	if expiration > 0 {
+		if expiration%time.Second == 0 {
+			args = append(args, "EX", strconv.FormatInt(int64(expiration/time.Second), 10))
+		} else {
+			args = append(args, "PX", strconv.FormatInt(int64(expiration/time.Millisecond), 10))
+		}
+	}
+	if condition != "" {
+		args = append(args, condition)
+	}
+	return args
+}
+
+// Set sets key to value. A positive expiration makes the key expire after it.
+func (c *Client) Set(ctx context.Context, key, value string, expiration time.Duration) error {
+	return c.Do(ctx, setArgs(key, value, expiration, "")...).Err()
+}
+
+// SetNX sets key to value only if the key doesn't exist yet, and reports whether it did.
+func (c *Client) SetNX(ctx context.Context, key, value string, expiration time.Duration) (bool, error) {
+	return setIf(c.Do(ctx, setArgs(key, value, expiration, "NX")...))
+}
+
+// SetXX sets key to value only if the key already exists, and reports whether it did.
+func (c *Client) SetXX(ctx context.Context, key, value string, expiration time.Duration) (bool, error) {
+	return setIf(c.Do(ctx, setArgs(key, value, expiration, "XX")...))
+}
+
+func setIf(cmd *Cmd) (bool, error) {
+	switch err := cmd.Err(); err {
+	case nil:
+		return true, nil
+	case Nil:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// Del removes keys and returns how many of them existed.
+func (c *Client) Del(ctx context.Context, keys ...string) (int64, error) {
+	return c.Do(ctx, append([]string{"DEL"}, keys...)...).Int()
+}
+
+// Keys returns the keys matching a glob-style pattern.
+func (c *Client) Keys(ctx context.Context, pattern string) ([]string, error) {
+	return c.Do(ctx, "KEYS", pattern).Strings()
+}
+
+// Expire sets a timeout on key, rounded down to whole seconds, and reports
+// whether the key exists.
+func (c *Client) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	return c.Do(ctx, "EXPIRE", key, strconv.FormatInt(int64(expiration/time.Second), 10)).Bool()
+}
+
+// TTL returns the remaining time to live of key. Like the server, it returns
+// -1 for a key without a timeout and -2 for a missing key, as durations in
+// nanoseconds.
+func (c *Client) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := c.Do(ctx, "TTL", key).Int()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return time.Duration(ttl), nil
+	}
+	return time.Duration(ttl) * time.Second, nil
+}
+
+// ZAdd adds members to the sorted set at key and returns how many were new.
+func (c *Client) ZAdd(ctx context.Context, key string, members ...Z) (int64, error) {
+	args := make([]string, 0, 2+2*len(members))
+	args = append(args, "ZADD", key)
+	for _, z := range members {
+		args = append(args, formatFloat(z.Score), z.Member)
+	}
+	return c.Do(ctx, args...).Int()
+}
+
+// ZRange returns the members of the sorted set at key between two ranks, inclusive.
+func (c *Client) ZRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return c.Do(ctx, "ZRANGE", key, strconv.FormatInt(start, 10), strconv.FormatInt(stop, 10)).Strings()
+}
+
+// Publish posts message to channel and returns the number of subscribers that received it.
+func (c *Client) Publish(ctx context.Context, channel, message string) (int64, error) {
+	return c.Do(ctx, "PUBLISH", channel, message).Int()
+}
@@ -0,0 +1,174 @@
+// File: pkg/client/conn.go
+
+package client
+
+import (
+	"basic-go-redis/internal/protocol"
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// aLongTimeAgo is a deadline in the past, used to interrupt blocked I/O.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// conn is one connection to the server. It is not safe for concurrent use;
+// the pool hands it to one caller at a time.
+type conn struct {
+	netConn net.Conn
+	rd      *bufio.Reader
+	wr      *bufio.Writer
+	opt     *Options
+
+	usedAt atomic.Int64 // unix nanoseconds of the last successful I/O
+
+	// broken is set after an I/O or protocol error, when the connection may
+	// be half way through a reply and can't be reused.
+	broken atomic.Bool
+}
+
+// dial connects to the server and runs the AUTH and SELECT handshake.
+func dial(ctx context.Context, opt *Options) (*conn, error) {
+	dialer := &net.Dialer{Timeout: opt.DialTimeout, KeepAlive: 5 * time.Minute}
+	var netConn net.Conn
+	var err error
+	if opt.TLSConfig != nil {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: opt.TLSConfig}
+		netConn, err = tlsDialer.DialContext(ctx, "tcp", opt.Addr)
+	} else {
+		netConn, err = dialer.DialContext(ctx, "tcp", opt.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cn := &conn{
+		netConn: netConn,
+		rd:      bufio.NewReader(netConn),
+		wr:      bufio.NewWriter(netConn),
+		opt:     opt,
+	}
+	cn.usedAt.Store(time.Now().UnixNano())
+
+	var handshake []*Cmd
+	if opt.Password != "" {
+		handshake = append(handshake, NewCmd("AUTH", opt.Password))
+	}
+	if opt.DB != 0 {
+		handshake = append(handshake, NewCmd("SELECT", strconv.Itoa(opt.DB)))
+	}
+	if len(handshake) > 0 {
+		if err := cn.roundTrip(ctx, handshake); err != nil {
+			cn.Close()
+			return nil, err
+		}
+		for _, cmd := range handshake {
+			if cmd.Err() != nil {
+				cn.Close()
+				return nil, cmd.Err()
+			}
+		}
+	}
+	return cn, nil
+}
+
+// Close closes the network connection.
+func (cn *conn) Close() error {
+	return cn.netConn.Close()
+}
+
+// roundTrip sends cmds in one write and reads one reply for each of them.
+// It returns an error only when the connection itself failed; error replies
+// are recorded in the commands.
+func (cn *conn) roundTrip(ctx context.Context, cmds []*Cmd) error {
+	if err := cn.writeCmds(ctx, cmds...); err != nil {
+		return err
+	}
+	for _, cmd := range cmds {
+		v, err := cn.readReply(ctx, cn.opt.ReadTimeout)
+		if err != nil {
+			return err
+		}
+		cmd.setReply(v)
+	}
+	return nil
+}
+
+// writeCmds serializes cmds into the write buffer and flushes it.
+func (cn *conn) writeCmds(ctx context.Context, cmds ...*Cmd) error {
+	return cn.withDeadline(ctx, cn.opt.WriteTimeout, cn.netConn.SetWriteDeadline, func() error {
+		for _, cmd := range cmds {
+			if len(cmd.args) == 0 {
+				continue
+			}
+			if _, err := cn.wr.WriteString(protocol.Serialize(cmd.args[0], cmd.args[1:])); err != nil {
+				return err
+			}
+		}
+		return cn.wr.Flush()
+	})
+}
+
+// readReply reads one reply, waiting at most timeout (zero meaning no limit)
+// or until ctx is done.
+func (cn *conn) readReply(ctx context.Context, timeout time.Duration) (protocol.Value, error) {
+	var v protocol.Value
+	err := cn.withDeadline(ctx, timeout, cn.netConn.SetReadDeadline, func() error {
+		var err error
+		v, err = protocol.ReadValue(cn.rd)
+		return err
+	})
+	return v, err
+}
+
+// withDeadline runs an I/O operation under the earlier of the timeout and
+// the context's deadline. Cancelling ctx interrupts the operation. Any error
+// marks the connection as broken.
+func (cn *conn) withDeadline(ctx context.Context, timeout time.Duration, setDeadline func(time.Time) error, op func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	ctxDeadline := false
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline, ctxDeadline = d, true
+	}
+	if err := setDeadline(deadline); err != nil {
+		cn.broken.Store(true)
+		return err
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		setDeadline(aLongTimeAgo)
+	})
+	err := op()
+	if !stop() {
+		// The context was cancelled while the operation ran, and the
+		// connection's deadline now lies in the past.
+		cn.broken.Store(true)
+		return ctx.Err()
+	}
+	if err != nil {
+		cn.broken.Store(true)
+		// The socket's deadline can pass a moment before the context's
+		// timer fires: a timeout at the context's deadline is its error.
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if ctxDeadline && errors.Is(err, os.ErrDeadlineExceeded) {
+			return context.DeadlineExceeded
+		}
+		return err
+	}
+	cn.usedAt.Store(time.Now().UnixNano())
+	return nil
+}
@@ -0,0 +1,77 @@
+// File: pkg/client/options.go
+
+package client
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+// Options configures a Client. The zero value of every field selects a default.
+type Options struct {
+	// Addr is the server address as host:port. Defaults to localhost:6379.
+	Addr string
+	// Password, if set, is sent with AUTH on every new connection.
+	Password string
+	// DB, if not zero, is selected on every new connection.
+	DB int
+
+	// DialTimeout bounds establishing a connection. Defaults to 5 seconds.
+	DialTimeout time.Duration
+	// ReadTimeout bounds waiting for a reply. Defaults to 3 seconds; -1 disables it.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds sending a command. Defaults to ReadTimeout; -1 disables it.
+	WriteTimeout time.Duration
+
+	// PoolSize is the maximum number of connections. Defaults to 10.
+	PoolSize int
+	// PoolTimeout bounds waiting for a free connection when all of them are
+	// busy. Defaults to ReadTimeout plus one second.
+	PoolTimeout time.Duration
+	// IdleTimeout closes connections left unused for this long. Defaults to
+	// 5 minutes; -1 keeps idle connections forever.
+	IdleTimeout time.Duration
+
+	// MaxRetries is how many times a command is retried after a network
+	// error. Retried commands may run twice on the server. Defaults to 0.
+	MaxRetries int
+
+	// TLSConfig, if set, makes connections use TLS.
+	TLSConfig *tls.Config
+}
+
+// withDefaults returns a copy of opt with every unset field given its default.
+func (opt *Options) withDefaults() *Options {
+	o := *opt
+	if o.Addr == "" {
+		o.Addr = "localhost:6379"
+	}
+	if o.DialTimeout == 0 {
+		o.DialTimeout = 5 * time.Second
+	}
+	switch o.ReadTimeout {
+	case -1:
+		o.ReadTimeout = 0
+	case 0:
+		o.ReadTimeout = 3 * time.Second
+	}
+	switch o.WriteTimeout {
+	case -1:
+		o.WriteTimeout = 0
+	case 0:
+		o.WriteTimeout = o.ReadTimeout
+	}
+	if o.PoolSize <= 0 {
+		o.PoolSize = 10
+	}
+	if o.PoolTimeout == 0 {
+		o.PoolTimeout = o.ReadTimeout + time.Second
+	}
+	switch o.IdleTimeout {
+	case -1:
+		o.IdleTimeout = 0
+	case 0:
+		o.IdleTimeout = 5 * time.Minute
+	}
+	return &o
+}
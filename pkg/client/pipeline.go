@@ -0,0 +1,145 @@
+// File: pkg/client/pipeline.go
+
+package client
+
+import (
+	"basic-go-redis/internal/protocol"
+	"context"
+	"errors"
+)
+
+// ErrTxAborted is returned by a transaction the server discarded, for
+// example because a watched key changed or a command failed to queue.
+var ErrTxAborted = errors.New("redis: transaction aborted")
+
+// Pipeline queues commands and sends them to the server in one batch,
+// reading all the replies afterwards. A transactional pipeline wraps the
+// batch in MULTI and EXEC so that the server runs it atomically.
+// A Pipeline is not safe for concurrent use.
+type Pipeline struct {
+	c    *Client
+	tx   bool
+	cmds []*Cmd
+}
+
+// Pipeline returns an empty pipeline.
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{c: c}
+}
+
+// TxPipeline returns an empty pipeline that runs as a MULTI/EXEC transaction.
+func (c *Client) TxPipeline() *Pipeline {
+	return &Pipeline{c: c, tx: true}
+}
+
+// Do queues a command. Its reply is available once Exec returns.
+func (p *Pipeline) Do(args ...string) *Cmd {
+	cmd := NewCmd(args...)
+	p.cmds = append(p.cmds, cmd)
+	return cmd
+}
+
+// Len returns the number of queued commands.
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// Discard drops the queued commands.
+func (p *Pipeline) Discard() {
+	p.cmds = nil
+}
+
+// Exec sends the queued commands and reads their replies. It returns the
+// commands, emptying the pipeline, and the first error among them.
+func (p *Pipeline) Exec(ctx context.Context) ([]*Cmd, error) {
+	cmds := p.cmds
+	p.cmds = nil
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+
+	err := p.c.withRetries(ctx, func(cn *conn) error {
+		if p.tx {
+			return execTx(ctx, cn, cmds)
+		}
+		return cn.roundTrip(ctx, cmds)
+	})
+	if err != nil {
+		for _, cmd := range cmds {
+			if cmd.err == nil {
+				cmd.err = err
+			}
+		}
+		return cmds, err
+	}
+	for _, cmd := range cmds {
+		if cmd.err != nil && cmd.err != Nil {
+			return cmds, cmd.err
+		}
+	}
+	return cmds, nil
+}
+
+// execTx runs cmds between MULTI and EXEC. The server answers every queued
+// command with +QUEUED and delivers the real replies as EXEC's array.
+func execTx(ctx context.Context, cn *conn, cmds []*Cmd) error {
+	multi, exec := NewCmd("MULTI"), NewCmd("EXEC")
+	batch := make([]*Cmd, 0, len(cmds)+2)
+	batch = append(batch, multi)
+	batch = append(batch, cmds...)
+	batch = append(batch, exec)
+	if err := cn.writeCmds(ctx, batch...); err != nil {
+		return err
+	}
+
+	// Replies to MULTI and to the queued commands
+	queueErrs := make([]error, len(cmds))
+	for i := -1; i < len(cmds); i++ {
+		v, err := cn.readReply(ctx, cn.opt.ReadTimeout)
+		if err != nil {
+			return err
+		}
+		switch {
+		case i == -1 && v.IsError():
+			multi.setReply(v)
+		case i >= 0 && v.IsError():
+			queueErrs[i] = Error(v.Str)
+		}
+	}
+
+	v, err := cn.readReply(ctx, cn.opt.ReadTimeout)
+	if err != nil {
+		return err
+	}
+	if multi.err != nil {
+		setAll(cmds, multi.err)
+		return nil
+	}
+	switch {
+	case v.IsError():
+		// EXECABORT: report why each failed command was rejected
+		for i, cmd := range cmds {
+			if queueErrs[i] != nil {
+				cmd.err = queueErrs[i]
+			} else {
+				cmd.err = Error(v.Str)
+			}
+		}
+	case v.Null:
+		setAll(cmds, ErrTxAborted)
+	case v.Kind == protocol.KindArray && len(v.Elems) == len(cmds):
+		for i, cmd := range cmds {
+			cmd.setReply(v.Elems[i])
+		}
+	default:
+		cn.broken.Store(true)
+		setAll(cmds, errors.New("redis: unexpected reply to EXEC"))
+	}
+	return nil
+}
+
+func setAll(cmds []*Cmd, err error) {
+	for _, cmd := range cmds {
+		cmd.err = err
+	}
+}
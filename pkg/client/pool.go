@@ -0,0 +1,138 @@
+// File: pkg/client/pool.go
+
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrClosed is returned when using a Client or PubSub after Close.
+	ErrClosed = errors.New("redis: client is closed")
+	// ErrPoolTimeout is returned when no connection became free within PoolTimeout.
+	ErrPoolTimeout = errors.New("redis: connection pool timeout")
+)
+
+// pool keeps up to PoolSize connections and lends them out one caller at a time.
+type pool struct {
+	opt *Options
+
+	// slots holds one token per connection that may be lent out, bounding
+	// the number of connections in use or being dialed.
+	slots chan struct{}
+
+	mu     sync.Mutex
+	idle   []*conn // most recently used last
+	closed bool
+}
+
+func newPool(opt *Options) *pool {
+	return &pool{
+		opt:   opt,
+		slots: make(chan struct{}, opt.PoolSize),
+	}
+}
+
+// get returns an idle connection or dials a new one once a slot is free.
+func (p *pool) get(ctx context.Context) (*conn, error) {
+	if err := p.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			p.release()
+			return nil, ErrClosed
+		}
+		n := len(p.idle)
+		if n == 0 {
+			p.mu.Unlock()
+			break
+		}
+		cn := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+
+		if p.stale(cn) {
+			cn.Close()
+			continue
+		}
+		return cn, nil
+	}
+
+	cn, err := dial(ctx, p.opt)
+	if err != nil {
+		p.release()
+		return nil, err
+	}
+	return cn, nil
+}
+
+// put returns a connection to the pool, closing it if it can't be reused.
+func (p *pool) put(cn *conn) {
+	p.mu.Lock()
+	if cn.broken.Load() || p.closed || cn.rd.Buffered() > 0 {
+		p.mu.Unlock()
+		cn.Close()
+	} else {
+		p.idle = append(p.idle, cn)
+		p.mu.Unlock()
+	}
+	p.release()
+}
+
+// acquire waits for a free slot, for at most PoolTimeout.
+func (p *pool) acquire(ctx context.Context) error {
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(p.opt.PoolTimeout)
+	defer timer.Stop()
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return ErrPoolTimeout
+	}
+}
+
+func (p *pool) release() {
+	<-p.slots
+}
+
+// stale reports whether an idle connection has outlived IdleTimeout.
+func (p *pool) stale(cn *conn) bool {
+	return p.opt.IdleTimeout > 0 && time.Since(time.Unix(0, cn.usedAt.Load())) > p.opt.IdleTimeout
+}
+
+// idleCount returns the number of idle connections.
+func (p *pool) idleCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle)
+}
+
+// close closes the idle connections; connections in use are closed when returned.
+func (p *pool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClosed
+	}
+	p.closed = true
+	for _, cn := range p.idle {
+		cn.Close()
+	}
+	p.idle = nil
+	return nil
+}
@@ -0,0 +1,307 @@
+// File: pkg/client/pubsub.go
+
+package client
+
+import (
+	"basic-go-redis/internal/protocol"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a message published to a channel the PubSub listens to.
+// Pattern is set when the message matched a pattern subscription.
+type Message struct {
+	Channel string
+	Pattern string
+	Payload string
+}
+
+// Subscription confirms a change to the subscriptions: Kind is one of
+// subscribe, unsubscribe, psubscribe or punsubscribe, and Count is the
+// number of subscriptions the connection holds afterwards.
+type Subscription struct {
+	Kind    string
+	Channel string
+	Count   int
+}
+
+// Pong is the reply to a PING sent while subscribed.
+type Pong struct {
+	Payload string
+}
+
+// PubSub listens for messages on a dedicated connection, outside the pool.
+// Subscribing and receiving may happen from different goroutines, but only
+// one goroutine should receive at a time.
+type PubSub struct {
+	c *Client
+
+	mu       sync.Mutex // guards cn, the subscription sets and closed
+	cn       *conn
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	closed   bool
+
+	chOnce sync.Once
+	ch     chan *Message
+	done   chan struct{}
+}
+
+// Subscribe returns a PubSub subscribed to channels.
+func (c *Client) Subscribe(ctx context.Context, channels ...string) (*PubSub, error) {
+	ps := c.newPubSub()
+	if len(channels) > 0 {
+		if err := ps.Subscribe(ctx, channels...); err != nil {
+			ps.Close()
+			return nil, err
+		}
+	}
+	return ps, nil
+}
+
+// PSubscribe returns a PubSub subscribed to glob-style channel patterns.
+func (c *Client) PSubscribe(ctx context.Context, patterns ...string) (*PubSub, error) {
+	ps := c.newPubSub()
+	if len(patterns) > 0 {
+		if err := ps.PSubscribe(ctx, patterns...); err != nil {
+			ps.Close()
+			return nil, err
+		}
+	}
+	return ps, nil
+}
+
+func (c *Client) newPubSub() *PubSub {
+	return &PubSub{
+		c:        c,
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Subscribe adds channels to the subscription. Confirmations arrive through Receive.
+func (ps *PubSub) Subscribe(ctx context.Context, channels ...string) error {
+	return ps.send(ctx, "SUBSCRIBE", channels, ps.channels, true)
+}
+
+// Unsubscribe removes channels, or every channel if none are given.
+func (ps *PubSub) Unsubscribe(ctx context.Context, channels ...string) error {
+	return ps.send(ctx, "UNSUBSCRIBE", channels, ps.channels, false)
+}
+
+// PSubscribe adds patterns to the subscription.
+func (ps *PubSub) PSubscribe(ctx context.Context, patterns ...string) error {
+	return ps.send(ctx, "PSUBSCRIBE", patterns, ps.patterns, true)
+}
+
+// PUnsubscribe removes patterns, or every pattern if none are given.
+func (ps *PubSub) PUnsubscribe(ctx context.Context, patterns ...string) error {
+	return ps.send(ctx, "PUNSUBSCRIBE", patterns, ps.patterns, false)
+}
+
+// Ping asks the server for a Pong, which arrives through Receive.
+func (ps *PubSub) Ping(ctx context.Context) error {
+	return ps.send(ctx, "PING", nil, nil, false)
+}
+
+// send writes a subscription command and records the change in set, so it
+// can be replayed after a reconnect.
+func (ps *PubSub) send(ctx context.Context, name string, names []string, set map[string]struct{}, add bool) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.closed {
+		return ErrClosed
+	}
+	if set != nil {
+		if add {
+			for _, n := range names {
+				set[n] = struct{}{}
+			}
+		} else if len(names) == 0 {
+			clear(set)
+		} else {
+			for _, n := range names {
+				delete(set, n)
+			}
+		}
+	}
+	cn, err := ps.connLocked(ctx)
+	if err != nil {
+		return err
+	}
+	if err := cn.writeCmds(ctx, NewCmd(append([]string{name}, names...)...)); err != nil {
+		ps.dropConnLocked()
+		return err
+	}
+	return nil
+}
+
+// connLocked returns the connection, dialing and resubscribing if needed.
+func (ps *PubSub) connLocked(ctx context.Context) (*conn, error) {
+	if ps.cn != nil {
+		return ps.cn, nil
+	}
+	cn, err := dial(ctx, ps.c.opt)
+	if err != nil {
+		return nil, err
+	}
+	var resubscribe []*Cmd
+	if len(ps.channels) > 0 {
+		resubscribe = append(resubscribe, NewCmd(append([]string{"SUBSCRIBE"}, keys(ps.channels)...)...))
+	}
+	if len(ps.patterns) > 0 {
+		resubscribe = append(resubscribe, NewCmd(append([]string{"PSUBSCRIBE"}, keys(ps.patterns)...)...))
+	}
+	if len(resubscribe) > 0 {
+		if err := cn.writeCmds(ctx, resubscribe...); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	ps.cn = cn
+	return cn, nil
+}
+
+func (ps *PubSub) dropConnLocked() {
+	if ps.cn != nil {
+		ps.cn.Close()
+		ps.cn = nil
+	}
+}
+
+func keys(set map[string]struct{}) []string {
+	names := make([]string, 0, len(set))
+	for n := range set {
+		names = append(names, n)
+	}
+	return names
+}
+
+// Receive waits for the next event: a *Subscription, *Message or *Pong.
+// It waits until ctx is done; the client's read timeout doesn't apply.
+func (ps *PubSub) Receive(ctx context.Context) (interface{}, error) {
+	ps.mu.Lock()
+	if ps.closed {
+		ps.mu.Unlock()
+		return nil, ErrClosed
+	}
+	cn, err := ps.connLocked(ctx)
+	ps.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := cn.readReply(ctx, 0)
+	if err != nil {
+		ps.mu.Lock()
+		if ps.cn == cn {
+			ps.dropConnLocked()
+		}
+		closed := ps.closed
+		ps.mu.Unlock()
+		if closed {
+			return nil, ErrClosed
+		}
+		return nil, err
+	}
+	return parseEvent(v)
+}
+
+// parseEvent turns a push reply into a Subscription, Message or Pong.
+func parseEvent(v protocol.Value) (interface{}, error) {
+	if v.IsError() {
+		return nil, Error(v.Str)
+	}
+	if v.Kind == protocol.KindSimpleString && v.Str == "PONG" {
+		return &Pong{}, nil
+	}
+	if v.Kind != protocol.KindArray || len(v.Elems) < 2 {
+		return nil, fmt.Errorf("redis: unexpected pub/sub reply %q", byte(v.Kind))
+	}
+	kind := strings.ToLower(v.Elems[0].Str)
+	switch {
+	case kind == "message" && len(v.Elems) == 3:
+		return &Message{Channel: v.Elems[1].Str, Payload: v.Elems[2].Str}, nil
+	case kind == "pmessage" && len(v.Elems) == 4:
+		return &Message{Pattern: v.Elems[1].Str, Channel: v.Elems[2].Str, Payload: v.Elems[3].Str}, nil
+	case kind == "pong":
+		return &Pong{Payload: v.Elems[1].Str}, nil
+	case len(v.Elems) == 3 && v.Elems[2].Kind == protocol.KindInteger:
+		return &Subscription{Kind: kind, Channel: v.Elems[1].Str, Count: int(v.Elems[2].Int)}, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected pub/sub message %q", kind)
+}
+
+// ReceiveMessage waits for the next message, skipping other events.
+func (ps *PubSub) ReceiveMessage(ctx context.Context) (*Message, error) {
+	for {
+		event, err := ps.Receive(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if msg, ok := event.(*Message); ok {
+			return msg, nil
+		}
+	}
+}
+
+// Channel returns a channel delivering messages until the PubSub is closed.
+// Network errors are handled by reconnecting and resubscribing.
+func (ps *PubSub) Channel() <-chan *Message {
+	ps.chOnce.Do(func() {
+		ps.ch = make(chan *Message, 100)
+		go ps.deliver()
+	})
+	return ps.ch
+}
+
+func (ps *PubSub) deliver() {
+	defer close(ps.ch)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-ps.done
+		cancel()
+	}()
+
+	backoff := 100 * time.Millisecond
+	for {
+		msg, err := ps.ReceiveMessage(ctx)
+		if err != nil {
+			if err == ErrClosed || ctx.Err() != nil {
+				return
+			}
+			select {
+			case <-time.After(backoff):
+			case <-ps.done:
+				return
+			}
+			if backoff < 5*time.Second {
+				backoff *= 2
+			}
+			continue
+		}
+		backoff = 100 * time.Millisecond
+		select {
+		case ps.ch <- msg:
+		case <-ps.done:
+			return
+		}
+	}
+}
+
+// Close unsubscribes by closing the connection.
+func (ps *PubSub) Close() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.closed {
+		return ErrClosed
+	}
+	ps.closed = true
+	close(ps.done)
+	ps.dropConnLocked()
+	return nil
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadAndRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	original := `{
+    "server_host": "localhost",
+    "server_port": 7000,
+    "log_level": "info"
+}
+`
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := r.Get("port"); got != "7000" {
+		t.Errorf("port = %q, want 7000", got)
+	}
+	if got := r.Get("loglevel"); got != "notice" {
+		t.Errorf("loglevel = %q, want info read as notice", got)
+	}
+
+	if err := r.SetRuntime("maxmemory", "1mb", "loglevel", "warning"); err != nil {
+		t.Fatalf("SetRuntime: %v", err)
+	}
+	if err := r.Rewrite(); err != nil {
+		t.Fatalf("Rewrite: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	want := `{
+    "server_host": "localhost",
+    "server_port": "7000",
+    "log_level": "warning",
+    "max_memory": "1048576"
+}
+`
+	if string(data) != want {
+		t.Errorf("rewritten file:\n%s\nwant:\n%s", data, want)
+	}
+
+	// The rewritten file loads back to the same values
+	again, err := Load(path)
+	if err != nil || again.Int("maxmemory") != 1<<20 || again.Get("loglevel") != "warning" {
+		t.Errorf("reloading: maxmemory %d, loglevel %q, %v", again.Int("maxmemory"), again.Get("loglevel"), err)
+	}
+
+	if err := New().Rewrite(); !errors.Is(err, ErrNoFile) {
+		t.Errorf("Rewrite without a file = %v, want ErrNoFile", err)
+	}
+	if _, err := Load(writeFile(t, `{"max_clients": 0}`)); err == nil || !strings.Contains(err.Error(), "between 1 and") {
+		t.Errorf("Load with maxclients 0 = %v, want a range error", err)
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSetRuntime(t *testing.T) {
+	r := New()
+	var applied []string
+	r.OnChange("timeout", func(value string) error {
+		applied = append(applied, value)
+		return nil
+	})
+	r.OnChange("maxclients", func(value string) error {
+		if value == "13" {
+			return errors.New("unlucky")
+		}
+		return nil
+	})
+
+	tests := []struct {
+		pairs []string
+		err   error
+		msg   string
+	}{
+		{[]string{"nosuch", "1"}, ErrUnknown, ""},
+		{[]string{"port", "7000"}, ErrImmutable, ""},
+		{[]string{"timeout", "1", "TIMEOUT", "2"}, nil, "duplicate parameter"},
+		{[]string{"timeout", "x"}, nil, "couldn't be parsed into an integer"},
+		{[]string{"maxmemory-policy", "allkeys-lru"}, nil, "must be one of the following: noeviction, allkeys-random"},
+		{[]string{"maxmemory", "10xb"}, nil, "must be a memory value"},
+		{[]string{"maxmemory", "9999999999gb"}, nil, "must be a memory value"},
+		{[]string{"timeout", "5", "maxclients", "13"}, nil, "unlucky"},
+	}
+	for _, tt := range tests {
+		err := r.SetRuntime(tt.pairs...)
+		if err == nil || (tt.err != nil && !errors.Is(err, tt.err)) || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("SetRuntime(%q) = %v, want %v %q", tt.pairs, err, tt.err, tt.msg)
+		}
+	}
+	// The failed set put timeout back
+	if got := r.Get("timeout"); got != "0" || !reflect.DeepEqual(applied, []string{"5", "0"}) {
+		t.Errorf("timeout = %q, applied %q, want it set back to 0", got, applied)
+	}
+
+	if err := r.SetRuntime("MaxMemory", "2GB", "maxmemory-policy", "VOLATILE-TTL"); err != nil {
+		t.Fatalf("SetRuntime: %v", err)
+	}
+	if r.Int("maxmemory") != 2<<30 || r.Get("maxmemory-policy") != "volatile-ttl" {
+		t.Errorf("maxmemory %d, policy %q", r.Int("maxmemory"), r.Get("maxmemory-policy"))
+	}
+	if got := r.Match("maxmemory*"); !reflect.DeepEqual(got, []string{"maxmemory", "maxmemory-policy", "maxmemory-samples"}) {
+		t.Errorf("Match(maxmemory*) = %q", got)
+	}
+}
@@ -0,0 +1,187 @@
+// File: pkg/config/params.go
+
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// kind is how a parameter's value is checked and normalized.
+type kind int
+
+const (
+	kindString kind = iota
+	kindInt         // An integer between Min and Max
+	kindBool        // yes or no
+	kindMemory      // A byte count with an optional unit such as 100mb
+	kindEnum        // One of Values
+	kindSave        // Save rules, as ParseSaveRules reads them
+)
+
+// Param describes a configuration parameter.
+type Param struct {
+	Name      string // Redis's name, used by CONFIG GET and CONFIG SET
+	Key       string // Key in the JSON config file
+	Default   string
+	Immutable bool // Only set at startup, not by CONFIG SET
+
+	kind     kind
+	min, max int64             // Bounds of an int or memory parameter
+	values   []string          // Values of an enum parameter
+	aliases  map[string]string // Other spellings accepted for values
+}
+
+// params are the parameters the server knows, in the order CONFIG
+// REWRITE adds them to the file.
+var params = []*Param{
+	{Name: "port", Key: "server_port", Default: "6379", Immutable: true, kind: kindInt, min: 0, max: 65535},
+	{Name: "loglevel", Key: "log_level", Default: "notice", kind: kindEnum,
+		values: []string{"debug", "verbose", "notice", "warning", "nothing"}, aliases: map[string]string{"info": "notice"}},
+	{Name: "logfile", Key: "log_file", Default: "", Immutable: true},
+	{Name: "log-format", Key: "log_format", Default: "text", Immutable: true, kind: kindEnum, values: []string{"text", "json"}},
+	{Name: "log-max-size", Key: "log_max_size", Default: "0", Immutable: true, kind: kindMemory, min: 0, max: 1 << 62},
+	{Name: "log-max-backups", Key: "log_max_backups", Default: "5", Immutable: true, kind: kindInt, min: 0, max: 1000},
+	{Name: "syslog-enabled", Key: "syslog_enabled", Default: "no", Immutable: true, kind: kindBool},
+	{Name: "syslog-ident", Key: "syslog_ident", Default: "redis", Immutable: true},
+	{Name: "syslog-facility", Key: "syslog_facility", Default: "local0", Immutable: true, kind: kindEnum,
+		values: []string{"user", "local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7"}},
+	{Name: "maxclients", Key: "max_clients", Default: "10000", kind: kindInt, min: 1, max: 1 << 31},
+	{Name: "timeout", Key: "timeout", Default: "0", kind: kindInt, min: 0, max: 1 << 31},
+	{Name: "maxmemory", Key: "max_memory", Default: "0", kind: kindMemory, min: 0, max: 1 << 62},
+	{Name: "maxmemory-policy", Key: "max_memory_policy", Default: "noeviction", kind: kindEnum,
+		values: []string{"noeviction", "allkeys-random", "volatile-random", "volatile-ttl"}},
+	{Name: "maxmemory-samples", Key: "max_memory_samples", Default: "5", kind: kindInt, min: 1, max: 64},
+	{Name: "dir", Key: "dir", Default: "."},
+	{Name: "dbfilename", Key: "db_filename", Default: "dump.rdb"},
+	{Name: "save", Key: "save", Default: "3600 1 300 100 60 10000", kind: kindSave},
+	{Name: "appendonly", Key: "append_only", Default: "no", Immutable: true, kind: kindBool},
+	{Name: "appendfilename", Key: "append_filename", Default: "appendonly.aof", Immutable: true},
+	{Name: "appendfsync", Key: "append_fsync", Default: "everysec", kind: kindEnum, values: []string{"always", "everysec", "no"}},
+	{Name: "aof-load-truncated", Key: "aof_load_truncated", Default: "yes", kind: kindBool},
+	{Name: "auto-aof-rewrite-percentage", Key: "auto_aof_rewrite_percentage", Default: "100", kind: kindInt, min: 0, max: 1 << 31},
+	{Name: "auto-aof-rewrite-min-size", Key: "auto_aof_rewrite_min_size", Default: "67108864", kind: kindMemory, min: 0, max: 1 << 62},
+	{Name: "replicaof", Key: "replica_of", Default: "", Immutable: true},
+	{Name: "replica-read-only", Key: "replica_read_only", Default: "yes", kind: kindBool},
+	{Name: "replica-serve-stale-data", Key: "replica_serve_stale_data", Default: "yes", kind: kindBool},
+	{Name: "replica-priority", Key: "replica_priority", Default: "100", kind: kindInt, min: 0, max: 1 << 31},
+	{Name: "repl-backlog-size", Key: "repl_backlog_size", Default: "1048576", kind: kindMemory, min: 1, max: 1 << 62},
+	{Name: "repl-timeout", Key: "repl_timeout", Default: "60", kind: kindInt, min: 1, max: 1 << 31},
+	{Name: "repl-ping-replica-period", Key: "repl_ping_replica_period", Default: "10", kind: kindInt, min: 1, max: 1 << 31},
+	{Name: "min-replicas-to-write", Key: "min_replicas_to_write", Default: "0", kind: kindInt, min: 0, max: 1 << 31},
+	{Name: "min-replicas-max-lag", Key: "min_replicas_max_lag", Default: "10", kind: kindInt, min: 0, max: 1 << 31},
+	{Name: "cluster-enabled", Key: "cluster_enabled", Default: "no", Immutable: true, kind: kindBool},
+	{Name: "cluster-config-file", Key: "cluster_config_file", Default: "nodes.conf", Immutable: true},
+	{Name: "cluster-node-timeout", Key: "cluster_node_timeout", Default: "15000", kind: kindInt, min: 100, max: 1 << 31},
+	{Name: "cluster-announce-ip", Key: "cluster_announce_ip", Default: ""},
+	{Name: "cluster-require-full-coverage", Key: "cluster_require_full_coverage", Default: "yes", kind: kindBool},
+}
+
+// normalize checks value and returns it in the form CONFIG GET reports.
+func (p *Param) normalize(value string) (string, error) {
+	switch p.kind {
+	case kindInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("argument couldn't be parsed into an integer")
+		}
+		if n < p.min || n > p.max {
+			return "", fmt.Errorf("argument must be between %d and %d inclusive", p.min, p.max)
+		}
+		return strconv.FormatInt(n, 10), nil
+	case kindMemory:
+		n, err := ParseMemory(value)
+		if err != nil {
+			return "", err
+		}
+		if n < p.min || n > p.max {
+			return "", fmt.Errorf("argument must be between %d and %d inclusive", p.min, p.max)
+		}
+		return strconv.FormatInt(n, 10), nil
+	case kindBool:
+		switch strings.ToLower(value) {
+		case "yes":
+			return "yes", nil
+		case "no":
+			return "no", nil
+		}
+		return "", fmt.Errorf("argument must be 'yes' or 'no'")
+	case kindEnum:
+		value = strings.ToLower(value)
+		if alias, ok := p.aliases[value]; ok {
+			value = alias
+		}
+		for _, v := range p.values {
+			if v == value {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("argument(s) must be one of the following: %s", strings.Join(p.values, ", "))
+	case kindSave:
+		rules, err := ParseSaveRules(value)
+		if err != nil {
+			return "", err
+		}
+		parts := make([]string, 0, 2*len(rules))
+		for _, rule := range rules {
+			parts = append(parts, strconv.FormatInt(rule.Seconds, 10), strconv.FormatInt(rule.Changes, 10))
+		}
+		return strings.Join(parts, " "), nil
+	}
+	return value, nil
+}
+
+// memoryUnits are the suffixes ParseMemory accepts, as Redis does: k, m
+// and g are powers of 1000, kb, mb and gb powers of 1024.
+var memoryUnits = []struct {
+	suffix string
+	scale  int64
+}{
+	{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+	{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	{"b", 1},
+}
+
+// ParseMemory parses a byte count such as 1024, 100mb or 2g.
+func ParseMemory(value string) (int64, error) {
+	lower := strings.ToLower(value)
+	scale := int64(1)
+	for _, unit := range memoryUnits {
+		if number, ok := strings.CutSuffix(lower, unit.suffix); ok {
+			lower, scale = number, unit.scale
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/scale {
+		return 0, fmt.Errorf("argument must be a memory value")
+	}
+	return n * scale, nil
+}
+
+// SaveRule asks for a snapshot once Changes writes have been made and
+// Seconds have passed since the last one.
+type SaveRule struct {
+	Seconds, Changes int64
+}
+
+// ParseSaveRules parses the save parameter: pairs of seconds and changes
+// such as "3600 1 300 100", or "" for no automatic snapshots.
+func ParseSaveRules(value string) ([]SaveRule, error) {
+	fields := strings.Fields(value)
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("Invalid save parameters")
+	}
+	rules := make([]SaveRule, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err1 := strconv.ParseInt(fields[i], 10, 64)
+		changes, err2 := strconv.ParseInt(fields[i+1], 10, 64)
+		if err1 != nil || err2 != nil || seconds < 1 || changes < 0 {
+			return nil, fmt.Errorf("Invalid save parameters")
+		}
+		rules = append(rules, SaveRule{seconds, changes})
+	}
+	return rules, nil
+}
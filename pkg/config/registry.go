@@ -0,0 +1,303 @@
+// File: pkg/config/registry.go
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrUnknown is returned for a parameter the server doesn't have.
+	ErrUnknown = errors.New("unknown option")
+	// ErrImmutable is returned by SetRuntime for a parameter only set at startup.
+	ErrImmutable = errors.New("can't set immutable config")
+	// ErrNoFile is returned by Rewrite when no config file was loaded.
+	ErrNoFile = errors.New("the server is running without a config file")
+)
+
+// ParamError is a failure to set a parameter.
+type ParamError struct {
+	Name string
+	Err  error
+}
+
+func (e *ParamError) Error() string { return e.Name + ": " + e.Err.Error() }
+
+func (e *ParamError) Unwrap() error { return e.Err }
+
+// Registry holds the server's configuration: the value of every parameter,
+// checked against its type, and the file it was loaded from.
+type Registry struct {
+	mu       sync.RWMutex
+	byName   map[string]*Param
+	values   map[string]string
+	onChange map[string]func(value string) error
+
+	path     string
+	fileKeys []string                   // Keys of the file, in its order
+	unknown  map[string]json.RawMessage // Keys of the file that aren't parameters
+}
+
+// New returns a registry holding the default of every parameter.
+func New() *Registry {
+	r := &Registry{
+		byName:   make(map[string]*Param, len(params)),
+		values:   make(map[string]string, len(params)),
+		onChange: make(map[string]func(string) error),
+		unknown:  make(map[string]json.RawMessage),
+	}
+	for _, p := range params {
+		r.byName[p.Name] = p
+		r.values[p.Name] = p.Default
+	}
+	return r
+}
+
+// Load reads a JSON config file into a new registry. Keys that aren't
+// parameters, such as those meant for the client, are kept for Rewrite.
+func Load(configPath string) (*Registry, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	r := New()
+	r.path = configPath
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("%s: expected a JSON object", configPath)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", configPath, err)
+		}
+		key := tok.(string)
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", configPath, err)
+		}
+		r.fileKeys = append(r.fileKeys, key)
+
+		p := paramByKey(key)
+		if p == nil {
+			r.unknown[key] = raw
+			continue
+		}
+		value, err := jsonValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", configPath, key, err)
+		}
+		if err := r.Set(p.Name, value); err != nil {
+			return nil, fmt.Errorf("%s: %w", configPath, err)
+		}
+	}
+	return r, nil
+}
+
+func paramByKey(key string) *Param {
+	for _, p := range params {
+		if p.Key == key {
+			return p
+		}
+	}
+	return nil
+}
+
+// jsonValue turns a JSON string, number or boolean into a parameter value.
+func jsonValue(raw json.RawMessage) (string, error) {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return "yes", nil
+		}
+		return "no", nil
+	}
+	return "", errors.New("expected a string, number or boolean")
+}
+
+// Path returns the file the registry was loaded from, or "".
+func (r *Registry) Path() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.path
+}
+
+// Get returns the value of a parameter, "" if there's no such parameter.
+func (r *Registry) Get(name string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.values[name]
+}
+
+// Int returns the value of an int or memory parameter.
+func (r *Registry) Int(name string) int64 {
+	n, _ := strconv.ParseInt(r.Get(name), 10, 64)
+	return n
+}
+
+// Bool returns the value of a yes/no parameter.
+func (r *Registry) Bool(name string) bool {
+	return r.Get(name) == "yes"
+}
+
+// Match returns the names of the parameters matching a glob pattern,
+// regardless of case, in the order they were registered.
+func (r *Registry) Match(pattern string) []string {
+	pattern = strings.ToLower(pattern)
+	var names []string
+	for _, p := range params {
+		if ok, _ := path.Match(pattern, p.Name); ok {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+// OnChange makes fn apply every new value of a parameter. An error from fn
+// refuses the value. fn is called with the registry locked, so it must not
+// use the registry.
+func (r *Registry) OnChange(name string, fn func(value string) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onChange[name] = fn
+}
+
+// Set checks and sets a parameter, whether or not it is immutable.
+func (r *Registry) Set(name, value string) error {
+	return r.set([]string{name, value}, false)
+}
+
+// SetRuntime sets parameters from name, value pairs, as CONFIG SET does:
+// every pair is checked first, immutable parameters are refused, and if
+// applying one fails the others are set back.
+func (r *Registry) SetRuntime(pairs ...string) error {
+	return r.set(pairs, true)
+}
+
+func (r *Registry) set(pairs []string, runtime bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(pairs)/2)
+	values := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		name := strings.ToLower(pairs[i])
+		p, ok := r.byName[name]
+		if !ok {
+			return &ParamError{pairs[i], ErrUnknown}
+		}
+		if runtime && p.Immutable {
+			return &ParamError{name, ErrImmutable}
+		}
+		for _, seen := range names {
+			if seen == name {
+				return &ParamError{name, errors.New("duplicate parameter")}
+			}
+		}
+		value, err := p.normalize(pairs[i+1])
+		if err != nil {
+			return &ParamError{name, err}
+		}
+		names = append(names, name)
+		values = append(values, value)
+	}
+
+	old := make([]string, len(names))
+	for i, name := range names {
+		old[i] = r.values[name]
+		r.values[name] = values[i]
+		fn := r.onChange[name]
+		if fn == nil {
+			continue
+		}
+		if err := fn(values[i]); err != nil {
+			// Set back what was applied so far, this one included
+			for j := i; j >= 0; j-- {
+				r.values[names[j]] = old[j]
+				if fn := r.onChange[names[j]]; fn != nil && j < i {
+					fn(old[j])
+				}
+			}
+			return &ParamError{name, err}
+		}
+	}
+	return nil
+}
+
+// Rewrite saves the configuration to the file it was loaded from. The keys
+// already in the file keep their order, with their current values, and
+// the parameters that differ from their defaults are added after them.
+func (r *Registry) Rewrite() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.path == "" {
+		return ErrNoFile
+	}
+
+	keys := append([]string(nil), r.fileKeys...)
+	inFile := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		inFile[key] = true
+	}
+	for _, p := range params {
+		if !inFile[p.Key] && r.values[p.Name] != p.Default {
+			keys = append(keys, p.Key)
+		}
+	}
+
+	entries := make([]string, 0, len(keys))
+	for _, key := range keys {
+		raw := r.unknown[key]
+		if p := paramByKey(key); p != nil {
+			raw, _ = json.Marshal(r.values[p.Name])
+		}
+		name, _ := json.Marshal(key)
+		entries = append(entries, fmt.Sprintf("    %s: %s", name, raw))
+	}
+	data := "{\n" + strings.Join(entries, ",\n") + "\n}\n"
+
+	// Write a temporary file and move it over, so a crash leaves the old
+	// file or the new one
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), ".config-rewrite-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if info, err := os.Stat(r.path); err == nil {
+		os.Chmod(tmp.Name(), info.Mode())
+	}
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return err
+	}
+	r.fileKeys = keys
+	return nil
+}
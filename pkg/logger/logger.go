@@ -1,26 +1,194 @@
 // File: pkg/logger/logger.go
 
+// Package logger is the server's structured, levelled logging, built on
+// log/slog. Until Setup is called, messages of level notice and above go to
+// stderr as text.
 package logger
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
+// Levels, using Redis's names. Verbose sits between slog's debug and info
+// levels, and errors are logged above warnings.
+const (
+	LevelDebug   = slog.LevelDebug
+	LevelVerbose = slog.Level(-2)
+	LevelNotice  = slog.LevelInfo
+	LevelWarning = slog.LevelWarn
+	LevelError   = slog.LevelError
+	levelNothing = slog.Level(1 << 10)
+)
+
+// ParseLevel turns a level name into a level. info is taken for notice,
+// and nothing turns logging off.
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "verbose":
+		return LevelVerbose, nil
+	case "notice", "info":
+		return LevelNotice, nil
+	case "warning":
+		return LevelWarning, nil
+	case "nothing":
+		return levelNothing, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+func levelName(level slog.Level) string {
+	switch {
+	case level < LevelVerbose:
+		return "DEBUG"
+	case level < LevelNotice:
+		return "VERBOSE"
+	case level < LevelWarning:
+		return "NOTICE"
+	case level < LevelError:
+		return "WARNING"
+	}
+	return "ERROR"
+}
+
+// Logger logs messages with attributes, such as those of a connection.
+type Logger struct {
+	l *slog.Logger
+}
+
+func (l *Logger) log(level slog.Level, msg string, args ...any) {
+	l.l.Log(context.Background(), level, msg, args...)
+}
+
+func (l *Logger) Debug(msg string, args ...any)   { l.log(LevelDebug, msg, args...) }
+func (l *Logger) Verbose(msg string, args ...any) { l.log(LevelVerbose, msg, args...) }
+func (l *Logger) Notice(msg string, args ...any)  { l.log(LevelNotice, msg, args...) }
+func (l *Logger) Warning(msg string, args ...any) { l.log(LevelWarning, msg, args...) }
+func (l *Logger) Error(msg string, args ...any)   { l.log(LevelError, msg, args...) }
+
+// With returns a logger adding the attributes, as key and value pairs, to
+// every message.
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{l.l.With(args...)}
+}
+
+// Options configure the logger.
+type Options struct {
+	Level  string // debug, verbose, notice, warning or nothing
+	Format string // text, the default, or json
+	File   string // Path of the log file, "" for stdout
+
+	// Once the file reaches MaxSize bytes it is renamed File.1, the
+	// previous File.1 becoming File.2 and so on, keeping MaxBackups of
+	// them. A MaxSize of 0 never rotates.
+	MaxSize    int64
+	MaxBackups int
+
+	// Syslog sends messages to the system logger instead of File.
+	Syslog         bool
+	SyslogIdent    string
+	SyslogFacility string // user or local0 to local7
+}
+
 var (
-	// InfoLogger for logging informational messages
-	InfoLogger *log.Logger
-	// ErrorLogger for logging error messages
-	ErrorLogger *log.Logger
+	level   slog.LevelVar // Shared by every handler, so SetLevel applies at once
+	current atomic.Pointer[Logger]
+
+	closerMu sync.Mutex
+	closer   io.Closer // The destination Setup opened
 )
 
 func init() {
-	// Open a file for logging
-	logFile, err := os.OpenFile("app.log", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	level.Set(LevelNotice)
+	current.Store(&Logger{slog.New(slog.NewTextHandler(os.Stderr, handlerOptions()))})
+}
+
+func handlerOptions() *slog.HandlerOptions {
+	return &slog.HandlerOptions{
+		Level: &level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && len(groups) == 0 {
+				a.Value = slog.StringValue(levelName(a.Value.Any().(slog.Level)))
+			}
+			return a
+		},
+	}
+}
+
+// Setup sends messages where opts says, replacing the destination of an
+// earlier Setup.
+func Setup(opts Options) error {
+	lvl, err := ParseLevel(opts.Level)
 	if err != nil {
-		log.Fatalf("error opening log file: %v", err)
+		return err
+	}
+
+	var handler slog.Handler
+	var dest io.Closer
+	if opts.Syslog {
+		handler, dest, err = newSyslogHandler(opts.SyslogIdent, opts.SyslogFacility, handlerOptions())
+		if err != nil {
+			return err
+		}
+	} else {
+		var w io.Writer = os.Stdout
+		if opts.File != "" {
+			file, err := openRotatingFile(opts.File, opts.MaxSize, opts.MaxBackups)
+			if err != nil {
+				return err
+			}
+			w, dest = file, file
+		}
+		switch opts.Format {
+		case "", "text":
+			handler = slog.NewTextHandler(w, handlerOptions())
+		case "json":
+			handler = slog.NewJSONHandler(w, handlerOptions())
+		default:
+			if dest != nil {
+				dest.Close()
+			}
+			return fmt.Errorf("unknown log format %q", opts.Format)
+		}
 	}
 
-	InfoLogger = log.New(logFile, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-	ErrorLogger = log.New(logFile, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+	level.Set(lvl)
+	current.Store(&Logger{slog.New(handler)})
+	closerMu.Lock()
+	if closer != nil {
+		closer.Close()
+	}
+	closer = dest
+	closerMu.Unlock()
+	return nil
+}
+
+// SetLevel changes which messages are logged, for every logger at once.
+func SetLevel(name string) error {
+	lvl, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.Set(lvl)
+	return nil
 }
+
+// Default returns the logger Setup configured.
+func Default() *Logger { return current.Load() }
+
+// With returns the default logger adding the attributes to every message.
+func With(args ...any) *Logger { return Default().With(args...) }
+
+func Debug(msg string, args ...any)   { Default().Debug(msg, args...) }
+func Verbose(msg string, args ...any) { Default().Verbose(msg, args...) }
+func Notice(msg string, args ...any)  { Default().Notice(msg, args...) }
+func Warning(msg string, args ...any) { Default().Warning(msg, args...) }
+func Error(msg string, args ...any)   { Default().Error(msg, args...) }
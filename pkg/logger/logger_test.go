@@ -0,0 +1,77 @@
+package logger
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLevelsAndFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	if err := Setup(Options{Level: "verbose", Format: "json", File: path}); err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	defer Setup(Options{Level: "notice"})
+
+	Debug("hidden")
+	With("client_id", 7, "addr", "127.0.0.1:5000").Verbose("Accepted connection")
+	SetLevel("warning")
+	Notice("hidden")
+	Warning("shown", "err", "boom")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), data)
+	}
+	var first, second map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal([]byte(lines[1]), &second)
+	if first["level"] != "VERBOSE" || first["msg"] != "Accepted connection" || first["client_id"] != 7.0 || first["addr"] != "127.0.0.1:5000" {
+		t.Errorf("first line = %v", first)
+	}
+	if second["level"] != "WARNING" || second["err"] != "boom" {
+		t.Errorf("second line = %v", second)
+	}
+
+	if err := SetLevel("loud"); err == nil {
+		t.Error("SetLevel accepted an unknown level")
+	}
+	if err := Setup(Options{Level: "notice", Format: "xml"}); err == nil {
+		t.Error("Setup accepted an unknown format")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	f, err := openRotatingFile(path, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	line := strings.Repeat("x", 59) + "\n"
+	for i := 0; i < 5; i++ {
+		f.Write([]byte(line))
+	}
+	// Each file holds one line, and only two old files are kept
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != line {
+			t.Errorf("%s holds %q", name, data)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Errorf("%s.3 was kept", path)
+	}
+}
@@ -0,0 +1,15 @@
+// File: pkg/logger/syslog_other.go
+
+//go:build windows || plan9
+
+package logger
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+)
+
+func newSyslogHandler(ident, facility string, opts *slog.HandlerOptions) (slog.Handler, io.Closer, error) {
+	return nil, nil, errors.New("syslog is not supported on this platform")
+}
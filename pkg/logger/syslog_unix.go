@@ -0,0 +1,100 @@
+// File: pkg/logger/syslog_unix.go
+
+//go:build !windows && !plan9
+
+package logger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"log/syslog"
+	"strings"
+	"sync"
+)
+
+var facilities = map[string]syslog.Priority{
+	"user":   syslog.LOG_USER,
+	"local0": syslog.LOG_LOCAL0,
+	"local1": syslog.LOG_LOCAL1,
+	"local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3,
+	"local4": syslog.LOG_LOCAL4,
+	"local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6,
+	"local7": syslog.LOG_LOCAL7,
+}
+
+// syslogHandler formats messages as text, leaving the time and level to
+// syslog, and sends them with the syslog priority of their level.
+type syslogHandler struct {
+	w    *syslog.Writer
+	text slog.Handler
+
+	mu  *sync.Mutex // Guards buf, shared with the handlers derived by With
+	buf *bytes.Buffer
+}
+
+func newSyslogHandler(ident, facility string, opts *slog.HandlerOptions) (slog.Handler, io.Closer, error) {
+	if facility == "" {
+		facility = "local0"
+	}
+	priority, ok := facilities[strings.ToLower(facility)]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown syslog facility %q", facility)
+	}
+	w, err := syslog.New(priority|syslog.LOG_NOTICE, ident)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	replace := opts.ReplaceAttr
+	opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+			return slog.Attr{}
+		}
+		return replace(groups, a)
+	}
+	buf := new(bytes.Buffer)
+	h := &syslogHandler{w: w, text: slog.NewTextHandler(buf, opts), mu: new(sync.Mutex), buf: buf}
+	return h, w, nil
+}
+
+func (h *syslogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.text.Enabled(ctx, level)
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buf.Reset()
+	if err := h.text.Handle(ctx, r); err != nil {
+		return err
+	}
+	line := strings.TrimSuffix(h.buf.String(), "\n")
+	switch {
+	case r.Level < LevelVerbose:
+		return h.w.Debug(line)
+	case r.Level < LevelNotice:
+		return h.w.Info(line)
+	case r.Level < LevelWarning:
+		return h.w.Notice(line)
+	case r.Level < LevelError:
+		return h.w.Warning(line)
+	}
+	return h.w.Err(line)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.text = h.text.WithAttrs(attrs)
+	return &c
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.text = h.text.WithGroup(name)
+	return &c
+}